@@ -0,0 +1,589 @@
+// cmd/cli/main.go
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"agricultural-iot-rag/internal/config"
+	"agricultural-iot-rag/internal/ingest"
+	"agricultural-iot-rag/internal/services"
+	"agricultural-iot-rag/internal/storage"
+	"agricultural-iot-rag/pkg/rag"
+)
+
+// Exit codes are part of the CLI contract so scripts can branch on them.
+const (
+	exitOK        = 0
+	exitFailure   = 1 // a backing service (Qdrant, Ollama, database) failed
+	exitUsage     = 2 // bad command line
+	exitNoResults = 3 // search succeeded but matched nothing
+)
+
+// errUsage marks errors caused by the command line rather than a service.
+var errUsage = errors.New("usage error")
+
+// errNoResults is returned by search when the knowledge base has no match.
+var errNoResults = errors.New("no results")
+
+// defaultKnowledge seeds an empty knowledge base when add-knowledge is run
+// without arguments.
+var defaultKnowledge = []struct {
+	Category string
+	Crop     string
+	Text     string
+}{
+	{"irrigation", "potato", "Potatoes require soil moisture between 60-80% for optimal growth and tuber development"},
+	{"temperature", "potato", "Optimal temperature for potato growth is 15-20°C during day and 10-15°C at night"},
+	{"irrigation", "potato", "Irrigate potatoes when soil moisture drops below 50% to prevent crop stress"},
+	{"irrigation", "potato", "Potatoes need 500-700mm of water throughout the growing season"},
+	{"temperature", "potato", "High temperatures above 30°C can damage potato tubers and reduce yield quality"},
+	{"irrigation", "tomato", "Tomatoes need consistent watering to prevent blossom end rot and fruit cracking"},
+	{"irrigation", "tomato", "Optimal soil moisture for tomatoes is 65-85% during fruit development"},
+	{"temperature", "tomato", "Temperature range of 21-27°C is ideal for tomato fruit set and development"},
+	{"nutrition", "tomato", "Calcium deficiency causes blossom end rot in tomatoes - maintain soil pH 6.0-6.8"},
+	{"nutrition", "corn", "High nitrogen fertilizer is recommended for corn during vegetative growth stage"},
+	{"irrigation", "corn", "Corn requires heaviest irrigation during silking and tasseling stages"},
+	{"irrigation", "corn", "Corn water stress during flowering can reduce yields by 20-50%"},
+	{"irrigation", "", "Drip irrigation is 90% efficient compared to 65% for sprinkler systems"},
+	{"irrigation", "", "Early morning irrigation (4-10 AM) minimizes water loss from evaporation"},
+	{"disease", "", "Avoid evening watering as it promotes fungal diseases on crops"},
+	{"soil", "", "Low soil moisture below 40% leads to crop stress and reduced photosynthesis"},
+	{"soil", "", "Waterlogged soil (>95% moisture) causes root oxygen deprivation and disease"},
+	{"soil", "", "Organic matter improves soil water retention capacity"},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, `Usage: cli [--json] <command> [flags] [args]
+
+Commands:
+  add-knowledge [text...]   Add documents to the knowledge base (built-in set if no text)
+  ingest <dir|archive>      Sync .md, .txt, .csv and .pdf files from a directory,
+                            a .zip/.tar/.tar.gz archive or a single file
+                            (--dry-run prints the planned changes)
+  search <query>            Search the knowledge base (--filter "crop = potato AND season = spring")
+  test-embedding [text]     Generate an embedding to verify the embedding service
+  migrate up                Apply pending database migrations
+  migrate down [--steps N]  Revert the last N migrations (default 1)
+  migrate status            List migrations and whether they are applied
+
+Flags:
+  --json                    Print machine-readable JSON on stdout
+
+Exit codes:
+  0  success
+  1  a backing service failed
+  2  invalid usage
+  3  search returned no results
+
+Configuration is read from the same environment variables as the server
+(QDRANT_URL, QDRANT_COLLECTION, EMBEDDING_API_URL, EMBEDDING_MODEL,
+STORAGE_DRIVER, POSTGRES_DSN, SQLITE_PATH, ...).`)
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	global := flag.NewFlagSet("cli", flag.ContinueOnError)
+	global.SetOutput(io.Discard)
+	jsonOut := global.Bool("json", false, "print JSON output")
+	if err := global.Parse(args); err != nil || global.NArg() == 0 {
+		usage(os.Stderr)
+		return exitUsage
+	}
+
+	cmd, cmdArgs := global.Arg(0), global.Args()[1:]
+	if cmd == "help" || cmd == "-h" || cmd == "--help" {
+		usage(os.Stdout)
+		return exitOK
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cfg := config.Load()
+	out := &output{json: jsonOut}
+
+	var err error
+	switch cmd {
+	case "add-knowledge":
+		err = addKnowledge(ctx, cfg, out, cmdArgs)
+	case "ingest":
+		err = ingestFiles(ctx, cfg, out, cmdArgs)
+	case "search":
+		err = search(ctx, cfg, out, cmdArgs)
+	case "test-embedding":
+		err = testEmbedding(ctx, cfg, out, cmdArgs)
+	case "migrate":
+		err = migrate(ctx, cfg, out, cmdArgs)
+	default:
+		err = fmt.Errorf("%w: unknown command %q", errUsage, cmd)
+	}
+
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errNoResults):
+		out.fail(err)
+		return exitNoResults
+	case errors.Is(err, errUsage):
+		out.fail(err)
+		if !*out.json {
+			usage(os.Stderr)
+		}
+		return exitUsage
+	default:
+		out.fail(err)
+		return exitFailure
+	}
+}
+
+// output prints either human-readable text or a single JSON document.
+type output struct {
+	json *bool
+	// written is set once a result has been printed.
+	written bool
+}
+
+func (o *output) result(v interface{}, text func()) {
+	o.written = true
+	if *o.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+		return
+	}
+	text()
+}
+
+// fail reports err. In JSON mode it is skipped after a result, which then
+// describes the failure and leaves the exit code to tell it apart.
+func (o *output) fail(err error) {
+	if *o.json {
+		if o.written {
+			return
+		}
+		json.NewEncoder(os.Stdout).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+}
+
+// parseFlags parses fs from args while allowing flags to follow positional
+// arguments, e.g. `cli search "query" --json`.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, fmt.Errorf("%w: %v", errUsage, err)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func newKnowledgeService(cfg *config.Config) (*services.KnowledgeService, func(), error) {
+	chunking := rag.ChunkOptions{Strategy: cfg.ChunkStrategy, Size: cfg.ChunkSize, Overlap: cfg.ChunkOverlap}
+	if err := chunking.Validate(); err != nil {
+		return nil, nil, err
+	}
+	rerankURL, rerankModel, err := cfg.RerankEndpoint()
+	if err != nil {
+		return nil, nil, err
+	}
+	reranker, err := services.NewReranker(cfg.Reranker, rerankURL, rerankModel)
+	if err != nil {
+		return nil, nil, err
+	}
+	vectorStore, err := rag.NewVectorStore(cfg.QdrantURL, cfg.QdrantCollection)
+	if err != nil {
+		return nil, nil, err
+	}
+	embeddingService := rag.NewEmbeddingService(cfg.EmbeddingAPIURL, cfg.EmbeddingModel)
+	closeFn := func() { vectorStore.Close() }
+	return services.NewKnowledgeService(vectorStore, embeddingService, services.KnowledgeOptions{
+		Chunking: chunking,
+		Hybrid: services.HybridOptions{
+			LexicalWeight:  cfg.HybridLexicalWeight,
+			SemanticWeight: cfg.HybridSemanticWeight,
+			RRFK:           cfg.HybridRRFK,
+			Refresh:        cfg.KeywordIndexRefresh,
+		},
+		Rerank: services.RerankOptions{
+			Reranker:   reranker,
+			Candidates: cfg.RerankCandidates,
+		},
+		Diversity: services.DiversityOptions{
+			Lambda:     cfg.MMRLambda,
+			Candidates: cfg.MMRCandidates,
+		},
+		MinScore: float32(cfg.KnowledgeMinScore),
+	}), closeFn, nil
+}
+
+// documentID derives a stable ID from the text so re-adding the same
+// document overwrites it instead of creating a duplicate.
+func documentID(text string) string {
+	sum := sha1.Sum([]byte(text))
+	return "kb_" + hex.EncodeToString(sum[:6])
+}
+
+type addResult struct {
+	ID       string `json:"id"`
+	Category string `json:"category,omitempty"`
+	Crop     string `json:"crop,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func addKnowledge(ctx context.Context, cfg *config.Config, out *output, args []string) error {
+	fs := flag.NewFlagSet("add-knowledge", flag.ContinueOnError)
+	fs.BoolVar(out.json, "json", *out.json, "print JSON output")
+	id := fs.String("id", "", "document ID (only valid with a single text)")
+	category := fs.String("category", "", "category metadata")
+	crop := fs.String("crop", "", "crop metadata")
+	region := fs.String("region", "", "region metadata")
+	season := fs.String("season", "", "season metadata")
+	texts, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if *id != "" && len(texts) != 1 {
+		return fmt.Errorf("%w: --id requires exactly one text argument", errUsage)
+	}
+
+	type doc struct{ id, category, crop, region, season, text string }
+	var docs []doc
+	if len(texts) == 0 {
+		for _, k := range defaultKnowledge {
+			docs = append(docs, doc{id: documentID(k.Text), category: k.Category, crop: k.Crop, text: k.Text})
+		}
+	} else {
+		for _, text := range texts {
+			docID := *id
+			if docID == "" {
+				docID = documentID(text)
+			}
+			docs = append(docs, doc{docID, *category, *crop, *region, *season, text})
+		}
+	}
+
+	ks, closeFn, err := newKnowledgeService(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	var results []addResult
+	failed := 0
+	for _, d := range docs {
+		metadata := map[string]interface{}{"source": "cli"}
+		if d.category != "" {
+			metadata["category"] = d.category
+		}
+		if d.crop != "" {
+			metadata["crop"] = d.crop
+		}
+		if d.region != "" {
+			metadata["region"] = d.region
+		}
+		if d.season != "" {
+			metadata["season"] = d.season
+		}
+
+		res := addResult{ID: d.id, Category: d.category, Crop: d.crop}
+		if err := ks.AddKnowledge(ctx, d.id, d.text, metadata); err != nil {
+			res.Error = err.Error()
+			failed++
+		}
+		results = append(results, res)
+	}
+
+	out.result(map[string]interface{}{"added": len(results) - failed, "failed": failed, "documents": results}, func() {
+		for _, r := range results {
+			if r.Error != "" {
+				fmt.Printf("✗ %s: %s\n", r.ID, r.Error)
+			} else {
+				fmt.Printf("✓ %s\n", r.ID)
+			}
+		}
+		fmt.Printf("Added %d of %d documents\n", len(results)-failed, len(results))
+	})
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d documents failed", failed, len(results))
+	}
+	return nil
+}
+
+func ingestFiles(ctx context.Context, cfg *config.Config, out *output, args []string) error {
+	fs := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	fs.BoolVar(out.json, "json", *out.json, "print JSON output")
+	dryRun := fs.Bool("dry-run", false, "print the planned changes without applying them")
+	paths, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) != 1 {
+		return fmt.Errorf("%w: ingest requires one directory, archive or file", errUsage)
+	}
+
+	info, err := os.Stat(paths[0])
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	opts := ingest.Options{DryRun: *dryRun}
+	var files iofs.FS
+	if info.IsDir() {
+		abs, err := filepath.Abs(paths[0])
+		if err != nil {
+			return err
+		}
+		files, opts.Root = os.DirFS(paths[0]), "dir:"+filepath.ToSlash(abs)
+	} else {
+		f, err := os.Open(paths[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if files, err = ingest.OpenUpload(filepath.Base(paths[0]), f, info.Size()); err != nil {
+			return fmt.Errorf("%w: %v", errUsage, err)
+		}
+		opts.Root = "upload:" + filepath.Base(paths[0])
+	}
+
+	ks, closeFn, err := newKnowledgeService(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	report, err := ingest.NewIngester(ks).Ingest(ctx, files, opts)
+	if err != nil {
+		return err
+	}
+
+	out.result(report, func() {
+		added, updated := 0, 0
+		for _, f := range report.Files {
+			for _, id := range f.Added {
+				fmt.Printf("+ %s (%s)\n", id, f.Path)
+			}
+			for _, id := range f.Updated {
+				fmt.Printf("~ %s (%s)\n", id, f.Path)
+			}
+			added, updated = added+len(f.Added), updated+len(f.Updated)
+			switch f.Status {
+			case ingest.StatusSkipped:
+				fmt.Printf("  skipped %s: %s\n", f.Path, f.Reason)
+			case ingest.StatusFailed:
+				fmt.Printf("✗ %s: %s\n", f.Path, f.Error)
+			}
+		}
+		for _, id := range report.Deleted {
+			fmt.Printf("- %s\n", id)
+		}
+		summary := "Added %d, updated %d and deleted %d documents"
+		if report.DryRun {
+			summary = "Would add %d, update %d and delete %d documents"
+		}
+		fmt.Printf(summary+"; %d files unchanged, %d skipped, %d failed\n",
+			added, updated, len(report.Deleted), report.Unchanged, report.Skipped, report.Failed)
+	})
+
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d files failed", report.Failed, len(report.Files))
+	}
+	return nil
+}
+
+func search(ctx context.Context, cfg *config.Config, out *output, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	fs.BoolVar(out.json, "json", *out.json, "print JSON output")
+	filterExpr := fs.String("filter", "", "metadata filter expression")
+	limit := fs.Int("limit", 0, "number of results (default 5)")
+	merge := fs.Bool("merge", false, "merge adjacent chunks of a document into one result")
+	words, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	query := strings.TrimSpace(strings.Join(words, " "))
+	if query == "" {
+		return fmt.Errorf("%w: search requires a query", errUsage)
+	}
+	filter, err := rag.ParseFilter(*filterExpr)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	ks, closeFn, err := newKnowledgeService(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	hits, err := ks.SearchKnowledge(ctx, services.KnowledgeQuery{Query: query, Filter: filter, Limit: *limit, MergeChunks: *merge})
+	if err != nil {
+		return err
+	}
+
+	out.result(map[string]interface{}{"query": query, "filter": filter.String(), "results": hits}, func() {
+		fmt.Printf("Results for %q:\n\n", query)
+		for i, hit := range hits {
+			fmt.Printf("%d. %s [%s, score %.3f]\n   %s\n", i+1, hit.Title, hit.ID, hit.Score, hit.Content)
+		}
+	})
+
+	if len(hits) == 0 {
+		return errNoResults
+	}
+	return nil
+}
+
+func testEmbedding(ctx context.Context, cfg *config.Config, out *output, args []string) error {
+	fs := flag.NewFlagSet("test-embedding", flag.ContinueOnError)
+	fs.BoolVar(out.json, "json", *out.json, "print JSON output")
+	words, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	text := strings.Join(words, " ")
+	if text == "" {
+		text = "Potatoes require soil moisture between 60-80% for optimal growth"
+	}
+
+	embeddingService := rag.NewEmbeddingService(cfg.EmbeddingAPIURL, cfg.EmbeddingModel)
+	start := time.Now()
+	embedding, err := embeddingService.GetEmbedding(ctx, text)
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+
+	preview := embedding
+	if len(preview) > 5 {
+		preview = preview[:5]
+	}
+
+	out.result(map[string]interface{}{
+		"model":       cfg.EmbeddingModel,
+		"text":        text,
+		"dimensions":  len(embedding),
+		"preview":     preview,
+		"duration_ms": elapsed.Milliseconds(),
+	}, func() {
+		fmt.Printf("Model:      %s\n", cfg.EmbeddingModel)
+		fmt.Printf("Dimensions: %d\n", len(embedding))
+		fmt.Printf("Preview:    %v\n", preview)
+		fmt.Printf("Duration:   %s\n", elapsed.Round(time.Millisecond))
+	})
+	return nil
+}
+
+type migrationResult struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+}
+
+func migrate(ctx context.Context, cfg *config.Config, out *output, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.BoolVar(out.json, "json", *out.json, "print JSON output")
+	steps := fs.Int("steps", 1, "number of migrations to revert (down only)")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("%w: migrate requires one of up, down or status", errUsage)
+	}
+	action := positional[0]
+	if action != "up" && action != "down" && action != "status" {
+		return fmt.Errorf("%w: unknown migrate action %q", errUsage, action)
+	}
+	if *steps <= 0 {
+		return fmt.Errorf("%w: --steps must be positive", errUsage)
+	}
+
+	db, err := storage.Open(cfg.StorageDriver, cfg.StorageDSN())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	migrator, err := db.Migrator()
+	if err != nil {
+		return err
+	}
+
+	if action == "status" {
+		states, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		out.result(map[string]interface{}{"migrations": states}, func() {
+			for _, s := range states {
+				status := "pending"
+				switch {
+				case s.Missing:
+					status = "applied, file missing"
+				case s.Modified:
+					status = "applied, file modified"
+				case s.AppliedAt != nil:
+					status = "applied " + s.AppliedAt.Format(time.RFC3339)
+				}
+				fmt.Printf("%04d %-32s %s\n", s.Version, s.Name, status)
+			}
+		})
+		return nil
+	}
+
+	var done []storage.Migration
+	verb := "Applied"
+	if action == "up" {
+		done, err = migrator.Up(ctx)
+	} else {
+		done, err = migrator.Down(ctx, *steps)
+		verb = "Reverted"
+	}
+	// Report what completed even if a later migration failed.
+	results := []migrationResult{}
+	for _, m := range done {
+		results = append(results, migrationResult{m.Version, m.Name})
+	}
+	if err != nil {
+		out.result(map[string]interface{}{"action": action, "migrations": results, "error": err.Error()}, func() {
+			for _, r := range results {
+				fmt.Fprintf(os.Stderr, "%s %04d_%s\n", verb, r.Version, r.Name)
+			}
+		})
+		return err
+	}
+
+	out.result(map[string]interface{}{"action": action, "migrations": results}, func() {
+		for _, r := range results {
+			fmt.Printf("%s %04d_%s\n", verb, r.Version, r.Name)
+		}
+		if len(results) == 0 {
+			fmt.Println("Nothing to do")
+		}
+	})
+	return nil
+}
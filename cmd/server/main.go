@@ -0,0 +1,358 @@
+// cmd/server/main.go
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"agricultural-iot-rag/internal/config"
+	"agricultural-iot-rag/internal/handlers"
+	"agricultural-iot-rag/internal/ingest"
+	"agricultural-iot-rag/internal/metrics"
+	"agricultural-iot-rag/internal/models"
+	"agricultural-iot-rag/internal/notify"
+	"agricultural-iot-rag/internal/services"
+	"agricultural-iot-rag/internal/storage"
+	"agricultural-iot-rag/pkg/iot"
+	"agricultural-iot-rag/pkg/llm"
+	"agricultural-iot-rag/pkg/rag"
+)
+
+const (
+	dataChanSize    = 100
+	shutdownTimeout = 15 * time.Second
+	ingestTimeout   = 5 * time.Second
+)
+
+func main() {
+	cfg := config.Load()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// RAG components
+	vectorStore, err := rag.NewVectorStore(cfg.QdrantURL, cfg.QdrantCollection)
+	if err != nil {
+		log.Fatalf("Failed to initialize vector store: %v", err)
+	}
+	embeddingService := rag.NewEmbeddingService(cfg.EmbeddingAPIURL, cfg.EmbeddingModel)
+	chunking := rag.ChunkOptions{Strategy: cfg.ChunkStrategy, Size: cfg.ChunkSize, Overlap: cfg.ChunkOverlap}
+	if err := chunking.Validate(); err != nil {
+		log.Fatalf("Invalid chunking configuration: %v", err)
+	}
+	rerankURL, rerankModel, err := cfg.RerankEndpoint()
+	if err != nil {
+		log.Fatalf("Invalid reranker configuration: %v", err)
+	}
+	reranker, err := services.NewReranker(cfg.Reranker, rerankURL, rerankModel)
+	if err != nil {
+		log.Fatalf("Invalid reranker configuration: %v", err)
+	}
+	knowledgeService := services.NewKnowledgeService(vectorStore, embeddingService, services.KnowledgeOptions{
+		Chunking: chunking,
+		Hybrid: services.HybridOptions{
+			LexicalWeight:  cfg.HybridLexicalWeight,
+			SemanticWeight: cfg.HybridSemanticWeight,
+			RRFK:           cfg.HybridRRFK,
+			Refresh:        cfg.KeywordIndexRefresh,
+		},
+		Rerank: services.RerankOptions{
+			Reranker:   reranker,
+			Candidates: cfg.RerankCandidates,
+		},
+		Diversity: services.DiversityOptions{
+			Lambda:     cfg.MMRLambda,
+			Candidates: cfg.MMRCandidates,
+		},
+		MinScore: float32(cfg.KnowledgeMinScore),
+	})
+	llmClient := llm.NewOllamaClient(cfg.OllamaURL, cfg.LLMModel)
+
+	// Relational store for the field registry and alerts: Postgres, or
+	// SQLite on gateways. The server keeps running without it;
+	// registry-backed endpoints report 503 instead. A reachable database
+	// that cannot be migrated is fatal, since running against the wrong
+	// schema is worse.
+	var db storage.Store
+	if store, err := storage.Open(cfg.StorageDriver, cfg.StorageDSN()); err != nil {
+		log.Printf("Storage (%s) unavailable, field registry disabled: %v", cfg.StorageDriver, err)
+	} else if err := store.MigrateUp(ctx); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	} else {
+		db = store
+	}
+
+	// Sensor ingestion. Readings go to InfluxDB unless READINGS_STORE=sql
+	// keeps them in the relational store.
+	var timeseries storage.TimeSeries = storage.NewInfluxDB(cfg.InfluxDBURL, cfg.InfluxDBToken, cfg.InfluxDBOrg, cfg.InfluxDBBucket)
+	if cfg.ReadingsStore == "sql" {
+		if db == nil {
+			log.Fatalf("READINGS_STORE=sql requires a working %s store", cfg.StorageDriver)
+		}
+		timeseries = db
+	}
+
+	// MQTT ingestion: the collector feeds dataChan, the processor consumes
+	// it. The collector also publishes alert notifications.
+	dataChan := make(chan models.SensorReading, dataChanSize)
+	mqttCollector := iot.NewMQTTCollector(cfg.MQTTBroker, dataChan)
+
+	notifier, err := newNotifier(cfg, db, mqttCollector)
+	if err != nil {
+		log.Fatalf("Failed to configure notifications: %v", err)
+	}
+	alertService := services.NewAlertService(db, notifier)
+	if db != nil {
+		if err := alertService.Load(ctx); err != nil {
+			log.Fatalf("Failed to load alert rules: %v", err)
+		}
+	}
+	sensorService := services.NewSensorService(timeseries, db, alertService, cfg.UnregisteredDevicePolicy)
+	registryService := services.NewRegistryService(db)
+	decisionService := services.NewDecisionService(knowledgeService, sensorService, llmClient, services.DecisionOptions{
+		Samples: cfg.DecisionSamples,
+		Expansion: services.ExpansionOptions{
+			Queries: cfg.QueryRewrites,
+			HyDE:    cfg.QueryHyDE,
+		},
+	})
+
+	// HTTP handlers
+	decisionHandler := handlers.NewDecisionHandler(decisionService)
+	sensorHandler := handlers.NewSensorHandler(sensorService)
+	registryHandler := handlers.NewRegistryHandler(registryService)
+	alertHandler := handlers.NewAlertHandler(alertService)
+	knowledgeHandler := handlers.NewKnowledgeHandler(knowledgeService, ingest.NewIngester(knowledgeService), cfg.KnowledgeDir)
+
+	router := gin.Default()
+	router.Use(corsMiddleware(), metricsMiddleware())
+
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status":    "ok",
+			"timestamp": time.Now().Unix(),
+			"service":   "agricultural-iot-rag",
+		})
+	})
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	api := router.Group("/api/v1")
+	{
+		api.POST("/decision", decisionHandler.GetDecision)
+
+		api.GET("/knowledge", knowledgeHandler.ListKnowledge)
+		api.POST("/knowledge/import", knowledgeHandler.ImportKnowledge)
+		api.GET("/knowledge/:doc_id", knowledgeHandler.GetKnowledge)
+		api.PUT("/knowledge/:doc_id", knowledgeHandler.PutKnowledge)
+		api.DELETE("/knowledge/:doc_id", knowledgeHandler.DeleteKnowledge)
+
+		api.GET("/sensors/:field_id", sensorHandler.GetSensorData)
+		api.GET("/sensors/:field_id/history", sensorHandler.GetSensorHistory)
+		api.POST("/sensors/data", sensorHandler.ReceiveSensorData)
+		api.GET("/fields/stats", sensorHandler.GetFieldsStats)
+
+		api.POST("/fields", registryHandler.CreateField)
+		api.GET("/fields", registryHandler.ListFields)
+		api.GET("/fields/:field_id", registryHandler.GetField)
+		api.PATCH("/fields/:field_id", registryHandler.UpdateField)
+		api.DELETE("/fields/:field_id", registryHandler.RetireField)
+
+		api.POST("/devices", registryHandler.CreateDevice)
+		api.GET("/devices", registryHandler.ListDevices)
+		api.GET("/devices/:device_id", registryHandler.GetDevice)
+		api.PATCH("/devices/:device_id", registryHandler.UpdateDevice)
+		api.DELETE("/devices/:device_id", registryHandler.RetireDevice)
+
+		api.POST("/alert-rules", alertHandler.CreateRule)
+		api.GET("/alert-rules", alertHandler.ListRules)
+		api.GET("/alert-rules/:rule_id", alertHandler.GetRule)
+		api.PUT("/alert-rules/:rule_id", alertHandler.UpdateRule)
+		api.DELETE("/alert-rules/:rule_id", alertHandler.DeleteRule)
+
+		api.GET("/alerts", alertHandler.ListAlerts)
+		api.GET("/alerts/:alert_id", alertHandler.GetAlert)
+		api.POST("/alerts/:alert_id/acknowledge", alertHandler.AcknowledgeAlert)
+		api.POST("/alerts/:alert_id/resolve", alertHandler.ResolveAlert)
+		api.POST("/alerts/:alert_id/snooze", alertHandler.SnoozeAlert)
+		api.GET("/notifications/dead-letters", alertHandler.ListDeadLetters)
+	}
+
+	mqttCtx, stopMQTT := context.WithCancel(context.Background())
+	mqttDone := make(chan struct{})
+	go func() {
+		defer close(mqttDone)
+		if err := mqttCollector.Start(mqttCtx); err != nil {
+			log.Printf("MQTT collector stopped: %v", err)
+		}
+	}()
+
+	stopProcessing := make(chan struct{})
+	processorDone := make(chan struct{})
+	go func() {
+		defer close(processorDone)
+		processIncomingData(sensorService, dataChan, stopProcessing)
+	}()
+
+	server := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: router,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server running on http://localhost:%s", cfg.Port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		log.Println("Shutdown signal received")
+	case err := <-serverErr:
+		log.Printf("HTTP server failed: %v", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// 1. Stop accepting HTTP requests and let in-flight ones finish.
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server shutdown: %v", err)
+	}
+
+	// 2. Disconnect from the broker so no new readings are queued.
+	stopMQTT()
+	select {
+	case <-mqttDone:
+	case <-shutdownCtx.Done():
+		log.Println("Timed out waiting for MQTT collector")
+	}
+
+	// 3. Drain readings that were already queued.
+	close(stopProcessing)
+	select {
+	case <-processorDone:
+	case <-shutdownCtx.Done():
+		log.Printf("Timed out draining sensor readings, %d dropped", len(dataChan))
+	}
+
+	// 4. Give queued notifications a chance to go out; the rest are
+	// dead-lettered.
+	if err := notifier.Close(shutdownCtx); err != nil {
+		log.Printf("Notifier shutdown: %v", err)
+	}
+
+	// 5. Release backing stores.
+	if err := vectorStore.Close(); err != nil {
+		log.Printf("Failed to close vector store: %v", err)
+	}
+	if db != nil {
+		if err := db.Close(); err != nil {
+			log.Printf("Failed to close database: %v", err)
+		}
+	}
+
+	log.Println("Server stopped")
+}
+
+// newNotifier builds the alert notifier from the configured channels.
+// Undeliverable notifications are dead-lettered to db when it is available.
+func newNotifier(cfg *config.Config, db storage.Store, publisher notify.Publisher) (*notify.Notifier, error) {
+	channels := []notify.Channel{notify.NewMQTTChannel(publisher)}
+	if cfg.NotifyWebhookURL != "" {
+		channels = append(channels, notify.NewWebhookChannel(cfg.NotifyWebhookURL, cfg.NotifyWebhookSecret))
+	}
+	if cfg.SMTPAddr != "" && cfg.NotifyEmailTo != "" {
+		channels = append(channels, notify.NewSMTPChannel(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword,
+			cfg.SMTPFrom, strings.Split(cfg.NotifyEmailTo, ",")))
+	}
+
+	routes, err := notify.ParseRoutes(cfg.NotifyRoutes)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(cfg.NotifyTimezone)
+	if err != nil {
+		return nil, err
+	}
+	quiet, err := notify.ParseQuietHours(cfg.NotifyQuietHours, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := notify.Options{Channels: channels, Routes: routes, QuietHours: quiet}
+	if db != nil {
+		opts.DeadLetters = db
+	}
+	return notify.New(opts)
+}
+
+// processIncomingData consumes readings until stop is closed, then drains
+// whatever is still buffered in dataChan before returning.
+func processIncomingData(sensorService *services.SensorService, dataChan <-chan models.SensorReading, stop <-chan struct{}) {
+	for {
+		select {
+		case reading := <-dataChan:
+			handleReading(sensorService, reading)
+		case <-stop:
+			for {
+				select {
+				case reading := <-dataChan:
+					handleReading(sensorService, reading)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func handleReading(sensorService *services.SensorService, reading models.SensorReading) {
+	ctx, cancel := context.WithTimeout(context.Background(), ingestTimeout)
+	defer cancel()
+
+	err := sensorService.Ingest(ctx, &reading)
+	switch {
+	case errors.Is(err, services.ErrReadingQuarantined):
+		log.Printf("Quarantined reading from unregistered device %s", reading.DeviceID)
+	case err != nil:
+		log.Printf("Failed to ingest reading from device %s: %v", reading.DeviceID, err)
+	}
+}
+
+func corsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", "*")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
+
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		endpoint := c.FullPath()
+		if endpoint == "" {
+			endpoint = "unmatched"
+		}
+		metrics.APIRequestsTotal.WithLabelValues(c.Request.Method, endpoint, strconv.Itoa(c.Writer.Status())).Inc()
+	}
+}
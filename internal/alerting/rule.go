@@ -0,0 +1,156 @@
+// internal/alerting/rule.go
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidRule is returned when a rule expression cannot be parsed.
+var ErrInvalidRule = errors.New("invalid rule")
+
+// Comparison operators accepted in rule expressions.
+const (
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+	OpEqual        = "=="
+	OpNotEqual     = "!="
+)
+
+// Condition is a parsed rule expression of the form
+//
+//	<measurement> <op> <threshold> [for <duration>] [on <key>=<value>[,...]]
+//
+// for example "soil_moisture < 30 for 2h on crop=potato". The selector
+// keys are crop and field; a condition without selectors applies to every
+// field.
+type Condition struct {
+	Measurement string
+	Op          string
+	Threshold   float64
+	// For is how long the comparison must hold before the rule fires.
+	For   time.Duration
+	Crop  string
+	Field string
+}
+
+// Parse parses a rule expression.
+func Parse(expr string) (*Condition, error) {
+	tokens := strings.Fields(expr)
+	if len(tokens) < 3 {
+		return nil, fmt.Errorf("%w: expected \"<measurement> <op> <threshold>\"", ErrInvalidRule)
+	}
+
+	c := &Condition{Measurement: tokens[0], Op: tokens[1]}
+	switch c.Op {
+	case OpLess, OpLessEqual, OpGreater, OpGreaterEqual, OpEqual, OpNotEqual:
+	default:
+		return nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidRule, c.Op)
+	}
+	threshold, err := strconv.ParseFloat(tokens[2], 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: threshold %q is not a number", ErrInvalidRule, tokens[2])
+	}
+	c.Threshold = threshold
+
+	rest := tokens[3:]
+	if len(rest) >= 2 && rest[0] == "for" {
+		if c.For, err = parseDuration(rest[1]); err != nil {
+			return nil, err
+		}
+		rest = rest[2:]
+	}
+	if len(rest) >= 2 && rest[0] == "on" {
+		for _, sel := range strings.Split(strings.Join(rest[1:], ""), ",") {
+			key, value, ok := strings.Cut(sel, "=")
+			if !ok || value == "" {
+				return nil, fmt.Errorf("%w: selector %q must be key=value", ErrInvalidRule, sel)
+			}
+			switch key {
+			case "crop":
+				c.Crop = strings.ToLower(value)
+			case "field":
+				c.Field = value
+			default:
+				return nil, fmt.Errorf("%w: unknown selector %q", ErrInvalidRule, key)
+			}
+		}
+		rest = nil
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidRule, strings.Join(rest, " "))
+	}
+	return c, nil
+}
+
+// parseDuration accepts Go durations plus a "d" suffix for whole days.
+func parseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("%w: invalid duration %q", ErrInvalidRule, s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%w: invalid duration %q", ErrInvalidRule, s)
+	}
+	return d, nil
+}
+
+// Matches reports whether the condition applies to a field.
+func (c *Condition) Matches(fieldID, crop string) bool {
+	if c.Field != "" && c.Field != fieldID {
+		return false
+	}
+	if c.Crop != "" && !strings.EqualFold(c.Crop, crop) {
+		return false
+	}
+	return true
+}
+
+// Breached reports whether value violates the threshold.
+func (c *Condition) Breached(value float64) bool {
+	switch c.Op {
+	case OpLess:
+		return value < c.Threshold
+	case OpLessEqual:
+		return value <= c.Threshold
+	case OpGreater:
+		return value > c.Threshold
+	case OpGreaterEqual:
+		return value >= c.Threshold
+	case OpEqual:
+		return value == c.Threshold
+	case OpNotEqual:
+		return value != c.Threshold
+	}
+	return false
+}
+
+// Cleared reports whether a firing condition has recovered. For ordered
+// comparisons the value must move past the threshold by hysteresis, so a
+// reading hovering around the threshold does not flap.
+func (c *Condition) Cleared(value, hysteresis float64) bool {
+	switch c.Op {
+	case OpLess, OpLessEqual:
+		return !c.Breached(value) && value >= c.Threshold+hysteresis
+	case OpGreater, OpGreaterEqual:
+		return !c.Breached(value) && value <= c.Threshold-hysteresis
+	}
+	return !c.Breached(value)
+}
+
+func (c *Condition) String() string {
+	s := fmt.Sprintf("%s %s %s", c.Measurement, c.Op, strconv.FormatFloat(c.Threshold, 'f', -1, 64))
+	if c.For > 0 {
+		s += " for " + c.For.String()
+	}
+	return s
+}
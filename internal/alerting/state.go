@@ -0,0 +1,70 @@
+// internal/alerting/state.go
+package alerting
+
+import "time"
+
+// Transition is the outcome of feeding one value to a rule's state.
+type Transition int
+
+const (
+	NoChange Transition = iota
+	Fire
+	Resolve
+)
+
+// Settings are the per-rule knobs that shape when alerts fire and clear.
+type Settings struct {
+	// Hysteresis is how far past the threshold a value must recover
+	// before a firing alert resolves.
+	Hysteresis float64
+	// Debounce is the minimum time after an alert resolves before the
+	// same rule can fire again for the field.
+	Debounce time.Duration
+}
+
+// State tracks one rule on one field.
+type State struct {
+	// PendingSince is when the condition started to hold without firing.
+	PendingSince time.Time
+	// Active is set while an alert is open; AlertID identifies it.
+	Active  bool
+	AlertID int64
+	// ClearedAt is when the last alert resolved.
+	ClearedAt time.Time
+	// LastAt is the newest reading seen, so late readings are ignored.
+	LastAt time.Time
+}
+
+// Step advances the state with a value observed at at.
+func (s *State) Step(c *Condition, settings Settings, value float64, at time.Time) Transition {
+	if at.Before(s.LastAt) {
+		return NoChange
+	}
+	s.LastAt = at
+
+	if s.Active {
+		if !c.Cleared(value, settings.Hysteresis) {
+			return NoChange
+		}
+		s.Active = false
+		s.ClearedAt = at
+		s.PendingSince = time.Time{}
+		return Resolve
+	}
+
+	if !c.Breached(value) {
+		s.PendingSince = time.Time{}
+		return NoChange
+	}
+	if s.PendingSince.IsZero() {
+		s.PendingSince = at
+	}
+	if at.Sub(s.PendingSince) < c.For {
+		return NoChange
+	}
+	if !s.ClearedAt.IsZero() && at.Sub(s.ClearedAt) < settings.Debounce {
+		return NoChange
+	}
+	s.Active = true
+	return Fire
+}
@@ -2,41 +2,191 @@
 package config
 
 import (
+	"errors"
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
 	Port             string
 	QdrantURL        string
+	QdrantCollection string
 	OllamaURL        string
 	MQTTBroker       string
 	EmbeddingAPIURL  string
 	EmbeddingModel   string
 	LLMModel         string
+	StorageDriver    string
 	PostgresDSN      string
+	SQLitePath       string
+	ReadingsStore    string
 	InfluxDBURL      string
 	InfluxDBToken    string
 	InfluxDBOrg      string
 	InfluxDBBucket   string
 	RedisURL         string
+
+	// Knowledge documents longer than ChunkSize words are split into
+	// chunks by ChunkStrategy ("markdown", "sentence" or "fixed"),
+	// overlapping by ChunkOverlap words.
+	ChunkStrategy string
+	ChunkSize     int
+	ChunkOverlap  int
+	// Hybrid retrieval fuses BM25 keyword and embedding rankings with
+	// reciprocal rank fusion, weighting them by HybridLexicalWeight and
+	// HybridSemanticWeight; a lexical weight of 0 searches by embedding
+	// alone. HybridRRFK is the fusion constant and KeywordIndexRefresh how
+	// often the in-memory keyword index is rebuilt from Qdrant.
+	HybridLexicalWeight  float64
+	HybridSemanticWeight float64
+	HybridRRFK           int
+	KeywordIndexRefresh  time.Duration
+	// Reranker rescores the best RerankCandidates hits of a search: ""
+	// (off), "model" for a cross-encoder behind a rerank endpoint, "llm"
+	// for relevance ratings from a chat model or "lexical" for BM25.
+	// "model" needs RerankURL and RerankModel; for "llm" they default to
+	// Ollama and the LLM model. See RerankEndpoint.
+	Reranker         string
+	RerankURL        string
+	RerankModel      string
+	RerankCandidates int
+	// MMRLambda trades relevance (1) against diversity (0) when picking
+	// retrieved passages by maximal marginal relevance from the best
+	// MMRCandidates; 1 keeps the best-ranked passages.
+	MMRLambda     float64
+	MMRCandidates int
+	// KnowledgeMinScore is the cosine similarity below which retrieved
+	// documents are dropped as irrelevant; 0 keeps them all.
+	KnowledgeMinScore float64
+
+	// KnowledgeDir is the directory POST /knowledge/import may read
+	// directories from; requests name paths relative to it.
+	KnowledgeDir string
+
+	// DecisionSamples is how many answers are generated per decision to
+	// measure their agreement for the confidence score. The default, 1,
+	// skips sampling; more multiplies the model calls per decision.
+	DecisionSamples int
+	// QueryRewrites is how many agronomic search queries the model
+	// rewrites each decision question into, and QueryHyDE whether it also
+	// writes a hypothetical answer to search with; both are searched
+	// alongside the question. 0 and false search with the question alone.
+	QueryRewrites int
+	QueryHyDE     bool
+
+	// UnregisteredDevicePolicy decides what happens to readings from devices
+	// missing from the registry: "quarantine" or "reject".
+	UnregisteredDevicePolicy string
+
+	// Alert notifications. The webhook channel is enabled by
+	// NotifyWebhookURL and the email channel by SMTPAddr plus
+	// NotifyEmailTo; MQTT is always available.
+	NotifyWebhookURL    string
+	NotifyWebhookSecret string
+	SMTPAddr            string
+	SMTPUsername        string
+	SMTPPassword        string
+	SMTPFrom            string
+	NotifyEmailTo       string
+	// NotifyRoutes routes fields to channels, e.g.
+	// "field_001=webhook+email;*@high=mqtt". Empty sends everything
+	// everywhere.
+	NotifyRoutes string
+	// NotifyQuietHours ("22:00-06:00" in NotifyTimezone) holds
+	// non-critical notifications until the window ends.
+	NotifyQuietHours string
+	NotifyTimezone   string
 }
 
 func Load() *Config {
 	return &Config{
-		Port:            getEnv("PORT", "8080"),
-		QdrantURL:       getEnv("QDRANT_URL", "localhost:6333"),
-		OllamaURL:       getEnv("OLLAMA_URL", "http://localhost:11434"),
-		MQTTBroker:      getEnv("MQTT_BROKER", "tcp://localhost:1883"),
-		EmbeddingAPIURL: getEnv("EMBEDDING_API_URL", "http://localhost:11434"),
-		EmbeddingModel:  getEnv("EMBEDDING_MODEL", "nomic-embed-text"),
-		LLMModel:        getEnv("LLM_MODEL", "llama3.2"),
-		PostgresDSN:     getEnv("POSTGRES_DSN", "host=localhost user=postgres password=password dbname=agricultural_iot port=5432 sslmode=disable"),
-		InfluxDBURL:     getEnv("INFLUXDB_URL", "http://localhost:8086"),
-		InfluxDBToken:   getEnv("INFLUXDB_TOKEN", "my-token"),
-		InfluxDBOrg:     getEnv("INFLUXDB_ORG", "agurotech"),
-		InfluxDBBucket:  getEnv("INFLUXDB_BUCKET", "sensors"),
-		RedisURL:        getEnv("REDIS_URL", "localhost:6379"),
+		Port:             getEnv("PORT", "8080"),
+		QdrantURL:        getEnv("QDRANT_URL", "localhost:6333"),
+		QdrantCollection: getEnv("QDRANT_COLLECTION", "agricultural_knowledge"),
+		OllamaURL:        getEnv("OLLAMA_URL", "http://localhost:11434"),
+		MQTTBroker:       getEnv("MQTT_BROKER", "tcp://localhost:1883"),
+		EmbeddingAPIURL:  getEnv("EMBEDDING_API_URL", "http://localhost:11434"),
+		EmbeddingModel:   getEnv("EMBEDDING_MODEL", "nomic-embed-text"),
+		LLMModel:         getEnv("LLM_MODEL", "llama3.2"),
+		StorageDriver:    getEnv("STORAGE_DRIVER", "postgres"),
+		PostgresDSN:      getEnv("POSTGRES_DSN", "host=localhost user=postgres password=password dbname=agricultural_iot port=5432 sslmode=disable"),
+		SQLitePath:       getEnv("SQLITE_PATH", "data/agricultural_iot.db"),
+		ReadingsStore:    getEnv("READINGS_STORE", "influxdb"),
+		InfluxDBURL:      getEnv("INFLUXDB_URL", "http://localhost:8086"),
+		InfluxDBToken:    getEnv("INFLUXDB_TOKEN", "my-token"),
+		InfluxDBOrg:      getEnv("INFLUXDB_ORG", "agurotech"),
+		InfluxDBBucket:   getEnv("INFLUXDB_BUCKET", "sensors"),
+		RedisURL:         getEnv("REDIS_URL", "localhost:6379"),
+
+		ChunkStrategy: getEnv("CHUNK_STRATEGY", "markdown"),
+		ChunkSize:     getEnvInt("CHUNK_SIZE", 256),
+		ChunkOverlap:  getEnvInt("CHUNK_OVERLAP", 32),
+		KnowledgeDir:  getEnv("KNOWLEDGE_DIR", "knowledge"),
+
+		HybridLexicalWeight:  getEnvFloat("HYBRID_LEXICAL_WEIGHT", 1),
+		HybridSemanticWeight: getEnvFloat("HYBRID_SEMANTIC_WEIGHT", 1),
+		HybridRRFK:           getEnvInt("HYBRID_RRF_K", 60),
+		KeywordIndexRefresh:  getEnvDuration("KEYWORD_INDEX_REFRESH", 5*time.Minute),
+
+		Reranker:         getEnv("RERANKER", ""),
+		RerankURL:        getEnv("RERANK_URL", ""),
+		RerankModel:      getEnv("RERANK_MODEL", ""),
+		RerankCandidates: getEnvInt("RERANK_CANDIDATES", 30),
+
+		MMRLambda:     getEnvFloat("MMR_LAMBDA", 0.7),
+		MMRCandidates: getEnvInt("MMR_CANDIDATES", 20),
+
+		KnowledgeMinScore: getEnvFloat("KNOWLEDGE_MIN_SCORE", 0.3),
+
+		DecisionSamples: getEnvInt("DECISION_SAMPLES", 1),
+		QueryRewrites:   getEnvInt("QUERY_REWRITES", 0),
+		QueryHyDE:       getEnvBool("QUERY_HYDE", false),
+
+		UnregisteredDevicePolicy: getEnv("UNREGISTERED_DEVICE_POLICY", "quarantine"),
+
+		NotifyWebhookURL:    getEnv("NOTIFY_WEBHOOK_URL", ""),
+		NotifyWebhookSecret: getEnv("NOTIFY_WEBHOOK_SECRET", ""),
+		SMTPAddr:            getEnv("SMTP_ADDR", ""),
+		SMTPUsername:        getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:        getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:            getEnv("SMTP_FROM", "alerts@localhost"),
+		NotifyEmailTo:       getEnv("NOTIFY_EMAIL_TO", ""),
+		NotifyRoutes:        getEnv("NOTIFY_ROUTES", ""),
+		NotifyQuietHours:    getEnv("NOTIFY_QUIET_HOURS", ""),
+		NotifyTimezone:      getEnv("NOTIFY_TIMEZONE", "UTC"),
+	}
+}
+
+// StorageDSN returns the connection string for the configured storage
+// driver: the Postgres DSN or the SQLite file path.
+func (c *Config) StorageDSN() string {
+	if c.StorageDriver == "sqlite" {
+		return c.SQLitePath
 	}
+	return c.PostgresDSN
+}
+
+// RerankEndpoint returns the URL and model of the configured reranker.
+// "model" has no default: Ollama serves no rerank endpoint, so RerankURL
+// must name one, such as a llama.cpp server's /v1/rerank. "llm" defaults
+// to Ollama and the LLM model.
+func (c *Config) RerankEndpoint() (url, model string, err error) {
+	url, model = c.RerankURL, c.RerankModel
+	switch c.Reranker {
+	case "model":
+		if url == "" || model == "" {
+			return "", "", errors.New("RERANKER=model requires RERANK_URL and RERANK_MODEL")
+		}
+	case "llm":
+		if url == "" {
+			url = c.OllamaURL
+		}
+		if model == "" {
+			model = c.LLMModel
+		}
+	}
+	return url, model, nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -45,3 +195,31 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,325 @@
+// internal/decision/output.go
+
+// Package decision defines the structured reply the advisor model must
+// give: a recommendation plus typed actions. It supplies the JSON schema
+// sent to the model, and parses replies, repairing common formatting slips
+// before validating them against the schema.
+package decision
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Action types a recommendation may contain.
+const (
+	ActionIrrigate    = "irrigate"
+	ActionFertilize   = "fertilize"
+	ActionPestControl = "pest_control"
+	ActionHarvest     = "harvest"
+	ActionMonitor     = "monitor"
+	ActionOther       = "other"
+)
+
+// ActionTypes lists the valid action types in schema order.
+var ActionTypes = []string{ActionIrrigate, ActionFertilize, ActionPestControl, ActionHarvest, ActionMonitor, ActionOther}
+
+// Action is one concrete step the model recommends. Quantity and Unit are
+// omitted for actions without an amount, such as monitoring.
+type Action struct {
+	Type        string   `json:"type"`
+	TargetField string   `json:"target_field"`
+	Quantity    *float64 `json:"quantity,omitempty"`
+	Unit        string   `json:"unit,omitempty"`
+	Timing      string   `json:"timing"`
+	Rationale   string   `json:"rationale"`
+}
+
+// Output is the reply the model must produce. An empty Actions list means
+// nothing needs doing.
+type Output struct {
+	Recommendation string   `json:"recommendation"`
+	Actions        []Action `json:"actions"`
+}
+
+// Schema is the JSON schema of Output, passed to the model as its output
+// format.
+var Schema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "recommendation": {"type": "string"},
+    "actions": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "type": {"type": "string", "enum": ["` + strings.Join(ActionTypes, `", "`) + `"]},
+          "target_field": {"type": "string"},
+          "quantity": {"type": ["number", "null"], "minimum": 0},
+          "unit": {"type": "string"},
+          "timing": {"type": "string"},
+          "rationale": {"type": "string"}
+        },
+        "required": ["type", "target_field", "timing", "rationale"]
+      }
+    }
+  },
+  "required": ["recommendation", "actions"]
+}`)
+
+// Instructions describe the schema in words for the prompt; models follow
+// a format better when it is both enforced and explained.
+const Instructions = `Reply with only a JSON object of this form:
+{"recommendation": "<short summary of your advice>",
+ "actions": [{"type": "<irrigate|fertilize|pest_control|harvest|monitor|other>",
+              "target_field": "<field id>",
+              "quantity": <number or null>,
+              "unit": "<unit of quantity, e.g. mm or kg/ha>",
+              "timing": "<when, e.g. today, within 48h, at next rain-free morning>",
+              "rationale": "<why, citing the sensor values or documents used>"}]}
+Only list actions that should actually be taken; if nothing should be done,
+return an empty actions list. A warning against an action (for example "do
+not irrigate") is not an action.
+Cite the numbered knowledge documents you rely on inline, as [1] or [1, 3],
+in the recommendation and in each rationale. Do not cite numbers that are
+not listed.`
+
+// Expect holds what a reply is checked against besides the schema.
+type Expect struct {
+	// FieldID fills in actions without a target field.
+	FieldID string
+	// Sources is the number of documents the prompt listed; citations
+	// must fall within 1..Sources.
+	Sources int
+}
+
+// ValidationError lists every way a reply failed to match the schema.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid recommendation output: " + strings.Join(e.Problems, "; ")
+}
+
+// actionAliases maps names models commonly use to the schema's types.
+var actionAliases = map[string]string{
+	"irrigation":    ActionIrrigate,
+	"irrigating":    ActionIrrigate,
+	"water":         ActionIrrigate,
+	"watering":      ActionIrrigate,
+	"fertilise":     ActionFertilize,
+	"fertilizer":    ActionFertilize,
+	"fertilizing":   ActionFertilize,
+	"fertilising":   ActionFertilize,
+	"fertilization": ActionFertilize,
+	"fertilisation": ActionFertilize,
+	"pest":          ActionPestControl,
+	"pest-control":  ActionPestControl,
+	"spray":         ActionPestControl,
+	"harvesting":    ActionHarvest,
+	"monitoring":    ActionMonitor,
+	"inspect":       ActionMonitor,
+	"scout":         ActionMonitor,
+}
+
+var (
+	codeFence     = regexp.MustCompile("(?s)^```[a-zA-Z]*\\s*(.*?)\\s*```$")
+	trailingComma = regexp.MustCompile(`,\s*([}\]])`)
+	leadingNumber = regexp.MustCompile(`^\s*(\d+(?:\.\d+)?)\s*(.*)$`)
+	citation      = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+)
+
+// Parse decodes a model reply into an Output. Before validating it repairs
+// what can be repaired without guessing: code fences and prose around the
+// object, trailing commas, a single action given without a list, action
+// type synonyms, quantities written as strings ("25 mm"), and a missing
+// target field when expect.FieldID is set. Anything else, including
+// citations of sources that were not listed, is reported as a
+// *ValidationError.
+func Parse(content string, expect Expect) (*Output, error) {
+	raw := extractObject(content)
+	if raw == "" {
+		return nil, &ValidationError{Problems: []string{"reply does not contain a JSON object"}}
+	}
+	raw = trailingComma.ReplaceAllString(raw, "$1")
+
+	var loose map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &loose); err != nil {
+		return nil, &ValidationError{Problems: []string{"reply is not valid JSON: " + err.Error()}}
+	}
+
+	var problems []string
+	out := &Output{}
+	switch v := loose["recommendation"].(type) {
+	case string:
+		out.Recommendation = strings.TrimSpace(v)
+	case nil:
+	default:
+		problems = append(problems, "recommendation must be a string")
+	}
+	if out.Recommendation == "" && len(problems) == 0 {
+		problems = append(problems, "recommendation is required")
+	}
+
+	var items []interface{}
+	switch v := loose["actions"].(type) {
+	case []interface{}:
+		items = v
+	case map[string]interface{}:
+		items = []interface{}{v}
+	case nil:
+		if _, ok := loose["actions"]; !ok {
+			problems = append(problems, "actions is required")
+		}
+	default:
+		problems = append(problems, "actions must be a list")
+	}
+
+	out.Actions = make([]Action, 0, len(items))
+	for i, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			problems = append(problems, fmt.Sprintf("actions[%d] must be an object", i))
+			continue
+		}
+		a, errs := parseAction(obj, expect.FieldID)
+		for _, e := range errs {
+			problems = append(problems, fmt.Sprintf("actions[%d].%s", i, e))
+		}
+		out.Actions = append(out.Actions, a)
+	}
+
+	for _, n := range out.References() {
+		switch {
+		case expect.Sources == 0:
+			problems = append(problems, fmt.Sprintf("citation [%d] used but no documents were listed", n))
+		case n < 1 || n > expect.Sources:
+			problems = append(problems, fmt.Sprintf("citation [%d] does not match a listed document (1-%d)", n, expect.Sources))
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return out, nil
+}
+
+// References returns the distinct source numbers cited in the
+// recommendation and the action rationales, in ascending order.
+func (o *Output) References() []int {
+	seen := map[int]bool{}
+	collect := func(text string) {
+		for _, m := range citation.FindAllStringSubmatch(text, -1) {
+			for _, part := range strings.Split(m[1], ",") {
+				if n, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+					seen[n] = true
+				}
+			}
+		}
+	}
+	collect(o.Recommendation)
+	for _, a := range o.Actions {
+		collect(a.Rationale)
+	}
+
+	refs := make([]int, 0, len(seen))
+	for n := range seen {
+		refs = append(refs, n)
+	}
+	sort.Ints(refs)
+	return refs
+}
+
+func parseAction(obj map[string]interface{}, fieldID string) (Action, []string) {
+	var a Action
+	var problems []string
+	str := func(key string) string {
+		s, _ := obj[key].(string)
+		return strings.TrimSpace(s)
+	}
+
+	a.Type = normalizeType(str("type"))
+	if !validType(a.Type) {
+		problems = append(problems, fmt.Sprintf("type %q is not one of %s", str("type"), strings.Join(ActionTypes, ", ")))
+	}
+
+	a.TargetField = str("target_field")
+	if a.TargetField == "" {
+		a.TargetField = fieldID
+	}
+	if a.TargetField == "" {
+		problems = append(problems, "target_field is required")
+	}
+
+	a.Unit = str("unit")
+	switch q := obj["quantity"].(type) {
+	case nil:
+	case float64:
+		a.Quantity = &q
+	case string:
+		// "25 mm" or "25": split off the unit if the model folded it in.
+		if m := leadingNumber.FindStringSubmatch(q); m != nil {
+			v, _ := strconv.ParseFloat(m[1], 64)
+			a.Quantity = &v
+			if a.Unit == "" {
+				a.Unit = strings.TrimSpace(m[2])
+			}
+		} else if strings.TrimSpace(q) != "" {
+			problems = append(problems, fmt.Sprintf("quantity %q is not a number", q))
+		}
+	default:
+		problems = append(problems, "quantity must be a number")
+	}
+	if a.Quantity != nil {
+		if *a.Quantity < 0 {
+			problems = append(problems, "quantity must not be negative")
+		}
+		if a.Unit == "" {
+			problems = append(problems, "unit is required with a quantity")
+		}
+	}
+
+	if a.Timing = str("timing"); a.Timing == "" {
+		problems = append(problems, "timing is required")
+	}
+	if a.Rationale = str("rationale"); a.Rationale == "" {
+		problems = append(problems, "rationale is required")
+	}
+	return a, problems
+}
+
+// extractObject returns the outermost JSON object in s, dropping code
+// fences and any prose around it.
+func extractObject(s string) string {
+	s = strings.TrimSpace(s)
+	if m := codeFence.FindStringSubmatch(s); m != nil {
+		s = m[1]
+	}
+	start, end := strings.IndexByte(s, '{'), strings.LastIndexByte(s, '}')
+	if start < 0 || end < start {
+		return ""
+	}
+	return s[start : end+1]
+}
+
+func normalizeType(t string) string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	if alias, ok := actionAliases[t]; ok {
+		return alias
+	}
+	return strings.ReplaceAll(t, " ", "_")
+}
+
+func validType(t string) bool {
+	for _, valid := range ActionTypes {
+		if t == valid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,258 @@
+// internal/handlers/alerts.go
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"agricultural-iot-rag/internal/models"
+	"agricultural-iot-rag/internal/services"
+	"agricultural-iot-rag/internal/storage"
+)
+
+type AlertHandler struct {
+	alertService *services.AlertService
+}
+
+func NewAlertHandler(alertService *services.AlertService) *AlertHandler {
+	return &AlertHandler{
+		alertService: alertService,
+	}
+}
+
+// alertRuleRequest is the body of rule create and replace requests. Rules
+// are enabled unless the request says otherwise.
+type alertRuleRequest struct {
+	Name            string  `json:"name"`
+	Expression      string  `json:"expression"`
+	Severity        string  `json:"severity"`
+	Hysteresis      float64 `json:"hysteresis"`
+	DebounceMinutes int     `json:"debounce_minutes"`
+	Enabled         *bool   `json:"enabled"`
+}
+
+func (r alertRuleRequest) rule() *models.AlertRule {
+	rule := &models.AlertRule{
+		Name:            r.Name,
+		Expression:      r.Expression,
+		Severity:        r.Severity,
+		Hysteresis:      r.Hysteresis,
+		DebounceMinutes: r.DebounceMinutes,
+		Enabled:         true,
+	}
+	if r.Enabled != nil {
+		rule.Enabled = *r.Enabled
+	}
+	return rule
+}
+
+func (ah *AlertHandler) CreateRule(c *gin.Context) {
+	var req alertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := req.rule()
+	if err := ah.alertService.CreateRule(c.Request.Context(), rule); err != nil {
+		registryError(c, err, "alert rule")
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (ah *AlertHandler) ListRules(c *gin.Context) {
+	rules, err := ah.alertService.ListRules(c.Request.Context())
+	if err != nil {
+		registryError(c, err, "alert rules")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": rules, "count": len(rules)})
+}
+
+func (ah *AlertHandler) GetRule(c *gin.Context) {
+	id, ok := pathID(c, "rule_id")
+	if !ok {
+		return
+	}
+	rule, err := ah.alertService.GetRule(c.Request.Context(), id)
+	if err != nil {
+		registryError(c, err, "alert rule "+c.Param("rule_id"))
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+func (ah *AlertHandler) UpdateRule(c *gin.Context) {
+	id, ok := pathID(c, "rule_id")
+	if !ok {
+		return
+	}
+	var req alertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := req.rule()
+	rule.ID = id
+	if err := ah.alertService.UpdateRule(c.Request.Context(), rule); err != nil {
+		registryError(c, err, "alert rule "+c.Param("rule_id"))
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+func (ah *AlertHandler) DeleteRule(c *gin.Context) {
+	id, ok := pathID(c, "rule_id")
+	if !ok {
+		return
+	}
+	if err := ah.alertService.DeleteRule(c.Request.Context(), id); err != nil {
+		registryError(c, err, "alert rule "+c.Param("rule_id"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted", "id": id})
+}
+
+// maxAlertLimit caps the limit query parameter of ListAlerts.
+const maxAlertLimit = 1000
+
+// ListAlerts returns alerts filtered by field_id, severity, resolved and a
+// created_at range given as RFC3339 from and to.
+func (ah *AlertHandler) ListAlerts(c *gin.Context) {
+	filter := storage.AlertFilter{
+		FieldID:  c.Query("field_id"),
+		Severity: c.Query("severity"),
+	}
+
+	var err error
+	if v := c.Query("resolved"); v != "" {
+		resolved, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "resolved must be a boolean"})
+			return
+		}
+		filter.Resolved = &resolved
+	}
+	if v := c.Query("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC3339 timestamp"})
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC3339 timestamp"})
+			return
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 || filter.Limit > maxAlertLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+			return
+		}
+	}
+
+	alerts, err := ah.alertService.ListAlerts(c.Request.Context(), filter)
+	if err != nil {
+		registryError(c, err, "alerts")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"alerts": alerts, "count": len(alerts)})
+}
+
+func (ah *AlertHandler) GetAlert(c *gin.Context) {
+	id, ok := pathID(c, "alert_id")
+	if !ok {
+		return
+	}
+	alert, err := ah.alertService.GetAlert(c.Request.Context(), id)
+	if err != nil {
+		registryError(c, err, "alert "+c.Param("alert_id"))
+		return
+	}
+	c.JSON(http.StatusOK, alert)
+}
+
+func (ah *AlertHandler) ListDeadLetters(c *gin.Context) {
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxAlertLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+			return
+		}
+	}
+
+	letters, err := ah.alertService.ListDeadLetters(c.Request.Context(), limit)
+	if err != nil {
+		registryError(c, err, "dead letters")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"dead_letters": letters, "count": len(letters)})
+}
+
+// alertTransitionRequest is the body of acknowledge, resolve and snooze
+// requests. Duration is only used by snooze.
+type alertTransitionRequest struct {
+	Actor    string `json:"actor"`
+	Note     string `json:"note"`
+	Duration string `json:"duration"`
+}
+
+func (ah *AlertHandler) AcknowledgeAlert(c *gin.Context) {
+	ah.transition(c, func(id int64, req alertTransitionRequest) (*models.Alert, error) {
+		return ah.alertService.Acknowledge(c.Request.Context(), id, req.Actor, req.Note)
+	})
+}
+
+func (ah *AlertHandler) ResolveAlert(c *gin.Context) {
+	ah.transition(c, func(id int64, req alertTransitionRequest) (*models.Alert, error) {
+		return ah.alertService.Resolve(c.Request.Context(), id, req.Actor, req.Note)
+	})
+}
+
+func (ah *AlertHandler) SnoozeAlert(c *gin.Context) {
+	ah.transition(c, func(id int64, req alertTransitionRequest) (*models.Alert, error) {
+		d, err := parseWindow(req.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("%w: duration must be like 30m, 4h or 2d", services.ErrInvalidInput)
+		}
+		return ah.alertService.Snooze(c.Request.Context(), id, d, req.Actor, req.Note)
+	})
+}
+
+func (ah *AlertHandler) transition(c *gin.Context, apply func(id int64, req alertTransitionRequest) (*models.Alert, error)) {
+	id, ok := pathID(c, "alert_id")
+	if !ok {
+		return
+	}
+	var req alertTransitionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	alert, err := apply(id, req)
+	if err != nil {
+		registryError(c, err, "alert "+c.Param("alert_id"))
+		return
+	}
+	c.JSON(http.StatusOK, alert)
+}
+
+// pathID parses a numeric path parameter, responding 400 if it is not a
+// positive integer.
+func pathID(c *gin.Context, param string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param(param), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be a positive integer"})
+		return 0, false
+	}
+	return id, true
+}
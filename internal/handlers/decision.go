@@ -2,25 +2,24 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
+	"log"
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 
+	"agricultural-iot-rag/internal/decision"
 	"agricultural-iot-rag/internal/services"
-	"agricultural-iot-rag/pkg/llm"
+	"agricultural-iot-rag/pkg/rag"
 )
 
 type DecisionHandler struct {
-	knowledgeService *services.KnowledgeService
-	llmClient        *llm.OllamaClient
+	decisionService *services.DecisionService
 }
 
-func NewDecisionHandler(ks *services.KnowledgeService, llmClient *llm.OllamaClient) *DecisionHandler {
+func NewDecisionHandler(decisionService *services.DecisionService) *DecisionHandler {
 	return &DecisionHandler{
-		knowledgeService: ks,
-		llmClient:        llmClient,
+		decisionService: decisionService,
 	}
 }
 
@@ -28,13 +27,37 @@ type DecisionRequest struct {
 	Query      string                 `json:"query" binding:"required"`
 	FieldID    string                 `json:"field_id"`
 	SensorData map[string]interface{} `json:"sensor_data,omitempty"`
+	// Filter restricts the knowledge used to documents whose metadata
+	// matches, e.g. "season = spring AND region = north"; see rag.Filter.
+	Filter string `json:"filter,omitempty"`
 }
 
 type DecisionResponse struct {
-	Recommendation string   `json:"recommendation"`
-	Confidence     float64  `json:"confidence"`
-	Sources        []string `json:"sources"`
-	Actions        []string `json:"actions"`
+	Recommendation string `json:"recommendation"`
+	// Confidence is a weighted combination of the breakdown components.
+	Confidence          float64                      `json:"confidence"`
+	ConfidenceBreakdown services.ConfidenceBreakdown `json:"confidence_breakdown"`
+	// InsufficientEvidence marks answers that should be checked before
+	// acting on them; EvidenceGaps explains why.
+	InsufficientEvidence bool     `json:"insufficient_evidence"`
+	EvidenceGaps         []string `json:"evidence_gaps,omitempty"`
+	// Disclaimer warns that no knowledge was relevant enough to use and
+	// the recommendation rests on sensor data alone.
+	Disclaimer string `json:"disclaimer,omitempty"`
+	// Sources are numbered as the recommendation cites them, e.g. [2].
+	Sources []services.Citation `json:"sources"`
+	Actions []decision.Action   `json:"actions"`
+	// ReadingsUsed lists the sensor values the recommendation was based on.
+	ReadingsUsed []services.ReadingUsed `json:"readings_used"`
+	// RetrievalFilter is the metadata filter the sources were retrieved
+	// with, including the field's crop unless too few documents matched it.
+	RetrievalFilter string `json:"retrieval_filter,omitempty"`
+	// ValidationErrors is set when the model never produced valid
+	// structured output; Recommendation is then its raw reply.
+	ValidationErrors []string `json:"validation_errors,omitempty"`
+	// Debug shows the queries retrieval used besides the question, when
+	// query expansion is on.
+	Debug *services.DecisionDebug `json:"debug,omitempty"`
 }
 
 func (dh *DecisionHandler) GetDecision(c *gin.Context) {
@@ -44,60 +67,45 @@ func (dh *DecisionHandler) GetDecision(c *gin.Context) {
 		return
 	}
 
-	// Retrieve relevant knowledge
-	documents, err := dh.knowledgeService.SearchKnowledge(c.Request.Context(), req.Query, nil)
+	filter, err := rag.ParseFilter(req.Filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve knowledge"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Prepare context for LLM
-	context := "You are an agricultural expert. Based on the following agricultural knowledge and sensor data, provide recommendations:\n\n"
-	for i, doc := range documents {
-		context += fmt.Sprintf("Document %d: %s\n\n", i+1, doc)
-	}
-
-	context += fmt.Sprintf("Question: %s\n\nProvide practical recommendations with specific actions.", req.Query)
-
-	// Get LLM response
-	messages := []llm.Message{
-		{Role: "system", Content: "You are an expert agricultural advisor. Provide practical, actionable recommendations based on sensor data and agricultural knowledge."},
-		{Role: "user", Content: context},
+	d, err := dh.decisionService.Decide(c.Request.Context(), services.DecisionQuery{
+		Query:      req.Query,
+		FieldID:    req.FieldID,
+		SensorData: req.SensorData,
+		Filter:     filter,
+	})
+	if errors.Is(err, services.ErrInvalidReading) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-
-	response, err := dh.llmClient.Chat(c.Request.Context(), messages, nil)
 	if err != nil {
+		log.Printf("Decision failed: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recommendation"})
 		return
 	}
 
-	// Parse and structure the response
 	recommendation := DecisionResponse{
-		Recommendation: response.Message.Content,
-		Confidence:     0.85, // You can implement confidence scoring
-		Sources:        documents,
-		Actions:        parseActions(response.Message.Content),
-	}
-
-	c.JSON(http.StatusOK, recommendation)
-}
-
-func parseActions(content string) []string {
-	actions := []string{}
-	lowerContent := strings.ToLower(content)
-
-	if strings.Contains(lowerContent, "irrigate") || strings.Contains(lowerContent, "water") {
-		actions = append(actions, "irrigation_recommended")
-	}
-	if strings.Contains(lowerContent, "fertilize") || strings.Contains(lowerContent, "nutrient") {
-		actions = append(actions, "fertilization_recommended")
+		Recommendation:       d.Recommendation,
+		Confidence:           d.Confidence,
+		ConfidenceBreakdown:  d.Breakdown,
+		InsufficientEvidence: d.InsufficientEvidence,
+		EvidenceGaps:         d.EvidenceGaps,
+		Disclaimer:           d.Disclaimer,
+		Sources:              d.Sources,
+		Actions:              d.Actions,
+		ReadingsUsed:         d.Readings,
+		RetrievalFilter:      d.Filter,
+		ValidationErrors:     d.ValidationErrors,
+		Debug:                d.Debug,
 	}
-	if strings.Contains(lowerContent, "pest") || strings.Contains(lowerContent, "spray") {
-		actions = append(actions, "pest_control_recommended")
-	}
-	if strings.Contains(lowerContent, "harvest") {
-		actions = append(actions, "harvest_recommended")
+	if recommendation.ReadingsUsed == nil {
+		recommendation.ReadingsUsed = []services.ReadingUsed{}
 	}
 
-	return actions
+	c.JSON(http.StatusOK, recommendation)
 }
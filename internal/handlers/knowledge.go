@@ -0,0 +1,220 @@
+// internal/handlers/knowledge.go
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"agricultural-iot-rag/internal/ingest"
+	"agricultural-iot-rag/internal/services"
+	"agricultural-iot-rag/pkg/rag"
+)
+
+// maxImportUpload caps the size of archives uploaded for import;
+// ingest.MaxArchiveSize caps what they decompress to.
+const maxImportUpload = 256 << 20
+
+type KnowledgeHandler struct {
+	knowledgeService *services.KnowledgeService
+	ingester         *ingest.Ingester
+	importDir        string
+}
+
+// NewKnowledgeHandler serves the knowledge API. Directory imports are
+// confined to importDir; an empty importDir allows uploads only.
+func NewKnowledgeHandler(knowledgeService *services.KnowledgeService, ingester *ingest.Ingester, importDir string) *KnowledgeHandler {
+	return &KnowledgeHandler{
+		knowledgeService: knowledgeService,
+		ingester:         ingester,
+		importDir:        importDir,
+	}
+}
+
+// KnowledgeRequest is the body of PUT /knowledge/:doc_id. Metadata keeps
+// JSON types: strings are keywords, numbers and booleans stay numbers and
+// booleans, and arrays are lists.
+type KnowledgeRequest struct {
+	Content  string                 `json:"content"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// ListKnowledge pages through stored documents. Repeat the request with
+// cursor=next_cursor to continue.
+func (kh *KnowledgeHandler) ListKnowledge(c *gin.Context) {
+	filter, err := rag.ParseFilter(c.Query("filter"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	q := services.KnowledgeListQuery{Filter: filter, Cursor: c.Query("cursor")}
+	if v := c.Query("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+	}
+
+	page, err := kh.knowledgeService.ListKnowledge(c.Request.Context(), q)
+	if err != nil {
+		knowledgeError(c, err, "documents")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"documents":   page.Documents,
+		"count":       len(page.Documents),
+		"next_cursor": page.NextCursor,
+	})
+}
+
+func (kh *KnowledgeHandler) GetKnowledge(c *gin.Context) {
+	id := c.Param("doc_id")
+	doc, err := kh.knowledgeService.GetKnowledge(c.Request.Context(), id)
+	if err != nil {
+		knowledgeError(c, err, "document "+id)
+		return
+	}
+	c.JSON(http.StatusOK, doc)
+}
+
+// PutKnowledge adds the document, replacing any stored under the same ID.
+func (kh *KnowledgeHandler) PutKnowledge(c *gin.Context) {
+	var req KnowledgeRequest
+	dec := json.NewDecoder(c.Request.Body)
+	// Keep integers integral so they match integer filters.
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "content is required"})
+		return
+	}
+
+	id := c.Param("doc_id")
+	ctx := c.Request.Context()
+	if err := kh.knowledgeService.AddKnowledge(ctx, id, req.Content, req.Metadata); err != nil {
+		knowledgeError(c, err, "document "+id)
+		return
+	}
+	doc, err := kh.knowledgeService.GetKnowledge(ctx, id)
+	if err != nil {
+		knowledgeError(c, err, "document "+id)
+		return
+	}
+	c.JSON(http.StatusOK, doc)
+}
+
+func (kh *KnowledgeHandler) DeleteKnowledge(c *gin.Context) {
+	id := c.Param("doc_id")
+	if err := kh.knowledgeService.DeleteKnowledge(c.Request.Context(), id); err != nil {
+		knowledgeError(c, err, "document "+id)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted", "id": id})
+}
+
+// ImportRequest is the JSON body of POST /knowledge/import naming a
+// directory, relative to the import directory, to ingest.
+type ImportRequest struct {
+	Directory string `json:"directory"`
+}
+
+// ImportKnowledge ingests a multipart "file" upload (a .zip, .tar, .tar.gz
+// or .tgz archive, or a single document) or a directory named in the body,
+// and reports the outcome of every file. Unchanged documents are not
+// re-embedded, and documents an earlier import of the same directory or
+// upload name stored but the files no longer hold are deleted. With
+// dry_run=true the report is the plan and nothing changes.
+func (kh *KnowledgeHandler) ImportKnowledge(c *gin.Context) {
+	var opts ingest.Options
+	if v := c.Query("dry_run"); v != "" {
+		var err error
+		if opts.DryRun, err = strconv.ParseBool(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run must be true or false"})
+			return
+		}
+	}
+
+	var fsys fs.FS
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportUpload)
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file upload is required: " + err.Error()})
+			return
+		}
+		f, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+		if fsys, err = ingest.OpenUpload(header.Filename, f, header.Size); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		opts.Root = "upload:" + filepath.Base(header.Filename)
+	} else {
+		var req ImportRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		dir, err := kh.importPath(req.Directory)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "directory " + req.Directory + " not found"})
+			return
+		}
+		fsys = os.DirFS(dir)
+		opts.Root = "dir:" + filepath.ToSlash(filepath.Clean(req.Directory))
+	}
+
+	report, err := kh.ingester.Ingest(c.Request.Context(), fsys, opts)
+	if err != nil {
+		knowledgeError(c, err, "import")
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// importPath resolves a requested directory inside the import directory.
+func (kh *KnowledgeHandler) importPath(dir string) (string, error) {
+	if kh.importDir == "" {
+		return "", errors.New("directory imports are disabled")
+	}
+	if dir == "" {
+		dir = "."
+	}
+	if !filepath.IsLocal(dir) {
+		return "", errors.New("directory must be a relative path inside the import directory")
+	}
+	return filepath.Join(kh.importDir, dir), nil
+}
+
+// knowledgeError maps knowledge base errors to HTTP responses. what names
+// the document for not-found messages.
+func knowledgeError(c *gin.Context, err error, what string) {
+	switch {
+	case errors.Is(err, rag.ErrDocumentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": what + " not found"})
+	case errors.Is(err, rag.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Knowledge operation on %s failed: %v", what, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Knowledge base operation failed"})
+	}
+}
@@ -0,0 +1,177 @@
+// internal/handlers/registry.go
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"agricultural-iot-rag/internal/models"
+	"agricultural-iot-rag/internal/services"
+	"agricultural-iot-rag/internal/storage"
+)
+
+type RegistryHandler struct {
+	registryService *services.RegistryService
+}
+
+func NewRegistryHandler(registryService *services.RegistryService) *RegistryHandler {
+	return &RegistryHandler{
+		registryService: registryService,
+	}
+}
+
+func (rh *RegistryHandler) CreateField(c *gin.Context) {
+	var field models.Field
+	if err := c.ShouldBindJSON(&field); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := rh.registryService.CreateField(c.Request.Context(), &field); err != nil {
+		registryError(c, err, "field "+field.ID)
+		return
+	}
+	c.JSON(http.StatusCreated, field)
+}
+
+func (rh *RegistryHandler) ListFields(c *gin.Context) {
+	filter := storage.FieldFilter{CropType: c.Query("crop_type")}
+	if v := c.Query("include_retired"); v != "" {
+		include, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "include_retired must be a boolean"})
+			return
+		}
+		filter.IncludeRetired = include
+	}
+
+	fields, err := rh.registryService.ListFields(c.Request.Context(), filter)
+	if err != nil {
+		registryError(c, err, "fields")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"fields": fields, "count": len(fields)})
+}
+
+func (rh *RegistryHandler) GetField(c *gin.Context) {
+	id := c.Param("field_id")
+	field, err := rh.registryService.GetField(c.Request.Context(), id)
+	if err != nil {
+		registryError(c, err, "field "+id)
+		return
+	}
+	c.JSON(http.StatusOK, field)
+}
+
+func (rh *RegistryHandler) UpdateField(c *gin.Context) {
+	var update models.FieldUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := c.Param("field_id")
+	field, err := rh.registryService.UpdateField(c.Request.Context(), id, update)
+	if err != nil {
+		registryError(c, err, "field "+id)
+		return
+	}
+	c.JSON(http.StatusOK, field)
+}
+
+// RetireField soft-deletes a field; its readings and alerts are kept.
+func (rh *RegistryHandler) RetireField(c *gin.Context) {
+	id := c.Param("field_id")
+	if err := rh.registryService.RetireField(c.Request.Context(), id); err != nil {
+		registryError(c, err, "field "+id)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "retired", "id": id})
+}
+
+func (rh *RegistryHandler) CreateDevice(c *gin.Context) {
+	var device models.Device
+	if err := c.ShouldBindJSON(&device); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := rh.registryService.CreateDevice(c.Request.Context(), &device); err != nil {
+		registryError(c, err, "device "+device.ID)
+		return
+	}
+	c.JSON(http.StatusCreated, device)
+}
+
+func (rh *RegistryHandler) ListDevices(c *gin.Context) {
+	filter := storage.DeviceFilter{
+		FieldID: c.Query("field_id"),
+		Status:  c.Query("status"),
+	}
+
+	devices, err := rh.registryService.ListDevices(c.Request.Context(), filter)
+	if err != nil {
+		registryError(c, err, "devices")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"devices": devices, "count": len(devices)})
+}
+
+func (rh *RegistryHandler) GetDevice(c *gin.Context) {
+	id := c.Param("device_id")
+	device, err := rh.registryService.GetDevice(c.Request.Context(), id)
+	if err != nil {
+		registryError(c, err, "device "+id)
+		return
+	}
+	c.JSON(http.StatusOK, device)
+}
+
+func (rh *RegistryHandler) UpdateDevice(c *gin.Context) {
+	var update models.DeviceUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := c.Param("device_id")
+	device, err := rh.registryService.UpdateDevice(c.Request.Context(), id, update)
+	if err != nil {
+		registryError(c, err, "device "+id)
+		return
+	}
+	c.JSON(http.StatusOK, device)
+}
+
+// RetireDevice marks a device as retired; further readings from it are
+// rejected.
+func (rh *RegistryHandler) RetireDevice(c *gin.Context) {
+	id := c.Param("device_id")
+	if err := rh.registryService.RetireDevice(c.Request.Context(), id); err != nil {
+		registryError(c, err, "device "+id)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "retired", "id": id})
+}
+
+// registryError maps registry errors to HTTP responses. what names the
+// record for not-found and conflict messages.
+func registryError(c *gin.Context, err error, what string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, storage.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": what + " not found"})
+	case errors.Is(err, storage.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": what + " already exists"})
+	case errors.Is(err, services.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrRegistryUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Registry operation failed"})
+	}
+}
@@ -2,69 +2,124 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"agricultural-iot-rag/internal/models"
+	"agricultural-iot-rag/internal/services"
+	"agricultural-iot-rag/internal/storage"
 )
 
 type SensorHandler struct {
-	// You can add storage/database connections here
+	sensorService *services.SensorService
 }
 
-func NewSensorHandler() *SensorHandler {
-	return &SensorHandler{}
+func NewSensorHandler(sensorService *services.SensorService) *SensorHandler {
+	return &SensorHandler{
+		sensorService: sensorService,
+	}
 }
 
 func (sh *SensorHandler) GetSensorData(c *gin.Context) {
 	fieldID := c.Param("field_id")
 
-	// Mock data for demonstration
-	// In production, fetch from time-series database
-	reading := models.SensorReading{
-		ID:        "reading_001",
-		DeviceID:  "device_" + fieldID,
-		Timestamp: time.Now(),
-		Location: models.Location{
-			Latitude:  40.7128,
-			Longitude: -74.0060,
-			FieldID:   fieldID,
-			CropType:  "potato",
-		},
-		Measurements: map[string]models.Measurement{
-			"soil_moisture": {
-				Value:   45.5,
-				Unit:    "%",
-				Quality: "good",
-			},
-			"soil_temperature": {
-				Value:   22.3,
-				Unit:    "°C",
-				Quality: "good",
-			},
-			"air_temperature": {
-				Value:   25.1,
-				Unit:    "°C",
-				Quality: "good",
-			},
-			"humidity": {
-				Value:   65.0,
-				Unit:    "%",
-				Quality: "good",
-			},
-		},
-		DeviceStatus: models.DeviceStatus{
-			BatteryLevel:    85,
-			SignalStrength:  -65,
-			LastCalibration: time.Now().Add(-24 * time.Hour),
-		},
+	reading, err := sh.sensorService.LatestReading(c.Request.Context(), fieldID)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No sensor data found for field " + fieldID})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sensor data"})
+		return
 	}
 
 	c.JSON(http.StatusOK, reading)
 }
 
+// GetSensorHistory returns bucketed history for one measurement of a field.
+// Long ranges are paged; repeat the request with from=next_from to continue.
+func (sh *SensorHandler) GetSensorHistory(c *gin.Context) {
+	now := time.Now().UTC()
+	q := storage.HistoryQuery{
+		FieldID:     c.Param("field_id"),
+		Measurement: c.Query("measurement"),
+		From:        now.Add(-24 * time.Hour),
+		To:          now,
+		Window:      time.Hour,
+		Agg:         c.DefaultQuery("agg", storage.AggMean),
+	}
+
+	var err error
+	if v := c.Query("to"); v != "" {
+		if q.To, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC3339 timestamp"})
+			return
+		}
+		q.From = q.To.Add(-24 * time.Hour)
+	}
+	if v := c.Query("from"); v != "" {
+		if q.From, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC3339 timestamp"})
+			return
+		}
+	}
+	if v := c.Query("window"); v != "" {
+		if q.Window, err = parseWindow(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+	}
+
+	page, err := sh.sensorService.History(c.Request.Context(), q)
+	if errors.Is(err, storage.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sensor history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"field_id":    q.FieldID,
+		"measurement": q.Measurement,
+		"window":      q.Window.String(),
+		"agg":         q.Agg,
+		"from":        page.From,
+		"to":          page.To,
+		"series":      page.Series,
+		"next_from":   page.NextFrom,
+	})
+}
+
+// parseWindow accepts Go durations plus a "d" suffix for whole days.
+func parseWindow(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("invalid window %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid window %q", s)
+	}
+	return d, nil
+}
+
 func (sh *SensorHandler) ReceiveSensorData(c *gin.Context) {
 	var reading models.SensorReading
 	if err := c.ShouldBindJSON(&reading); err != nil {
@@ -72,8 +127,26 @@ func (sh *SensorHandler) ReceiveSensorData(c *gin.Context) {
 		return
 	}
 
-	// In production, save to time-series database
-	// For now, just acknowledge receipt
+	err := sh.sensorService.Ingest(c.Request.Context(), &reading)
+	switch {
+	case errors.Is(err, services.ErrReadingQuarantined):
+		c.JSON(http.StatusAccepted, gin.H{
+			"status":  "quarantined",
+			"message": "Device is not registered; reading held for review",
+			"id":      reading.ID,
+		})
+		return
+	case errors.Is(err, services.ErrInvalidReading):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrUnregisteredDevice):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store sensor data"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "received",
 		"message": "Sensor data processed successfully",
@@ -81,17 +154,29 @@ func (sh *SensorHandler) ReceiveSensorData(c *gin.Context) {
 	})
 }
 
+// defaultActiveWindow is how recently a sensor must have reported to count
+// as active in field statistics.
+const defaultActiveWindow = 15 * time.Minute
+
 func (sh *SensorHandler) GetFieldsStats(c *gin.Context) {
-	// Mock statistics for demonstration
-	stats := gin.H{
-		"total_fields": 10,
-		"active_sensors": 25,
-		"alerts": []string{
-			"Field 3: Low soil moisture detected",
-			"Field 7: High temperature alert",
-		},
-		"avg_soil_moisture": 48.5,
-		"avg_temperature":   23.2,
+	window := defaultActiveWindow
+	if v := c.Query("active_minutes"); v != "" {
+		minutes, err := strconv.Atoi(v)
+		if err != nil || minutes <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "active_minutes must be a positive integer"})
+			return
+		}
+		window = time.Duration(minutes) * time.Minute
+	}
+
+	stats, err := sh.sensorService.FleetStats(c.Request.Context(), c.Query("crop_type"), window)
+	if errors.Is(err, services.ErrRegistryUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute field statistics"})
+		return
 	}
 
 	c.JSON(http.StatusOK, stats)
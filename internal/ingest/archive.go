@@ -0,0 +1,94 @@
+// internal/ingest/archive.go
+package ingest
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// ErrUnsupportedUpload is returned for uploads that are neither an archive
+// nor a supported document, or that are too large once decompressed.
+var ErrUnsupportedUpload = errors.New("unsupported upload")
+
+// MaxArchiveSize is the most the files of an archive may add up to once
+// decompressed, so a small compressed upload cannot exhaust memory.
+const MaxArchiveSize = 256 << 20
+
+// OpenUpload returns the files of an uploaded file named name, read from r
+// of the given size: the contents of a .zip, .tar, .tar.gz or .tgz
+// archive, or the file itself when it is a supported document. Zip
+// archives are read from r as they are walked, so r must stay open until
+// the files have been ingested.
+func OpenUpload(name string, r io.ReaderAt, size int64) (fs.FS, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid zip archive: %v", ErrUnsupportedUpload, err)
+		}
+		// Entries cannot decompress to more than their recorded size.
+		var total uint64
+		for _, f := range zr.File {
+			if total += f.UncompressedSize64; total > MaxArchiveSize {
+				return nil, archiveTooLarge()
+			}
+		}
+		return zr, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		gz, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid gzip archive: %v", ErrUnsupportedUpload, err)
+		}
+		return tarFS(gz)
+	case strings.HasSuffix(lower, ".tar"):
+		return tarFS(io.NewSectionReader(r, 0, size))
+	case Supported(name):
+		fsys := memFS{}
+		if err := fsys.add(path.Base(name), io.NewSectionReader(r, 0, size), size); err != nil {
+			return nil, err
+		}
+		return fsys, nil
+	}
+	return nil, fmt.Errorf("%w: %s is not an archive or a supported document", ErrUnsupportedUpload, name)
+}
+
+// tarFS reads the regular files of a tar archive. Entries with paths
+// outside the archive are left out.
+func tarFS(r io.Reader) (fs.FS, error) {
+	fsys := memFS{}
+	var total int64
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid tar archive: %v", ErrUnsupportedUpload, err)
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if hdr.Typeflag != tar.TypeReg || !fs.ValidPath(name) {
+			continue
+		}
+		// Files too large to ingest are decompressed to skip them too.
+		if total += hdr.Size; total > MaxArchiveSize {
+			return nil, archiveTooLarge()
+		}
+		if err := fsys.add(name, tr, hdr.Size); err != nil {
+			return nil, err
+		}
+	}
+	return fsys, nil
+}
+
+func archiveTooLarge() error {
+	return fmt.Errorf("%w: archive holds more than %d bytes once decompressed", ErrUnsupportedUpload, MaxArchiveSize)
+}
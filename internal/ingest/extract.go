@@ -0,0 +1,216 @@
+// internal/ingest/extract.go
+package ingest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+	"gopkg.in/yaml.v3"
+)
+
+// errUnsupported marks files of a type that is not ingested.
+var errUnsupported = errors.New("unsupported file type")
+
+// Document is a knowledge document extracted from a file.
+type Document struct {
+	ID       string
+	Text     string
+	Metadata map[string]interface{}
+}
+
+// Supported reports whether files named name are ingested.
+func Supported(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".markdown", ".txt", ".csv", ".pdf":
+		return true
+	}
+	return false
+}
+
+// extract reads the documents in a file. Markdown and text files hold one
+// document whose ID is the file's path without its extension; YAML front
+// matter supplies metadata, and an id or title in it is used as such. Each
+// CSV row is a document: the content or text column holds its text, an id
+// column its ID (the path and row number otherwise), and the other columns
+// become metadata, typed as numbers, booleans or dates where they parse as
+// one; dates in front matter are typed the same way.
+// PDFs hold one document of their plain text. Every document records its
+// file as source.
+func extract(name string, data []byte) ([]Document, error) {
+	id := strings.TrimSuffix(name, path.Ext(name))
+	var docs []Document
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".markdown", ".txt":
+		meta, body, err := frontMatter(data)
+		if err != nil {
+			return nil, err
+		}
+		doc := Document{ID: id, Text: string(body), Metadata: meta}
+		if v, ok := meta["id"]; ok {
+			doc.ID = fmt.Sprint(v)
+			delete(meta, "id")
+		}
+		docs = append(docs, doc)
+	case ".csv":
+		rows, err := csvDocuments(id, data)
+		if err != nil {
+			return nil, err
+		}
+		docs = rows
+	case ".pdf":
+		text, err := pdfText(data)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, Document{ID: id, Text: text, Metadata: map[string]interface{}{}})
+	default:
+		return nil, errUnsupported
+	}
+
+	for i := range docs {
+		docs[i].Metadata[MetadataSource] = name
+	}
+	return docs, nil
+}
+
+// frontMatter splits a leading "---" delimited YAML block from data.
+func frontMatter(data []byte) (map[string]interface{}, []byte, error) {
+	meta := map[string]interface{}{}
+	data = bytes.TrimPrefix(data, []byte("\uFEFF"))
+	if !bytes.HasPrefix(data, []byte("---\n")) && !bytes.HasPrefix(data, []byte("---\r\n")) {
+		return meta, data, nil
+	}
+	rest := data[bytes.IndexByte(data, '\n')+1:]
+	for off := 0; off < len(rest); {
+		end := bytes.IndexByte(rest[off:], '\n')
+		if end < 0 {
+			end = len(rest)
+		} else {
+			end += off + 1
+		}
+		if line := bytes.TrimRight(rest[off:end], "\r\n"); string(line) == "---" || string(line) == "..." {
+			if err := yaml.Unmarshal(rest[:off], &meta); err != nil {
+				return nil, nil, fmt.Errorf("invalid front matter: %w", err)
+			}
+			if meta == nil {
+				meta = map[string]interface{}{}
+			}
+			for k, v := range meta {
+				if s, ok := v.(string); ok {
+					meta[k] = dateValue(s)
+				}
+			}
+			return meta, rest[end:], nil
+		}
+		off = end
+	}
+	return nil, nil, errors.New("front matter is not closed")
+}
+
+func csvDocuments(id string, data []byte) ([]Document, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	content, idCol := -1, -1
+	for i, h := range header {
+		header[i] = strings.TrimSpace(h)
+		switch strings.ToLower(header[i]) {
+		case "content", "text":
+			if content < 0 {
+				content = i
+			}
+		case "id":
+			idCol = i
+		}
+	}
+	if content < 0 {
+		return nil, errors.New("CSV has no content or text column")
+	}
+
+	var docs []Document
+	for row := 1; ; row++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if content >= len(record) || strings.TrimSpace(record[content]) == "" {
+			continue
+		}
+		doc := Document{ID: fmt.Sprintf("%s#%d", id, row), Text: record[content], Metadata: map[string]interface{}{}}
+		for i, v := range record {
+			v = strings.TrimSpace(v)
+			switch {
+			case i == content || i >= len(header) || header[i] == "" || v == "":
+			case i == idCol:
+				doc.ID = v
+			default:
+				doc.Metadata[header[i]] = cellValue(v)
+			}
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// cellValue types a CSV cell like a filter literal: integers, floats,
+// booleans and dates parse as such, anything else stays a string.
+func cellValue(v string) interface{} {
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f
+	}
+	if b, err := strconv.ParseBool(v); err == nil && (strings.EqualFold(v, "true") || strings.EqualFold(v, "false")) {
+		return b
+	}
+	return dateValue(v)
+}
+
+// dateValue returns YYYY-MM-DD and RFC 3339 strings as times, so they are
+// stored as dates filters can compare, and other strings unchanged.
+func dateValue(v string) interface{} {
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t
+	}
+	return v
+}
+
+func pdfText(data []byte) (text string, err error) {
+	// The PDF reader panics on some malformed files.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid PDF: %v", r)
+		}
+	}()
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("invalid PDF: %w", err)
+	}
+	plain, err := r.GetPlainText()
+	if err != nil {
+		return "", fmt.Errorf("failed to extract PDF text: %w", err)
+	}
+	b, err := io.ReadAll(plain)
+	if err != nil {
+		return "", fmt.Errorf("failed to extract PDF text: %w", err)
+	}
+	return string(b), nil
+}
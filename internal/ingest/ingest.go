@@ -0,0 +1,317 @@
+// internal/ingest/ingest.go
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"agricultural-iot-rag/internal/services"
+	"agricultural-iot-rag/pkg/rag"
+)
+
+// MaxFileSize is the largest file ingested; bigger files are skipped.
+const MaxFileSize = 32 << 20
+
+// flushDocuments is how many documents are gathered, across files, before
+// they are embedded and stored together.
+const flushDocuments = 64
+
+// Metadata keys every ingested document records: the file it came from,
+// relative to the root it was ingested from, and that root.
+const (
+	MetadataSource = "source"
+	MetadataRoot   = "source_root"
+)
+
+// File outcomes. A file is added when none of its documents were stored
+// before, updated when some were stored but changed, and unchanged when
+// all of them are stored as they are.
+const (
+	StatusAdded     = "added"
+	StatusUpdated   = "updated"
+	StatusUnchanged = "unchanged"
+	StatusSkipped   = "skipped"
+	StatusFailed    = "failed"
+)
+
+// Options control an ingestion.
+type Options struct {
+	// Root names where the files come from, such as a directory or an
+	// archive's name. Stored documents ingested from the same Root that
+	// the files no longer hold are deleted; "" keeps them.
+	Root string
+	// DryRun reports what would be added, updated and deleted without
+	// changing the knowledge base.
+	DryRun bool
+}
+
+// FileResult reports what became of one file: the IDs of its documents
+// that were added, updated (re-embedded because they changed) and left
+// unchanged. Reason says why it was skipped and Error why it failed.
+type FileResult struct {
+	Path      string   `json:"path"`
+	Status    string   `json:"status"`
+	Added     []string `json:"added,omitempty"`
+	Updated   []string `json:"updated,omitempty"`
+	Unchanged []string `json:"unchanged,omitempty"`
+	Chunks    int      `json:"chunks,omitempty"`
+	Reason    string   `json:"reason,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// Report lists every file considered, in walk order, with counts per
+// status, and the documents deleted because their files are gone. In a
+// dry run it is the plan: nothing was stored or deleted.
+type Report struct {
+	DryRun    bool         `json:"dry_run,omitempty"`
+	Files     []FileResult `json:"files"`
+	Deleted   []string     `json:"deleted,omitempty"`
+	Added     int          `json:"added"`
+	Updated   int          `json:"updated"`
+	Unchanged int          `json:"unchanged"`
+	Skipped   int          `json:"skipped"`
+	Failed    int          `json:"failed"`
+}
+
+func (r *Report) count() {
+	r.Added, r.Updated, r.Unchanged, r.Skipped, r.Failed = 0, 0, 0, 0, 0
+	for _, f := range r.Files {
+		switch f.Status {
+		case StatusAdded:
+			r.Added++
+		case StatusUpdated:
+			r.Updated++
+		case StatusUnchanged:
+			r.Unchanged++
+		case StatusSkipped:
+			r.Skipped++
+		case StatusFailed:
+			r.Failed++
+		}
+	}
+}
+
+// Ingester loads files into the knowledge base.
+type Ingester struct {
+	knowledge *services.KnowledgeService
+}
+
+func NewIngester(knowledge *services.KnowledgeService) *Ingester {
+	return &Ingester{knowledge: knowledge}
+}
+
+// Ingest brings the knowledge base in line with the supported files in
+// fsys. Documents not stored yet are added; stored ones are re-embedded
+// only if their content, metadata, chunking or embedding model changed.
+// With opts.Root set, documents ingested earlier from that root whose
+// files are gone, or no longer hold them, are deleted. Hidden files and
+// directories are ignored. Files that cannot be read or stored fail on
+// their own and keep their stored documents; the error is only for
+// walking fsys, reading the stored versions or a cancelled ctx.
+func (in *Ingester) Ingest(ctx context.Context, fsys fs.FS, opts Options) (*Report, error) {
+	stored, err := in.knowledge.KnowledgeVersions(ctx, nil, MetadataSource, MetadataRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stored documents: %w", err)
+	}
+	versions := make(map[string]services.KnowledgeVersion, len(stored))
+	for _, v := range stored {
+		versions[v.ID] = v.KnowledgeVersion
+	}
+
+	report := &Report{DryRun: opts.DryRun}
+	seen := map[string]string{} // document ID -> file it came from
+	kept := map[string]bool{}   // files whose stored documents stay
+
+	// Changed documents are gathered from several files and stored
+	// together so their texts share embedding requests; the files' results
+	// are completed once they are stored.
+	type pendingFile struct {
+		index int
+		docs  []Document
+	}
+	var pending []pendingFile
+	pendingDocs := 0
+	flush := func() {
+		var inputs []services.KnowledgeInput
+		for _, p := range pending {
+			for _, d := range p.docs {
+				inputs = append(inputs, services.KnowledgeInput{ID: d.ID, Text: d.Text, Metadata: d.Metadata})
+			}
+		}
+		added := in.knowledge.AddKnowledgeBatch(ctx, inputs)
+		for _, p := range pending {
+			res := &report.Files[p.index]
+			var errs []string
+			for _, d := range p.docs {
+				a := added[0]
+				added = added[1:]
+				if a.Err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %v", d.ID, a.Err))
+					res.Added, res.Updated = remove(res.Added, d.ID), remove(res.Updated, d.ID)
+					continue
+				}
+				res.Chunks += a.Chunks
+			}
+			if len(errs) > 0 {
+				res.Status = StatusFailed
+				res.Error = strings.Join(errs, "; ")
+			}
+		}
+		pending, pendingDocs = nil, 0
+	}
+
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if name == "." {
+				return err
+			}
+			report.Files = append(report.Files, FileResult{Path: name, Status: StatusFailed, Error: err.Error()})
+			kept[name] = true
+			return nil
+		}
+		if name != "." && strings.HasPrefix(path.Base(name), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		docs, res := readFile(fsys, name, d, seen)
+		if res.Status != "" {
+			report.Files = append(report.Files, res)
+			kept[name] = true
+			return nil
+		}
+
+		var changed []Document
+		for _, doc := range docs {
+			seen[doc.ID] = name
+			if opts.Root != "" {
+				doc.Metadata[MetadataRoot] = opts.Root
+			}
+			old, ok := versions[doc.ID]
+			switch {
+			case !ok:
+				res.Added = append(res.Added, doc.ID)
+			case old != in.knowledge.Version(services.KnowledgeInput{ID: doc.ID, Text: doc.Text, Metadata: doc.Metadata}):
+				res.Updated = append(res.Updated, doc.ID)
+			default:
+				res.Unchanged = append(res.Unchanged, doc.ID)
+				continue
+			}
+			changed = append(changed, doc)
+		}
+		switch {
+		case len(changed) == 0:
+			res.Status = StatusUnchanged
+		case len(res.Updated) > 0 || len(res.Unchanged) > 0:
+			res.Status = StatusUpdated
+		default:
+			res.Status = StatusAdded
+		}
+		report.Files = append(report.Files, res)
+
+		if opts.DryRun || len(changed) == 0 {
+			return nil
+		}
+		pending = append(pending, pendingFile{index: len(report.Files) - 1, docs: changed})
+		if pendingDocs += len(changed); pendingDocs >= flushDocuments {
+			flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	flush()
+
+	if opts.Root != "" {
+		for _, v := range stored {
+			source, _ := v.Metadata[MetadataSource].(string)
+			if v.Metadata[MetadataRoot] != opts.Root || seen[v.ID] != "" || kept[source] {
+				continue
+			}
+			if !opts.DryRun {
+				if err := in.knowledge.DeleteKnowledge(ctx, v.ID); err != nil && !errors.Is(err, rag.ErrDocumentNotFound) {
+					report.Files = append(report.Files, FileResult{Path: source, Status: StatusFailed, Error: fmt.Sprintf("failed to delete %s: %v", v.ID, err)})
+					continue
+				}
+			}
+			report.Deleted = append(report.Deleted, v.ID)
+		}
+		sort.Strings(report.Deleted)
+	}
+	report.count()
+	return report, nil
+}
+
+func remove(ids []string, id string) []string {
+	for i, v := range ids {
+		if v == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
+
+// readFile extracts the documents of one file. A result with a status means
+// the file is skipped or failed before anything is stored.
+func readFile(fsys fs.FS, name string, d fs.DirEntry, seen map[string]string) ([]Document, FileResult) {
+	res := FileResult{Path: name}
+	if !Supported(name) {
+		res.Status, res.Reason = StatusSkipped, errUnsupported.Error()
+		return nil, res
+	}
+	info, err := d.Info()
+	if err != nil {
+		res.Status, res.Error = StatusFailed, err.Error()
+		return nil, res
+	}
+	if info.Size() > MaxFileSize {
+		res.Status, res.Reason = StatusSkipped, fmt.Sprintf("file is larger than %d bytes", MaxFileSize)
+		return nil, res
+	}
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		res.Status, res.Error = StatusFailed, err.Error()
+		return nil, res
+	}
+	docs, err := extract(name, data)
+	if err != nil {
+		res.Status, res.Error = StatusFailed, err.Error()
+		return nil, res
+	}
+
+	var kept []Document
+	ids := map[string]bool{}
+	for _, doc := range docs {
+		if strings.TrimSpace(doc.Text) == "" {
+			continue
+		}
+		if from, ok := seen[doc.ID]; ok || ids[doc.ID] {
+			if !ok {
+				from = name
+			}
+			res.Status, res.Error = StatusFailed, fmt.Sprintf("document ID %q is also used by %s", doc.ID, from)
+			return nil, res
+		}
+		ids[doc.ID] = true
+		kept = append(kept, doc)
+	}
+	if len(kept) == 0 {
+		res.Status, res.Reason = StatusSkipped, "no text"
+		return nil, res
+	}
+	return kept, res
+}
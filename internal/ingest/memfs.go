@@ -0,0 +1,162 @@
+// internal/ingest/memfs.go
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+// memFS serves files extracted from an upload from memory, keyed by their
+// slash-separated path. Directories are implied by the paths.
+type memFS map[string]*memFile
+
+// memFile is the content of a file. Files larger than MaxFileSize keep only
+// their size, which is enough for them to be skipped.
+type memFile struct {
+	data []byte
+	size int64
+}
+
+// add reads the file name, of the given size, from r.
+func (m memFS) add(name string, r io.Reader, size int64) error {
+	if size > MaxFileSize {
+		m[name] = &memFile{size: size}
+		return nil
+	}
+	data, err := io.ReadAll(io.LimitReader(r, MaxFileSize))
+	if err != nil {
+		return fmt.Errorf("%w: reading %s: %v", ErrUnsupportedUpload, name, err)
+	}
+	m[name] = &memFile{data: data, size: int64(len(data))}
+	return nil
+}
+
+func (m memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if f, ok := m[name]; ok {
+		return &openFile{info: fileInfo{name: baseName(name), size: f.size}, file: f, r: bytes.NewReader(f.data)}, nil
+	}
+	entries, ok := m.children(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &openDir{info: fileInfo{name: baseName(name), dir: true}, entries: entries}, nil
+}
+
+func (m memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries, ok := m.children(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return entries, nil
+}
+
+// children lists the entries of directory dir in name order, reporting
+// whether dir exists.
+func (m memFS) children(dir string) ([]fs.DirEntry, bool) {
+	prefix := dir + "/"
+	if dir == "." {
+		prefix = ""
+	}
+	found := dir == "."
+	dirs := map[string]bool{}
+	var entries []fs.DirEntry
+	for name, f := range m {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		found = true
+		rest := name[len(prefix):]
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			if sub := rest[:i]; !dirs[sub] {
+				dirs[sub] = true
+				entries = append(entries, fileInfo{name: sub, dir: true})
+			}
+			continue
+		}
+		entries = append(entries, fileInfo{name: rest, size: f.size})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, found
+}
+
+func baseName(name string) string {
+	return name[strings.LastIndexByte(name, '/')+1:]
+}
+
+// fileInfo describes a memFS file or directory, as both fs.FileInfo and
+// fs.DirEntry.
+type fileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fileInfo) IsDir() bool        { return fi.dir }
+func (fi fileInfo) Sys() interface{}   { return nil }
+
+func (fi fileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+func (fi fileInfo) Type() fs.FileMode          { return fi.Mode().Type() }
+func (fi fileInfo) Info() (fs.FileInfo, error) { return fi, nil }
+
+type openFile struct {
+	info fileInfo
+	file *memFile
+	r    *bytes.Reader
+}
+
+func (f *openFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *openFile) Close() error               { return nil }
+
+func (f *openFile) Read(p []byte) (int, error) {
+	if f.file.data == nil && f.file.size > 0 {
+		return 0, fmt.Errorf("%s is larger than %d bytes", f.info.name, MaxFileSize)
+	}
+	return f.r.Read(p)
+}
+
+type openDir struct {
+	info    fileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *openDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *openDir) Close() error               { return nil }
+
+func (d *openDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *openDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(rest))
+	d.offset += n
+	return rest[:n], nil
+}
@@ -40,6 +40,22 @@ var (
 		},
 	)
 
+	AlertsTriggered = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alerts_triggered_total",
+			Help: "Total number of alerts raised by alert rules",
+		},
+		[]string{"severity"},
+	)
+
+	NotificationsSent = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alert_notifications_total",
+			Help: "Alert notification delivery attempts by channel and result",
+		},
+		[]string{"channel", "result"},
+	)
+
 	APIRequestsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "api_requests_total",
@@ -0,0 +1,105 @@
+// internal/models/alert.go
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Alert severities.
+const (
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// Lifecycle states of an alert. An unresolved alert is snoozed while its
+// snooze runs, otherwise acknowledged once someone has acknowledged it, and
+// open until then.
+const (
+	AlertStateOpen         = "open"
+	AlertStateAcknowledged = "acknowledged"
+	AlertStateSnoozed      = "snoozed"
+	AlertStateResolved     = "resolved"
+)
+
+// Actions recorded in an alert's audit trail.
+const (
+	AlertActionAcknowledge = "acknowledge"
+	AlertActionResolve     = "resolve"
+	AlertActionSnooze      = "snooze"
+)
+
+type Alert struct {
+	ID        int64  `json:"id"`
+	FieldID   string `json:"field_id"`
+	AlertType string `json:"alert_type"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+	// RuleID and Value are set on alerts raised by the rule engine.
+	RuleID         *int64     `json:"rule_id,omitempty"`
+	Value          *float64   `json:"value,omitempty"`
+	State          string     `json:"state"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string     `json:"acknowledged_by,omitempty"`
+	SnoozedUntil   *time.Time `json:"snoozed_until,omitempty"`
+	Resolved       bool       `json:"resolved"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	// Events is the audit trail, included when a single alert is fetched.
+	Events []AlertEvent `json:"events,omitempty"`
+}
+
+// StateAt derives the lifecycle state of a at the given time.
+func (a *Alert) StateAt(now time.Time) string {
+	switch {
+	case a.Resolved:
+		return AlertStateResolved
+	case a.SnoozedUntil != nil && a.SnoozedUntil.After(now):
+		return AlertStateSnoozed
+	case a.AcknowledgedAt != nil:
+		return AlertStateAcknowledged
+	}
+	return AlertStateOpen
+}
+
+// AlertEvent records one transition of an alert.
+type AlertEvent struct {
+	ID           int64      `json:"id"`
+	AlertID      int64      `json:"alert_id"`
+	Action       string     `json:"action"`
+	Actor        string     `json:"actor"`
+	Note         string     `json:"note,omitempty"`
+	SnoozedUntil *time.Time `json:"snoozed_until,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// AlertRule raises alerts when readings match Expression, e.g.
+// "soil_moisture < 30 for 2h on crop=potato".
+type AlertRule struct {
+	ID         int64   `json:"id"`
+	Name       string  `json:"name"`
+	Expression string  `json:"expression"`
+	Severity   string  `json:"severity"`
+	Hysteresis float64 `json:"hysteresis"`
+	// DebounceMinutes is the quiet period after an alert resolves before
+	// the rule can fire again for the same field.
+	DebounceMinutes int       `json:"debounce_minutes"`
+	Enabled         bool      `json:"enabled"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// DeadLetter is a notification that could not be delivered.
+type DeadLetter struct {
+	ID       int64           `json:"id"`
+	AlertID  int64           `json:"alert_id"`
+	Channel  string          `json:"channel"`
+	Event    string          `json:"event"`
+	Payload  json.RawMessage `json:"payload"`
+	Error    string          `json:"error"`
+	Attempts int             `json:"attempts"`
+	// CreatedAt is when delivery was abandoned.
+	CreatedAt time.Time `json:"created_at"`
+}
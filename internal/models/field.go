@@ -0,0 +1,50 @@
+// internal/models/field.go
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Device statuses stored in devices.status.
+const (
+	DeviceStatusActive      = "active"
+	DeviceStatusInactive    = "inactive"
+	DeviceStatusQuarantined = "quarantined"
+	DeviceStatusRetired     = "retired"
+)
+
+type Field struct {
+	ID           string          `json:"id"`
+	Name         string          `json:"name"`
+	CropType     string          `json:"crop_type,omitempty"`
+	AreaHectares *float64        `json:"area_hectares,omitempty"`
+	Location     json.RawMessage `json:"location,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+	RetiredAt    *time.Time      `json:"retired_at,omitempty"`
+}
+
+// FieldUpdate is a partial update; nil members are left unchanged.
+type FieldUpdate struct {
+	Name         *string         `json:"name"`
+	CropType     *string         `json:"crop_type"`
+	AreaHectares *float64        `json:"area_hectares"`
+	Location     json.RawMessage `json:"location"`
+}
+
+type Device struct {
+	ID         string     `json:"id"`
+	FieldID    string     `json:"field_id,omitempty"`
+	DeviceType string     `json:"device_type,omitempty"`
+	Status     string     `json:"status"`
+	LastSeen   *time.Time `json:"last_seen,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// DeviceUpdate is a partial update; nil members are left unchanged.
+type DeviceUpdate struct {
+	FieldID    *string `json:"field_id"`
+	DeviceType *string `json:"device_type"`
+	Status     *string `json:"status"`
+}
@@ -0,0 +1,27 @@
+// internal/notify/mqtt.go
+package notify
+
+import "context"
+
+// Publisher publishes a JSON payload to an MQTT topic. iot.MQTTCollector
+// implements it.
+type Publisher interface {
+	Publish(topic string, payload interface{}) error
+}
+
+// MQTTChannel publishes notifications to alerts/<field_id>.
+type MQTTChannel struct {
+	publisher Publisher
+}
+
+func NewMQTTChannel(publisher Publisher) *MQTTChannel {
+	return &MQTTChannel{
+		publisher: publisher,
+	}
+}
+
+func (m *MQTTChannel) Name() string { return "mqtt" }
+
+func (m *MQTTChannel) Send(_ context.Context, n Notification) error {
+	return m.publisher.Publish("alerts/"+n.Alert.FieldID, n)
+}
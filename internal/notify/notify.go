@@ -0,0 +1,283 @@
+// internal/notify/notify.go
+
+// Package notify delivers alert notifications over pluggable channels
+// (webhook, email, MQTT). Deliveries are routed per field, retried with
+// exponential backoff, held during quiet hours and, when every attempt
+// fails, written to a dead-letter table.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"agricultural-iot-rag/internal/metrics"
+	"agricultural-iot-rag/internal/models"
+)
+
+// Notification events.
+const (
+	EventFired    = "fired"
+	EventResolved = "resolved"
+)
+
+// Notification is the payload every channel delivers.
+type Notification struct {
+	Event  string       `json:"event"`
+	Alert  models.Alert `json:"alert"`
+	SentAt time.Time    `json:"sent_at"`
+}
+
+// Subject is a one-line summary used for email subjects.
+func (n Notification) Subject() string {
+	return fmt.Sprintf("[%s] %s on %s %s", n.Alert.Severity, n.Alert.AlertType, n.Alert.FieldID, n.Event)
+}
+
+// Channel delivers notifications to one destination.
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, n Notification) error
+}
+
+// DeadLetterStore records notifications that could not be delivered.
+// storage.Store implements it.
+type DeadLetterStore interface {
+	CreateDeadLetter(ctx context.Context, d *models.DeadLetter) error
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a delivery error that retrying cannot fix, such as a
+// rejected request. The notification goes straight to the dead letters.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Options configure a Notifier. Zero retry settings use the defaults.
+type Options struct {
+	Channels []Channel
+	// Routes select channels per field. With no routes, every alert goes to
+	// every channel.
+	Routes     []Route
+	QuietHours *QuietHours
+	// DeadLetters may be nil, in which case failed notifications are only
+	// logged.
+	DeadLetters DeadLetterStore
+
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// Retry defaults: 5 attempts spaced 2s, 4s, 8s, 16s apart.
+const (
+	DefaultMaxAttempts = 5
+	DefaultBaseDelay   = 2 * time.Second
+	DefaultMaxDelay    = 5 * time.Minute
+
+	sendTimeout = 30 * time.Second
+)
+
+// Notifier fans alerts out to channels in the background.
+type Notifier struct {
+	channels    map[string]Channel
+	routes      []Route
+	quiet       *QuietHours
+	deadLetters DeadLetterStore
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	now         func() time.Time
+
+	// stop aborts waits for quiet hours and backoff; cancel aborts sends
+	// in flight. Close uses both.
+	stop   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// New creates a notifier. Routes naming a channel that is not configured
+// are reported as an error.
+func New(opts Options) (*Notifier, error) {
+	n := &Notifier{
+		channels:    map[string]Channel{},
+		routes:      opts.Routes,
+		quiet:       opts.QuietHours,
+		deadLetters: opts.DeadLetters,
+		maxAttempts: opts.MaxAttempts,
+		baseDelay:   opts.BaseDelay,
+		maxDelay:    opts.MaxDelay,
+		now:         time.Now,
+		stop:        make(chan struct{}),
+	}
+	if n.maxAttempts <= 0 {
+		n.maxAttempts = DefaultMaxAttempts
+	}
+	if n.baseDelay <= 0 {
+		n.baseDelay = DefaultBaseDelay
+	}
+	if n.maxDelay <= 0 {
+		n.maxDelay = DefaultMaxDelay
+	}
+	for _, ch := range opts.Channels {
+		n.channels[ch.Name()] = ch
+	}
+	for _, r := range n.routes {
+		for _, name := range r.Channels {
+			if _, ok := n.channels[name]; !ok {
+				return nil, fmt.Errorf("%w: route for %s uses unconfigured channel %q", ErrInvalidConfig, r.FieldID, name)
+			}
+		}
+	}
+	n.ctx, n.cancel = context.WithCancel(context.Background())
+	return n, nil
+}
+
+// Notify queues an alert event for delivery and returns immediately.
+func (n *Notifier) Notify(alert models.Alert, event string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		log.Printf("Notifier closed, dropping %s notification for alert %d", event, alert.ID)
+		return
+	}
+
+	msg := Notification{Event: event, Alert: alert}
+	for _, name := range n.route(alert) {
+		n.wg.Add(1)
+		go func(ch Channel) {
+			defer n.wg.Done()
+			n.deliver(ch, msg)
+		}(n.channels[name])
+	}
+}
+
+func (n *Notifier) route(alert models.Alert) []string {
+	if len(n.routes) == 0 {
+		names := make([]string, 0, len(n.channels))
+		for name := range n.channels {
+			names = append(names, name)
+		}
+		return names
+	}
+	return channelsFor(n.routes, alert)
+}
+
+// deliver sends msg on ch, waiting out quiet hours for non-critical alerts
+// and retrying failures with exponential backoff.
+func (n *Notifier) deliver(ch Channel, msg Notification) {
+	if n.quiet != nil && msg.Alert.Severity != models.SeverityCritical {
+		if wait := n.quiet.Until(n.now()); wait > 0 {
+			if !n.sleep(wait) {
+				n.deadLetter(ch, msg, 0, errors.New("notifier stopped during quiet hours"))
+				return
+			}
+		}
+	}
+
+	delay := n.baseDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		msg.SentAt = n.now().UTC()
+		ctx, cancel := context.WithTimeout(n.ctx, sendTimeout)
+		err = ch.Send(ctx, msg)
+		cancel()
+		if err == nil {
+			metrics.NotificationsSent.WithLabelValues(ch.Name(), "sent").Inc()
+			return
+		}
+		metrics.NotificationsSent.WithLabelValues(ch.Name(), "failed").Inc()
+
+		var permanent permanentError
+		if attempt >= n.maxAttempts || errors.As(err, &permanent) {
+			n.deadLetter(ch, msg, attempt, err)
+			return
+		}
+		log.Printf("Notification for alert %d via %s failed (attempt %d/%d), retrying in %s: %v",
+			msg.Alert.ID, ch.Name(), attempt, n.maxAttempts, delay, err)
+		if !n.sleep(delay) {
+			n.deadLetter(ch, msg, attempt, fmt.Errorf("notifier stopped before retry: %w", err))
+			return
+		}
+		delay = min(delay*2, n.maxDelay)
+	}
+}
+
+// sleep waits for d, returning false if the notifier is closed first.
+func (n *Notifier) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-n.stop:
+		return false
+	}
+}
+
+func (n *Notifier) deadLetter(ch Channel, msg Notification, attempts int, cause error) {
+	metrics.NotificationsSent.WithLabelValues(ch.Name(), "dead_letter").Inc()
+	log.Printf("Giving up on %s notification for alert %d via %s after %d attempts: %v",
+		msg.Event, msg.Alert.ID, ch.Name(), attempts, cause)
+	if n.deadLetters == nil {
+		return
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Failed to encode dead letter: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = n.deadLetters.CreateDeadLetter(ctx, &models.DeadLetter{
+		AlertID:  msg.Alert.ID,
+		Channel:  ch.Name(),
+		Event:    msg.Event,
+		Payload:  payload,
+		Error:    cause.Error(),
+		Attempts: attempts,
+	})
+	if err != nil {
+		log.Printf("Failed to record dead letter for alert %d: %v", msg.Alert.ID, err)
+	}
+}
+
+// Close stops accepting notifications. Deliveries waiting on quiet hours or
+// a retry are dead-lettered at once; sends in flight get until ctx is done
+// to finish before they are cancelled.
+func (n *Notifier) Close(ctx context.Context) error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil
+	}
+	n.closed = true
+	close(n.stop)
+	n.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		n.cancel()
+		return nil
+	case <-ctx.Done():
+		n.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
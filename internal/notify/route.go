@@ -0,0 +1,172 @@
+// internal/notify/route.go
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"agricultural-iot-rag/internal/models"
+)
+
+// ErrInvalidConfig is returned when routes or quiet hours cannot be parsed.
+var ErrInvalidConfig = errors.New("invalid notification config")
+
+// AnyField is the route field that matches every field.
+const AnyField = "*"
+
+// Route sends alerts on one field (or AnyField) at or above MinSeverity to
+// the named channels.
+type Route struct {
+	FieldID     string
+	MinSeverity string
+	Channels    []string
+}
+
+var severityRank = map[string]int{
+	models.SeverityLow:      1,
+	models.SeverityMedium:   2,
+	models.SeverityHigh:     3,
+	models.SeverityCritical: 4,
+}
+
+// ParseRoutes parses a route list of the form
+//
+//	<field|*>[@<min_severity>]=<channel>[+<channel>...];...
+//
+// for example "field_001=webhook+email;*@high=mqtt".
+func ParseRoutes(s string) ([]Route, error) {
+	var routes []Route
+	for _, spec := range strings.Split(s, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		target, channels, ok := strings.Cut(spec, "=")
+		if !ok || strings.TrimSpace(channels) == "" {
+			return nil, fmt.Errorf("%w: route %q must be <field>=<channels>", ErrInvalidConfig, spec)
+		}
+
+		r := Route{FieldID: strings.TrimSpace(target)}
+		if field, severity, ok := strings.Cut(r.FieldID, "@"); ok {
+			r.FieldID, r.MinSeverity = field, strings.ToLower(severity)
+			if _, known := severityRank[r.MinSeverity]; !known {
+				return nil, fmt.Errorf("%w: unknown severity %q in route %q", ErrInvalidConfig, severity, spec)
+			}
+		}
+		if r.FieldID == "" {
+			return nil, fmt.Errorf("%w: route %q has no field", ErrInvalidConfig, spec)
+		}
+		for _, ch := range strings.Split(channels, "+") {
+			if ch = strings.TrimSpace(ch); ch != "" {
+				r.Channels = append(r.Channels, ch)
+			}
+		}
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
+
+// channelsFor returns the channels an alert should go to. Routes for the
+// alert's own field replace the AnyField routes rather than adding to them,
+// so a field can opt out of the defaults.
+func channelsFor(routes []Route, alert models.Alert) []string {
+	specific := false
+	for _, r := range routes {
+		if r.FieldID == alert.FieldID {
+			specific = true
+			break
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, r := range routes {
+		if specific && r.FieldID != alert.FieldID || !specific && r.FieldID != AnyField {
+			continue
+		}
+		if r.MinSeverity != "" && severityRank[alert.Severity] < severityRank[r.MinSeverity] {
+			continue
+		}
+		for _, ch := range r.Channels {
+			seen[ch] = true
+		}
+	}
+
+	channels := make([]string, 0, len(seen))
+	for ch := range seen {
+		channels = append(channels, ch)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// QuietHours is a daily window, possibly spanning midnight, during which
+// non-critical notifications are held until the window ends.
+type QuietHours struct {
+	Start, End time.Duration // offsets from local midnight
+	Location   *time.Location
+}
+
+// ParseQuietHours parses "HH:MM-HH:MM" in the given location. An empty
+// string means no quiet hours and returns nil.
+func ParseQuietHours(s string, loc *time.Location) (*QuietHours, error) {
+	if s == "" {
+		return nil, nil
+	}
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("%w: quiet hours %q must be HH:MM-HH:MM", ErrInvalidConfig, s)
+	}
+	q := &QuietHours{Location: loc}
+	var err error
+	if q.Start, err = clock(start); err != nil {
+		return nil, err
+	}
+	if q.End, err = clock(end); err != nil {
+		return nil, err
+	}
+	if q.Start == q.End {
+		return nil, fmt.Errorf("%w: quiet hours %q are empty", ErrInvalidConfig, s)
+	}
+	if q.Location == nil {
+		q.Location = time.UTC
+	}
+	return q, nil
+}
+
+func clock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid time %q", ErrInvalidConfig, s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Until returns how long after t the quiet window ends, or 0 if t is
+// outside it.
+func (q *QuietHours) Until(t time.Time) time.Duration {
+	local := t.In(q.Location)
+	offset := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute +
+		time.Duration(local.Second())*time.Second + time.Duration(local.Nanosecond())
+
+	var end time.Time
+	switch {
+	case q.Start < q.End && offset >= q.Start && offset < q.End:
+		end = q.on(local, 0)
+	case q.Start > q.End && offset >= q.Start:
+		end = q.on(local, 1)
+	case q.Start > q.End && offset < q.End:
+		end = q.on(local, 0)
+	default:
+		return 0
+	}
+	return end.Sub(t)
+}
+
+// on returns the end of the window on the day days after local's date.
+func (q *QuietHours) on(local time.Time, days int) time.Time {
+	return time.Date(local.Year(), local.Month(), local.Day()+days,
+		int(q.End/time.Hour), int(q.End%time.Hour/time.Minute), 0, 0, q.Location)
+}
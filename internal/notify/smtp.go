@@ -0,0 +1,121 @@
+// internal/notify/smtp.go
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPChannel emails notifications as plain text.
+type SMTPChannel struct {
+	addr     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+// NewSMTPChannel creates an email channel that relays through the server at
+// addr (host:port). Credentials are optional; STARTTLS is used whenever the
+// server offers it.
+func NewSMTPChannel(addr, username, password, from string, to []string) *SMTPChannel {
+	s := &SMTPChannel{
+		addr:     addr,
+		username: username,
+		password: password,
+		from:     from,
+	}
+	for _, rcpt := range to {
+		if rcpt = strings.TrimSpace(rcpt); rcpt != "" {
+			s.to = append(s.to, rcpt)
+		}
+	}
+	return s
+}
+
+func (s *SMTPChannel) Name() string { return "email" }
+
+func (s *SMTPChannel) Send(ctx context.Context, n Notification) error {
+	if len(s.to) == 0 {
+		return Permanent(fmt.Errorf("no email recipients configured"))
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(30 * time.Second))
+	}
+
+	host, _, _ := net.SplitHostPort(s.addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.username, s.password, host)); err != nil {
+			return Permanent(err)
+		}
+	}
+	if err := c.Mail(s.from); err != nil {
+		return err
+	}
+	for _, rcpt := range s.to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(s.message(n)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (s *SMTPChannel) message(n Notification) []byte {
+	a := n.Alert
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.to, ", "))
+	// Rule names and field IDs end up in the subject; encoding it keeps
+	// any line breaks they carry from starting new headers.
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", n.Subject()))
+	fmt.Fprintf(&b, "Date: %s\r\n", n.SentAt.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+
+	fmt.Fprintf(&b, "%s\r\n\r\n", a.Message)
+	fmt.Fprintf(&b, "Field:    %s\r\n", a.FieldID)
+	fmt.Fprintf(&b, "Severity: %s\r\n", a.Severity)
+	fmt.Fprintf(&b, "Alert:    #%d (%s)\r\n", a.ID, a.AlertType)
+	fmt.Fprintf(&b, "Raised:   %s\r\n", a.CreatedAt.Format(time.RFC3339))
+	if a.ResolvedAt != nil {
+		fmt.Fprintf(&b, "Resolved: %s\r\n", a.ResolvedAt.Format(time.RFC3339))
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,167 @@
+// internal/notify/smtptest/server.go
+
+// Package smtptest provides an in-process SMTP sink. It speaks enough of
+// the protocol for net/smtp clients to deliver mail, and keeps every
+// message in memory so the email channel can be tested without a relay.
+package smtptest
+
+import (
+	"bufio"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+)
+
+// Message is one delivered email.
+type Message struct {
+	From string
+	To   []string
+	Data string
+}
+
+// Header returns the first value of a header in the message, or "".
+func (m Message) Header(name string) string {
+	msg, err := mail.ReadMessage(strings.NewReader(m.Data))
+	if err != nil {
+		return ""
+	}
+	return msg.Header.Get(name)
+}
+
+// Server accepts SMTP connections on a loopback port.
+type Server struct {
+	// Addr is the host:port the server listens on.
+	Addr string
+
+	listener net.Listener
+	mu       sync.Mutex
+	messages []Message
+	reject   int
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a sink on a random loopback port.
+func NewServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("smtptest: failed to listen: " + err.Error())
+	}
+	s := &Server{Addr: l.Addr().String(), listener: l}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Messages returns the messages delivered so far.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// RejectNext makes the next n deliveries fail with a temporary error.
+func (s *Server) RejectNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reject = n
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 smtptest ready")
+	var msg Message
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(verb, "EHLO"), strings.HasPrefix(verb, "HELO"):
+			reply("250 smtptest")
+		case strings.HasPrefix(verb, "MAIL FROM:"):
+			msg = Message{From: address(line[len("MAIL FROM:"):])}
+			reply("250 OK")
+		case strings.HasPrefix(verb, "RCPT TO:"):
+			msg.To = append(msg.To, address(line[len("RCPT TO:"):]))
+			reply("250 OK")
+		case verb == "DATA":
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			data, err := readData(r)
+			if err != nil {
+				return
+			}
+			msg.Data = data
+			reply(s.accept(msg))
+		case verb == "RSET", verb == "NOOP":
+			reply("250 OK")
+		case verb == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+func (s *Server) accept(msg Message) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reject > 0 {
+		s.reject--
+		return "451 try again later"
+	}
+	s.messages = append(s.messages, msg)
+	return "250 OK"
+}
+
+// readData reads a DATA section up to the terminating ".", undoing dot
+// stuffing.
+func readData(r *bufio.Reader) (string, error) {
+	var b strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if line == ".\r\n" || line == ".\n" {
+			return b.String(), nil
+		}
+		b.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
+
+func address(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		s = s[:i]
+	}
+	return strings.Trim(s, "<>")
+}
@@ -0,0 +1,84 @@
+// internal/notify/webhook.go
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Webhook signature headers. The signature is "sha256=" followed by the hex
+// HMAC-SHA256 of "<timestamp>.<body>" keyed with the shared secret, so
+// receivers can reject both forged and replayed requests.
+const (
+	SignatureHeader = "X-Signature-256"
+	TimestampHeader = "X-Signature-Timestamp"
+)
+
+// WebhookChannel posts notifications as JSON to a URL.
+type WebhookChannel struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+func NewWebhookChannel(url, secret string) *WebhookChannel {
+	return &WebhookChannel{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (w *WebhookChannel) Name() string { return "webhook" }
+
+func (w *WebhookChannel) Send(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return Permanent(err)
+	}
+	timestamp := strconv.FormatInt(n.SentAt.Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(w.secret, timestamp, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("webhook returned %s", resp.Status)
+		// Other client errors will not succeed on retry.
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return Permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// Sign returns the webhook signature header value for a request body.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,540 @@
+// internal/services/alerts.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"agricultural-iot-rag/internal/alerting"
+	"agricultural-iot-rag/internal/metrics"
+	"agricultural-iot-rag/internal/models"
+	"agricultural-iot-rag/internal/notify"
+	"agricultural-iot-rag/internal/storage"
+)
+
+// ErrInvalidTransition is returned when an alert cannot move to the
+// requested state, such as acknowledging a resolved alert.
+var ErrInvalidTransition = errors.New("invalid alert transition")
+
+const (
+	// maxRuleNameLength matches alerts.alert_type, which records the rule name.
+	maxRuleNameLength = 100
+	// maxActorLength matches alert_events.actor.
+	maxActorLength = 255
+	// MaxSnooze bounds how long an alert can be snoozed in one request.
+	MaxSnooze = 30 * 24 * time.Hour
+)
+
+// RuleEngineActor is recorded as the actor for transitions made by the
+// rule engine itself.
+const RuleEngineActor = "rule-engine"
+
+// AlertService manages alert rules and evaluates them against incoming
+// readings. Rule state (pending conditions, open alerts, debounce) is kept
+// in memory and rebuilt from the open alerts by Load.
+type AlertService struct {
+	db       storage.Store
+	notifier AlertNotifier
+
+	mu     sync.Mutex
+	rules  []compiledRule
+	states map[ruleState]*alerting.State
+}
+
+type compiledRule struct {
+	rule models.AlertRule
+	cond *alerting.Condition
+}
+
+type ruleState struct {
+	ruleID  int64
+	fieldID string
+}
+
+// AlertNotifier is told when alerts fire and resolve. notify.Notifier
+// implements it.
+type AlertNotifier interface {
+	Notify(alert models.Alert, event string)
+}
+
+// NewAlertService creates the alert service. db may be nil, in which case
+// rule management returns ErrRegistryUnavailable and Evaluate does nothing.
+// notifier may be nil to skip notifications.
+func NewAlertService(db storage.Store, notifier AlertNotifier) *AlertService {
+	return &AlertService{
+		db:       db,
+		notifier: notifier,
+		states:   map[ruleState]*alerting.State{},
+	}
+}
+
+// Load reads the rules from the store and marks fields with an open rule
+// alert as firing, so a restart neither duplicates nor orphans alerts.
+func (as *AlertService) Load(ctx context.Context) error {
+	if as.db == nil {
+		return ErrRegistryUnavailable
+	}
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if err := as.reloadRules(ctx); err != nil {
+		return err
+	}
+	open, err := as.db.OpenRuleAlerts(ctx)
+	if err != nil {
+		return err
+	}
+	as.states = map[ruleState]*alerting.State{}
+	for _, a := range open {
+		as.states[ruleState{*a.RuleID, a.FieldID}] = &alerting.State{Active: true, AlertID: a.ID}
+	}
+	return nil
+}
+
+// reloadRules refreshes the rule cache. Callers hold as.mu.
+func (as *AlertService) reloadRules(ctx context.Context) error {
+	rules, err := as.db.ListAlertRules(ctx)
+	if err != nil {
+		return err
+	}
+	as.rules = as.rules[:0]
+	for _, r := range rules {
+		if !r.Enabled {
+			continue
+		}
+		cond, err := alerting.Parse(r.Expression)
+		if err != nil {
+			// Expressions are validated on write; this only happens if the
+			// grammar changed under a stored rule.
+			log.Printf("Skipping alert rule %d: %v", r.ID, err)
+			continue
+		}
+		as.rules = append(as.rules, compiledRule{rule: r, cond: cond})
+	}
+	return nil
+}
+
+// Evaluate runs the enabled rules against a stored reading, raising alerts
+// for conditions that have held long enough and resolving alerts whose
+// condition has cleared. Readings for fields missing from the registry are
+// not evaluated, since alerts must reference a registered field. Rule
+// states advance under as.mu; the alerts are written after it is released
+// so concurrent readings are not serialized behind the database.
+func (as *AlertService) Evaluate(ctx context.Context, reading models.SensorReading) error {
+	if as.db == nil {
+		return nil
+	}
+	fieldID := reading.Location.FieldID
+	if !as.hasRuleFor(reading) {
+		return nil
+	}
+	field, err := as.db.GetField(ctx, fieldID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up field %s: %w", fieldID, err)
+	}
+	// The registered crop is preferred over the one the device reports.
+	crop := field.CropType
+	if crop == "" {
+		crop = reading.Location.CropType
+	}
+
+	var transitions []transition
+	as.mu.Lock()
+	for _, cr := range as.rules {
+		value, ok := ruleValue(cr, reading)
+		if !ok || !cr.cond.Matches(fieldID, crop) {
+			continue
+		}
+		key := ruleState{cr.rule.ID, fieldID}
+		state, ok := as.states[key]
+		if !ok {
+			state = &alerting.State{}
+			as.states[key] = state
+		}
+		settings := alerting.Settings{
+			Hysteresis: cr.rule.Hysteresis,
+			Debounce:   time.Duration(cr.rule.DebounceMinutes) * time.Minute,
+		}
+		if step := state.Step(cr.cond, settings, value, reading.Timestamp); step != alerting.NoChange {
+			transitions = append(transitions, transition{cr, key, state, step, value, state.AlertID})
+		}
+	}
+	as.mu.Unlock()
+
+	var errs []error
+	for _, t := range transitions {
+		if err := as.apply(ctx, t, fieldID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// transition is a rule state change still to be written.
+type transition struct {
+	cr      compiledRule
+	key     ruleState
+	state   *alerting.State
+	step    alerting.Transition
+	value   float64
+	alertID int64
+}
+
+// hasRuleFor reports whether any rule watches a numeric measurement of
+// reading, so readings no rule can match skip the field lookup.
+func (as *AlertService) hasRuleFor(reading models.SensorReading) bool {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	for _, cr := range as.rules {
+		if _, ok := ruleValue(cr, reading); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleValue returns the numeric value of the measurement cr watches.
+func ruleValue(cr compiledRule, reading models.SensorReading) (float64, bool) {
+	m, ok := reading.Measurements[cr.cond.Measurement]
+	if !ok {
+		return 0, false
+	}
+	return numericValue(m.Value)
+}
+
+// apply writes a transition. An alert whose condition cleared, or whose
+// rule was disabled or deleted, while it was being raised is resolved
+// straight away; a resolve that overtook the raise is left to it.
+func (as *AlertService) apply(ctx context.Context, t transition, fieldID string) error {
+	switch t.step {
+	case alerting.Fire:
+		alert, err := as.raise(ctx, t.cr, fieldID, t.value)
+		as.mu.Lock()
+		current := as.states[t.key] == t.state
+		active := current && t.state.Active
+		if active {
+			if err != nil {
+				// Leave the rule pending so the next reading retries.
+				t.state.Active = false
+			} else {
+				t.state.AlertID = alert.ID
+			}
+		}
+		as.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		if !active {
+			note := "rule changed while the alert was raised"
+			if current {
+				note = t.cr.cond.Measurement + " recovered"
+			}
+			return as.autoResolve(ctx, alert.ID, note)
+		}
+	case alerting.Resolve:
+		if t.alertID == 0 {
+			return nil
+		}
+		note := fmt.Sprintf("%s recovered to %s", t.cr.cond.Measurement, strconv.FormatFloat(t.value, 'f', -1, 64))
+		return as.autoResolve(ctx, t.alertID, note)
+	}
+	return nil
+}
+
+func (as *AlertService) raise(ctx context.Context, cr compiledRule, fieldID string, value float64) (*models.Alert, error) {
+	ruleID := cr.rule.ID
+	alert := &models.Alert{
+		FieldID:   fieldID,
+		AlertType: cr.rule.Name,
+		Severity:  cr.rule.Severity,
+		Message: fmt.Sprintf("%s is %s (rule %q: %s)", cr.cond.Measurement,
+			strconv.FormatFloat(value, 'f', -1, 64), cr.rule.Name, cr.cond),
+		RuleID: &ruleID,
+		Value:  &value,
+	}
+	if err := as.db.CreateAlert(ctx, alert); err != nil {
+		return nil, err
+	}
+	metrics.AlertsTriggered.WithLabelValues(alert.Severity).Inc()
+	as.notify(*alert, notify.EventFired)
+	return alert, nil
+}
+
+// autoResolve resolves an alert on behalf of the rule engine. Alerts that
+// were already resolved by hand are left alone.
+func (as *AlertService) autoResolve(ctx context.Context, id int64, note string) error {
+	err := as.db.ResolveAlert(ctx, &models.AlertEvent{AlertID: id, Actor: RuleEngineActor, Note: note})
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to resolve alert %d: %w", id, err)
+	}
+	if alert, err := as.db.GetAlert(ctx, id); err == nil {
+		as.notify(*alert, notify.EventResolved)
+	}
+	return nil
+}
+
+func (as *AlertService) notify(alert models.Alert, event string) {
+	if as.notifier != nil {
+		as.notifier.Notify(alert, event)
+	}
+}
+
+func (as *AlertService) CreateRule(ctx context.Context, r *models.AlertRule) error {
+	if as.db == nil {
+		return ErrRegistryUnavailable
+	}
+	if err := validateAlertRule(r); err != nil {
+		return err
+	}
+	if err := as.db.CreateAlertRule(ctx, r); err != nil {
+		return err
+	}
+	return as.refresh(ctx)
+}
+
+func (as *AlertService) GetRule(ctx context.Context, id int64) (*models.AlertRule, error) {
+	if as.db == nil {
+		return nil, ErrRegistryUnavailable
+	}
+	return as.db.GetAlertRule(ctx, id)
+}
+
+func (as *AlertService) ListRules(ctx context.Context) ([]models.AlertRule, error) {
+	if as.db == nil {
+		return nil, ErrRegistryUnavailable
+	}
+	return as.db.ListAlertRules(ctx)
+}
+
+// UpdateRule replaces a rule. Open alerts stay open and are resolved by the
+// new condition; disabling the rule resolves them immediately.
+func (as *AlertService) UpdateRule(ctx context.Context, r *models.AlertRule) error {
+	if as.db == nil {
+		return ErrRegistryUnavailable
+	}
+	if err := validateAlertRule(r); err != nil {
+		return err
+	}
+	existing, err := as.db.GetAlertRule(ctx, r.ID)
+	if err != nil {
+		return err
+	}
+	r.CreatedAt = existing.CreatedAt
+	if err := as.db.UpdateAlertRule(ctx, r); err != nil {
+		return err
+	}
+	if !r.Enabled {
+		return as.dropRule(ctx, r.ID, "rule disabled")
+	}
+	return as.refresh(ctx)
+}
+
+// DeleteRule removes a rule and resolves its open alerts.
+func (as *AlertService) DeleteRule(ctx context.Context, id int64) error {
+	if as.db == nil {
+		return ErrRegistryUnavailable
+	}
+	if _, err := as.db.GetAlertRule(ctx, id); err != nil {
+		return err
+	}
+	if err := as.db.DeleteAlertRule(ctx, id); err != nil {
+		return err
+	}
+	return as.dropRule(ctx, id, "rule deleted")
+}
+
+func (as *AlertService) refresh(ctx context.Context) error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	return as.reloadRules(ctx)
+}
+
+// dropRule reloads the rules after ruleID was disabled or deleted, forgets
+// its state and resolves the alerts it left open. The rules and states
+// change together under as.mu, so no reading is evaluated against the
+// rule once its state is gone; the alerts are resolved after it is
+// released. Alerts still being raised are resolved by Evaluate.
+func (as *AlertService) dropRule(ctx context.Context, ruleID int64, note string) error {
+	as.mu.Lock()
+	if err := as.reloadRules(ctx); err != nil {
+		as.mu.Unlock()
+		return err
+	}
+	var open []int64
+	for key, state := range as.states {
+		if key.ruleID != ruleID {
+			continue
+		}
+		if state.Active && state.AlertID != 0 {
+			open = append(open, state.AlertID)
+		}
+		delete(as.states, key)
+	}
+	as.mu.Unlock()
+
+	var errs []error
+	for _, id := range open {
+		if err := as.autoResolve(ctx, id, note); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ListAlerts returns alerts matching filter, newest first.
+func (as *AlertService) ListAlerts(ctx context.Context, filter storage.AlertFilter) ([]models.Alert, error) {
+	if as.db == nil {
+		return nil, ErrRegistryUnavailable
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidInput)
+	}
+	filter.Severity = strings.ToLower(filter.Severity)
+	return as.db.ListAlerts(ctx, filter)
+}
+
+// GetAlert returns an alert with its audit trail.
+func (as *AlertService) GetAlert(ctx context.Context, id int64) (*models.Alert, error) {
+	if as.db == nil {
+		return nil, ErrRegistryUnavailable
+	}
+	alert, err := as.db.GetAlert(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if alert.Events, err = as.db.AlertEvents(ctx, id); err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
+
+// Acknowledge records that actor has seen an unresolved alert.
+func (as *AlertService) Acknowledge(ctx context.Context, id int64, actor, note string) (*models.Alert, error) {
+	return as.transition(ctx, &models.AlertEvent{AlertID: id, Actor: actor, Note: note}, func(a *models.Alert, e *models.AlertEvent) error {
+		if a.AcknowledgedAt != nil {
+			return fmt.Errorf("%w: alert %d was already acknowledged by %s", ErrInvalidTransition, a.ID, a.AcknowledgedBy)
+		}
+		return as.db.AcknowledgeAlert(ctx, e)
+	})
+}
+
+// Resolve closes an alert by hand. If its rule condition still holds, the
+// rule does not fire again until the condition has cleared.
+func (as *AlertService) Resolve(ctx context.Context, id int64, actor, note string) (*models.Alert, error) {
+	alert, err := as.transition(ctx, &models.AlertEvent{AlertID: id, Actor: actor, Note: note}, func(_ *models.Alert, e *models.AlertEvent) error {
+		return as.db.ResolveAlert(ctx, e)
+	})
+	if err != nil {
+		return nil, err
+	}
+	as.notify(*alert, notify.EventResolved)
+	return alert, nil
+}
+
+// ListDeadLetters returns notifications that could not be delivered,
+// newest first.
+func (as *AlertService) ListDeadLetters(ctx context.Context, limit int) ([]models.DeadLetter, error) {
+	if as.db == nil {
+		return nil, ErrRegistryUnavailable
+	}
+	return as.db.ListDeadLetters(ctx, limit)
+}
+
+// Snooze silences an unresolved alert for d. Snoozing again replaces the
+// previous snooze.
+func (as *AlertService) Snooze(ctx context.Context, id int64, d time.Duration, actor, note string) (*models.Alert, error) {
+	if d <= 0 || d > MaxSnooze {
+		return nil, fmt.Errorf("%w: snooze duration must be between 0 and %s", ErrInvalidInput, MaxSnooze)
+	}
+	until := time.Now().UTC().Add(d)
+	return as.transition(ctx, &models.AlertEvent{AlertID: id, Actor: actor, Note: note, SnoozedUntil: &until}, func(_ *models.Alert, e *models.AlertEvent) error {
+		return as.db.SnoozeAlert(ctx, e)
+	})
+}
+
+// transition validates the actor, checks the alert is unresolved, applies
+// fn and returns the updated alert with its audit trail.
+func (as *AlertService) transition(ctx context.Context, e *models.AlertEvent, fn func(*models.Alert, *models.AlertEvent) error) (*models.Alert, error) {
+	if as.db == nil {
+		return nil, ErrRegistryUnavailable
+	}
+	e.Actor = strings.TrimSpace(e.Actor)
+	if e.Actor == "" || len(e.Actor) > maxActorLength {
+		return nil, fmt.Errorf("%w: actor must be 1-%d characters", ErrInvalidInput, maxActorLength)
+	}
+	e.Note = strings.TrimSpace(e.Note)
+
+	alert, err := as.db.GetAlert(ctx, e.AlertID)
+	if err != nil {
+		return nil, err
+	}
+	if alert.Resolved {
+		return nil, fmt.Errorf("%w: alert %d is already resolved", ErrInvalidTransition, alert.ID)
+	}
+	err = fn(alert, e)
+	if errors.Is(err, storage.ErrNotFound) {
+		// Resolved between the read and the update.
+		return nil, fmt.Errorf("%w: alert %d is already resolved", ErrInvalidTransition, alert.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return as.GetAlert(ctx, e.AlertID)
+}
+
+func validateAlertRule(r *models.AlertRule) error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" || len(r.Name) > maxRuleNameLength {
+		return fmt.Errorf("%w: name must be 1-%d characters", ErrInvalidInput, maxRuleNameLength)
+	}
+	if strings.IndexFunc(r.Name, unicode.IsControl) >= 0 {
+		return fmt.Errorf("%w: name cannot contain control characters", ErrInvalidInput)
+	}
+	if _, err := alerting.Parse(r.Expression); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	r.Expression = strings.Join(strings.Fields(r.Expression), " ")
+
+	r.Severity = strings.ToLower(strings.TrimSpace(r.Severity))
+	switch r.Severity {
+	case models.SeverityLow, models.SeverityMedium, models.SeverityHigh, models.SeverityCritical:
+	default:
+		return fmt.Errorf("%w: severity must be low, medium, high or critical", ErrInvalidInput)
+	}
+	if r.Hysteresis < 0 {
+		return fmt.Errorf("%w: hysteresis cannot be negative", ErrInvalidInput)
+	}
+	if r.DebounceMinutes < 0 {
+		return fmt.Errorf("%w: debounce_minutes cannot be negative", ErrInvalidInput)
+	}
+	return nil
+}
+
+// numericValue converts a decoded measurement value to float64. Readings
+// decoded from JSON carry float64; other numeric types come from code.
+func numericValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
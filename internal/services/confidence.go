@@ -0,0 +1,205 @@
+// internal/services/confidence.go
+package services
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"agricultural-iot-rag/internal/decision"
+)
+
+// Confidence weights. A component that cannot be measured, such as
+// agreement when only one answer is generated, is left out and the others
+// are rescaled.
+const (
+	retrievalWeight  = 0.35
+	sensorWeight     = 0.25
+	agreementWeight  = 0.2
+	validationWeight = 0.2
+)
+
+// Below this score a decision is flagged as based on insufficient evidence.
+const insufficientEvidenceBelow = 0.5
+
+// noKnowledgeConfidence caps the confidence of answers given without any
+// knowledge documents, however good the sensor data.
+const noKnowledgeConfidence = 0.4
+
+// Cosine similarities are mapped linearly from [floor, ceiling] onto
+// [0, 1]: below the floor a document is effectively unrelated, above the
+// ceiling it is as good a match as the embedding model produces.
+const (
+	similarityFloor   = 0.3
+	similarityCeiling = 0.8
+)
+
+// Readings count as fully fresh up to freshFor old and lose all weight at
+// staleAfter. Values supplied with a request cannot be checked and get
+// suppliedFreshness.
+const (
+	freshFor          = time.Hour
+	staleAfter        = 24 * time.Hour
+	suppliedFreshness = 0.8
+)
+
+// ConfidenceBreakdown holds each confidence component in [0, 1].
+// Agreement is nil when a single answer was generated.
+type ConfidenceBreakdown struct {
+	Retrieval  float64  `json:"retrieval"`
+	SensorData float64  `json:"sensor_data"`
+	Agreement  *float64 `json:"agreement"`
+	Validation float64  `json:"validation"`
+}
+
+// sample is one generated answer. out is nil when no attempt validated.
+type sample struct {
+	out      *decision.Output
+	raw      string
+	attempts int
+	problems []string
+}
+
+// scoreConfidence combines the components into d.Confidence and records
+// why the evidence is weak, if it is.
+func scoreConfidence(d *Decision, hits []KnowledgeHit, samples []sample, now time.Time) {
+	b := ConfidenceBreakdown{
+		Retrieval:  retrievalConfidence(hits),
+		SensorData: sensorConfidence(d.Readings, now),
+		Validation: validationConfidence(samples[0]),
+	}
+	weighted := retrievalWeight*b.Retrieval + sensorWeight*b.SensorData + validationWeight*b.Validation
+	total := retrievalWeight + sensorWeight + validationWeight
+	if len(samples) > 1 {
+		a := agreement(samples)
+		b.Agreement = &a
+		weighted += agreementWeight * a
+		total += agreementWeight
+	}
+	d.Breakdown = b
+	d.Confidence = round2(weighted / total)
+	if len(hits) == 0 {
+		d.Confidence = math.Min(d.Confidence, noKnowledgeConfidence)
+	}
+
+	if len(hits) == 0 {
+		d.EvidenceGaps = append(d.EvidenceGaps, "no relevant documents were found")
+	} else if b.Retrieval < 0.4 {
+		d.EvidenceGaps = append(d.EvidenceGaps, "retrieved documents are only loosely related to the question")
+	}
+	if len(d.Readings) == 0 {
+		d.EvidenceGaps = append(d.EvidenceGaps, "no sensor readings were available")
+	} else if b.SensorData < 0.5 {
+		d.EvidenceGaps = append(d.EvidenceGaps, "sensor readings are stale or of poor quality")
+	}
+	if b.Agreement != nil && *b.Agreement < 0.5 {
+		d.EvidenceGaps = append(d.EvidenceGaps, "sampled answers disagree on the actions to take")
+	}
+	if b.Validation == 0 {
+		d.EvidenceGaps = append(d.EvidenceGaps, "the model did not produce a valid structured answer")
+	}
+	d.InsufficientEvidence = d.Confidence < insufficientEvidenceBelow || len(hits) == 0
+}
+
+// retrievalConfidence is the mapped mean similarity of the top three hits.
+func retrievalConfidence(hits []KnowledgeHit) float64 {
+	if len(hits) == 0 {
+		return 0
+	}
+	scores := make([]float64, len(hits))
+	for i, h := range hits {
+		scores[i] = float64(h.Score)
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(scores)))
+	if len(scores) > 3 {
+		scores = scores[:3]
+	}
+	mean := 0.0
+	for _, s := range scores {
+		mean += s
+	}
+	mean /= float64(len(scores))
+	return round2(clamp01((mean - similarityFloor) / (similarityCeiling - similarityFloor)))
+}
+
+// sensorConfidence averages freshness times quality over the readings.
+func sensorConfidence(readings []ReadingUsed, now time.Time) float64 {
+	if len(readings) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, r := range readings {
+		freshness := suppliedFreshness
+		if r.Source != ReadingSourceRequest && r.Timestamp != nil {
+			age := now.Sub(*r.Timestamp)
+			freshness = clamp01(1 - float64(age-freshFor)/float64(staleAfter-freshFor))
+		}
+		sum += freshness * qualityFactor(r.Quality)
+	}
+	return round2(sum / float64(len(readings)))
+}
+
+func qualityFactor(quality string) float64 {
+	switch quality {
+	case "", "good":
+		return 1
+	case "fair":
+		return 0.6
+	default:
+		return 0.3
+	}
+}
+
+// validationConfidence rewards answers that matched the schema, and those
+// that did so without correction most.
+func validationConfidence(s sample) float64 {
+	switch {
+	case s.out == nil:
+		return 0
+	case s.attempts == 1:
+		return 1
+	default:
+		return 0.7
+	}
+}
+
+// agreement is the mean overlap (Jaccard index) between the action types
+// of the first answer and each other sample. Samples that never validated
+// count as full disagreement.
+func agreement(samples []sample) float64 {
+	primary := actionTypes(samples[0].out)
+	sum := 0.0
+	for _, s := range samples[1:] {
+		if s.out != nil && samples[0].out != nil {
+			sum += jaccard(primary, actionTypes(s.out))
+		}
+	}
+	return round2(sum / float64(len(samples)-1))
+}
+
+func actionTypes(out *decision.Output) map[string]bool {
+	types := map[string]bool{}
+	if out != nil {
+		for _, a := range out.Actions {
+			types[a.Type] = true
+		}
+	}
+	return types
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	shared := 0
+	for t := range a {
+		if b[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
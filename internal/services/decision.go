@@ -0,0 +1,360 @@
+// internal/services/decision.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agricultural-iot-rag/internal/decision"
+	"agricultural-iot-rag/internal/metrics"
+	"agricultural-iot-rag/pkg/llm"
+	"agricultural-iot-rag/pkg/rag"
+)
+
+// maxDecisionAttempts bounds how often the model is asked to correct a
+// reply that does not match the output schema.
+const maxDecisionAttempts = 3
+
+// minCropHits is the fewest documents a crop-filtered search must find
+// before the decision falls back to searching every crop.
+const minCropHits = 2
+
+// sampleTemperature is used for the extra answers generated to measure
+// agreement, so they explore the answers the model considers plausible.
+const sampleTemperature = 0.8
+
+// noKnowledgeDisclaimer accompanies answers given without any knowledge
+// documents.
+const noKnowledgeDisclaimer = "No sufficiently relevant documents were found in the knowledge base. " +
+	"This recommendation is based on the field's sensor data and general practice only; verify it before acting."
+
+const decisionSystemPrompt = "You are an expert agricultural advisor. Provide practical, actionable recommendations based on sensor data and agricultural knowledge."
+
+// DecisionService answers farm management questions. It grounds each
+// question in the field's sensor data, retrieves relevant knowledge and
+// asks the model for a structured recommendation.
+type DecisionService struct {
+	knowledge *KnowledgeService
+	sensors   *SensorService
+	llm       *llm.OllamaClient
+	samples   int
+	expansion ExpansionOptions
+}
+
+// DecisionOptions tune decision making.
+type DecisionOptions struct {
+	// Samples is the number of answers generated per question; their
+	// agreement feeds the confidence score. Values below 1 mean 1.
+	Samples int
+	// Expansion searches with rewritten queries and a hypothetical answer
+	// as well as the question; the zero value searches with the question
+	// alone.
+	Expansion ExpansionOptions
+}
+
+func NewDecisionService(knowledge *KnowledgeService, sensors *SensorService, llmClient *llm.OllamaClient, opts DecisionOptions) *DecisionService {
+	return &DecisionService{
+		knowledge: knowledge,
+		sensors:   sensors,
+		llm:       llmClient,
+		samples:   max(opts.Samples, 1),
+		expansion: opts.Expansion,
+	}
+}
+
+// DecisionQuery is a question about a field. SensorData supplies readings
+// directly and overrides stored values of the same measurement. Filter,
+// which may be nil, restricts the knowledge retrieved.
+type DecisionQuery struct {
+	Query      string
+	FieldID    string
+	SensorData map[string]interface{}
+	Filter     *rag.Filter
+}
+
+// Decision is a recommendation with the evidence it was based on.
+type Decision struct {
+	Recommendation string
+	Actions        []decision.Action
+	Sources        []Citation
+	Readings       []ReadingUsed
+	// Filter is the filter the sources were retrieved with, if any.
+	Filter string
+	// Attempts is the number of model calls made for the answer. When none
+	// produced valid structured output, ValidationErrors holds the problems
+	// with the last reply, Recommendation its raw text and Actions is
+	// empty.
+	Attempts         int
+	ValidationErrors []string
+
+	Confidence float64
+	Breakdown  ConfidenceBreakdown
+	// InsufficientEvidence flags answers too weakly supported to act on
+	// without checking; EvidenceGaps says what was missing.
+	InsufficientEvidence bool
+	EvidenceGaps         []string
+	// Disclaimer is set when no knowledge was relevant enough to use and
+	// the answer rests on sensor data alone.
+	Disclaimer string
+	// Debug shows how the question was expanded for retrieval, if it was.
+	Debug *DecisionDebug
+}
+
+// DecisionDebug is what the question was expanded into before retrieval.
+// ExpansionError says why expansion failed, in which case the question
+// was searched alone.
+type DecisionDebug struct {
+	RewrittenQueries   []string `json:"rewritten_queries"`
+	HypotheticalAnswer string   `json:"hypothetical_answer,omitempty"`
+	ExpansionError     string   `json:"expansion_error,omitempty"`
+}
+
+// Citation is a retrieved document numbered for the answer to reference
+// inline as [Number].
+type Citation struct {
+	Number int `json:"number"`
+	KnowledgeHit
+	// Cited reports whether the answer referenced this source.
+	Cited bool `json:"cited"`
+}
+
+// Decide answers q. Malformed supplied sensor data is an ErrInvalidReading.
+func (ds *DecisionService) Decide(ctx context.Context, q DecisionQuery) (*Decision, error) {
+	sensors, err := ds.sensors.SensorContext(ctx, q.FieldID, q.SensorData)
+	if err != nil {
+		return nil, err
+	}
+
+	var expansion *QueryExpansion
+	var debug *DecisionDebug
+	if ds.expansion.enabled() {
+		debug = &DecisionDebug{RewrittenQueries: []string{}}
+		if expansion, err = ds.expand(ctx, q.Query, sensors.CropType); err != nil {
+			log.Printf("Searching with the question alone: %v", err)
+			debug.ExpansionError = err.Error()
+		} else {
+			debug.HypotheticalAnswer = expansion.Hypothetical
+			if expansion.Queries != nil {
+				debug.RewrittenQueries = expansion.Queries
+			}
+		}
+	}
+
+	hits, filter, err := ds.retrieve(ctx, q, sensors, expansion)
+	if err != nil {
+		return nil, err
+	}
+	citations := make([]Citation, len(hits))
+	for i, h := range hits {
+		citations[i] = Citation{Number: i + 1, KnowledgeHit: h}
+	}
+
+	now := time.Now()
+	messages := []llm.Message{
+		{Role: "system", Content: decisionSystemPrompt},
+		{Role: "user", Content: buildDecisionPrompt(q.Query, citations, sensors, now)},
+	}
+	expect := decision.Expect{FieldID: targetField(q.FieldID), Sources: len(citations)}
+	samples, err := ds.sample(ctx, messages, expect)
+	if err != nil {
+		return nil, err
+	}
+
+	answer := samples[0]
+	d := &Decision{
+		Sources:  citations,
+		Readings: sensors.Readings,
+		Filter:   filter.String(),
+		Attempts: answer.attempts,
+		Debug:    debug,
+	}
+	if len(hits) == 0 {
+		d.Disclaimer = noKnowledgeDisclaimer
+	}
+	if answer.out != nil {
+		d.Recommendation = answer.out.Recommendation
+		d.Actions = answer.out.Actions
+		for _, n := range answer.out.References() {
+			citations[n-1].Cited = true
+		}
+	} else {
+		d.Recommendation = strings.TrimSpace(answer.raw)
+		d.Actions = []decision.Action{}
+		d.ValidationErrors = answer.problems
+	}
+	scoreConfidence(d, hits, samples, now)
+	return d, nil
+}
+
+// retrieve searches the knowledge base for q. When the field's crop is
+// known, documents about other crops are left out, unless that leaves fewer
+// than minCropHits documents, in which case every crop is searched. It
+// returns the hits and the filter they were found with. expansion, which
+// may be nil, is searched along with the question.
+func (ds *DecisionService) retrieve(ctx context.Context, q DecisionQuery, sensors *SensorContext, expansion *QueryExpansion) ([]KnowledgeHit, *rag.Filter, error) {
+	kq := KnowledgeQuery{Query: q.Query, Sensors: sensors, Filter: q.Filter, Expansion: expansion, MergeChunks: true}
+	if sensors.CropType != "" {
+		crop, err := rag.ParseFilter(fmt.Sprintf("crop = %s OR crop IS EMPTY", strconv.Quote(sensors.CropType)))
+		if err != nil {
+			return nil, nil, err
+		}
+		cropQuery := kq
+		cropQuery.Filter = q.Filter.And(crop)
+		hits, err := ds.knowledge.SearchKnowledge(ctx, cropQuery)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(hits) >= minCropHits {
+			return hits, cropQuery.Filter, nil
+		}
+		log.Printf("Only %d documents match crop %q; searching all crops", len(hits), sensors.CropType)
+	}
+	hits, err := ds.knowledge.SearchKnowledge(ctx, kq)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hits, q.Filter, nil
+}
+
+// sample generates the answer with the model's default settings and, in
+// parallel, the extra samples used to measure agreement. An extra sample
+// that fails outright is dropped; only the answer itself is required.
+func (ds *DecisionService) sample(ctx context.Context, messages []llm.Message, expect decision.Expect) ([]sample, error) {
+	results := make([]sample, ds.samples)
+	errs := make([]error, ds.samples)
+	var wg sync.WaitGroup
+	for i := range results {
+		var opts []llm.ChatOption
+		if i > 0 {
+			opts = append(opts, llm.WithOptions(map[string]interface{}{"temperature": sampleTemperature, "seed": i}))
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = ds.generate(ctx, messages, expect, opts...)
+		}(i)
+	}
+	wg.Wait()
+
+	if errs[0] != nil {
+		return nil, errs[0]
+	}
+	samples := []sample{results[0]}
+	for i := 1; i < len(results); i++ {
+		if errs[i] != nil {
+			log.Printf("Dropping decision sample %d: %v", i, errs[i])
+			continue
+		}
+		samples = append(samples, results[i])
+	}
+	return samples, nil
+}
+
+// generate asks for a structured recommendation, feeding validation
+// problems back to the model until it produces a valid reply or runs out of
+// attempts.
+func (ds *DecisionService) generate(ctx context.Context, messages []llm.Message, expect decision.Expect, opts ...llm.ChatOption) (sample, error) {
+	var s sample
+	opts = append(opts, llm.WithFormat(decision.Schema))
+	// The conversation grows with corrections; keep the caller's intact.
+	messages = append([]llm.Message(nil), messages...)
+	for s.attempts < maxDecisionAttempts {
+		s.attempts++
+		start := time.Now()
+		resp, err := ds.llm.Chat(ctx, messages, nil, opts...)
+		metrics.LLMRequestDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			return s, fmt.Errorf("failed to generate recommendation: %w", err)
+		}
+
+		s.raw = resp.Message.Content
+		out, err := decision.Parse(s.raw, expect)
+		if err == nil {
+			s.out, s.problems = out, nil
+			return s, nil
+		}
+		var invalid *decision.ValidationError
+		if !errors.As(err, &invalid) {
+			return s, err
+		}
+		s.problems = invalid.Problems
+		log.Printf("Recommendation attempt %d/%d did not match the schema: %v", s.attempts, maxDecisionAttempts, err)
+		messages = append(messages,
+			llm.Message{Role: "assistant", Content: s.raw},
+			llm.Message{Role: "user", Content: fmt.Sprintf(
+				"That reply did not match the required format: %s. Reply again with only the corrected JSON object.",
+				strings.Join(invalid.Problems, "; "))},
+		)
+	}
+	return s, nil
+}
+
+// targetField is the field actions apply to when the model leaves it out.
+func targetField(fieldID string) string {
+	if fieldID == "" {
+		return "unspecified"
+	}
+	return fieldID
+}
+
+// buildDecisionPrompt lays out the numbered knowledge documents, the
+// field's sensor data and the question in clearly delimited sections, so
+// the model can tell measured conditions apart from general guidance and
+// cite what it relies on.
+func buildDecisionPrompt(query string, citations []Citation, sensors *SensorContext, now time.Time) string {
+	var b strings.Builder
+	b.WriteString("You are an agricultural expert. Based on the following agricultural knowledge and sensor data, provide recommendations.\n\n")
+
+	b.WriteString("=== AGRICULTURAL KNOWLEDGE ===\n")
+	if len(citations) == 0 {
+		b.WriteString("No relevant documents were found. Answer from the sensor data and general agronomic practice only, " +
+			"say that no reference material supports the answer and do not cite any sources.\n")
+	}
+	for _, c := range citations {
+		fmt.Fprintf(&b, "[%d] %s", c.Number, c.Title)
+		var tags []string
+		if c.Category != "" {
+			tags = append(tags, "category: "+c.Category)
+		}
+		if c.Crop != "" {
+			tags = append(tags, "crop: "+c.Crop)
+		}
+		if len(c.Headings) > 0 {
+			tags = append(tags, "section: "+strings.Join(c.Headings, " > "))
+		}
+		if len(tags) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(tags, ", "))
+		}
+		fmt.Fprintf(&b, "\n%s\n\n", c.Content)
+	}
+	b.WriteString("=== END AGRICULTURAL KNOWLEDGE ===\n\n")
+
+	b.WriteString("=== SENSOR DATA ===\n")
+	if sensors.FieldID != "" {
+		fmt.Fprintf(&b, "Field: %s\n", sensors.FieldID)
+	}
+	if sensors.CropType != "" {
+		fmt.Fprintf(&b, "Crop: %s\n", sensors.CropType)
+	}
+	if sensors.Empty() {
+		b.WriteString("No sensor readings are available; do not assume any measured values.\n")
+	}
+	for _, r := range sensors.Readings {
+		fmt.Fprintf(&b, "- %s\n", r.Describe(now))
+	}
+	b.WriteString("=== END SENSOR DATA ===\n\n")
+
+	fmt.Fprintf(&b, "Question: %s\n\n", query)
+	b.WriteString("Provide practical recommendations with specific actions, referring to the sensor values you relied on. ")
+	if sensors.FieldID != "" {
+		fmt.Fprintf(&b, "Use %q as the target_field of actions for this field. ", sensors.FieldID)
+	}
+	b.WriteString(decision.Instructions)
+	return b.String()
+}
@@ -0,0 +1,139 @@
+// internal/services/expand.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"agricultural-iot-rag/internal/metrics"
+)
+
+// ExpansionOptions configure query expansion, which has the model turn a
+// short, colloquial question into agronomic search queries and, HyDE
+// style, a hypothetical answer, each searched alongside the question.
+type ExpansionOptions struct {
+	// Queries is the most rewritten queries asked for; 0 asks for none.
+	Queries int
+	// HyDE also searches with a hypothetical answer to the question.
+	HyDE bool
+}
+
+func (o ExpansionOptions) enabled() bool {
+	return o.Queries > 0 || o.HyDE
+}
+
+// QueryExpansion is what a question was expanded into.
+type QueryExpansion struct {
+	Queries      []string
+	Hypothetical string
+}
+
+// texts returns the expansion's search texts.
+func (e *QueryExpansion) texts() []string {
+	if e == nil {
+		return nil
+	}
+	texts := append([]string(nil), e.Queries...)
+	if e.Hypothetical != "" {
+		texts = append(texts, e.Hypothetical)
+	}
+	return texts
+}
+
+const rewritePrompt = `A farmer asked: %q%s
+Rewrite the question into up to %d short search queries for an agronomy knowledge base, using the technical terms a guide would use (crop stages, symptoms, pathogens, nutrients, practices). Cover different likely causes or topics.
+Reply with one query per line and nothing else.`
+
+const hydePrompt = `A farmer asked: %q%s
+Write the short passage, 2 to 4 sentences, of an agronomy guide that answers this question. Use technical terms and state the likely causes and remedies. Reply with the passage only.`
+
+// expand rewrites question as configured, using crop for context when it
+// is known. The rewritten queries and the hypothetical answer are
+// generated in parallel; if one fails, the other is still used.
+func (ds *DecisionService) expand(ctx context.Context, question, crop string) (*QueryExpansion, error) {
+	about := ""
+	if crop != "" {
+		about = fmt.Sprintf(" (the field grows %s)", crop)
+	}
+
+	start := time.Now()
+	defer func() {
+		metrics.RAGQueryDuration.WithLabelValues("query_expansion").Observe(time.Since(start).Seconds())
+	}()
+
+	var (
+		wg                sync.WaitGroup
+		exp               QueryExpansion
+		rewriteErr, hyErr error
+	)
+	if n := ds.expansion.Queries; n > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var reply string
+			if reply, rewriteErr = ds.complete(ctx, fmt.Sprintf(rewritePrompt, question, about, n)); rewriteErr == nil {
+				exp.Queries = parseQueries(reply, question, n)
+			}
+		}()
+	}
+	if ds.expansion.HyDE {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var reply string
+			if reply, hyErr = ds.complete(ctx, fmt.Sprintf(hydePrompt, question, about)); hyErr == nil {
+				exp.Hypothetical = strings.TrimSpace(reply)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if (ds.expansion.Queries == 0 || rewriteErr != nil) && (!ds.expansion.HyDE || hyErr != nil) {
+		return nil, fmt.Errorf("failed to expand query: %w", errors.Join(rewriteErr, hyErr))
+	}
+	if rewriteErr != nil {
+		log.Printf("Query rewriting failed, searching with the hypothetical answer only: %v", rewriteErr)
+	}
+	if hyErr != nil {
+		log.Printf("Hypothetical answer failed, searching with rewritten queries only: %v", hyErr)
+	}
+	return &exp, nil
+}
+
+// complete answers a single prompt, timing it like other model calls.
+func (ds *DecisionService) complete(ctx context.Context, prompt string) (string, error) {
+	start := time.Now()
+	reply, err := ds.llm.Generate(ctx, prompt)
+	metrics.LLMRequestDuration.Observe(time.Since(start).Seconds())
+	return reply, err
+}
+
+// listMarker matches a bullet or number starting a list item.
+var listMarker = regexp.MustCompile(`^(?:[-*•]|\d+[.)])\s*`)
+
+// parseQueries reads up to n queries, one per line, stripping list
+// markers and quotes and dropping repeats and the question itself.
+func parseQueries(reply, question string, n int) []string {
+	seen := map[string]bool{strings.ToLower(strings.TrimSpace(question)): true}
+	var queries []string
+	for _, line := range strings.Split(reply, "\n") {
+		q := listMarker.ReplaceAllString(strings.TrimSpace(line), "")
+		q = strings.Trim(q, "\"'` ")
+		key := strings.ToLower(q)
+		if q == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		queries = append(queries, q)
+		if len(queries) == n {
+			break
+		}
+	}
+	return queries
+}
@@ -0,0 +1,292 @@
+// internal/services/hybrid.go
+package services
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"agricultural-iot-rag/pkg/rag"
+
+	pb "github.com/qdrant/go-client/qdrant"
+)
+
+// HybridOptions configure hybrid retrieval, which ranks documents both by
+// embedding similarity and by BM25 keyword match and fuses the two
+// rankings by reciprocal rank fusion: a hit ranked r (from 1) by a
+// retriever gains weight/(RRFK+r) from it. Keyword search finds exact
+// terms such as pathogen names and fertilizer codes that embeddings blur.
+type HybridOptions struct {
+	// LexicalWeight weights the keyword ranking; 0 turns hybrid retrieval
+	// off and searches by embedding alone.
+	LexicalWeight float64
+	// SemanticWeight weights the embedding ranking; 0 means 1.
+	SemanticWeight float64
+	// RRFK damps the advantage of top ranks; 0 means defaultRRFK.
+	RRFK int
+	// Refresh is how old the keyword index may get before it is rebuilt
+	// from the vector store, picking up documents other processes such as
+	// the CLI stored; 0 means defaultKeywordRefresh.
+	Refresh time.Duration
+}
+
+// Hybrid retrieval defaults. 60 is the constant of the original RRF paper.
+const (
+	defaultRRFK           = 60
+	defaultKeywordRefresh = 5 * time.Minute
+)
+
+// Each retriever contributes candidatesPerHit candidates per requested
+// hit, and at least minCandidates, so fusion has enough to reorder.
+const (
+	candidatesPerHit = 4
+	minCandidates    = 20
+)
+
+func (o HybridOptions) enabled() bool {
+	return o.LexicalWeight > 0
+}
+
+func (o HybridOptions) normalize() HybridOptions {
+	if o.SemanticWeight == 0 {
+		o.SemanticWeight = 1
+	}
+	if o.RRFK <= 0 {
+		o.RRFK = defaultRRFK
+	}
+	if o.Refresh <= 0 {
+		o.Refresh = defaultKeywordRefresh
+	}
+	return o
+}
+
+// RankContribution is how one retriever ranked a hit: Rank from 1, the
+// retriever's own Score (cosine similarity or BM25) and the Contribution
+// that made to the fused score.
+type RankContribution struct {
+	Rank         int     `json:"rank"`
+	Score        float64 `json:"score"`
+	Contribution float64 `json:"contribution"`
+}
+
+// hybridSearch ranks the points most similar to queryEmbedding and those
+// best matching query's keywords, both restricted to filter, and returns
+// up to limit hits by fused score.
+func (ks *KnowledgeService) hybridSearch(ctx context.Context, query string, queryEmbedding []float32, filter *rag.Filter, limit int) ([]KnowledgeHit, error) {
+	candidates := max(limit*candidatesPerHit, minCandidates)
+	results, err := ks.vectorStore.Search(ctx, queryEmbedding, uint64(candidates), filter, ks.searchOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	type candidate struct {
+		hit   KnowledgeHit
+		fused float64
+	}
+	byPoint := map[string]*candidate{}
+	var order []string
+	add := func(pointID string, hit KnowledgeHit) *candidate {
+		c := &candidate{hit: hit}
+		byPoint[pointID] = c
+		order = append(order, pointID)
+		return c
+	}
+
+	rank := 0
+	for _, r := range results {
+		hit, ok := knowledgeHit(r.Payload, r.Score)
+		if !ok {
+			continue
+		}
+		rank++
+		hit.vector = r.GetVectors().GetVector().GetData()
+		c := add(rag.PointIDString(r.Id), hit)
+		contribution := ks.hybrid.SemanticWeight / float64(ks.hybrid.RRFK+rank)
+		c.hit.Semantic = &RankContribution{Rank: rank, Score: float64(r.Score), Contribution: contribution}
+		c.fused += contribution
+	}
+
+	for i, kw := range ks.keywordMatches(ctx, query, filter, candidates) {
+		c := byPoint[kw.id]
+		if c == nil {
+			vector := kw.point.GetVectors().GetVector().GetData()
+			hit, ok := knowledgeHit(kw.point.Payload, cosine(queryEmbedding, vector))
+			if !ok || hit.Score < ks.minScore {
+				// Keyword matches are held to the same minimum as
+				// embedding hits.
+				continue
+			}
+			hit.vector = vector
+			c = add(kw.id, hit)
+		}
+		contribution := ks.hybrid.LexicalWeight / float64(ks.hybrid.RRFK+i+1)
+		c.hit.Lexical = &RankContribution{Rank: i + 1, Score: kw.score, Contribution: contribution}
+		c.fused += contribution
+	}
+
+	fused := make([]*candidate, len(order))
+	for i, id := range order {
+		fused[i] = byPoint[id]
+	}
+	sort.SliceStable(fused, func(i, j int) bool {
+		if fused[i].fused != fused[j].fused {
+			return fused[i].fused > fused[j].fused
+		}
+		return fused[i].hit.Score > fused[j].hit.Score
+	})
+	hits := make([]KnowledgeHit, 0, min(limit, len(fused)))
+	for _, c := range fused[:min(limit, len(fused))] {
+		c.hit.FusedScore = c.fused
+		hits = append(hits, c.hit)
+	}
+	return hits, nil
+}
+
+type keywordMatch struct {
+	id    string
+	score float64
+	point *pb.RetrievedPoint
+}
+
+// keywordMatches returns up to limit points matching filter, best BM25
+// match for query first. Keyword search failing is logged and yields
+// nothing, leaving the embedding ranking alone.
+func (ks *KnowledgeService) keywordMatches(ctx context.Context, query string, filter *rag.Filter, limit int) []keywordMatch {
+	index, err := ks.keywordIndex(ctx)
+	if err != nil {
+		log.Printf("Keyword index unavailable, searching by embedding only: %v", err)
+		return nil
+	}
+	// The index does not know payloads; over-fetch so enough survive the
+	// filter, which also drops points deleted since the index was built.
+	hits := index.Search(query, limit*candidatesPerHit)
+	if len(hits) == 0 {
+		return nil
+	}
+	ids := make([]string, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+	}
+	points, err := ks.vectorStore.LookupPoints(ctx, ids, filter)
+	if err != nil {
+		log.Printf("Keyword match lookup failed, searching by embedding only: %v", err)
+		return nil
+	}
+	byID := make(map[string]*pb.RetrievedPoint, len(points))
+	for _, p := range points {
+		byID[rag.PointIDString(p.Id)] = p
+	}
+
+	var matches []keywordMatch
+	for _, h := range hits {
+		if p := byID[h.ID]; p != nil && len(matches) < limit {
+			matches = append(matches, keywordMatch{id: h.ID, score: h.Score, point: p})
+		}
+	}
+	return matches
+}
+
+// keywordIndex returns the keyword index, building it from the vector
+// store on first use. Once it is older than the refresh interval it is
+// rebuilt in the background while the current one keeps serving.
+func (ks *KnowledgeService) keywordIndex(ctx context.Context) (*rag.KeywordIndex, error) {
+	ks.keywordsMu.Lock()
+	defer ks.keywordsMu.Unlock()
+	if ks.keywords == nil {
+		index, err := ks.loadKeywordIndex(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ks.keywords, ks.keywordsBuilt = index, time.Now()
+		return index, nil
+	}
+	if !ks.keywordsLoading && time.Since(ks.keywordsBuilt) > ks.hybrid.Refresh {
+		ks.keywordsLoading = true
+		go ks.reloadKeywordIndex()
+	}
+	return ks.keywords, nil
+}
+
+func (ks *KnowledgeService) reloadKeywordIndex() {
+	index, err := ks.loadKeywordIndex(context.Background())
+	ks.keywordsMu.Lock()
+	defer ks.keywordsMu.Unlock()
+	pending := ks.keywordsPending
+	ks.keywordsLoading, ks.keywordsPending = false, nil
+	ks.keywordsBuilt = time.Now()
+	if err != nil {
+		log.Printf("Failed to refresh keyword index: %v", err)
+		return
+	}
+	// Replay changes made while loading, which the scan may have missed.
+	for _, update := range pending {
+		update(index)
+	}
+	ks.keywords = index
+}
+
+// loadKeywordIndex indexes every stored chunk by its headings and content.
+func (ks *KnowledgeService) loadKeywordIndex(ctx context.Context) (*rag.KeywordIndex, error) {
+	points, err := ks.vectorStore.ScanPoints(ctx, nil, rag.PayloadDocID, rag.PayloadContent, rag.PayloadHeadings)
+	if err != nil {
+		return nil, err
+	}
+	passages := map[string][]rag.Passage{}
+	for _, p := range points {
+		id := rag.PointIDString(p.Id)
+		docID := payloadString(p.Payload, rag.PayloadDocID)
+		if docID == "" {
+			// Stored before document IDs were kept: index the point alone.
+			docID = id
+		}
+		text := keywordText(payloadStrings(p.Payload, rag.PayloadHeadings), payloadString(p.Payload, rag.PayloadContent))
+		passages[docID] = append(passages[docID], rag.Passage{ID: id, Text: text})
+	}
+	index := rag.NewKeywordIndex()
+	for docID, ps := range passages {
+		index.Put(docID, ps)
+	}
+	return index, nil
+}
+
+// updateKeywords applies a change to the keyword index, if it is built,
+// and to the one being loaded.
+func (ks *KnowledgeService) updateKeywords(update func(*rag.KeywordIndex)) {
+	if !ks.hybrid.enabled() {
+		return
+	}
+	ks.keywordsMu.Lock()
+	defer ks.keywordsMu.Unlock()
+	if ks.keywords != nil {
+		update(ks.keywords)
+	}
+	if ks.keywordsLoading {
+		ks.keywordsPending = append(ks.keywordsPending, update)
+	}
+}
+
+func keywordText(headings []string, content string) string {
+	if len(headings) == 0 {
+		return content
+	}
+	return strings.Join(headings, " ") + "\n" + content
+}
+
+func cosine(a, b []float32) float32 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return float32(dot / math.Sqrt(na*nb))
+}
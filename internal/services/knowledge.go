@@ -3,9 +3,16 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
-	"agricultural-iot-rag/internal/models"
 	"agricultural-iot-rag/pkg/rag"
 
 	pb "github.com/qdrant/go-client/qdrant"
@@ -14,74 +21,710 @@ import (
 type KnowledgeService struct {
 	vectorStore *rag.VectorStore
 	embeddings  *rag.EmbeddingService
+	chunking    rag.ChunkOptions
+	hybrid      HybridOptions
+	rerankOpts  RerankOptions
+	diversity   DiversityOptions
+	minScore    float32
+
+	// The keyword index for hybrid retrieval, built on first use; see
+	// keywordIndex.
+	keywordsMu      sync.Mutex
+	keywords        *rag.KeywordIndex
+	keywordsBuilt   time.Time
+	keywordsLoading bool
+	keywordsPending []func(*rag.KeywordIndex)
+}
+
+// KnowledgeOptions tune how documents are stored and retrieved.
+type KnowledgeOptions struct {
+	// Chunking splits documents longer than one chunk; see rag.ChunkText.
+	Chunking rag.ChunkOptions
+	// Hybrid adds keyword matching to retrieval; the zero value searches
+	// by embedding alone.
+	Hybrid HybridOptions
+	// Rerank rescores an over-fetched set of hits; the zero value keeps
+	// the retrieval order.
+	Rerank RerankOptions
+	// Diversity selects hits by maximal marginal relevance; the zero value
+	// keeps the best-ranked ones.
+	Diversity DiversityOptions
+	// MinScore leaves out hits whose cosine similarity to the query is
+	// below it, so a search may find nothing; 0 keeps every hit.
+	MinScore float32
 }
 
-func NewKnowledgeService(vectorStore *rag.VectorStore, embeddings *rag.EmbeddingService) *KnowledgeService {
+func NewKnowledgeService(vectorStore *rag.VectorStore, embeddings *rag.EmbeddingService, opts KnowledgeOptions) *KnowledgeService {
 	return &KnowledgeService{
 		vectorStore: vectorStore,
 		embeddings:  embeddings,
+		chunking:    opts.Chunking,
+		hybrid:      opts.Hybrid.normalize(),
+		rerankOpts:  opts.Rerank.normalize(),
+		diversity:   opts.Diversity.normalize(),
+		minScore:    opts.MinScore,
 	}
 }
 
-func (ks *KnowledgeService) SearchKnowledge(ctx context.Context, query string, sensorData *models.SensorReading) ([]string, error) {
+// KnowledgeHit is one retrieved document with its similarity to the query.
+// ID is the ID the document was added under. Title falls back to the
+// opening of the content when the document has none. For documents stored
+// in chunks, Chunks lists the chunks the content comes from, ChunkStart and
+// ChunkEnd are its byte offsets within the source document and Headings is
+// the Markdown section it is in. Hybrid searches rank hits by FusedScore
+// and report how the embedding (Semantic) and keyword (Lexical) rankings
+// contributed to it; Score stays the cosine similarity either way.
+// RerankScore is set when a reranker reordered the hits.
+type KnowledgeHit struct {
+	ID          string            `json:"id"`
+	Score       float32           `json:"score"`
+	FusedScore  float64           `json:"fused_score,omitempty"`
+	Semantic    *RankContribution `json:"semantic,omitempty"`
+	Lexical     *RankContribution `json:"lexical,omitempty"`
+	RerankScore *float64          `json:"rerank_score,omitempty"`
+	Title       string            `json:"title"`
+	Category    string            `json:"category,omitempty"`
+	Crop        string            `json:"crop,omitempty"`
+	Chunks      []int             `json:"chunks,omitempty"`
+	ChunkStart  *int              `json:"chunk_start,omitempty"`
+	ChunkEnd    *int              `json:"chunk_end,omitempty"`
+	Headings    []string          `json:"headings,omitempty"`
+	Content     string            `json:"content"`
+
+	// vector is the hit's embedding, kept for MMR.
+	vector []float32
+}
+
+// titleLength caps titles derived from content.
+const titleLength = 80
+
+// defaultSearchLimit is the number of hits a search returns by default.
+const defaultSearchLimit = 5
+
+// KnowledgeQuery describes a knowledge search.
+type KnowledgeQuery struct {
+	Query string
+	// Sensors, when not empty, folds the field's crop and readings into
+	// the search text so retrieval favours documents about the current
+	// conditions.
+	Sensors *SensorContext
+	// Filter restricts the search to documents whose metadata matches;
+	// nil searches everything.
+	Filter *rag.Filter
+	// Expansion, when not nil, is searched as well as Query and the hits
+	// of all searches merged.
+	Expansion *QueryExpansion
+	// Limit is the number of hits; 0 means defaultSearchLimit.
+	Limit int
+	// MergeChunks joins hits that are adjacent chunks of one document into
+	// a single passage, so fewer than Limit hits may be returned.
+	MergeChunks bool
+}
+
+// SearchKnowledge returns the documents most relevant to q, best first.
+// With a reranker, the best candidates are retrieved and the top q.Limit
+// by rerank score are returned; with MMR, q.Limit of them are picked to
+// cover distinct topics.
+func (ks *KnowledgeService) SearchKnowledge(ctx context.Context, q KnowledgeQuery) ([]KnowledgeHit, error) {
 	// Enhance query with sensor context
-	enhancedQuery := ks.enhanceQueryWithSensorData(query, sensorData)
+	enhancedQuery := ks.enhanceQueryWithSensorData(q.Query, q.Sensors)
 
-	// Get embedding for the query
-	queryEmbedding, err := ks.embeddings.GetEmbedding(ctx, enhancedQuery)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get query embedding: %w", err)
+	// Keywords come from the question alone; sensor readings would only
+	// add noise terms. Expanded queries are searched as they are: they
+	// already name the topics.
+	expanded := q.Expansion.texts()
+	keywords := append([]string{q.Query}, expanded...)
+
+	// Get embeddings for the queries
+	var queryEmbeddings [][]float32
+	if len(expanded) == 0 {
+		embedding, err := ks.embeddings.GetEmbedding(ctx, enhancedQuery)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get query embedding: %w", err)
+		}
+		queryEmbeddings = [][]float32{embedding}
+	} else {
+		embeddings, err := ks.embeddings.GetEmbeddings(ctx, append([]string{enhancedQuery}, expanded...))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get query embeddings: %w", err)
+		}
+		queryEmbeddings = embeddings
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	fetch := limit
+	if ks.diversity.enabled() {
+		fetch = max(fetch, ks.diversity.Candidates)
+	}
+	if ks.rerankOpts.enabled() {
+		fetch = max(fetch, ks.rerankOpts.Candidates)
+	}
+
+	lists := make([][]KnowledgeHit, len(queryEmbeddings))
+	for i, embedding := range queryEmbeddings {
+		hits, err := ks.search(ctx, keywords[i], embedding, q.Filter, fetch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search knowledge base: %w", err)
+		}
+		lists[i] = hits
+	}
+	hits := lists[0]
+	if len(lists) > 1 {
+		hits = ks.mergeQueryHits(lists, fetch)
+	}
+
+	if ks.rerankOpts.enabled() {
+		// The reranker judges the question itself, like keyword search.
+		hits = ks.rerank(ctx, q.Query, hits)
+	}
+	if ks.diversity.enabled() {
+		hits = selectMMR(hits, limit, ks.diversity.Lambda)
+	}
+	hits = hits[:min(limit, len(hits))]
+	if q.MergeChunks {
+		hits = mergeChunks(hits)
+	}
+	return hits, nil
+}
+
+// search returns up to limit hits for one query: by embedding similarity
+// and, for hybrid retrieval, by keyword match too.
+func (ks *KnowledgeService) search(ctx context.Context, keywords string, embedding []float32, filter *rag.Filter, limit int) ([]KnowledgeHit, error) {
+	if ks.hybrid.enabled() {
+		return ks.hybridSearch(ctx, keywords, embedding, filter, limit)
 	}
 
 	// Search vector database
-	results, err := ks.vectorStore.Search(ctx, queryEmbedding, 5)
+	results, err := ks.vectorStore.Search(ctx, embedding, uint64(limit), filter, ks.searchOptions()...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search knowledge base: %w", err)
+		return nil, err
 	}
 
 	// Extract relevant documents
-	var documents []string
+	var hits []KnowledgeHit
 	for _, result := range results {
-		if result.Payload != nil {
-			if contentVal, ok := result.Payload["content"]; ok {
-				if content, ok := contentVal.GetKind().(*pb.Value_StringValue); ok {
-					documents = append(documents, content.StringValue)
+		if hit, ok := knowledgeHit(result.Payload, result.Score); ok {
+			hit.vector = result.GetVectors().GetVector().GetData()
+			hits = append(hits, hit)
+		}
+	}
+	return hits, nil
+}
+
+// mergeQueryHits merges the hits of several queries into up to limit
+// hits. Each passage found by more than one query is kept once, as the
+// query that ranked it best found it, and passages are ordered by
+// reciprocal rank fusion over the queries, so those several queries rank
+// well come first.
+func (ks *KnowledgeService) mergeQueryHits(lists [][]KnowledgeHit, limit int) []KnowledgeHit {
+	type merged struct {
+		hit   KnowledgeHit
+		rank  int
+		fused float64
+	}
+	byKey := map[string]*merged{}
+	var order []string
+	for _, hits := range lists {
+		for rank, h := range hits {
+			key := passageKey(h)
+			m := byKey[key]
+			if m == nil {
+				m = &merged{hit: h, rank: rank}
+				byKey[key] = m
+				order = append(order, key)
+			} else if rank < m.rank {
+				m.hit, m.rank = h, rank
+			}
+			m.fused += 1 / float64(ks.hybrid.RRFK+rank+1)
+		}
+	}
+	out := make([]*merged, len(order))
+	for i, key := range order {
+		out[i] = byKey[key]
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].fused > out[j].fused })
+	hits := make([]KnowledgeHit, 0, min(limit, len(out)))
+	for _, m := range out[:min(limit, len(out))] {
+		hits = append(hits, m.hit)
+	}
+	return hits
+}
+
+// passageKey identifies the stored passage a hit is: a document or one of
+// its chunks.
+func passageKey(h KnowledgeHit) string {
+	key := h.ID
+	if key == "" {
+		// Stored before document IDs were kept.
+		key = "content:" + h.Content
+	}
+	if len(h.Chunks) == 1 {
+		key += "#" + strconv.Itoa(h.Chunks[0])
+	}
+	return key
+}
+
+// searchOptions are the options of every vector search.
+func (ks *KnowledgeService) searchOptions() []rag.SearchOption {
+	var opts []rag.SearchOption
+	if ks.diversity.enabled() {
+		opts = append(opts, rag.WithVectors())
+	}
+	if ks.minScore > 0 {
+		opts = append(opts, rag.WithScoreThreshold(ks.minScore))
+	}
+	return opts
+}
+
+// mergeChunks joins runs of consecutive chunks of the same document into
+// one hit with the scores of the run's best-ranked chunk, placed where that chunk
+// ranked.
+func mergeChunks(hits []KnowledgeHit) []KnowledgeHit {
+	byDoc := map[string][]int{}
+	for i, h := range hits {
+		if len(h.Chunks) == 1 && h.ChunkStart != nil && h.ChunkEnd != nil {
+			byDoc[h.ID] = append(byDoc[h.ID], i)
+		}
+	}
+
+	// merged[i] replaces hit i; dropped hits were merged into another.
+	merged := map[int]KnowledgeHit{}
+	dropped := map[int]bool{}
+	for _, idx := range byDoc {
+		sort.Slice(idx, func(a, b int) bool { return hits[idx[a]].Chunks[0] < hits[idx[b]].Chunks[0] })
+		for start := 0; start < len(idx); {
+			end := start + 1
+			for end < len(idx) && hits[idx[end]].Chunks[0] == hits[idx[end-1]].Chunks[0]+1 {
+				end++
+			}
+			if end-start > 1 {
+				run := idx[start:end]
+				best := run[0]
+				var chunks []rag.Chunk
+				h := hits[run[0]]
+				h.Chunks = nil
+				for _, i := range run {
+					if i < best {
+						best = i
+					}
+					chunks = append(chunks, rag.Chunk{Text: hits[i].Content, Start: *hits[i].ChunkStart, End: *hits[i].ChunkEnd})
+					h.Chunks = append(h.Chunks, hits[i].Chunks[0])
+					dropped[i] = true
 				}
+				h.Score, h.FusedScore = hits[best].Score, hits[best].FusedScore
+				h.Semantic, h.Lexical = hits[best].Semantic, hits[best].Lexical
+				h.RerankScore = hits[best].RerankScore
+				h.ChunkEnd = hits[run[len(run)-1]].ChunkEnd
+				h.Content = rag.JoinChunks(chunks)
+				merged[best] = h
+				delete(dropped, best)
 			}
+			start = end
 		}
 	}
 
-	return documents, nil
+	out := make([]KnowledgeHit, 0, len(hits))
+	for i, h := range hits {
+		if m, ok := merged[i]; ok {
+			out = append(out, m)
+		} else if !dropped[i] {
+			out = append(out, h)
+		}
+	}
+	return out
 }
 
-func (ks *KnowledgeService) enhanceQueryWithSensorData(query string, sensorData *models.SensorReading) string {
-	if sensorData == nil {
-		return query
+// knowledgeHit reads a hit from a point's payload. Points without content
+// are skipped.
+func knowledgeHit(payload map[string]*pb.Value, score float32) (KnowledgeHit, bool) {
+	content := payloadString(payload, rag.PayloadContent)
+	if content == "" {
+		return KnowledgeHit{}, false
 	}
+	hit := KnowledgeHit{
+		ID:         payloadString(payload, rag.PayloadDocID),
+		Score:      score,
+		Title:      payloadString(payload, "title"),
+		Category:   payloadString(payload, "category"),
+		Crop:       payloadString(payload, "crop"),
+		ChunkStart: payloadInt(payload, rag.PayloadChunkStart),
+		ChunkEnd:   payloadInt(payload, rag.PayloadChunkEnd),
+		Headings:   payloadStrings(payload, rag.PayloadHeadings),
+		Content:    content,
+	}
+	if i := payloadInt(payload, rag.PayloadChunkIndex); i != nil {
+		hit.Chunks = []int{*i}
+	}
+	if hit.Title == "" {
+		hit.Title = deriveTitle(content)
+	}
+	return hit, true
+}
+
+// deriveTitle uses the first sentence or line of content, shortened to
+// titleLength runes.
+func deriveTitle(content string) string {
+	title := strings.TrimSpace(content)
+	if i := strings.IndexByte(title, '\n'); i > 0 {
+		title = title[:i]
+	}
+	if i := strings.Index(title, ". "); i > 0 {
+		title = title[:i]
+	}
+	title = strings.TrimSuffix(strings.TrimSpace(title), ".")
+	if runes := []rune(title); len(runes) > titleLength {
+		title = strings.TrimSpace(string(runes[:titleLength-1])) + "…"
+	}
+	return title
+}
 
-	context := fmt.Sprintf("Field context: Location %s, ", sensorData.Location.FieldID)
+// payloadString reads a string, joining lists of strings such as the crops
+// a document applies to.
+func payloadString(payload map[string]*pb.Value, key string) string {
+	switch v := payload[key].GetKind().(type) {
+	case *pb.Value_StringValue:
+		return v.StringValue
+	case *pb.Value_ListValue:
+		var parts []string
+		for _, e := range v.ListValue.GetValues() {
+			if s, ok := e.GetKind().(*pb.Value_StringValue); ok {
+				parts = append(parts, s.StringValue)
+			}
+		}
+		return strings.Join(parts, ", ")
+	}
+	return ""
+}
 
-	if soilMoisture, ok := sensorData.Measurements["soil_moisture"]; ok {
-		context += fmt.Sprintf("Soil moisture: %v%s, ", soilMoisture.Value, soilMoisture.Unit)
+// payloadStrings reads a list of strings.
+func payloadStrings(payload map[string]*pb.Value, key string) []string {
+	var out []string
+	for _, v := range payload[key].GetListValue().GetValues() {
+		if s, ok := v.GetKind().(*pb.Value_StringValue); ok {
+			out = append(out, s.StringValue)
+		}
+	}
+	return out
+}
+
+// payloadInt reads an integer stored either as a number or, as documents
+// added before metadata was typed have it, as a string.
+func payloadInt(payload map[string]*pb.Value, key string) *int {
+	switch v := payload[key].GetKind().(type) {
+	case *pb.Value_IntegerValue:
+		n := int(v.IntegerValue)
+		return &n
+	case *pb.Value_DoubleValue:
+		n := int(v.DoubleValue)
+		return &n
+	case *pb.Value_StringValue:
+		if n, err := strconv.Atoi(v.StringValue); err == nil {
+			return &n
+		}
 	}
+	return nil
+}
 
-	if temp, ok := sensorData.Measurements["soil_temperature"]; ok {
-		context += fmt.Sprintf("Soil temperature: %v%s, ", temp.Value, temp.Unit)
+func (ks *KnowledgeService) enhanceQueryWithSensorData(query string, sensors *SensorContext) string {
+	if sensors == nil || (sensors.Empty() && sensors.CropType == "") {
+		return query
 	}
 
-	if sensorData.Location.CropType != "" {
-		context += fmt.Sprintf("Crop type: %s, ", sensorData.Location.CropType)
+	context := "Field context: "
+	if sensors.FieldID != "" {
+		context += fmt.Sprintf("Location %s, ", sensors.FieldID)
+	}
+	if sensors.CropType != "" {
+		context += fmt.Sprintf("Crop type: %s, ", sensors.CropType)
+	}
+	for _, r := range sensors.Readings {
+		context += fmt.Sprintf("%s: %v%s", r.Measurement, r.Value, r.Unit)
+		if r.Trend != nil {
+			context += " " + r.Trend.Direction
+		}
+		context += ", "
 	}
 
 	return context + "Question: " + query
 }
 
-// AddKnowledge adds a new knowledge document to the vector store
+// embedBatchSize caps the texts embedded per request.
+const embedBatchSize = 32
+
+// AddKnowledge adds a knowledge document to the vector store, replacing
+// any document with the same ID. Documents longer than one chunk are
+// stored in chunks, each embedded together with its headings.
 func (ks *KnowledgeService) AddKnowledge(ctx context.Context, id, text string, metadata map[string]interface{}) error {
-	embedding, err := ks.embeddings.GetEmbedding(ctx, text)
+	return ks.AddKnowledgeBatch(ctx, []KnowledgeInput{{ID: id, Text: text, Metadata: metadata}})[0].Err
+}
+
+// KnowledgeInput is a document to add.
+type KnowledgeInput struct {
+	ID       string
+	Text     string
+	Metadata map[string]interface{}
+}
+
+// KnowledgeAdded reports how adding one document went: the number of
+// chunks stored (1 for documents stored whole) or why it failed.
+type KnowledgeAdded struct {
+	Chunks int
+	Err    error
+}
+
+// KnowledgeVersion identifies what a stored document was built from.
+// Adding a document whose version equals the stored one changes nothing.
+type KnowledgeVersion struct {
+	ContentHash    string `json:"content_hash"`
+	EmbeddingModel string `json:"embedding_model"`
+}
+
+// Version returns the version d would be stored with: a hash of its text,
+// metadata and the chunking options, and the embedding model.
+func (ks *KnowledgeService) Version(d KnowledgeInput) KnowledgeVersion {
+	// encoding/json sorts map keys, so equal metadata hashes equally.
+	data, _ := json.Marshal(struct {
+		Text     string
+		Metadata map[string]interface{}
+		Chunking rag.ChunkOptions
+	}{d.Text, d.Metadata, ks.chunking})
+	sum := sha256.Sum256(data)
+	return KnowledgeVersion{ContentHash: hex.EncodeToString(sum[:]), EmbeddingModel: ks.embeddings.Model()}
+}
+
+// StoredVersion is the version of a stored document, with the metadata
+// keys KnowledgeVersions was asked for.
+type StoredVersion struct {
+	ID string
+	KnowledgeVersion
+	Metadata map[string]interface{}
+}
+
+// KnowledgeVersions returns the version of every stored document matching
+// filter, which may be nil. Documents stored before versions were recorded
+// have empty ones.
+func (ks *KnowledgeService) KnowledgeVersions(ctx context.Context, filter *rag.Filter, metadataKeys ...string) ([]StoredVersion, error) {
+	keys := append([]string{rag.PayloadDocID, rag.PayloadContentHash, rag.PayloadEmbeddingModel}, metadataKeys...)
+	points, err := ks.vectorStore.ScanDocuments(ctx, filter, keys...)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]StoredVersion, 0, len(points))
+	for _, p := range points {
+		versions = append(versions, StoredVersion{
+			ID:               payloadString(p.Payload, rag.PayloadDocID),
+			KnowledgeVersion: storedVersion(p.Payload),
+			Metadata:         rag.PayloadMetadata(p.Payload),
+		})
+	}
+	return versions, nil
+}
+
+func storedVersion(payload map[string]*pb.Value) KnowledgeVersion {
+	return KnowledgeVersion{
+		ContentHash:    payloadString(payload, rag.PayloadContentHash),
+		EmbeddingModel: payloadString(payload, rag.PayloadEmbeddingModel),
+	}
+}
+
+// AddKnowledgeBatch adds documents as AddKnowledge does, embedding the
+// texts of all of them in batches of up to embedBatchSize. A failed batch
+// fails the documents with texts in it; the others are still stored. The
+// results are in the order of docs. Every document records its Version.
+func (ks *KnowledgeService) AddKnowledgeBatch(ctx context.Context, docs []KnowledgeInput) []KnowledgeAdded {
+	results := make([]KnowledgeAdded, len(docs))
+
+	// Collect every text to embed, remembering which document it is for.
+	type input struct {
+		doc  int
+		text string
+	}
+	var inputs []input
+	chunks := make([][]rag.Chunk, len(docs))
+	for i, d := range docs {
+		c, err := rag.ChunkText(d.Text, ks.chunking)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		if len(c) <= 1 {
+			inputs = append(inputs, input{i, d.Text})
+			results[i].Chunks = 1
+			continue
+		}
+		chunks[i] = c
+		results[i].Chunks = len(c)
+		for _, chunk := range c {
+			text := chunk.Text
+			if len(chunk.Headings) > 0 {
+				text = strings.Join(chunk.Headings, " > ") + "\n\n" + text
+			}
+			inputs = append(inputs, input{i, text})
+		}
+	}
+
+	embeddings := make([][][]float32, len(docs))
+	for start := 0; start < len(inputs); start += embedBatchSize {
+		batch := inputs[start:min(start+embedBatchSize, len(inputs))]
+		texts := make([]string, len(batch))
+		for j, in := range batch {
+			texts[j] = in.text
+		}
+		vectors, err := ks.embeddings.GetEmbeddings(ctx, texts)
+		for j, in := range batch {
+			if err != nil {
+				results[in.doc].Err = fmt.Errorf("failed to get embedding: %w", err)
+				continue
+			}
+			embeddings[in.doc] = append(embeddings[in.doc], vectors[j])
+		}
+	}
+
+	for i, d := range docs {
+		if results[i].Err != nil {
+			results[i].Chunks = 0
+			continue
+		}
+		version := ks.Version(d)
+		metadata := make(map[string]interface{}, len(d.Metadata)+2)
+		for k, v := range d.Metadata {
+			metadata[k] = v
+		}
+		metadata[rag.PayloadContentHash] = version.ContentHash
+		metadata[rag.PayloadEmbeddingModel] = version.EmbeddingModel
+		var passages []rag.Passage
+		if chunks[i] == nil {
+			results[i].Err = ks.vectorStore.AddDocument(ctx, d.ID, d.Text, embeddings[i][0], metadata)
+			passages = []rag.Passage{{ID: rag.PointID(d.ID), Text: d.Text}}
+		} else {
+			results[i].Err = ks.vectorStore.AddChunks(ctx, d.ID, chunks[i], embeddings[i], metadata)
+			for _, c := range chunks[i] {
+				passages = append(passages, rag.Passage{ID: rag.ChunkPointID(d.ID, c.Index), Text: keywordText(c.Headings, c.Text)})
+			}
+		}
+		if results[i].Err != nil {
+			results[i].Chunks = 0
+			continue
+		}
+		id := d.ID
+		ks.updateKeywords(func(index *rag.KeywordIndex) { index.Put(id, passages) })
+	}
+	return results
+}
+
+// KnowledgeDocument is a stored document. Metadata holds everything it was
+// added with besides its ID and content. Chunks is the number of chunks
+// a long document is stored in.
+type KnowledgeDocument struct {
+	ID             string                 `json:"id"`
+	Title          string                 `json:"title"`
+	Content        string                 `json:"content"`
+	Chunks         int                    `json:"chunks,omitempty"`
+	ContentHash    string                 `json:"content_hash,omitempty"`
+	EmbeddingModel string                 `json:"embedding_model,omitempty"`
+	Metadata       map[string]interface{} `json:"metadata"`
+}
+
+// Document listing page sizes.
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// KnowledgeListQuery selects a page of documents. Cursor is "" for the
+// first page and a previous page's NextCursor after that.
+type KnowledgeListQuery struct {
+	Filter *rag.Filter
+	Limit  int
+	Cursor string
+}
+
+// KnowledgePage is one page of documents. NextCursor is "" on the last
+// page.
+type KnowledgePage struct {
+	Documents  []KnowledgeDocument `json:"documents"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+// GetKnowledge returns the document stored under id, or
+// rag.ErrDocumentNotFound.
+func (ks *KnowledgeService) GetKnowledge(ctx context.Context, id string) (*KnowledgeDocument, error) {
+	points, err := ks.vectorStore.GetDocument(ctx, id)
 	if err != nil {
-		return fmt.Errorf("failed to get embedding: %w", err)
+		return nil, err
 	}
+	doc := knowledgeDocument(points[0].Payload, id)
+	if len(points) > 1 {
+		chunks := make([]rag.Chunk, len(points))
+		for i, p := range points {
+			chunks[i] = rag.Chunk{Text: payloadString(p.Payload, rag.PayloadContent)}
+			if start, end := payloadInt(p.Payload, rag.PayloadChunkStart), payloadInt(p.Payload, rag.PayloadChunkEnd); start != nil && end != nil {
+				chunks[i].Start, chunks[i].End = *start, *end
+			}
+		}
+		doc.Content = rag.JoinChunks(chunks)
+		doc.Chunks = len(points)
+	}
+	return &doc, nil
+}
+
+// DeleteKnowledge removes the document stored under id, or returns
+// rag.ErrDocumentNotFound.
+func (ks *KnowledgeService) DeleteKnowledge(ctx context.Context, id string) error {
+	if err := ks.vectorStore.DeleteDocument(ctx, id); err != nil {
+		return err
+	}
+	ks.updateKeywords(func(index *rag.KeywordIndex) { index.Delete(id) })
+	return nil
+}
+
+// ListKnowledge pages through the stored documents matching q.Filter.
+// Limits default to 50 and are capped at 500.
+func (ks *KnowledgeService) ListKnowledge(ctx context.Context, q KnowledgeListQuery) (*KnowledgePage, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	limit = min(limit, maxListLimit)
+
+	points, next, err := ks.vectorStore.ListDocuments(ctx, q.Filter, uint32(limit), q.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	page := &KnowledgePage{Documents: make([]KnowledgeDocument, len(points)), NextCursor: next}
+	for i, p := range points {
+		page.Documents[i] = knowledgeDocument(p.Payload, "")
+		if payloadInt(p.Payload, rag.PayloadChunkCount) != nil {
+			// Only the first chunk was listed; assemble the rest.
+			doc, err := ks.GetKnowledge(ctx, page.Documents[i].ID)
+			if err != nil {
+				return nil, err
+			}
+			page.Documents[i] = *doc
+		}
+	}
+	return page, nil
+}
 
-	return ks.vectorStore.AddDocument(ctx, id, text, embedding, metadata)
+// knowledgeDocument reads a document from a point's payload. id is used
+// when the payload has none, as for points stored before IDs were kept.
+func knowledgeDocument(payload map[string]*pb.Value, id string) KnowledgeDocument {
+	doc := KnowledgeDocument{
+		ID:       payloadString(payload, rag.PayloadDocID),
+		Title:    payloadString(payload, "title"),
+		Content:  payloadString(payload, rag.PayloadContent),
+		Metadata: rag.PayloadMetadata(payload),
+	}
+	version := storedVersion(payload)
+	doc.ContentHash, doc.EmbeddingModel = version.ContentHash, version.EmbeddingModel
+	if doc.ID == "" {
+		doc.ID = id
+	}
+	if doc.Title == "" {
+		doc.Title = deriveTitle(doc.Content)
+	}
+	return doc
 }
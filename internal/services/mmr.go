@@ -0,0 +1,73 @@
+// internal/services/mmr.go
+package services
+
+import "math"
+
+// DiversityOptions configure maximal marginal relevance (MMR) selection,
+// which picks hits one at a time by
+//
+//	Lambda*relevance - (1-Lambda)*max similarity to the hits already picked
+//
+// so near-duplicates of a picked hit give way to hits on other topics.
+// Relevance falls linearly from 1 for the best-ranked candidate, so it
+// follows whichever ranking came before (similarity, fusion or rerank)
+// whatever its scale; similarity is the cosine of the hits' embeddings.
+type DiversityOptions struct {
+	// Lambda trades relevance (1) against diversity (0); 0 and 1 turn
+	// MMR off.
+	Lambda float64
+	// Candidates is how many hits MMR chooses from; 0 means
+	// defaultMMRCandidates.
+	Candidates int
+}
+
+// defaultMMRCandidates is how many hits MMR chooses from by default.
+const defaultMMRCandidates = 20
+
+func (o DiversityOptions) enabled() bool {
+	return o.Lambda > 0 && o.Lambda < 1
+}
+
+func (o DiversityOptions) normalize() DiversityOptions {
+	if o.Candidates <= 0 {
+		o.Candidates = defaultMMRCandidates
+	}
+	return o
+}
+
+// selectMMR returns up to limit of hits, which are ordered best first, in
+// the order MMR picks them.
+func selectMMR(hits []KnowledgeHit, limit int, lambda float64) []KnowledgeHit {
+	if len(hits) <= 1 {
+		return hits
+	}
+	relevance := make([]float64, len(hits))
+	for i := range hits {
+		relevance[i] = 1 - float64(i)/float64(len(hits))
+	}
+
+	// redundancy[i] is the highest similarity of hit i to a picked hit.
+	redundancy := make([]float64, len(hits))
+	picked := make([]bool, len(hits))
+	selected := make([]KnowledgeHit, 0, min(limit, len(hits)))
+	for len(selected) < cap(selected) {
+		best, bestScore := -1, math.Inf(-1)
+		for i := range hits {
+			if picked[i] {
+				continue
+			}
+			score := lambda*relevance[i] - (1-lambda)*redundancy[i]
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		picked[best] = true
+		selected = append(selected, hits[best])
+		for i := range hits {
+			if !picked[i] {
+				redundancy[i] = math.Max(redundancy[i], float64(cosine(hits[i].vector, hits[best].vector)))
+			}
+		}
+	}
+	return selected
+}
@@ -0,0 +1,197 @@
+// internal/services/registry.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"agricultural-iot-rag/internal/models"
+	"agricultural-iot-rag/internal/storage"
+)
+
+// ErrInvalidInput is returned when a registry request fails validation.
+var ErrInvalidInput = errors.New("invalid input")
+
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,255}$`)
+
+// RegistryService manages the registered fields and devices.
+type RegistryService struct {
+	db storage.Store
+}
+
+// NewRegistryService creates the registry service. db may be nil, in which
+// case every operation returns ErrRegistryUnavailable.
+func NewRegistryService(db storage.Store) *RegistryService {
+	return &RegistryService{
+		db: db,
+	}
+}
+
+func (rs *RegistryService) CreateField(ctx context.Context, f *models.Field) error {
+	if rs.db == nil {
+		return ErrRegistryUnavailable
+	}
+	if !idPattern.MatchString(f.ID) {
+		return fmt.Errorf("%w: id must be 1-255 letters, digits or _.:-", ErrInvalidInput)
+	}
+	f.Name = strings.TrimSpace(f.Name)
+	if f.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+	f.CropType = normalizeCrop(f.CropType)
+	if err := validateField(f.AreaHectares, f.Location); err != nil {
+		return err
+	}
+	return rs.db.CreateField(ctx, f)
+}
+
+func (rs *RegistryService) GetField(ctx context.Context, id string) (*models.Field, error) {
+	if rs.db == nil {
+		return nil, ErrRegistryUnavailable
+	}
+	return rs.db.GetField(ctx, id)
+}
+
+func (rs *RegistryService) ListFields(ctx context.Context, filter storage.FieldFilter) ([]models.Field, error) {
+	if rs.db == nil {
+		return nil, ErrRegistryUnavailable
+	}
+	filter.CropType = normalizeCrop(filter.CropType)
+	return rs.db.ListFields(ctx, filter)
+}
+
+func (rs *RegistryService) UpdateField(ctx context.Context, id string, u models.FieldUpdate) (*models.Field, error) {
+	if rs.db == nil {
+		return nil, ErrRegistryUnavailable
+	}
+	if u.Name != nil {
+		name := strings.TrimSpace(*u.Name)
+		if name == "" {
+			return nil, fmt.Errorf("%w: name cannot be empty", ErrInvalidInput)
+		}
+		u.Name = &name
+	}
+	if u.CropType != nil {
+		crop := normalizeCrop(*u.CropType)
+		u.CropType = &crop
+	}
+	if err := validateField(u.AreaHectares, u.Location); err != nil {
+		return nil, err
+	}
+	return rs.db.UpdateField(ctx, id, u)
+}
+
+// RetireField hides a field from listings and statistics while keeping
+// its history.
+func (rs *RegistryService) RetireField(ctx context.Context, id string) error {
+	if rs.db == nil {
+		return ErrRegistryUnavailable
+	}
+	return rs.db.RetireField(ctx, id)
+}
+
+func (rs *RegistryService) CreateDevice(ctx context.Context, d *models.Device) error {
+	if rs.db == nil {
+		return ErrRegistryUnavailable
+	}
+	if !idPattern.MatchString(d.ID) {
+		return fmt.Errorf("%w: id must be 1-255 letters, digits or _.:-", ErrInvalidInput)
+	}
+	if d.Status == "" {
+		d.Status = models.DeviceStatusActive
+	}
+	if err := validateDeviceStatus(d.Status); err != nil {
+		return err
+	}
+	if err := rs.checkAssignableField(ctx, d.FieldID); err != nil {
+		return err
+	}
+	return rs.db.CreateDevice(ctx, d)
+}
+
+func (rs *RegistryService) GetDevice(ctx context.Context, id string) (*models.Device, error) {
+	if rs.db == nil {
+		return nil, ErrRegistryUnavailable
+	}
+	return rs.db.GetDevice(ctx, id)
+}
+
+func (rs *RegistryService) ListDevices(ctx context.Context, filter storage.DeviceFilter) ([]models.Device, error) {
+	if rs.db == nil {
+		return nil, ErrRegistryUnavailable
+	}
+	return rs.db.ListDevices(ctx, filter)
+}
+
+func (rs *RegistryService) UpdateDevice(ctx context.Context, id string, u models.DeviceUpdate) (*models.Device, error) {
+	if rs.db == nil {
+		return nil, ErrRegistryUnavailable
+	}
+	if u.Status != nil {
+		if err := validateDeviceStatus(*u.Status); err != nil {
+			return nil, err
+		}
+	}
+	if u.FieldID != nil {
+		if err := rs.checkAssignableField(ctx, *u.FieldID); err != nil {
+			return nil, err
+		}
+	}
+	return rs.db.UpdateDevice(ctx, id, u)
+}
+
+// RetireDevice stops accepting readings from a device.
+func (rs *RegistryService) RetireDevice(ctx context.Context, id string) error {
+	if rs.db == nil {
+		return ErrRegistryUnavailable
+	}
+	return rs.db.RetireDevice(ctx, id)
+}
+
+// checkAssignableField verifies that a device can be assigned to fieldID.
+// An empty fieldID means unassigned and is always allowed.
+func (rs *RegistryService) checkAssignableField(ctx context.Context, fieldID string) error {
+	if fieldID == "" {
+		return nil
+	}
+	field, err := rs.db.GetField(ctx, fieldID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("%w: field %s does not exist", ErrInvalidInput, fieldID)
+	}
+	if err != nil {
+		return err
+	}
+	if field.RetiredAt != nil {
+		return fmt.Errorf("%w: field %s is retired", ErrInvalidInput, fieldID)
+	}
+	return nil
+}
+
+func validateField(area *float64, location json.RawMessage) error {
+	if area != nil && *area < 0 {
+		return fmt.Errorf("%w: area_hectares cannot be negative", ErrInvalidInput)
+	}
+	if len(location) > 0 && string(location) != "null" {
+		var obj map[string]interface{}
+		if err := json.Unmarshal(location, &obj); err != nil {
+			return fmt.Errorf("%w: location must be a JSON object", ErrInvalidInput)
+		}
+	}
+	return nil
+}
+
+func validateDeviceStatus(status string) error {
+	switch status {
+	case models.DeviceStatusActive, models.DeviceStatusInactive, models.DeviceStatusQuarantined, models.DeviceStatusRetired:
+		return nil
+	}
+	return fmt.Errorf("%w: unknown device status %q", ErrInvalidInput, status)
+}
+
+func normalizeCrop(crop string) string {
+	return strings.ToLower(strings.TrimSpace(crop))
+}
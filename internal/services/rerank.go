@@ -0,0 +1,187 @@
+// internal/services/rerank.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"agricultural-iot-rag/internal/metrics"
+	"agricultural-iot-rag/pkg/llm"
+	"agricultural-iot-rag/pkg/rag"
+)
+
+// Reranker scores passages by their relevance to a query, returning one
+// score per passage in order; higher is more relevant. Scores only need to
+// be comparable within one call.
+type Reranker interface {
+	Rerank(ctx context.Context, query string, passages []string) ([]float64, error)
+}
+
+// Reranker kinds accepted by NewReranker.
+const (
+	RerankerModel   = "model"
+	RerankerLLM     = "llm"
+	RerankerLexical = "lexical"
+)
+
+// NewReranker returns the reranker of the given kind, or nil for "":
+// RerankerModel sends passages to a cross-encoder behind the rerank
+// endpoint at url, RerankerLLM asks the chat model at url to rate them and
+// RerankerLexical scores them by BM25 without calling out.
+func NewReranker(kind, url, model string) (Reranker, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case RerankerModel:
+		if url == "" || model == "" {
+			return nil, fmt.Errorf("reranker %q needs a rerank endpoint URL and a model", kind)
+		}
+		return rag.NewRerankService(url, model), nil
+	case RerankerLLM:
+		return NewLLMReranker(llm.NewOllamaClient(url, model)), nil
+	case RerankerLexical:
+		return LexicalReranker{}, nil
+	}
+	return nil, fmt.Errorf("unknown reranker %q (want %s, %s or %s)", kind, RerankerModel, RerankerLLM, RerankerLexical)
+}
+
+// RerankOptions configure the rerank stage, which rescores the best
+// Candidates hits of a search with Reranker and keeps the top ones.
+type RerankOptions struct {
+	// Reranker rescores candidates; nil turns reranking off.
+	Reranker Reranker
+	// Candidates is how many hits are fetched for reranking; 0 means
+	// defaultRerankCandidates.
+	Candidates int
+}
+
+// defaultRerankCandidates is how many hits are reranked by default.
+const defaultRerankCandidates = 30
+
+func (o RerankOptions) enabled() bool {
+	return o.Reranker != nil
+}
+
+func (o RerankOptions) normalize() RerankOptions {
+	if o.Candidates <= 0 {
+		o.Candidates = defaultRerankCandidates
+	}
+	return o
+}
+
+// rerank orders hits by the reranker's scores for query, recording each
+// in RerankScore. Ties keep the retrieval order. If the reranker fails the
+// hits are returned as they were.
+func (ks *KnowledgeService) rerank(ctx context.Context, query string, hits []KnowledgeHit) []KnowledgeHit {
+	if len(hits) == 0 {
+		return hits
+	}
+	passages := make([]string, len(hits))
+	for i, h := range hits {
+		passages[i] = keywordText(h.Headings, h.Content)
+	}
+
+	start := time.Now()
+	scores, err := ks.rerankOpts.Reranker.Rerank(ctx, query, passages)
+	metrics.RAGQueryDuration.WithLabelValues("rerank").Observe(time.Since(start).Seconds())
+	if err == nil && len(scores) != len(hits) {
+		err = fmt.Errorf("got %d scores for %d passages", len(scores), len(hits))
+	}
+	if err != nil {
+		log.Printf("Reranking failed, keeping retrieval order: %v", err)
+		return hits
+	}
+
+	reranked := make([]KnowledgeHit, len(hits))
+	for i, h := range hits {
+		score := scores[i]
+		h.RerankScore = &score
+		reranked[i] = h
+	}
+	sort.SliceStable(reranked, func(i, j int) bool {
+		return *reranked[i].RerankScore > *reranked[j].RerankScore
+	})
+	return reranked
+}
+
+// LexicalReranker scores passages by BM25 with term statistics taken from
+// the passages themselves. It needs no model, so it suits gateways, but
+// only rewards shared words.
+type LexicalReranker struct{}
+
+func (LexicalReranker) Rerank(_ context.Context, query string, passages []string) ([]float64, error) {
+	index := rag.NewKeywordIndex()
+	for i, p := range passages {
+		id := strconv.Itoa(i)
+		index.Put(id, []rag.Passage{{ID: id, Text: p}})
+	}
+	scores := make([]float64, len(passages))
+	for _, hit := range index.Search(query, len(passages)) {
+		i, _ := strconv.Atoi(hit.ID)
+		scores[i] = hit.Score
+	}
+	return scores, nil
+}
+
+// LLMReranker asks a chat model to rate how well each passage answers the
+// query, from 0 to 10, a few passages per request so prompts stay within
+// small context windows.
+type LLMReranker struct {
+	llm *llm.OllamaClient
+}
+
+func NewLLMReranker(client *llm.OllamaClient) *LLMReranker {
+	return &LLMReranker{llm: client}
+}
+
+// llmRerankBatch is how many passages one relevance prompt rates.
+const llmRerankBatch = 8
+
+// llmRerankSchema constrains the reply to a list of ratings.
+var llmRerankSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "scores": {"type": "array", "items": {"type": "number", "minimum": 0, "maximum": 10}}
+  },
+  "required": ["scores"]
+}`)
+
+const llmRerankPrompt = `Rate how relevant each numbered passage is to answering the question, from 0 (unrelated) to 10 (answers it directly).
+Reply with JSON {"scores": [...]} holding one rating per passage, in passage order.
+
+Question: %s
+
+%s`
+
+func (r *LLMReranker) Rerank(ctx context.Context, query string, passages []string) ([]float64, error) {
+	scores := make([]float64, 0, len(passages))
+	for start := 0; start < len(passages); start += llmRerankBatch {
+		batch := passages[start:min(start+llmRerankBatch, len(passages))]
+		var listed strings.Builder
+		for i, p := range batch {
+			fmt.Fprintf(&listed, "[%d] %s\n\n", i+1, strings.TrimSpace(p))
+		}
+		messages := []llm.Message{{Role: "user", Content: fmt.Sprintf(llmRerankPrompt, query, listed.String())}}
+		resp, err := r.llm.Chat(ctx, messages, nil, llm.WithFormat(llmRerankSchema), llm.WithOptions(map[string]interface{}{"temperature": 0}))
+		if err != nil {
+			return nil, fmt.Errorf("failed to rate passages: %w", err)
+		}
+		var reply struct {
+			Scores []float64 `json:"scores"`
+		}
+		if err := json.Unmarshal([]byte(resp.Message.Content), &reply); err != nil {
+			return nil, fmt.Errorf("failed to parse passage ratings: %w", err)
+		}
+		if len(reply.Scores) != len(batch) {
+			return nil, fmt.Errorf("got %d ratings for %d passages", len(reply.Scores), len(batch))
+		}
+		scores = append(scores, reply.Scores...)
+	}
+	return scores, nil
+}
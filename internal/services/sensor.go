@@ -0,0 +1,312 @@
+// internal/services/sensor.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"agricultural-iot-rag/internal/metrics"
+	"agricultural-iot-rag/internal/models"
+	"agricultural-iot-rag/internal/storage"
+)
+
+// ErrInvalidReading is returned when a reading is missing required fields.
+var ErrInvalidReading = errors.New("invalid sensor reading")
+
+// ErrRegistryUnavailable is returned by operations that need the field
+// registry when the server runs without a relational store.
+var ErrRegistryUnavailable = errors.New("field registry unavailable")
+
+// ErrUnregisteredDevice is returned when a reading comes from a device that
+// is retired, or unknown while the reject policy is in effect.
+var ErrUnregisteredDevice = errors.New("device not registered")
+
+// ErrReadingQuarantined is returned when a reading was held for review
+// instead of being stored with the field's data.
+var ErrReadingQuarantined = errors.New("reading quarantined")
+
+// Policies for readings from devices missing from the registry.
+const (
+	UnregisteredQuarantine = "quarantine"
+	UnregisteredReject     = "reject"
+)
+
+// Measurements averaged per crop in fleet statistics.
+const (
+	soilMoistureMeasurement = "soil_moisture"
+	temperatureMeasurement  = "air_temperature"
+)
+
+// SensorService is the single ingestion path for sensor readings, shared by
+// the HTTP API and the MQTT processor.
+type SensorService struct {
+	timeseries         storage.TimeSeries
+	db                 storage.Store
+	alerts             *AlertService
+	unregisteredPolicy string
+}
+
+// NewSensorService creates the sensor service. db may be nil, in which case
+// registry-backed features such as fleet statistics and device checks are
+// unavailable. unregisteredPolicy is UnregisteredQuarantine or
+// UnregisteredReject. alerts, if not nil, evaluates alert rules against
+// every stored reading.
+func NewSensorService(timeseries storage.TimeSeries, db storage.Store, alerts *AlertService, unregisteredPolicy string) *SensorService {
+	return &SensorService{
+		timeseries:         timeseries,
+		db:                 db,
+		alerts:             alerts,
+		unregisteredPolicy: unregisteredPolicy,
+	}
+}
+
+// Ingest validates a reading, fills in defaults and persists it. When the
+// registry is available the device must be registered: readings from a
+// device assigned to a field are attributed to that field, and the device's
+// last_seen is updated. Stored readings are then checked against the alert
+// rules.
+func (s *SensorService) Ingest(ctx context.Context, reading *models.SensorReading) error {
+	if reading.DeviceID == "" {
+		return fmt.Errorf("%w: device_id is required", ErrInvalidReading)
+	}
+	if s.db != nil {
+		if err := s.checkDevice(ctx, reading); err != nil {
+			return err
+		}
+	}
+	if reading.Location.FieldID == "" {
+		return fmt.Errorf("%w: location.field_id is required", ErrInvalidReading)
+	}
+	if reading.Timestamp.IsZero() {
+		reading.Timestamp = time.Now().UTC()
+	}
+
+	if err := s.timeseries.WriteReading(ctx, *reading); err != nil {
+		return fmt.Errorf("failed to store reading: %w", err)
+	}
+
+	metrics.SensorDataReceived.WithLabelValues(deviceType(reading.DeviceID), reading.Location.FieldID).Inc()
+
+	if s.db != nil {
+		// The reading is already stored; a stale last_seen is not worth
+		// failing the request over.
+		if err := s.db.TouchDevice(ctx, reading.DeviceID, reading.Timestamp); err != nil {
+			log.Printf("Failed to update last_seen for %s: %v", reading.DeviceID, err)
+		}
+	}
+	if s.alerts != nil {
+		if err := s.alerts.Evaluate(ctx, *reading); err != nil {
+			log.Printf("Failed to evaluate alert rules for %s: %v", reading.Location.FieldID, err)
+		}
+	}
+	return nil
+}
+
+// checkDevice applies the registry policy to a reading's device.
+func (s *SensorService) checkDevice(ctx context.Context, reading *models.SensorReading) error {
+	device, err := s.db.GetDevice(ctx, reading.DeviceID)
+	if errors.Is(err, storage.ErrNotFound) {
+		if s.unregisteredPolicy == UnregisteredReject {
+			return fmt.Errorf("%w: %s", ErrUnregisteredDevice, reading.DeviceID)
+		}
+		return s.quarantine(ctx, reading)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up device: %w", err)
+	}
+
+	switch device.Status {
+	case models.DeviceStatusRetired:
+		return fmt.Errorf("%w: %s is retired", ErrUnregisteredDevice, reading.DeviceID)
+	case models.DeviceStatusQuarantined:
+		return s.quarantine(ctx, reading)
+	}
+	if device.FieldID != "" {
+		reading.Location.FieldID = device.FieldID
+	}
+	return nil
+}
+
+func (s *SensorService) quarantine(ctx context.Context, reading *models.SensorReading) error {
+	if reading.Timestamp.IsZero() {
+		reading.Timestamp = time.Now().UTC()
+	}
+	if err := s.db.QuarantineReading(ctx, *reading); err != nil {
+		return err
+	}
+	return ErrReadingQuarantined
+}
+
+// LatestReading returns the most recent stored reading for a field, or
+// storage.ErrNotFound.
+func (s *SensorService) LatestReading(ctx context.Context, fieldID string) (*models.SensorReading, error) {
+	return s.timeseries.LatestReading(ctx, fieldID)
+}
+
+// History returns one page of windowed aggregates for a field's measurement.
+func (s *SensorService) History(ctx context.Context, q storage.HistoryQuery) (*storage.HistoryPage, error) {
+	return s.timeseries.History(ctx, q)
+}
+
+// FleetStats summarizes registered fields, recently active sensors, open
+// alerts and per-crop conditions.
+type FleetStats struct {
+	CropType            string `json:"crop_type,omitempty"`
+	ActiveWindowMinutes int    `json:"active_window_minutes"`
+	TotalFields         int    `json:"total_fields"`
+	ActiveFields        int    `json:"active_fields"`
+	ActiveSensors       int    `json:"active_sensors"`
+	// OpenAlerts counts unresolved alerts by severity; UnresolvedAlerts
+	// splits the same alerts by lifecycle state.
+	OpenAlerts       map[string]int `json:"open_alerts"`
+	TotalOpenAlerts  int            `json:"total_open_alerts"`
+	UnresolvedAlerts map[string]int `json:"unresolved_alerts"`
+	AvgSoilMoisture  *float64       `json:"avg_soil_moisture"`
+	AvgTemperature   *float64       `json:"avg_temperature"`
+	Crops            []CropStats    `json:"crops"`
+}
+
+// CropStats holds averages across the fields growing one crop. Averages
+// are nil when no field of the crop reported in the window.
+type CropStats struct {
+	CropType        string   `json:"crop_type"`
+	Fields          int      `json:"fields"`
+	ActiveFields    int      `json:"active_fields"`
+	AvgSoilMoisture *float64 `json:"avg_soil_moisture"`
+	AvgTemperature  *float64 `json:"avg_temperature"`
+}
+
+// FleetStats computes statistics from the field registry and the readings
+// received within activeWindow. An empty cropType covers all crops.
+func (s *SensorService) FleetStats(ctx context.Context, cropType string, activeWindow time.Duration) (*FleetStats, error) {
+	if s.db == nil {
+		return nil, ErrRegistryUnavailable
+	}
+
+	fieldCrops, err := s.db.FieldCrops(ctx, cropType)
+	if err != nil {
+		return nil, err
+	}
+	alertCounts, err := s.db.UnresolvedAlerts(ctx, cropType, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	activity, err := s.timeseries.RecentActivity(ctx, activeWindow)
+	if err != nil {
+		return nil, err
+	}
+	moisture, err := s.timeseries.FieldMeans(ctx, soilMoistureMeasurement, activeWindow)
+	if err != nil {
+		return nil, err
+	}
+	temperature, err := s.timeseries.FieldMeans(ctx, temperatureMeasurement, activeWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &FleetStats{
+		CropType:            cropType,
+		ActiveWindowMinutes: int(activeWindow / time.Minute),
+		TotalFields:         len(fieldCrops),
+		OpenAlerts:          map[string]int{},
+		UnresolvedAlerts: map[string]int{
+			models.AlertStateOpen:         0,
+			models.AlertStateAcknowledged: 0,
+			models.AlertStateSnoozed:      0,
+		},
+	}
+	for _, c := range alertCounts {
+		stats.OpenAlerts[c.Severity] += c.Count
+		stats.UnresolvedAlerts[c.State] += c.Count
+		stats.TotalOpenAlerts += c.Count
+	}
+
+	activeFields := map[string]bool{}
+	activeDevices := map[string]bool{}
+	for _, a := range activity {
+		if _, registered := fieldCrops[a.FieldID]; cropType != "" && !registered {
+			continue
+		}
+		activeDevices[a.DeviceID] = true
+		activeFields[a.FieldID] = true
+	}
+	stats.ActiveSensors = len(activeDevices)
+
+	byCrop := map[string]*CropStats{}
+	var cropNames []string
+	var allMoisture, allTemperature []float64
+	cropMoisture := map[string][]float64{}
+	cropTemperature := map[string][]float64{}
+	for fieldID, crop := range fieldCrops {
+		cs, ok := byCrop[crop]
+		if !ok {
+			cs = &CropStats{CropType: crop}
+			byCrop[crop] = cs
+			cropNames = append(cropNames, crop)
+		}
+		cs.Fields++
+		if activeFields[fieldID] {
+			cs.ActiveFields++
+			stats.ActiveFields++
+		}
+		if v, ok := moisture[fieldID]; ok {
+			cropMoisture[crop] = append(cropMoisture[crop], v)
+			allMoisture = append(allMoisture, v)
+		}
+		if v, ok := temperature[fieldID]; ok {
+			cropTemperature[crop] = append(cropTemperature[crop], v)
+			allTemperature = append(allTemperature, v)
+		}
+	}
+
+	sort.Strings(cropNames)
+	stats.Crops = make([]CropStats, 0, len(cropNames))
+	for _, crop := range cropNames {
+		cs := byCrop[crop]
+		cs.AvgSoilMoisture = average(cropMoisture[crop])
+		cs.AvgTemperature = average(cropTemperature[crop])
+		stats.Crops = append(stats.Crops, *cs)
+	}
+	stats.AvgSoilMoisture = average(allMoisture)
+	stats.AvgTemperature = average(allTemperature)
+
+	return stats, nil
+}
+
+func average(values []float64) *float64 {
+	if len(values) == 0 {
+		return nil
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	avg := math.Round(sum/float64(len(values))*100) / 100
+	return &avg
+}
+
+// unknownDeviceType labels readings from devices whose ID has no serial.
+const unknownDeviceType = "unknown"
+
+// deviceType strips the trailing serial from a device ID such as
+// "soil_sensor_001" so the metric label stays low-cardinality. IDs
+// without a numeric serial share unknownDeviceType rather than each
+// becoming a series of their own.
+func deviceType(deviceID string) string {
+	i := strings.LastIndex(deviceID, "_")
+	if i <= 0 || i == len(deviceID)-1 {
+		return unknownDeviceType
+	}
+	for _, r := range deviceID[i+1:] {
+		if r < '0' || r > '9' {
+			return unknownDeviceType
+		}
+	}
+	return deviceID[:i]
+}
@@ -0,0 +1,252 @@
+// internal/services/sensor_context.go
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"agricultural-iot-rag/internal/storage"
+)
+
+// Reading sources reported with each measurement a decision used.
+const (
+	ReadingSourceLatest  = "latest"
+	ReadingSourceRequest = "request"
+)
+
+// Trend settings: hourly means over the last day.
+const (
+	trendRange  = 24 * time.Hour
+	trendWindow = time.Hour
+)
+
+// SensorContext is the field data a decision is grounded in.
+type SensorContext struct {
+	FieldID  string
+	CropType string
+	Readings []ReadingUsed
+}
+
+// ReadingUsed is one measurement fed into retrieval and the prompt.
+// Timestamp and DeviceID are unknown for values supplied with the request.
+type ReadingUsed struct {
+	Measurement string      `json:"measurement"`
+	Value       interface{} `json:"value"`
+	Unit        string      `json:"unit,omitempty"`
+	Quality     string      `json:"quality,omitempty"`
+	DeviceID    string      `json:"device_id,omitempty"`
+	Timestamp   *time.Time  `json:"timestamp,omitempty"`
+	Source      string      `json:"source"`
+	Trend       *Trend      `json:"trend,omitempty"`
+}
+
+// Trend summarizes how a measurement moved over the trend range, from the
+// first to the last hourly mean with data.
+type Trend struct {
+	Range     string  `json:"range"`
+	From      float64 `json:"from"`
+	To        float64 `json:"to"`
+	Change    float64 `json:"change"`
+	Direction string  `json:"direction"`
+	Samples   int     `json:"samples"`
+}
+
+// Empty reports whether there is no sensor data to use.
+func (sc *SensorContext) Empty() bool {
+	return sc == nil || len(sc.Readings) == 0
+}
+
+// SensorContext gathers the readings a decision for fieldID should use:
+// the newest stored value of each of the field's measurements, whichever
+// device reported it, with a trend per numeric measurement, overlaid with
+// any values supplied in the request. Either part may be
+// missing. Storage failures are logged rather than returned, so a decision
+// can still be made from knowledge alone; malformed supplied values are an
+// ErrInvalidReading.
+func (s *SensorService) SensorContext(ctx context.Context, fieldID string, supplied map[string]interface{}) (*SensorContext, error) {
+	sc := &SensorContext{FieldID: fieldID}
+	byMeasurement := map[string]ReadingUsed{}
+
+	if fieldID != "" {
+		latest, err := s.timeseries.LatestMeasurements(ctx, fieldID)
+		if err != nil {
+			log.Printf("Failed to load latest readings for %s: %v", fieldID, err)
+		}
+		var cropAt time.Time
+		for _, m := range latest {
+			if m.CropType != "" && m.Timestamp.After(cropAt) {
+				sc.CropType, cropAt = m.CropType, m.Timestamp
+			}
+			ts := m.Timestamp
+			byMeasurement[m.Name] = ReadingUsed{
+				Measurement: m.Name,
+				Value:       m.Value,
+				Unit:        m.Unit,
+				Quality:     m.Quality,
+				DeviceID:    m.DeviceID,
+				Timestamp:   &ts,
+				Source:      ReadingSourceLatest,
+			}
+		}
+		if sc.CropType == "" && s.db != nil {
+			if field, err := s.db.GetField(ctx, fieldID); err == nil {
+				sc.CropType = field.CropType
+			}
+		}
+	}
+
+	for name, raw := range supplied {
+		if name == "crop_type" {
+			crop, ok := raw.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: sensor_data.crop_type must be a string", ErrInvalidReading)
+			}
+			sc.CropType = crop
+			continue
+		}
+		r, err := suppliedReading(name, raw)
+		if err != nil {
+			return nil, err
+		}
+		byMeasurement[name] = r
+	}
+
+	for _, r := range byMeasurement {
+		if fieldID != "" {
+			r.Trend = s.trend(ctx, fieldID, r)
+		}
+		sc.Readings = append(sc.Readings, r)
+	}
+	sort.Slice(sc.Readings, func(i, j int) bool {
+		return sc.Readings[i].Measurement < sc.Readings[j].Measurement
+	})
+	return sc, nil
+}
+
+// suppliedReading parses one sensor_data entry, either a bare number or an
+// object with value, unit and quality.
+func suppliedReading(name string, raw interface{}) (ReadingUsed, error) {
+	r := ReadingUsed{Measurement: name, Source: ReadingSourceRequest}
+	switch v := raw.(type) {
+	case map[string]interface{}:
+		value, ok := numericValue(v["value"])
+		if !ok {
+			return r, fmt.Errorf("%w: sensor_data.%s.value must be a number", ErrInvalidReading, name)
+		}
+		r.Value = value
+		r.Unit, _ = v["unit"].(string)
+		r.Quality, _ = v["quality"].(string)
+	default:
+		value, ok := numericValue(v)
+		if !ok {
+			return r, fmt.Errorf("%w: sensor_data.%s must be a number or an object with a value", ErrInvalidReading, name)
+		}
+		r.Value = value
+	}
+	return r, nil
+}
+
+// trend returns the recent trend of a numeric reading, or nil when there
+// are fewer than two hourly means to compare. The reading's own device is
+// preferred when several report the measurement.
+func (s *SensorService) trend(ctx context.Context, fieldID string, r ReadingUsed) *Trend {
+	if _, ok := numericValue(r.Value); !ok {
+		return nil
+	}
+	now := time.Now().UTC()
+	page, err := s.timeseries.History(ctx, storage.HistoryQuery{
+		FieldID:     fieldID,
+		Measurement: r.Measurement,
+		From:        now.Add(-trendRange),
+		To:          now,
+		Window:      trendWindow,
+		Agg:         storage.AggMean,
+	})
+	if err != nil {
+		log.Printf("Failed to load %s trend for %s: %v", r.Measurement, fieldID, err)
+		return nil
+	}
+	if len(page.Series) == 0 {
+		return nil
+	}
+
+	series := page.Series[0]
+	for _, ds := range page.Series {
+		if ds.DeviceID == r.DeviceID {
+			series = ds
+			break
+		}
+	}
+	var values []float64
+	for _, p := range series.Points {
+		if p.Value != nil {
+			values = append(values, *p.Value)
+		}
+	}
+	if len(values) < 2 {
+		return nil
+	}
+
+	first, last := values[0], values[len(values)-1]
+	t := &Trend{
+		Range:   "24h",
+		From:    round2(first),
+		To:      round2(last),
+		Change:  round2(last - first),
+		Samples: len(values),
+	}
+	// Moves within 2% of the starting level count as steady.
+	switch threshold := 0.02 * math.Max(math.Abs(first), 1); {
+	case t.Change > threshold:
+		t.Direction = "rising"
+	case t.Change < -threshold:
+		t.Direction = "falling"
+	default:
+		t.Direction = "steady"
+	}
+	return t
+}
+
+// Describe renders one reading for prompts, e.g. "soil_moisture: 22.5 %
+// (device soil_sensor_001, 40m ago; 24h trend: falling from 30.1 to 22.5)".
+func (r ReadingUsed) Describe(now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %v", r.Measurement, r.Value)
+	if r.Unit != "" {
+		fmt.Fprintf(&b, " %s", r.Unit)
+	}
+
+	var notes []string
+	switch {
+	case r.Source == ReadingSourceRequest:
+		notes = append(notes, "reported with the question")
+	case r.Timestamp != nil:
+		notes = append(notes, fmt.Sprintf("device %s, %s", r.DeviceID, formatAge(now.Sub(*r.Timestamp))))
+	}
+	if r.Quality != "" && r.Quality != "good" {
+		notes = append(notes, "quality "+r.Quality)
+	}
+	if r.Trend != nil {
+		notes = append(notes, fmt.Sprintf("%s trend: %s from %v to %v", r.Trend.Range, r.Trend.Direction, r.Trend.From, r.Trend.To))
+	}
+	if len(notes) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(notes, "; "))
+	}
+	return b.String()
+}
+
+func formatAge(d time.Duration) string {
+	if d < time.Minute {
+		return "just now"
+	}
+	return strings.TrimSuffix(d.Round(time.Minute).String(), "0s") + " ago"
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
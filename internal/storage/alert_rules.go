@@ -0,0 +1,90 @@
+// internal/storage/alert_rules.go
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"agricultural-iot-rag/internal/models"
+)
+
+const alertRuleColumns = `id, name, expression, severity, hysteresis, debounce_minutes, enabled, created_at, updated_at`
+
+func scanAlertRule(row interface{ Scan(...interface{}) error }) (*models.AlertRule, error) {
+	var r models.AlertRule
+	if err := row.Scan(&r.ID, &r.Name, &r.Expression, &r.Severity, &r.Hysteresis, &r.DebounceMinutes, &r.Enabled, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// CreateAlertRule inserts a rule and sets its ID.
+func (s *sqlStore) CreateAlertRule(ctx context.Context, r *models.AlertRule) error {
+	now := time.Now().UTC()
+	r.CreatedAt, r.UpdatedAt = now, now
+
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO alert_rules (name, expression, severity, hysteresis, debounce_minutes, enabled, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`,
+		r.Name, r.Expression, r.Severity, r.Hysteresis, r.DebounceMinutes, r.Enabled, now, now).Scan(&r.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create alert rule: %w", err)
+	}
+	return nil
+}
+
+// GetAlertRule returns a rule or ErrNotFound.
+func (s *sqlStore) GetAlertRule(ctx context.Context, id int64) (*models.AlertRule, error) {
+	r, err := scanAlertRule(s.db.QueryRowContext(ctx, `SELECT `+alertRuleColumns+` FROM alert_rules WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return r, err
+}
+
+func (s *sqlStore) ListAlertRules(ctx context.Context) ([]models.AlertRule, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+alertRuleColumns+` FROM alert_rules ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alert rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []models.AlertRule{}
+	for rows.Next() {
+		r, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *r)
+	}
+	return rules, rows.Err()
+}
+
+// UpdateAlertRule replaces every editable column of rule r.ID.
+func (s *sqlStore) UpdateAlertRule(ctx context.Context, r *models.AlertRule) error {
+	r.UpdatedAt = time.Now().UTC()
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE alert_rules SET
+			name = $2, expression = $3, severity = $4, hysteresis = $5,
+			debounce_minutes = $6, enabled = $7, updated_at = $8
+		WHERE id = $1`,
+		r.ID, r.Name, r.Expression, r.Severity, r.Hysteresis, r.DebounceMinutes, r.Enabled, r.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update alert rule: %w", err)
+	}
+	return notFoundIfUnchanged(res)
+}
+
+// DeleteAlertRule removes a rule. Alerts it raised are kept with their
+// rule_id cleared.
+func (s *sqlStore) DeleteAlertRule(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM alert_rules WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete alert rule: %w", err)
+	}
+	return notFoundIfUnchanged(res)
+}
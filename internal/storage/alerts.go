@@ -0,0 +1,261 @@
+// internal/storage/alerts.go
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"agricultural-iot-rag/internal/models"
+)
+
+// DefaultAlertLimit caps ListAlerts when the filter sets no limit.
+const DefaultAlertLimit = 100
+
+// AlertFilter narrows ListAlerts. A nil Resolved matches both states; a
+// zero From or To leaves that end of the created_at range open.
+type AlertFilter struct {
+	FieldID  string
+	Severity string
+	Resolved *bool
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+// AlertCount is the number of unresolved alerts with one severity in one
+// lifecycle state.
+type AlertCount struct {
+	Severity string
+	State    string
+	Count    int
+}
+
+const alertColumns = `id, COALESCE(field_id, ''), COALESCE(alert_type, ''), COALESCE(severity, ''), COALESCE(message, ''), rule_id, value, acknowledged_at, COALESCE(acknowledged_by, ''), snoozed_until, resolved, created_at, resolved_at`
+
+func scanAlert(row interface{ Scan(...interface{}) error }) (*models.Alert, error) {
+	var a models.Alert
+	var ruleID sql.NullInt64
+	var value sql.NullFloat64
+	var acknowledgedAt, snoozedUntil, resolvedAt sql.NullTime
+	if err := row.Scan(&a.ID, &a.FieldID, &a.AlertType, &a.Severity, &a.Message, &ruleID, &value,
+		&acknowledgedAt, &a.AcknowledgedBy, &snoozedUntil, &a.Resolved, &a.CreatedAt, &resolvedAt); err != nil {
+		return nil, err
+	}
+	if acknowledgedAt.Valid {
+		a.AcknowledgedAt = &acknowledgedAt.Time
+	}
+	if snoozedUntil.Valid {
+		a.SnoozedUntil = &snoozedUntil.Time
+	}
+	if ruleID.Valid {
+		a.RuleID = &ruleID.Int64
+	}
+	if value.Valid {
+		a.Value = &value.Float64
+	}
+	if resolvedAt.Valid {
+		a.ResolvedAt = &resolvedAt.Time
+	}
+	a.State = a.StateAt(time.Now())
+	return &a, nil
+}
+
+// CreateAlert inserts an open alert and sets its ID.
+func (s *sqlStore) CreateAlert(ctx context.Context, a *models.Alert) error {
+	a.CreatedAt = time.Now().UTC()
+	a.Resolved = false
+	a.ResolvedAt = nil
+	a.State = models.AlertStateOpen
+
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO alerts (field_id, alert_type, severity, message, rule_id, value, resolved, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, FALSE, $7)
+		RETURNING id`,
+		nullString(a.FieldID), a.AlertType, a.Severity, a.Message, a.RuleID, a.Value, a.CreatedAt).Scan(&a.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create alert: %w", err)
+	}
+	return nil
+}
+
+// GetAlert returns an alert or ErrNotFound.
+func (s *sqlStore) GetAlert(ctx context.Context, id int64) (*models.Alert, error) {
+	a, err := scanAlert(s.db.QueryRowContext(ctx, `SELECT `+alertColumns+` FROM alerts WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return a, err
+}
+
+// ListAlerts returns matching alerts, newest first.
+func (s *sqlStore) ListAlerts(ctx context.Context, filter AlertFilter) ([]models.Alert, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultAlertLimit
+	}
+	// Open ends of the range become bounds no alert falls outside, which
+	// keeps the query free of nullable time parameters.
+	from, to := filter.From, filter.To
+	if from.IsZero() {
+		from = time.Unix(0, 0)
+	}
+	if to.IsZero() {
+		to = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+alertColumns+`
+		FROM alerts
+		WHERE ($1 = '' OR field_id = $1)
+			AND ($2 = '' OR severity = $2)
+			AND ($3 = '' OR resolved = ($3 = 'true'))
+			AND created_at >= $4 AND created_at < $5
+		ORDER BY created_at DESC, id DESC
+		LIMIT $6`,
+		filter.FieldID, filter.Severity, boolFilter(filter.Resolved), from.UTC(), to.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alerts: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := []models.Alert{}
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, *a)
+	}
+	return alerts, rows.Err()
+}
+
+// AcknowledgeAlert marks an unresolved alert as acknowledged by e.Actor and
+// records e in its audit trail. It returns ErrNotFound if the alert does
+// not exist or is already resolved.
+func (s *sqlStore) AcknowledgeAlert(ctx context.Context, e *models.AlertEvent) error {
+	e.Action = models.AlertActionAcknowledge
+	return s.transitionAlert(ctx, e, `
+		UPDATE alerts SET acknowledged_at = $2, acknowledged_by = $3
+		WHERE id = $1 AND resolved = FALSE`, e.Actor)
+}
+
+// ResolveAlert marks an unresolved alert as resolved and records e in its
+// audit trail. It returns ErrNotFound if the alert does not exist or is
+// already resolved.
+func (s *sqlStore) ResolveAlert(ctx context.Context, e *models.AlertEvent) error {
+	e.Action = models.AlertActionResolve
+	return s.transitionAlert(ctx, e, `
+		UPDATE alerts SET resolved = TRUE, resolved_at = $2
+		WHERE id = $1 AND resolved = FALSE`)
+}
+
+// SnoozeAlert snoozes an unresolved alert until e.SnoozedUntil and records
+// e in its audit trail. It returns ErrNotFound if the alert does not exist
+// or is already resolved.
+func (s *sqlStore) SnoozeAlert(ctx context.Context, e *models.AlertEvent) error {
+	e.Action = models.AlertActionSnooze
+	return s.transitionAlert(ctx, e, `
+		UPDATE alerts SET snoozed_until = $3
+		WHERE id = $1 AND resolved = FALSE`, e.SnoozedUntil.UTC())
+}
+
+// transitionAlert applies update, whose first two parameters are the alert
+// ID and the transition time, and appends e to the audit trail in the same
+// transaction.
+func (s *sqlStore) transitionAlert(ctx context.Context, e *models.AlertEvent, update string, args ...interface{}) error {
+	e.CreatedAt = time.Now().UTC()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, update, append([]interface{}{e.AlertID, e.CreatedAt}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to %s alert: %w", e.Action, err)
+	}
+	if err := notFoundIfUnchanged(res); err != nil {
+		return err
+	}
+
+	var snoozedUntil interface{}
+	if e.SnoozedUntil != nil {
+		snoozedUntil = e.SnoozedUntil.UTC()
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO alert_events (alert_id, action, actor, note, snoozed_until, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		e.AlertID, e.Action, e.Actor, nullString(e.Note), snoozedUntil, e.CreatedAt).Scan(&e.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record alert event: %w", err)
+	}
+	return tx.Commit()
+}
+
+// AlertEvents returns an alert's audit trail, oldest first.
+func (s *sqlStore) AlertEvents(ctx context.Context, alertID int64) ([]models.AlertEvent, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, alert_id, action, actor, COALESCE(note, ''), snoozed_until, created_at
+		FROM alert_events
+		WHERE alert_id = $1
+		ORDER BY created_at, id`, alertID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alert events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.AlertEvent{}
+	for rows.Next() {
+		var e models.AlertEvent
+		var snoozedUntil sql.NullTime
+		if err := rows.Scan(&e.ID, &e.AlertID, &e.Action, &e.Actor, &e.Note, &snoozedUntil, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if snoozedUntil.Valid {
+			e.SnoozedUntil = &snoozedUntil.Time
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// OpenRuleAlerts returns the unresolved alerts raised by alert rules, so
+// the rule engine can pick up where it left off after a restart.
+func (s *sqlStore) OpenRuleAlerts(ctx context.Context) ([]models.Alert, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+alertColumns+`
+		FROM alerts
+		WHERE rule_id IS NOT NULL AND resolved = FALSE
+		ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rule alerts: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := []models.Alert{}
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, *a)
+	}
+	return alerts, rows.Err()
+}
+
+// boolFilter encodes an optional boolean as "", "true" or "false" so one
+// query text works for both dialects.
+func boolFilter(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	if *b {
+		return "true"
+	}
+	return "false"
+}
@@ -2,13 +2,64 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
 	"time"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// Storage drivers accepted by Open.
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
 )
 
+// Open connects to the relational store selected by driver. dsn is a
+// Postgres connection string or a SQLite file path.
+func Open(driver, dsn string) (Store, error) {
+	// Return a nil interface on error rather than a typed nil pointer.
+	switch driver {
+	case DriverPostgres:
+		db, err := NewPostgresDB(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case DriverSQLite:
+		db, err := NewSQLiteDB(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
+}
+
+// sqlStore implements Store on database/sql. The queries are written in
+// the subset of SQL shared by Postgres and SQLite; dialect holds the rest.
+type sqlStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+type dialect struct {
+	name string
+	// migrations is the directory under migrations/ for this dialect.
+	migrations string
+	// lock serializes migrations across processes on conn.
+	lock func(ctx context.Context, conn *sql.Conn) (unlock func(), err error)
+}
+
+// PostgresDB is the Store used by the central server.
 type PostgresDB struct {
-	db *sql.DB
+	sqlStore
 }
 
 func NewPostgresDB(dsn string) (*PostgresDB, error) {
@@ -25,54 +76,73 @@ func NewPostgresDB(dsn string) (*PostgresDB, error) {
 
 	// Test connection
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &PostgresDB{db: db}, nil
+	return &PostgresDB{sqlStore{db: db, dialect: postgresDialect}}, nil
+}
+
+var postgresDialect = dialect{
+	name:       DriverPostgres,
+	migrations: "postgres",
+	lock: func(ctx context.Context, conn *sql.Conn) (func(), error) {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+			return nil, err
+		}
+		return func() {
+			conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+		}, nil
+	},
+}
+
+// SQLiteDB is the embedded Store for edge gateways that cannot run
+// Postgres. It uses a pure-Go driver, so binaries stay CGO-free.
+type SQLiteDB struct {
+	sqlStore
+}
+
+// NewSQLiteDB opens or creates the database file at path.
+func NewSQLiteDB(path string) (*SQLiteDB, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
+		}
+	}
+
+	// Times are written in SQLite's own format, which sorts correctly as
+	// text, and write transactions take the lock up front so concurrent
+	// writers wait on busy_timeout instead of failing mid-transaction.
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Set("_time_format", "sqlite")
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	return &SQLiteDB{sqlStore{db: db, dialect: sqliteDialect}}, nil
 }
 
-func (p *PostgresDB) Close() error {
-	return p.db.Close()
+// SQLite has no advisory locks. Each migration runs in an immediate
+// transaction that re-checks schema_migrations, which is enough to keep two
+// processes from applying the same migration.
+var sqliteDialect = dialect{
+	name:       DriverSQLite,
+	migrations: "sqlite",
+	lock: func(context.Context, *sql.Conn) (func(), error) {
+		return func() {}, nil
+	},
 }
 
-func (p *PostgresDB) InitSchema() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS fields (
-		id VARCHAR(255) PRIMARY KEY,
-		name VARCHAR(255) NOT NULL,
-		location JSONB,
-		crop_type VARCHAR(100),
-		area_hectares DECIMAL(10,2),
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TABLE IF NOT EXISTS devices (
-		id VARCHAR(255) PRIMARY KEY,
-		field_id VARCHAR(255) REFERENCES fields(id),
-		device_type VARCHAR(100),
-		status VARCHAR(50),
-		last_seen TIMESTAMP,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TABLE IF NOT EXISTS alerts (
-		id SERIAL PRIMARY KEY,
-		field_id VARCHAR(255) REFERENCES fields(id),
-		alert_type VARCHAR(100),
-		severity VARCHAR(50),
-		message TEXT,
-		resolved BOOLEAN DEFAULT FALSE,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		resolved_at TIMESTAMP
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_fields_crop_type ON fields(crop_type);
-	CREATE INDEX IF NOT EXISTS idx_devices_field_id ON devices(field_id);
-	CREATE INDEX IF NOT EXISTS idx_alerts_field_id ON alerts(field_id);
-	CREATE INDEX IF NOT EXISTS idx_alerts_resolved ON alerts(resolved);
-	`
-
-	_, err := p.db.Exec(schema)
-	return err
+func (s *sqlStore) Close() error {
+	return s.db.Close()
 }
@@ -0,0 +1,176 @@
+// internal/storage/history.go
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// ErrInvalidQuery is returned when a history query fails validation.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Aggregation functions accepted by History.
+const (
+	AggMean = "mean"
+	AggMin  = "min"
+	AggMax  = "max"
+	AggLast = "last"
+)
+
+// DefaultHistoryLimit is the number of windows returned per page when the
+// caller does not ask for a specific page size.
+const DefaultHistoryLimit = 500
+
+// MaxHistoryLimit caps the page size to keep responses bounded.
+const MaxHistoryLimit = 5000
+
+// HistoryQuery selects one measurement of a field over a time range,
+// bucketed into fixed windows.
+type HistoryQuery struct {
+	FieldID     string
+	Measurement string
+	From        time.Time
+	To          time.Time
+	Window      time.Duration
+	Agg         string
+	// Limit is the maximum number of windows in one page.
+	Limit int
+}
+
+// HistoryPoint is one aggregation window. Value is nil and Gap is true
+// when no data was recorded in the window.
+type HistoryPoint struct {
+	Time  time.Time `json:"time"`
+	Value *float64  `json:"value"`
+	Gap   bool      `json:"gap,omitempty"`
+}
+
+// DeviceSeries is the bucketed history of one device.
+type DeviceSeries struct {
+	DeviceID string         `json:"device_id"`
+	Unit     string         `json:"unit,omitempty"`
+	Points   []HistoryPoint `json:"points"`
+}
+
+// HistoryPage is one page of a history query. NextFrom is set when the
+// requested range continues past this page.
+type HistoryPage struct {
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Series   []DeviceSeries `json:"series"`
+	NextFrom *time.Time     `json:"next_from,omitempty"`
+}
+
+// Validate checks the query and applies defaults.
+func (q *HistoryQuery) Validate() error {
+	if q.FieldID == "" || q.Measurement == "" {
+		return fmt.Errorf("%w: field and measurement are required", ErrInvalidQuery)
+	}
+	if q.Window < time.Second {
+		return fmt.Errorf("%w: window must be at least 1s", ErrInvalidQuery)
+	}
+	if !q.From.Before(q.To) {
+		return fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+	switch q.Agg {
+	case "":
+		q.Agg = AggMean
+	case AggMean, AggMin, AggMax, AggLast:
+	default:
+		return fmt.Errorf("%w: unsupported aggregation %q", ErrInvalidQuery, q.Agg)
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultHistoryLimit
+	}
+	if q.Limit > MaxHistoryLimit {
+		q.Limit = MaxHistoryLimit
+	}
+	return nil
+}
+
+// page returns the window-aligned bounds of the page starting at q.From.
+func (q HistoryQuery) page() (from, to time.Time, next *time.Time) {
+	from = WindowStart(q.From, q.Window)
+	to = from.Add(time.Duration(q.Limit) * q.Window)
+	if to.Before(q.To) {
+		n := to
+		return from, to, &n
+	}
+	return from, q.To, nil
+}
+
+// WindowStart aligns t to the start of its window, counting from the Unix
+// epoch the same way InfluxDB's aggregateWindow does.
+func WindowStart(t time.Time, window time.Duration) time.Time {
+	ns := t.UnixNano()
+	offset := ns % int64(window)
+	if offset < 0 {
+		offset += int64(window)
+	}
+	return time.Unix(0, ns-offset).UTC()
+}
+
+// fillGaps expands sparse per-device aggregates into one point per window
+// of the page, marking windows without data as gaps.
+func fillGaps(from, to time.Time, window time.Duration, devices map[seriesID]map[int64]float64) []DeviceSeries {
+	ids := make([]seriesID, 0, len(devices))
+	for id := range devices {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i].deviceID != ids[j].deviceID {
+			return ids[i].deviceID < ids[j].deviceID
+		}
+		return ids[i].unit < ids[j].unit
+	})
+
+	series := make([]DeviceSeries, 0, len(ids))
+	for _, id := range ids {
+		values := devices[id]
+		ds := DeviceSeries{DeviceID: id.deviceID, Unit: id.unit}
+		for t := from; t.Before(to); t = t.Add(window) {
+			point := HistoryPoint{Time: t}
+			if v, ok := values[t.UnixNano()]; ok {
+				v := v
+				point.Value = &v
+			} else {
+				point.Gap = true
+			}
+			ds.Points = append(ds.Points, point)
+		}
+		series = append(series, ds)
+	}
+	return series
+}
+
+// aggregate reduces the time-ordered values of one window with agg.
+func aggregate(values []float64, agg string) float64 {
+	result := values[0]
+	switch agg {
+	case AggMin:
+		for _, v := range values[1:] {
+			result = math.Min(result, v)
+		}
+	case AggMax:
+		for _, v := range values[1:] {
+			result = math.Max(result, v)
+		}
+	case AggLast:
+		result = values[len(values)-1]
+	default:
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		result = sum / float64(len(values))
+	}
+	return result
+}
+
+type seriesID struct {
+	deviceID string
+	unit     string
+}
@@ -0,0 +1,500 @@
+// internal/storage/influx.go
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"agricultural-iot-rag/internal/models"
+)
+
+// latestLookback bounds how far back LatestReading and LatestMeasurements
+// search.
+const latestLookback = 30 * 24 * time.Hour
+
+// Field keys written alongside each measurement's value so a full
+// SensorReading can be rebuilt from the series.
+const (
+	fieldValue           = "value"
+	fieldReadingID       = "reading_id"
+	fieldLatitude        = "latitude"
+	fieldLongitude       = "longitude"
+	fieldBatteryLevel    = "battery_level"
+	fieldSignalStrength  = "signal_strength"
+	fieldLastCalibration = "last_calibration"
+)
+
+// InfluxDB writes sensor readings to an InfluxDB 2.x bucket using line
+// protocol and reads them back with Flux.
+type InfluxDB struct {
+	url    string
+	token  string
+	org    string
+	bucket string
+	client *http.Client
+}
+
+func NewInfluxDB(url, token, org, bucket string) *InfluxDB {
+	return &InfluxDB{
+		url:    strings.TrimRight(url, "/"),
+		token:  token,
+		org:    org,
+		bucket: bucket,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// WriteReading stores one point per measurement in the reading. The
+// measurement name is the reading's measurement key (e.g. soil_moisture).
+func (i *InfluxDB) WriteReading(ctx context.Context, reading models.SensorReading) error {
+	body := EncodeLineProtocol(reading)
+	if len(body) == 0 {
+		return nil
+	}
+
+	params := url.Values{}
+	params.Set("org", i.org)
+	params.Set("bucket", i.bucket)
+	params.Set("precision", "ns")
+
+	req, err := http.NewRequestWithContext(ctx, "POST", i.url+"/api/v2/write?"+params.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+i.token)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write to InfluxDB: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("InfluxDB write returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// LatestReading returns the most recent reading recorded for a field.
+// When several devices report for the field, the newest device wins.
+func (i *InfluxDB) LatestReading(ctx context.Context, fieldID string) (*models.SensorReading, error) {
+	query := fmt.Sprintf(`from(bucket: %s)
+  |> range(start: -%s)
+  |> filter(fn: (r) => r.field_id == %s)
+  |> last()`, fluxString(i.bucket), fluxDuration(latestLookback), fluxString(fieldID))
+
+	rows, err := i.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var newest *fluxRow
+	for idx := range rows {
+		if newest == nil || rows[idx].Time.After(newest.Time) {
+			newest = &rows[idx]
+		}
+	}
+	if newest == nil {
+		return nil, ErrNotFound
+	}
+
+	var matched []fluxRow
+	for _, row := range rows {
+		if row.Tags["device_id"] == newest.Tags["device_id"] && row.Time.Equal(newest.Time) {
+			matched = append(matched, row)
+		}
+	}
+	return decodeReading(matched), nil
+}
+
+// LatestMeasurement is the newest value of one of a field's measurements,
+// with the device that reported it and when.
+type LatestMeasurement struct {
+	Name string
+	models.Measurement
+	DeviceID  string
+	CropType  string
+	Timestamp time.Time
+}
+
+// LatestMeasurements returns the newest value of each measurement recorded
+// for a field, across all of its devices, ordered by name.
+func (i *InfluxDB) LatestMeasurements(ctx context.Context, fieldID string) ([]LatestMeasurement, error) {
+	query := fmt.Sprintf(`from(bucket: %s)
+  |> range(start: -%s)
+  |> filter(fn: (r) => r.field_id == %s)
+  |> filter(fn: (r) => r._field == %s)
+  |> last()`, fluxString(i.bucket), fluxDuration(latestLookback), fluxString(fieldID), fluxString(fieldValue))
+
+	rows, err := i.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	newest := map[string]fluxRow{}
+	for _, row := range rows {
+		if prev, ok := newest[row.Measurement]; !ok || row.Time.After(prev.Time) {
+			newest[row.Measurement] = row
+		}
+	}
+	latest := make([]LatestMeasurement, 0, len(newest))
+	for name, row := range newest {
+		latest = append(latest, LatestMeasurement{
+			Name:        name,
+			Measurement: models.Measurement{Value: row.Value, Unit: row.Tags["unit"], Quality: row.Tags["quality"]},
+			DeviceID:    row.Tags["device_id"],
+			CropType:    row.Tags["crop_type"],
+			Timestamp:   row.Time,
+		})
+	}
+	sort.Slice(latest, func(a, b int) bool { return latest[a].Name < latest[b].Name })
+	return latest, nil
+}
+
+// History returns one page of windowed aggregates for a field's
+// measurement, one series per device, with empty windows marked as gaps.
+func (i *InfluxDB) History(ctx context.Context, q HistoryQuery) (*HistoryPage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	from, to, next := q.page()
+
+	query := fmt.Sprintf(`from(bucket: %s)
+  |> range(start: %s, stop: %s)
+  |> filter(fn: (r) => r._measurement == %s)
+  |> filter(fn: (r) => r.field_id == %s)
+  |> filter(fn: (r) => r._field == %s)
+  |> group(columns: ["device_id", "unit"])
+  |> aggregateWindow(every: %s, fn: %s, createEmpty: false, timeSrc: "_start")`,
+		fluxString(i.bucket), from.Format(time.RFC3339Nano), to.Format(time.RFC3339Nano),
+		fluxString(q.Measurement), fluxString(q.FieldID), fluxString(fieldValue),
+		fluxDuration(q.Window), q.Agg)
+
+	rows, err := i.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := map[seriesID]map[int64]float64{}
+	for _, row := range rows {
+		v, ok := row.Value.(float64)
+		if !ok {
+			continue
+		}
+		id := seriesID{deviceID: row.Tags["device_id"], unit: row.Tags["unit"]}
+		if devices[id] == nil {
+			devices[id] = map[int64]float64{}
+		}
+		devices[id][WindowStart(row.Time, q.Window).UnixNano()] = v
+	}
+
+	return &HistoryPage{
+		From:     from,
+		To:       to,
+		Series:   fillGaps(from, to, q.Window, devices),
+		NextFrom: next,
+	}, nil
+}
+
+// DeviceActivity is the last time a device reported for a field.
+type DeviceActivity struct {
+	DeviceID string
+	FieldID  string
+	LastSeen time.Time
+}
+
+// RecentActivity lists every device that reported within the lookback.
+func (i *InfluxDB) RecentActivity(ctx context.Context, lookback time.Duration) ([]DeviceActivity, error) {
+	query := fmt.Sprintf(`from(bucket: %s)
+  |> range(start: -%s)
+  |> filter(fn: (r) => r._field == %s)
+  |> keep(columns: ["_time", "device_id", "field_id"])
+  |> group(columns: ["device_id", "field_id"])
+  |> last(column: "_time")`, fluxString(i.bucket), fluxDuration(lookback), fluxString(fieldValue))
+
+	rows, err := i.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	activity := make([]DeviceActivity, 0, len(rows))
+	for _, row := range rows {
+		activity = append(activity, DeviceActivity{
+			DeviceID: row.Tags["device_id"],
+			FieldID:  row.Tags["field_id"],
+			LastSeen: row.Time,
+		})
+	}
+	return activity, nil
+}
+
+// FieldMeans returns the mean of a numeric measurement per field over the
+// lookback, keyed by field ID.
+func (i *InfluxDB) FieldMeans(ctx context.Context, measurement string, lookback time.Duration) (map[string]float64, error) {
+	query := fmt.Sprintf(`from(bucket: %s)
+  |> range(start: -%s)
+  |> filter(fn: (r) => r._measurement == %s)
+  |> filter(fn: (r) => r._field == %s)
+  |> group(columns: ["field_id"])
+  |> mean()`, fluxString(i.bucket), fluxDuration(lookback), fluxString(measurement), fluxString(fieldValue))
+
+	rows, err := i.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	means := map[string]float64{}
+	for _, row := range rows {
+		if v, ok := row.Value.(float64); ok {
+			means[row.Tags["field_id"]] = v
+		}
+	}
+	return means, nil
+}
+
+// fluxRow is one record of a Flux CSV response.
+type fluxRow struct {
+	Measurement string
+	Field       string
+	Value       interface{}
+	Time        time.Time
+	Tags        map[string]string
+}
+
+func (i *InfluxDB) query(ctx context.Context, flux string) ([]fluxRow, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", i.url+"/api/v2/query?org="+url.QueryEscape(i.org), strings.NewReader(flux))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Token "+i.token)
+	req.Header.Set("Content-Type", "application/vnd.flux")
+	req.Header.Set("Accept", "application/csv")
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query InfluxDB: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("InfluxDB query returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return parseFluxCSV(resp.Body)
+}
+
+// parseFluxCSV decodes the default (annotation-free) CSV dialect. Each
+// table starts with its own header row; blank separator lines are skipped
+// by the csv reader.
+func parseFluxCSV(r io.Reader) ([]fluxRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	var header []string
+	var rows []fluxRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse InfluxDB response: %w", err)
+		}
+
+		if len(record) > 2 && record[1] == "result" && record[2] == "table" {
+			header = record
+			continue
+		}
+		if header == nil || len(record) != len(header) {
+			continue
+		}
+
+		row := fluxRow{Tags: map[string]string{}}
+		for idx, col := range header {
+			val := record[idx]
+			switch col {
+			case "", "result", "table", "_start", "_stop":
+			case "_time":
+				row.Time, _ = time.Parse(time.RFC3339Nano, val)
+			case "_measurement":
+				row.Measurement = val
+			case "_field":
+				row.Field = val
+			case "_value":
+				row.Value = parseFluxValue(val)
+			default:
+				row.Tags[col] = val
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+func parseFluxValue(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	if b, err := strconv.ParseBool(s); err == nil {
+		return b
+	}
+	return s
+}
+
+// decodeReading rebuilds a SensorReading from the rows of a single write.
+func decodeReading(rows []fluxRow) *models.SensorReading {
+	reading := &models.SensorReading{Measurements: map[string]models.Measurement{}}
+	for _, row := range rows {
+		reading.DeviceID = row.Tags["device_id"]
+		reading.Timestamp = row.Time
+		reading.Location.FieldID = row.Tags["field_id"]
+		reading.Location.CropType = row.Tags["crop_type"]
+
+		switch row.Field {
+		case fieldValue:
+			reading.Measurements[row.Measurement] = models.Measurement{
+				Value:   row.Value,
+				Unit:    row.Tags["unit"],
+				Quality: row.Tags["quality"],
+			}
+		case fieldReadingID:
+			reading.ID = fmt.Sprint(row.Value)
+		case fieldLatitude:
+			reading.Location.Latitude, _ = row.Value.(float64)
+		case fieldLongitude:
+			reading.Location.Longitude, _ = row.Value.(float64)
+		case fieldBatteryLevel:
+			if v, ok := row.Value.(float64); ok {
+				reading.DeviceStatus.BatteryLevel = int(v)
+			}
+		case fieldSignalStrength:
+			if v, ok := row.Value.(float64); ok {
+				reading.DeviceStatus.SignalStrength = int(v)
+			}
+		case fieldLastCalibration:
+			if v, ok := row.Value.(float64); ok {
+				reading.DeviceStatus.LastCalibration = time.Unix(0, int64(v)).UTC()
+			}
+		}
+	}
+	return reading
+}
+
+// EncodeLineProtocol renders a reading as InfluxDB line protocol, one line
+// per measurement. Measurements whose value is not a number, bool or string
+// are skipped.
+func EncodeLineProtocol(reading models.SensorReading) []byte {
+	ts := reading.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	names := make([]string, 0, len(reading.Measurements))
+	for name := range reading.Measurements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		m := reading.Measurements[name]
+		value, ok := lineValue(m.Value)
+		if !ok || name == "" {
+			continue
+		}
+
+		buf.WriteString(escapeLP(name, ", "))
+		tags := [][2]string{
+			{"crop_type", reading.Location.CropType},
+			{"device_id", reading.DeviceID},
+			{"field_id", reading.Location.FieldID},
+			{"quality", m.Quality},
+			{"unit", m.Unit},
+		}
+		for _, tag := range tags {
+			if tag[1] == "" {
+				continue
+			}
+			buf.WriteByte(',')
+			buf.WriteString(tag[0])
+			buf.WriteByte('=')
+			buf.WriteString(escapeLP(tag[1], ",= "))
+		}
+
+		buf.WriteByte(' ')
+		buf.WriteString(fieldValue + "=" + value)
+		if reading.ID != "" {
+			buf.WriteString("," + fieldReadingID + "=" + quoteLP(reading.ID))
+		}
+		if reading.Location.Latitude != 0 || reading.Location.Longitude != 0 {
+			buf.WriteString("," + fieldLatitude + "=" + strconv.FormatFloat(reading.Location.Latitude, 'f', -1, 64))
+			buf.WriteString("," + fieldLongitude + "=" + strconv.FormatFloat(reading.Location.Longitude, 'f', -1, 64))
+		}
+		buf.WriteString("," + fieldBatteryLevel + "=" + strconv.Itoa(reading.DeviceStatus.BatteryLevel) + "i")
+		buf.WriteString("," + fieldSignalStrength + "=" + strconv.Itoa(reading.DeviceStatus.SignalStrength) + "i")
+		if !reading.DeviceStatus.LastCalibration.IsZero() {
+			buf.WriteString("," + fieldLastCalibration + "=" + strconv.FormatInt(reading.DeviceStatus.LastCalibration.UnixNano(), 10) + "i")
+		}
+
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatInt(ts.UnixNano(), 10))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func lineValue(v interface{}) (string, bool) {
+	switch val := v.(type) {
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), true
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32), true
+	case int:
+		return strconv.FormatFloat(float64(val), 'f', -1, 64), true
+	case int64:
+		return strconv.FormatFloat(float64(val), 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(val), true
+	case string:
+		return quoteLP(val), true
+	default:
+		return "", false
+	}
+}
+
+func escapeLP(s, chars string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '\\' || strings.ContainsRune(chars, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func quoteLP(s string) string {
+	return `"` + escapeLP(s, `"`) + `"`
+}
+
+func fluxString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func fluxDuration(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+}
@@ -0,0 +1,534 @@
+// internal/storage/influxtest/server.go
+
+// Package influxtest provides an in-process stand-in for the InfluxDB 2.x
+// HTTP API. It accepts line protocol writes and answers the subset of Flux
+// that storage.InfluxDB generates, so the time-series path can be exercised
+// without a running InfluxDB.
+package influxtest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Point is a single stored line protocol point.
+type Point struct {
+	Bucket      string
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	Time        time.Time
+}
+
+// Server is a fake InfluxDB backed by an in-memory point list.
+type Server struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	points []Point
+	now    func() time.Time
+}
+
+// NewServer starts a fake InfluxDB. Callers must Close it.
+func NewServer() *Server {
+	s := &Server{now: time.Now}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2/write", s.handleWrite)
+	mux.HandleFunc("/api/v2/query", s.handleQuery)
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"status":"pass"}`)
+	})
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Points returns a copy of every point written so far.
+func (s *Server) Points() []Point {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Point(nil), s.points...)
+}
+
+func (s *Server) handleWrite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	bucket := r.URL.Query().Get("bucket")
+	if bucket == "" || r.URL.Query().Get("org") == "" {
+		writeError(w, http.StatusBadRequest, "org and bucket are required")
+		return
+	}
+
+	var parsed []Point
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := parseLine(line)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		p.Bucket = bucket
+		parsed = append(parsed, p)
+	}
+
+	s.mu.Lock()
+	s.points = append(s.points, parsed...)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var (
+	reBucket = regexp.MustCompile(`from\(bucket:\s*"((?:[^"\\]|\\.)*)"\)`)
+	reRange  = regexp.MustCompile(`range\(start:\s*([^,)]+)(?:,\s*stop:\s*([^)]+))?\)`)
+	reFilter = regexp.MustCompile(`r\.(\w+)\s*==\s*"((?:[^"\\]|\\.)*)"`)
+	reLast   = regexp.MustCompile(`\|>\s*last\((column:\s*"_time")?\)`)
+	reMean   = regexp.MustCompile(`\|>\s*mean\(\)`)
+	reGroup  = regexp.MustCompile(`group\(columns:\s*\[([^\]]*)\]\)`)
+	reWindow = regexp.MustCompile(`aggregateWindow\(every:\s*(\w+),\s*fn:\s*(\w+)`)
+)
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	flux := string(body)
+
+	m := reBucket.FindStringSubmatch(flux)
+	if m == nil {
+		writeError(w, http.StatusBadRequest, "query must start with from(bucket: ...)")
+		return
+	}
+	bucket := unescapeFlux(m[1])
+
+	now := s.now()
+	start, stop := time.Time{}, now
+	if m := reRange.FindStringSubmatch(flux); m != nil {
+		if start, err = parseFluxTime(m[1], now); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if m[2] != "" {
+			if stop, err = parseFluxTime(m[2], now); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+	}
+
+	filters := map[string]string{}
+	for _, f := range reFilter.FindAllStringSubmatch(flux, -1) {
+		filters[f[1]] = unescapeFlux(f[2])
+	}
+
+	series := s.selectSeries(bucket, start, stop, filters)
+	if m := reGroup.FindStringSubmatch(flux); m != nil {
+		var columns []string
+		for _, col := range strings.Split(m[1], ",") {
+			columns = append(columns, strings.Trim(strings.TrimSpace(col), `"`))
+		}
+		series = regroup(series, columns)
+	}
+	if m := reWindow.FindStringSubmatch(flux); m != nil {
+		every, err := time.ParseDuration(m[1])
+		if err != nil || every <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid window "+m[1])
+			return
+		}
+		for _, sr := range series {
+			if sr.records, err = aggregateWindow(sr.records, every, m[2]); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+	}
+	if reMean.MatchString(flux) {
+		for _, sr := range series {
+			values := numericValues(sr.records)
+			if len(values) == 0 {
+				sr.records = nil
+				continue
+			}
+			mean, _ := aggregate(values, "mean")
+			sr.records = []record{{time: sr.records[len(sr.records)-1].time, value: mean}}
+		}
+	}
+	if reLast.MatchString(flux) {
+		for _, sr := range series {
+			if len(sr.records) > 0 {
+				sr.records = sr.records[len(sr.records)-1:]
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	writeCSV(w, series, start, stop)
+}
+
+type record struct {
+	time  time.Time
+	value interface{}
+}
+
+type series struct {
+	measurement string
+	field       string
+	tags        map[string]string
+	records     []record
+}
+
+func (s *Server) selectSeries(bucket string, start, stop time.Time, filters map[string]string) []*series {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byKey := map[string]*series{}
+	var keys []string
+	for _, p := range s.points {
+		if p.Bucket != bucket || p.Time.Before(start) || !p.Time.Before(stop) {
+			continue
+		}
+		if !matches(p, filters) {
+			continue
+		}
+		for field, value := range p.Fields {
+			if f, ok := filters["_field"]; ok && f != field {
+				continue
+			}
+			key := seriesKey(p.Measurement, field, p.Tags)
+			sr, ok := byKey[key]
+			if !ok {
+				sr = &series{measurement: p.Measurement, field: field, tags: p.Tags}
+				byKey[key] = sr
+				keys = append(keys, key)
+			}
+			sr.records = append(sr.records, record{time: p.Time, value: value})
+		}
+	}
+
+	sort.Strings(keys)
+	out := make([]*series, 0, len(keys))
+	for _, key := range keys {
+		sr := byKey[key]
+		sort.SliceStable(sr.records, func(i, j int) bool { return sr.records[i].time.Before(sr.records[j].time) })
+		out = append(out, sr)
+	}
+	return out
+}
+
+// regroup merges series so that only the given tag columns form the key.
+func regroup(all []*series, columns []string) []*series {
+	byKey := map[string]*series{}
+	var keys []string
+	for _, sr := range all {
+		tags := map[string]string{}
+		for _, col := range columns {
+			if v, ok := sr.tags[col]; ok {
+				tags[col] = v
+			}
+		}
+		key := seriesKey("", "", tags)
+		merged, ok := byKey[key]
+		if !ok {
+			merged = &series{measurement: sr.measurement, field: sr.field, tags: tags}
+			byKey[key] = merged
+			keys = append(keys, key)
+		}
+		merged.records = append(merged.records, sr.records...)
+	}
+
+	sort.Strings(keys)
+	out := make([]*series, 0, len(keys))
+	for _, key := range keys {
+		sr := byKey[key]
+		sort.SliceStable(sr.records, func(i, j int) bool { return sr.records[i].time.Before(sr.records[j].time) })
+		out = append(out, sr)
+	}
+	return out
+}
+
+// aggregateWindow buckets records into epoch-aligned windows stamped with
+// the window start, mirroring aggregateWindow(timeSrc: "_start").
+func aggregateWindow(records []record, every time.Duration, fn string) ([]record, error) {
+	var out []record
+	for i := 0; i < len(records); {
+		start := windowStart(records[i].time, every)
+		j := i
+		for j < len(records) && windowStart(records[j].time, every).Equal(start) {
+			j++
+		}
+		values := numericValues(records[i:j])
+		i = j
+		if len(values) == 0 {
+			continue
+		}
+
+		agg, err := aggregate(values, fn)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, record{time: start, value: agg})
+	}
+	return out, nil
+}
+
+func numericValues(records []record) []float64 {
+	var values []float64
+	for _, rec := range records {
+		switch v := rec.value.(type) {
+		case float64:
+			values = append(values, v)
+		case int64:
+			values = append(values, float64(v))
+		}
+	}
+	return values
+}
+
+func aggregate(values []float64, fn string) (float64, error) {
+	agg := values[0]
+	switch fn {
+	case "mean":
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		agg = sum / float64(len(values))
+	case "min":
+		for _, v := range values {
+			if v < agg {
+				agg = v
+			}
+		}
+	case "max":
+		for _, v := range values {
+			if v > agg {
+				agg = v
+			}
+		}
+	case "last":
+		agg = values[len(values)-1]
+	default:
+		return 0, fmt.Errorf("unsupported aggregate %q", fn)
+	}
+	return agg, nil
+}
+
+func windowStart(t time.Time, every time.Duration) time.Time {
+	ns := t.UnixNano()
+	return time.Unix(0, ns-ns%int64(every)).UTC()
+}
+
+func matches(p Point, filters map[string]string) bool {
+	for key, want := range filters {
+		switch key {
+		case "_field":
+		case "_measurement":
+			if p.Measurement != want {
+				return false
+			}
+		default:
+			if p.Tags[key] != want {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func seriesKey(measurement, field string, tags map[string]string) string {
+	keys := sortedKeys(tags)
+	var b strings.Builder
+	b.WriteString(measurement + "\x00" + field)
+	for _, k := range keys {
+		b.WriteString("\x00" + k + "=" + tags[k])
+	}
+	return b.String()
+}
+
+func writeCSV(w io.Writer, all []*series, start, stop time.Time) {
+	cw := csv.NewWriter(w)
+	for table, sr := range all {
+		if table > 0 {
+			cw.Flush()
+			io.WriteString(w, "\r\n")
+		}
+		tagKeys := sortedKeys(sr.tags)
+		header := append([]string{"", "result", "table", "_start", "_stop", "_time", "_value", "_field", "_measurement"}, tagKeys...)
+		cw.Write(header)
+		for _, rec := range sr.records {
+			row := []string{
+				"", "_result", strconv.Itoa(table),
+				start.UTC().Format(time.RFC3339Nano), stop.UTC().Format(time.RFC3339Nano),
+				rec.time.UTC().Format(time.RFC3339Nano), formatValue(rec.value),
+				sr.field, sr.measurement,
+			}
+			for _, k := range tagKeys {
+				row = append(row, sr.tags[k])
+			}
+			cw.Write(row)
+		}
+	}
+	cw.Flush()
+}
+
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+func parseFluxTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "-") {
+		d, err := time.ParseDuration(s[1:])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid duration %q", s)
+		}
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	return t, nil
+}
+
+func unescapeFlux(s string) string {
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(s)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"code":"invalid","message":%q}`, msg)
+}
+
+// parseLine parses one line of InfluxDB line protocol.
+func parseLine(line string) (Point, error) {
+	parts := splitUnescaped(line, ' ', true)
+	if len(parts) < 2 || len(parts) > 3 {
+		return Point{}, fmt.Errorf("malformed line: %q", line)
+	}
+
+	key := splitUnescaped(parts[0], ',', false)
+	p := Point{
+		Measurement: unescapeLP(key[0]),
+		Tags:        map[string]string{},
+		Fields:      map[string]interface{}{},
+		Time:        time.Now(),
+	}
+	for _, tag := range key[1:] {
+		kv := splitUnescaped(tag, '=', false)
+		if len(kv) != 2 {
+			return Point{}, fmt.Errorf("malformed tag %q", tag)
+		}
+		p.Tags[unescapeLP(kv[0])] = unescapeLP(kv[1])
+	}
+
+	for _, field := range splitUnescaped(parts[1], ',', true) {
+		idx := strings.IndexByte(field, '=')
+		if idx <= 0 {
+			return Point{}, fmt.Errorf("malformed field %q", field)
+		}
+		value, err := parseFieldValue(field[idx+1:])
+		if err != nil {
+			return Point{}, err
+		}
+		p.Fields[unescapeLP(field[:idx])] = value
+	}
+
+	if len(parts) == 3 {
+		ns, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			return Point{}, fmt.Errorf("invalid timestamp %q", parts[2])
+		}
+		p.Time = time.Unix(0, ns).UTC()
+	}
+	return p, nil
+}
+
+func parseFieldValue(s string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) && len(s) >= 2:
+		return unescapeLP(s[1 : len(s)-1]), nil
+	case strings.HasSuffix(s, "i"):
+		return strconv.ParseInt(strings.TrimSuffix(s, "i"), 10, 64)
+	case s == "t" || s == "T" || s == "true" || s == "True" || s == "TRUE":
+		return true, nil
+	case s == "f" || s == "F" || s == "false" || s == "False" || s == "FALSE":
+		return false, nil
+	default:
+		return strconv.ParseFloat(s, 64)
+	}
+}
+
+// splitUnescaped splits s on sep, ignoring backslash-escaped separators and,
+// when quotes is set, separators inside double-quoted strings.
+func splitUnescaped(s string, sep byte, quotes bool) []string {
+	var parts []string
+	inQuote := false
+	last := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quotes && s[i] == '"':
+			inQuote = !inQuote
+		case s[i] == sep && !inQuote:
+			parts = append(parts, s[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, s[last:])
+}
+
+func unescapeLP(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,326 @@
+// internal/storage/migrate.go
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations
+var embeddedMigrations embed.FS
+
+// migrationLockKey identifies the Postgres advisory lock held while
+// migrating, so that servers starting together apply migrations once.
+const migrationLockKey int64 = 0x61677269696f74 // "agriiot"
+
+// ErrChecksumMismatch is returned when an applied migration's file has been
+// edited since it ran.
+var ErrChecksumMismatch = errors.New("migration checksum mismatch")
+
+// Migration is one versioned schema change. Files are named
+// NNNN_name.up.sql and NNNN_name.down.sql; the down file is optional.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationState reports whether a migration has been applied.
+type MigrationState struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	// Modified is set when the applied checksum differs from the file.
+	Modified bool `json:"modified,omitempty"`
+	// Missing is set when a version is recorded as applied but has no file.
+	Missing bool `json:"missing,omitempty"`
+}
+
+var migrationFile = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// LoadMigrations reads migrations from the root of fsys, ordered by version.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".sql" {
+			continue
+		}
+		m := migrationFile.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", e.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", mig.Version, mig.Name)
+		}
+		sum := sha256.Sum256([]byte(mig.Up))
+		mig.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies migrations to a database, recording them in
+// schema_migrations.
+type Migrator struct {
+	db         *sql.DB
+	dialect    dialect
+	migrations []Migration
+}
+
+// EmbeddedMigrations returns the migrations compiled into the binary for a
+// storage driver.
+func EmbeddedMigrations(driver string) ([]Migration, error) {
+	sub, err := fs.Sub(embeddedMigrations, path.Join("migrations", driver))
+	if err != nil {
+		return nil, err
+	}
+	return LoadMigrations(sub)
+}
+
+// Migrator returns a migrator for the embedded migrations.
+func (s *sqlStore) Migrator() (*Migrator, error) {
+	migrations, err := EmbeddedMigrations(s.dialect.migrations)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: s.db, dialect: s.dialect, migrations: migrations}, nil
+}
+
+// MigrateUp applies all pending embedded migrations.
+func (s *sqlStore) MigrateUp(ctx context.Context) error {
+	m, err := s.Migrator()
+	if err != nil {
+		return err
+	}
+	_, err = m.Up(ctx)
+	return err
+}
+
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// withLock runs fn on a single connection holding the migration lock,
+// after making sure schema_migrations exists.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn, applied map[int]appliedMigration) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	unlock, err := m.dialect.lock(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("failed to take migration lock: %w", err)
+	}
+	defer unlock()
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum VARCHAR(64) NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = a
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return fn(conn, applied)
+}
+
+// verify fails if an applied migration was edited or removed.
+func (m *Migrator) verify(applied map[int]appliedMigration) error {
+	known := map[int]bool{}
+	for _, mig := range m.migrations {
+		known[mig.Version] = true
+		if a, ok := applied[mig.Version]; ok && a.checksum != mig.Checksum {
+			return fmt.Errorf("%w: %d_%s was changed after it was applied", ErrChecksumMismatch, mig.Version, mig.Name)
+		}
+	}
+	for version, a := range applied {
+		if !known[version] {
+			return fmt.Errorf("applied migration %d_%s has no file", version, a.name)
+		}
+	}
+	return nil
+}
+
+// Up applies pending migrations in order, each in its own transaction, and
+// returns the ones it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn, applied map[int]appliedMigration) error {
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			skipped := false
+			err := inTx(ctx, conn, func(tx *sql.Tx) error {
+				var err error
+				if skipped, err = isApplied(ctx, tx, mig.Version); err != nil || skipped {
+					return err
+				}
+				if _, err := tx.ExecContext(ctx, mig.Up); err != nil {
+					return err
+				}
+				_, err = tx.ExecContext(ctx, `
+					INSERT INTO schema_migrations (version, name, checksum, applied_at)
+					VALUES ($1, $2, $3, $4)`, mig.Version, mig.Name, mig.Checksum, time.Now().UTC())
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", mig.Version, mig.Name, err)
+			}
+			if !skipped {
+				done = append(done, mig)
+			}
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns
+// the ones it reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn, applied map[int]appliedMigration) error {
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %d_%s cannot be reverted: no down file", mig.Version, mig.Name)
+			}
+			err := inTx(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, mig.Down); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("reverting %d_%s failed: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status lists every known or applied migration in version order.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationState, error) {
+	var states []MigrationState
+	err := m.withLock(ctx, func(_ *sql.Conn, applied map[int]appliedMigration) error {
+		known := map[int]bool{}
+		for _, mig := range m.migrations {
+			known[mig.Version] = true
+			state := MigrationState{Version: mig.Version, Name: mig.Name}
+			if a, ok := applied[mig.Version]; ok {
+				at := a.appliedAt
+				state.AppliedAt = &at
+				state.Modified = a.checksum != mig.Checksum
+			}
+			states = append(states, state)
+		}
+		for version, a := range applied {
+			if !known[version] {
+				at := a.appliedAt
+				states = append(states, MigrationState{Version: version, Name: a.name, AppliedAt: &at, Missing: true})
+			}
+		}
+		return nil
+	})
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, err
+}
+
+// isApplied re-checks schema_migrations inside a migration's transaction,
+// for dialects whose lock does not cover the whole run.
+func isApplied(ctx context.Context, tx *sql.Tx, version int) (bool, error) {
+	var n int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations WHERE version = $1`, version).Scan(&n)
+	return n > 0, err
+}
+
+func inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS quarantined_readings;
+ALTER TABLE fields DROP COLUMN IF EXISTS retired_at;
@@ -0,0 +1,11 @@
+ALTER TABLE fields ADD COLUMN IF NOT EXISTS retired_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS quarantined_readings (
+	id SERIAL PRIMARY KEY,
+	device_id VARCHAR(255) NOT NULL,
+	field_id VARCHAR(255),
+	payload JSONB NOT NULL,
+	received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_quarantined_readings_device_id ON quarantined_readings(device_id);
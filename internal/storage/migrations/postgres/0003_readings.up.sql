@@ -0,0 +1,23 @@
+-- Readings kept in the relational store when READINGS_STORE=sql, one row
+-- per measurement like the InfluxDB points.
+CREATE TABLE IF NOT EXISTS readings (
+	id BIGSERIAL PRIMARY KEY,
+	reading_id VARCHAR(255),
+	device_id VARCHAR(255) NOT NULL,
+	field_id VARCHAR(255) NOT NULL,
+	crop_type VARCHAR(100),
+	measurement VARCHAR(100) NOT NULL,
+	value DOUBLE PRECISION,
+	raw_value TEXT,
+	unit VARCHAR(50),
+	quality VARCHAR(50),
+	latitude DOUBLE PRECISION,
+	longitude DOUBLE PRECISION,
+	battery_level INTEGER,
+	signal_strength INTEGER,
+	last_calibration TIMESTAMP,
+	recorded_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_readings_field_measurement_time ON readings(field_id, measurement, recorded_at);
+CREATE INDEX IF NOT EXISTS idx_readings_recorded_at ON readings(recorded_at);
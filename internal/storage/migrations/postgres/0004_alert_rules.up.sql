@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS alert_rules (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	expression TEXT NOT NULL,
+	severity VARCHAR(50) NOT NULL,
+	hysteresis DOUBLE PRECISION NOT NULL DEFAULT 0,
+	debounce_minutes INTEGER NOT NULL DEFAULT 0,
+	enabled BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS rule_id INTEGER REFERENCES alert_rules(id) ON DELETE SET NULL;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS value DOUBLE PRECISION;
+
+CREATE INDEX IF NOT EXISTS idx_alerts_rule_id ON alerts(rule_id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS alert_events;
+
+ALTER TABLE alerts DROP COLUMN IF EXISTS snoozed_until;
+ALTER TABLE alerts DROP COLUMN IF EXISTS acknowledged_by;
+ALTER TABLE alerts DROP COLUMN IF EXISTS acknowledged_at;
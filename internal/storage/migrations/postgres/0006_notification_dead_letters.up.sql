@@ -0,0 +1,13 @@
+-- Notifications that exhausted their retries.
+CREATE TABLE IF NOT EXISTS notification_dead_letters (
+	id SERIAL PRIMARY KEY,
+	alert_id INTEGER REFERENCES alerts(id) ON DELETE CASCADE,
+	channel VARCHAR(50) NOT NULL,
+	event VARCHAR(50) NOT NULL,
+	payload JSONB NOT NULL,
+	error TEXT NOT NULL,
+	attempts INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_dead_letters_created_at ON notification_dead_letters(created_at);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS alerts;
+DROP TABLE IF EXISTS devices;
+DROP TABLE IF EXISTS fields;
@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS fields (
+	id VARCHAR(255) PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	location JSONB,
+	crop_type VARCHAR(100),
+	area_hectares DECIMAL(10,2),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS devices (
+	id VARCHAR(255) PRIMARY KEY,
+	field_id VARCHAR(255) REFERENCES fields(id),
+	device_type VARCHAR(100),
+	status VARCHAR(50),
+	last_seen TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS alerts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	field_id VARCHAR(255) REFERENCES fields(id),
+	alert_type VARCHAR(100),
+	severity VARCHAR(50),
+	message TEXT,
+	resolved BOOLEAN DEFAULT FALSE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	resolved_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_fields_crop_type ON fields(crop_type);
+CREATE INDEX IF NOT EXISTS idx_devices_field_id ON devices(field_id);
+CREATE INDEX IF NOT EXISTS idx_alerts_field_id ON alerts(field_id);
+CREATE INDEX IF NOT EXISTS idx_alerts_resolved ON alerts(resolved);
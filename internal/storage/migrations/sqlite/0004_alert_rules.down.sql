@@ -0,0 +1,22 @@
+-- SQLite cannot drop a column that carries a foreign key, so rebuild alerts.
+DROP INDEX IF EXISTS idx_alerts_rule_id;
+
+CREATE TABLE alerts_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	field_id VARCHAR(255) REFERENCES fields(id),
+	alert_type VARCHAR(100),
+	severity VARCHAR(50),
+	message TEXT,
+	resolved BOOLEAN DEFAULT FALSE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	resolved_at TIMESTAMP
+);
+INSERT INTO alerts_old (id, field_id, alert_type, severity, message, resolved, created_at, resolved_at)
+	SELECT id, field_id, alert_type, severity, message, resolved, created_at, resolved_at FROM alerts;
+DROP TABLE alerts;
+ALTER TABLE alerts_old RENAME TO alerts;
+
+CREATE INDEX IF NOT EXISTS idx_alerts_field_id ON alerts(field_id);
+CREATE INDEX IF NOT EXISTS idx_alerts_resolved ON alerts(resolved);
+
+DROP TABLE IF EXISTS alert_rules;
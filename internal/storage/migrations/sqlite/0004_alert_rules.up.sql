@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS alert_rules (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(255) NOT NULL,
+	expression TEXT NOT NULL,
+	severity VARCHAR(50) NOT NULL,
+	hysteresis REAL NOT NULL DEFAULT 0,
+	debounce_minutes INTEGER NOT NULL DEFAULT 0,
+	enabled BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE alerts ADD COLUMN rule_id INTEGER REFERENCES alert_rules(id) ON DELETE SET NULL;
+ALTER TABLE alerts ADD COLUMN value REAL;
+
+CREATE INDEX IF NOT EXISTS idx_alerts_rule_id ON alerts(rule_id);
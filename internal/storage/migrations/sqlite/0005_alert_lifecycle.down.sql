@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS alert_events;
+
+ALTER TABLE alerts DROP COLUMN snoozed_until;
+ALTER TABLE alerts DROP COLUMN acknowledged_by;
+ALTER TABLE alerts DROP COLUMN acknowledged_at;
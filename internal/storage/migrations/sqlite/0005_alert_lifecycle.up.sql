@@ -0,0 +1,17 @@
+ALTER TABLE alerts ADD COLUMN acknowledged_at TIMESTAMP;
+ALTER TABLE alerts ADD COLUMN acknowledged_by VARCHAR(255);
+ALTER TABLE alerts ADD COLUMN snoozed_until TIMESTAMP;
+
+-- Audit trail of alert transitions: who acknowledged, resolved or snoozed
+-- an alert, and when.
+CREATE TABLE IF NOT EXISTS alert_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	alert_id INTEGER NOT NULL REFERENCES alerts(id) ON DELETE CASCADE,
+	action VARCHAR(50) NOT NULL,
+	actor VARCHAR(255) NOT NULL,
+	note TEXT,
+	snoozed_until TIMESTAMP,
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_events_alert_id ON alert_events(alert_id, created_at);
@@ -0,0 +1,58 @@
+// internal/storage/notifications.go
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"agricultural-iot-rag/internal/models"
+)
+
+// CreateDeadLetter records a notification that could not be delivered.
+func (s *sqlStore) CreateDeadLetter(ctx context.Context, d *models.DeadLetter) error {
+	d.CreatedAt = time.Now().UTC()
+
+	var alertID interface{}
+	if d.AlertID != 0 {
+		alertID = d.AlertID
+	}
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO notification_dead_letters (alert_id, channel, event, payload, error, attempts, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`,
+		alertID, d.Channel, d.Event, string(d.Payload), d.Error, d.Attempts, d.CreatedAt).Scan(&d.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record dead letter: %w", err)
+	}
+	return nil
+}
+
+// ListDeadLetters returns the most recent dead letters, newest first.
+func (s *sqlStore) ListDeadLetters(ctx context.Context, limit int) ([]models.DeadLetter, error) {
+	if limit <= 0 {
+		limit = DefaultAlertLimit
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, COALESCE(alert_id, 0), channel, event, payload, error, attempts, created_at
+		FROM notification_dead_letters
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	letters := []models.DeadLetter{}
+	for rows.Next() {
+		var d models.DeadLetter
+		var payload []byte
+		if err := rows.Scan(&d.ID, &d.AlertID, &d.Channel, &d.Event, &payload, &d.Error, &d.Attempts, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		d.Payload = json.RawMessage(payload)
+		letters = append(letters, d)
+	}
+	return letters, rows.Err()
+}
@@ -0,0 +1,312 @@
+// internal/storage/readings.go
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"agricultural-iot-rag/internal/models"
+)
+
+// WriteReading stores one row per measurement, mirroring the InfluxDB
+// points. Numeric values go to value; strings and bools are kept as JSON in
+// raw_value. Other value types are skipped.
+func (s *sqlStore) WriteReading(ctx context.Context, reading models.SensorReading) error {
+	ts := reading.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var lastCalibration interface{}
+	if !reading.DeviceStatus.LastCalibration.IsZero() {
+		lastCalibration = reading.DeviceStatus.LastCalibration.UTC()
+	}
+	for name, m := range reading.Measurements {
+		value, raw, ok := sqlValue(m.Value)
+		if !ok || name == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO readings (reading_id, device_id, field_id, crop_type, measurement, value, raw_value,
+				unit, quality, latitude, longitude, battery_level, signal_strength, last_calibration, recorded_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+			nullString(reading.ID), reading.DeviceID, reading.Location.FieldID, nullString(reading.Location.CropType),
+			name, value, raw, nullString(m.Unit), nullString(m.Quality),
+			reading.Location.Latitude, reading.Location.Longitude,
+			reading.DeviceStatus.BatteryLevel, reading.DeviceStatus.SignalStrength, lastCalibration, ts.UTC()); err != nil {
+			return fmt.Errorf("failed to write reading: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// LatestReading returns the most recent reading recorded for a field.
+// When several devices report for the field, the newest device wins.
+func (s *sqlStore) LatestReading(ctx context.Context, fieldID string) (*models.SensorReading, error) {
+	var deviceID string
+	var recordedAt time.Time
+	err := s.db.QueryRowContext(ctx, `
+		SELECT device_id, recorded_at
+		FROM readings
+		WHERE field_id = $1 AND recorded_at >= $2
+		ORDER BY recorded_at DESC, id DESC
+		LIMIT 1`, fieldID, time.Now().UTC().Add(-latestLookback)).Scan(&deviceID, &recordedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query readings: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT COALESCE(reading_id, ''), COALESCE(crop_type, ''), measurement, value, raw_value,
+			COALESCE(unit, ''), COALESCE(quality, ''), latitude, longitude,
+			battery_level, signal_strength, last_calibration
+		FROM readings
+		WHERE field_id = $1 AND device_id = $2 AND recorded_at = $3`, fieldID, deviceID, recordedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query readings: %w", err)
+	}
+	defer rows.Close()
+
+	reading := &models.SensorReading{
+		DeviceID:     deviceID,
+		Timestamp:    recordedAt.UTC(),
+		Location:     models.Location{FieldID: fieldID},
+		Measurements: map[string]models.Measurement{},
+	}
+	for rows.Next() {
+		var name, unit, quality string
+		var value sql.NullFloat64
+		var raw sql.NullString
+		var lat, lon sql.NullFloat64
+		var battery, signal sql.NullInt64
+		var calibration sql.NullTime
+		if err := rows.Scan(&reading.ID, &reading.Location.CropType, &name, &value, &raw,
+			&unit, &quality, &lat, &lon, &battery, &signal, &calibration); err != nil {
+			return nil, err
+		}
+
+		m := models.Measurement{Unit: unit, Quality: quality}
+		if value.Valid {
+			m.Value = value.Float64
+		} else if raw.Valid {
+			json.Unmarshal([]byte(raw.String), &m.Value)
+		}
+		reading.Measurements[name] = m
+		reading.Location.Latitude = lat.Float64
+		reading.Location.Longitude = lon.Float64
+		reading.DeviceStatus.BatteryLevel = int(battery.Int64)
+		reading.DeviceStatus.SignalStrength = int(signal.Int64)
+		if calibration.Valid {
+			reading.DeviceStatus.LastCalibration = calibration.Time.UTC()
+		}
+	}
+	return reading, rows.Err()
+}
+
+// LatestMeasurements returns the newest value of each measurement recorded
+// for a field, across all of its devices, ordered by name.
+func (s *sqlStore) LatestMeasurements(ctx context.Context, fieldID string) ([]LatestMeasurement, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT measurement, value, raw_value, unit, quality, device_id, crop_type, recorded_at
+		FROM (
+			SELECT measurement, value, raw_value, COALESCE(unit, '') AS unit, COALESCE(quality, '') AS quality,
+				device_id, COALESCE(crop_type, '') AS crop_type, recorded_at,
+				ROW_NUMBER() OVER (PARTITION BY measurement ORDER BY recorded_at DESC, id DESC) AS rn
+			FROM readings
+			WHERE field_id = $1 AND recorded_at >= $2
+		) newest
+		WHERE rn = 1
+		ORDER BY measurement`, fieldID, time.Now().UTC().Add(-latestLookback))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query readings: %w", err)
+	}
+	defer rows.Close()
+
+	var latest []LatestMeasurement
+	for rows.Next() {
+		var l LatestMeasurement
+		var value sql.NullFloat64
+		var raw sql.NullString
+		if err := rows.Scan(&l.Name, &value, &raw, &l.Unit, &l.Quality, &l.DeviceID, &l.CropType, &l.Timestamp); err != nil {
+			return nil, err
+		}
+		if value.Valid {
+			l.Value = value.Float64
+		} else if raw.Valid {
+			json.Unmarshal([]byte(raw.String), &l.Value)
+		}
+		l.Timestamp = l.Timestamp.UTC()
+		latest = append(latest, l)
+	}
+	return latest, rows.Err()
+}
+
+// History returns one page of windowed aggregates for a field's
+// measurement. Raw values are bucketed in Go with the same epoch-aligned
+// windows InfluxDB uses, so both stores page identically.
+func (s *sqlStore) History(ctx context.Context, q HistoryQuery) (*HistoryPage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	from, to, next := q.page()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT device_id, COALESCE(unit, ''), recorded_at, value
+		FROM readings
+		WHERE field_id = $1 AND measurement = $2 AND value IS NOT NULL
+			AND recorded_at >= $3 AND recorded_at < $4
+		ORDER BY recorded_at, id`, q.FieldID, q.Measurement, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := map[seriesID]map[int64][]float64{}
+	for rows.Next() {
+		var id seriesID
+		var ts time.Time
+		var value float64
+		if err := rows.Scan(&id.deviceID, &id.unit, &ts, &value); err != nil {
+			return nil, err
+		}
+		if buckets[id] == nil {
+			buckets[id] = map[int64][]float64{}
+		}
+		start := WindowStart(ts, q.Window).UnixNano()
+		buckets[id][start] = append(buckets[id][start], value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	devices := map[seriesID]map[int64]float64{}
+	for id, windows := range buckets {
+		devices[id] = map[int64]float64{}
+		for start, values := range windows {
+			devices[id][start] = aggregate(values, q.Agg)
+		}
+	}
+
+	return &HistoryPage{
+		From:     from,
+		To:       to,
+		Series:   fillGaps(from, to, q.Window, devices),
+		NextFrom: next,
+	}, nil
+}
+
+// RecentActivity lists every device that reported within the lookback.
+func (s *sqlStore) RecentActivity(ctx context.Context, lookback time.Duration) ([]DeviceActivity, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT device_id, field_id, MAX(recorded_at)
+		FROM readings
+		WHERE recorded_at >= $1
+		GROUP BY device_id, field_id`, time.Now().UTC().Add(-lookback))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query activity: %w", err)
+	}
+	defer rows.Close()
+
+	activity := []DeviceActivity{}
+	for rows.Next() {
+		var a DeviceActivity
+		var lastSeen sqlTime
+		if err := rows.Scan(&a.DeviceID, &a.FieldID, &lastSeen); err != nil {
+			return nil, err
+		}
+		a.LastSeen = lastSeen.Time
+		activity = append(activity, a)
+	}
+	return activity, rows.Err()
+}
+
+// FieldMeans returns the mean of a numeric measurement per field over the
+// lookback, keyed by field ID.
+func (s *sqlStore) FieldMeans(ctx context.Context, measurement string, lookback time.Duration) (map[string]float64, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT field_id, AVG(value)
+		FROM readings
+		WHERE measurement = $1 AND value IS NOT NULL AND recorded_at >= $2
+		GROUP BY field_id`, measurement, time.Now().UTC().Add(-lookback))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query means: %w", err)
+	}
+	defer rows.Close()
+
+	means := map[string]float64{}
+	for rows.Next() {
+		var fieldID string
+		var mean float64
+		if err := rows.Scan(&fieldID, &mean); err != nil {
+			return nil, err
+		}
+		means[fieldID] = mean
+	}
+	return means, rows.Err()
+}
+
+// sqlValue splits a measurement value into the value and raw_value columns.
+func sqlValue(v interface{}) (value, raw interface{}, ok bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, nil, true
+	case float32:
+		return float64(val), nil, true
+	case int:
+		return float64(val), nil, true
+	case int64:
+		return float64(val), nil, true
+	case bool, string:
+		b, _ := json.Marshal(val)
+		return nil, string(b), true
+	default:
+		return nil, nil, false
+	}
+}
+
+// sqlTime scans timestamps from expressions such as MAX(recorded_at),
+// which SQLite returns as text rather than a typed time.
+type sqlTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+var sqliteTimeFormats = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+}
+
+func (t *sqlTime) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		t.Time, t.Valid = time.Time{}, false
+		return nil
+	case time.Time:
+		t.Time, t.Valid = v.UTC(), true
+		return nil
+	case []byte:
+		return t.Scan(string(v))
+	case string:
+		for _, layout := range sqliteTimeFormats {
+			if parsed, err := time.Parse(layout, v); err == nil {
+				t.Time, t.Valid = parsed.UTC(), true
+				return nil
+			}
+		}
+		return fmt.Errorf("cannot parse time %q", v)
+	}
+	return fmt.Errorf("cannot scan %T into time", src)
+}
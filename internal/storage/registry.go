@@ -0,0 +1,302 @@
+// internal/storage/registry.go
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"agricultural-iot-rag/internal/models"
+)
+
+// FieldFilter narrows ListFields. Retired fields are excluded unless
+// IncludeRetired is set.
+type FieldFilter struct {
+	CropType       string
+	IncludeRetired bool
+}
+
+// DeviceFilter narrows ListDevices.
+type DeviceFilter struct {
+	FieldID string
+	Status  string
+}
+
+const fieldColumns = `id, name, COALESCE(crop_type, ''), area_hectares, location, created_at, updated_at, retired_at`
+
+func scanField(row interface{ Scan(...interface{}) error }) (*models.Field, error) {
+	var f models.Field
+	var area sql.NullFloat64
+	var location []byte
+	var retiredAt sql.NullTime
+	if err := row.Scan(&f.ID, &f.Name, &f.CropType, &area, &location, &f.CreatedAt, &f.UpdatedAt, &retiredAt); err != nil {
+		return nil, err
+	}
+	if area.Valid {
+		f.AreaHectares = &area.Float64
+	}
+	if len(location) > 0 {
+		f.Location = json.RawMessage(location)
+	}
+	if retiredAt.Valid {
+		f.RetiredAt = &retiredAt.Time
+	}
+	return &f, nil
+}
+
+// CreateField inserts a field, returning ErrConflict if the ID is taken.
+func (s *sqlStore) CreateField(ctx context.Context, f *models.Field) error {
+	now := time.Now().UTC()
+	f.CreatedAt, f.UpdatedAt = now, now
+
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO fields (id, name, crop_type, area_hectares, location, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO NOTHING`,
+		f.ID, f.Name, nullString(f.CropType), f.AreaHectares, nullJSON(f.Location), now, now)
+	if err != nil {
+		return fmt.Errorf("failed to create field: %w", err)
+	}
+	return conflictIfUnchanged(res)
+}
+
+// GetField returns a field, including retired ones, or ErrNotFound.
+func (s *sqlStore) GetField(ctx context.Context, id string) (*models.Field, error) {
+	f, err := scanField(s.db.QueryRowContext(ctx, `SELECT `+fieldColumns+` FROM fields WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *sqlStore) ListFields(ctx context.Context, filter FieldFilter) ([]models.Field, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+fieldColumns+`
+		FROM fields
+		WHERE ($1 = '' OR crop_type = $1) AND ($2 OR retired_at IS NULL)
+		ORDER BY id`, filter.CropType, filter.IncludeRetired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fields: %w", err)
+	}
+	defer rows.Close()
+
+	fields := []models.Field{}
+	for rows.Next() {
+		f, err := scanField(rows)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, *f)
+	}
+	return fields, rows.Err()
+}
+
+// UpdateField applies a partial update to an active field.
+func (s *sqlStore) UpdateField(ctx context.Context, id string, u models.FieldUpdate) (*models.Field, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE fields SET
+			name = COALESCE($2, name),
+			crop_type = COALESCE($3, crop_type),
+			area_hectares = COALESCE($4, area_hectares),
+			location = COALESCE($5, location),
+			updated_at = $6
+		WHERE id = $1 AND retired_at IS NULL`,
+		id, u.Name, u.CropType, u.AreaHectares, nullJSON(u.Location), time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to update field: %w", err)
+	}
+	if err := notFoundIfUnchanged(res); err != nil {
+		return nil, err
+	}
+	return s.GetField(ctx, id)
+}
+
+// RetireField marks a field as retired. Its history is kept.
+func (s *sqlStore) RetireField(ctx context.Context, id string) error {
+	now := time.Now().UTC()
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE fields SET retired_at = $2, updated_at = $2
+		WHERE id = $1 AND retired_at IS NULL`, id, now)
+	if err != nil {
+		return fmt.Errorf("failed to retire field: %w", err)
+	}
+	return notFoundIfUnchanged(res)
+}
+
+const deviceColumns = `id, COALESCE(field_id, ''), COALESCE(device_type, ''), COALESCE(status, ''), last_seen, created_at`
+
+func scanDevice(row interface{ Scan(...interface{}) error }) (*models.Device, error) {
+	var d models.Device
+	var lastSeen sql.NullTime
+	if err := row.Scan(&d.ID, &d.FieldID, &d.DeviceType, &d.Status, &lastSeen, &d.CreatedAt); err != nil {
+		return nil, err
+	}
+	if lastSeen.Valid {
+		d.LastSeen = &lastSeen.Time
+	}
+	return &d, nil
+}
+
+// CreateDevice inserts a device, returning ErrConflict if the ID is taken.
+func (s *sqlStore) CreateDevice(ctx context.Context, d *models.Device) error {
+	d.CreatedAt = time.Now().UTC()
+	if d.Status == "" {
+		d.Status = models.DeviceStatusActive
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO devices (id, field_id, device_type, status, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO NOTHING`,
+		d.ID, nullString(d.FieldID), nullString(d.DeviceType), d.Status, d.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create device: %w", err)
+	}
+	return conflictIfUnchanged(res)
+}
+
+// GetDevice returns a device or ErrNotFound.
+func (s *sqlStore) GetDevice(ctx context.Context, id string) (*models.Device, error) {
+	d, err := scanDevice(s.db.QueryRowContext(ctx, `SELECT `+deviceColumns+` FROM devices WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return d, err
+}
+
+func (s *sqlStore) ListDevices(ctx context.Context, filter DeviceFilter) ([]models.Device, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+deviceColumns+`
+		FROM devices
+		WHERE ($1 = '' OR field_id = $1) AND ($2 = '' OR status = $2)
+		ORDER BY id`, filter.FieldID, filter.Status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := []models.Device{}
+	for rows.Next() {
+		d, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, *d)
+	}
+	return devices, rows.Err()
+}
+
+// UpdateDevice applies a partial update. An empty FieldID unassigns the
+// device from its field.
+func (s *sqlStore) UpdateDevice(ctx context.Context, id string, u models.DeviceUpdate) (*models.Device, error) {
+	var fieldID interface{}
+	if u.FieldID != nil {
+		fieldID = *u.FieldID
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE devices SET
+			field_id = CASE WHEN $2 THEN NULLIF($3, '') ELSE field_id END,
+			device_type = COALESCE($4, device_type),
+			status = COALESCE($5, status)
+		WHERE id = $1`,
+		id, u.FieldID != nil, fieldID, u.DeviceType, u.Status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update device: %w", err)
+	}
+	if err := notFoundIfUnchanged(res); err != nil {
+		return nil, err
+	}
+	return s.GetDevice(ctx, id)
+}
+
+// RetireDevice marks a device as retired so its readings are rejected.
+func (s *sqlStore) RetireDevice(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE devices SET status = $2 WHERE id = $1`, id, models.DeviceStatusRetired)
+	if err != nil {
+		return fmt.Errorf("failed to retire device: %w", err)
+	}
+	return notFoundIfUnchanged(res)
+}
+
+// TouchDevice records that a device reported at seenAt.
+func (s *sqlStore) TouchDevice(ctx context.Context, id string, seenAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE devices SET last_seen = $2
+		WHERE id = $1 AND (last_seen IS NULL OR last_seen < $2)`, id, seenAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to update device last_seen: %w", err)
+	}
+	return nil
+}
+
+// QuarantineReading stores a reading from an unregistered or quarantined
+// device for later review, and registers the device as quarantined so it
+// shows up in the device list.
+func (s *sqlStore) QuarantineReading(ctx context.Context, reading models.SensorReading) error {
+	payload, err := json.Marshal(reading)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO devices (id, status, last_seen, created_at)
+		VALUES ($1, $2, $3, $3)
+		ON CONFLICT (id) DO UPDATE SET last_seen = $3`,
+		reading.DeviceID, models.DeviceStatusQuarantined, now); err != nil {
+		return fmt.Errorf("failed to register quarantined device: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO quarantined_readings (device_id, field_id, payload, received_at)
+		VALUES ($1, $2, $3, $4)`,
+		reading.DeviceID, nullString(reading.Location.FieldID), string(payload), now); err != nil {
+		return fmt.Errorf("failed to quarantine reading: %w", err)
+	}
+	return tx.Commit()
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	return string(raw)
+}
+
+func conflictIfUnchanged(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func notFoundIfUnchanged(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// internal/storage/stats.go
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// FieldCrops returns the crop type of every active registered field, keyed
+// by field ID. An empty cropType matches all fields.
+func (s *sqlStore) FieldCrops(ctx context.Context, cropType string) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, COALESCE(crop_type, '')
+		FROM fields
+		WHERE retired_at IS NULL AND ($1 = '' OR crop_type = $1)`, cropType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fields: %w", err)
+	}
+	defer rows.Close()
+
+	crops := map[string]string{}
+	for rows.Next() {
+		var id, crop string
+		if err := rows.Scan(&id, &crop); err != nil {
+			return nil, err
+		}
+		crops[id] = crop
+	}
+	return crops, rows.Err()
+}
+
+// UnresolvedAlerts counts unresolved alerts by severity and lifecycle
+// state as of now. An empty cropType counts alerts on all fields.
+func (s *sqlStore) UnresolvedAlerts(ctx context.Context, cropType string, now time.Time) ([]AlertCount, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT severity, state, COUNT(*)
+		FROM (
+			SELECT COALESCE(a.severity, 'unknown') AS severity,
+				CASE
+					WHEN a.snoozed_until > $2 THEN 'snoozed'
+					WHEN a.acknowledged_at IS NOT NULL THEN 'acknowledged'
+					ELSE 'open'
+				END AS state
+			FROM alerts a
+			LEFT JOIN fields f ON f.id = a.field_id
+			WHERE a.resolved = FALSE AND ($1 = '' OR f.crop_type = $1)
+		) unresolved
+		GROUP BY severity, state
+		ORDER BY severity, state`, cropType, now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alerts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []AlertCount{}
+	for rows.Next() {
+		var c AlertCount
+		if err := rows.Scan(&c.Severity, &c.State, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,86 @@
+// internal/storage/store.go
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"agricultural-iot-rag/internal/models"
+)
+
+var (
+	// ErrNotFound is returned when a lookup matches no stored data.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when creating a record whose ID already exists.
+	ErrConflict = errors.New("already exists")
+)
+
+// TimeSeries stores sensor readings and answers the queries the API needs.
+// It is implemented by InfluxDB and, for gateways without InfluxDB, by the
+// relational stores.
+type TimeSeries interface {
+	WriteReading(ctx context.Context, reading models.SensorReading) error
+	LatestReading(ctx context.Context, fieldID string) (*models.SensorReading, error)
+	LatestMeasurements(ctx context.Context, fieldID string) ([]LatestMeasurement, error)
+	History(ctx context.Context, q HistoryQuery) (*HistoryPage, error)
+	RecentActivity(ctx context.Context, lookback time.Duration) ([]DeviceActivity, error)
+	FieldMeans(ctx context.Context, measurement string, lookback time.Duration) (map[string]float64, error)
+}
+
+// Store is the relational store behind the field and device registry,
+// alerts and statistics. PostgresDB and SQLiteDB implement it.
+type Store interface {
+	TimeSeries
+
+	// Fields
+	CreateField(ctx context.Context, f *models.Field) error
+	GetField(ctx context.Context, id string) (*models.Field, error)
+	ListFields(ctx context.Context, filter FieldFilter) ([]models.Field, error)
+	UpdateField(ctx context.Context, id string, u models.FieldUpdate) (*models.Field, error)
+	RetireField(ctx context.Context, id string) error
+
+	// Devices
+	CreateDevice(ctx context.Context, d *models.Device) error
+	GetDevice(ctx context.Context, id string) (*models.Device, error)
+	ListDevices(ctx context.Context, filter DeviceFilter) ([]models.Device, error)
+	UpdateDevice(ctx context.Context, id string, u models.DeviceUpdate) (*models.Device, error)
+	RetireDevice(ctx context.Context, id string) error
+	TouchDevice(ctx context.Context, id string, seenAt time.Time) error
+	QuarantineReading(ctx context.Context, reading models.SensorReading) error
+
+	// Alerts
+	CreateAlert(ctx context.Context, a *models.Alert) error
+	GetAlert(ctx context.Context, id int64) (*models.Alert, error)
+	ListAlerts(ctx context.Context, filter AlertFilter) ([]models.Alert, error)
+	AcknowledgeAlert(ctx context.Context, e *models.AlertEvent) error
+	ResolveAlert(ctx context.Context, e *models.AlertEvent) error
+	SnoozeAlert(ctx context.Context, e *models.AlertEvent) error
+	AlertEvents(ctx context.Context, alertID int64) ([]models.AlertEvent, error)
+	OpenRuleAlerts(ctx context.Context) ([]models.Alert, error)
+
+	// Notification dead letters
+	CreateDeadLetter(ctx context.Context, d *models.DeadLetter) error
+	ListDeadLetters(ctx context.Context, limit int) ([]models.DeadLetter, error)
+
+	// Alert rules
+	CreateAlertRule(ctx context.Context, r *models.AlertRule) error
+	GetAlertRule(ctx context.Context, id int64) (*models.AlertRule, error)
+	ListAlertRules(ctx context.Context) ([]models.AlertRule, error)
+	UpdateAlertRule(ctx context.Context, r *models.AlertRule) error
+	DeleteAlertRule(ctx context.Context, id int64) error
+
+	// Statistics
+	FieldCrops(ctx context.Context, cropType string) (map[string]string, error)
+	UnresolvedAlerts(ctx context.Context, cropType string, now time.Time) ([]AlertCount, error)
+
+	Migrator() (*Migrator, error)
+	MigrateUp(ctx context.Context) error
+	Close() error
+}
+
+var (
+	_ Store      = (*PostgresDB)(nil)
+	_ Store      = (*SQLiteDB)(nil)
+	_ TimeSeries = (*InfluxDB)(nil)
+)
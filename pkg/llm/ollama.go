@@ -26,6 +26,32 @@ type ChatRequest struct {
 	Messages []Message `json:"messages"`
 	Stream   bool      `json:"stream"`
 	Tools    []Tool    `json:"tools,omitempty"`
+	// Format is "json" or a JSON schema the reply must follow.
+	Format json.RawMessage `json:"format,omitempty"`
+	// Options are model parameters such as temperature and seed.
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// FormatJSON asks for any well-formed JSON reply.
+var FormatJSON = json.RawMessage(`"json"`)
+
+// ChatOption adjusts a single chat request.
+type ChatOption func(*ChatRequest)
+
+// WithFormat constrains the reply to JSON: FormatJSON for any object, or a
+// JSON schema (Ollama 0.5 and later) the reply must match.
+func WithFormat(format json.RawMessage) ChatOption {
+	return func(r *ChatRequest) {
+		r.Format = format
+	}
+}
+
+// WithOptions sets model parameters for the request, e.g.
+// {"temperature": 0.8, "seed": 2}.
+func WithOptions(options map[string]interface{}) ChatOption {
+	return func(r *ChatRequest) {
+		r.Options = options
+	}
 }
 
 type Message struct {
@@ -57,13 +83,16 @@ type ToolCall struct {
 	} `json:"function"`
 }
 
-func (c *OllamaClient) Chat(ctx context.Context, messages []Message, tools []Tool) (*ChatResponse, error) {
+func (c *OllamaClient) Chat(ctx context.Context, messages []Message, tools []Tool, opts ...ChatOption) (*ChatResponse, error) {
 	req := ChatRequest{
 		Model:    c.model,
 		Messages: messages,
 		Stream:   false,
 		Tools:    tools,
 	}
+	for _, opt := range opts {
+		opt(&req)
+	}
 
 	jsonData, err := json.Marshal(req)
 	if err != nil {
@@ -0,0 +1,191 @@
+// pkg/llm/ollamatest/server.go
+
+// Package ollamatest provides an in-process stand-in for the Ollama HTTP
+// API. Chat replies come from a function the test supplies, and
+// embeddings are a deterministic bag-of-words hash, so texts that share
+// words score as similar without a running model.
+package ollamatest
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"agricultural-iot-rag/pkg/llm"
+)
+
+// Dimensions matches the vector size of the knowledge collection.
+const Dimensions = 768
+
+// Server is a fake Ollama that records every chat request.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	chats    []llm.ChatRequest
+	reply    func(req llm.ChatRequest) string
+	rerank   func(query, document string) float64
+	embedded int
+}
+
+// NewServer starts a fake Ollama whose chat replies are empty until
+// SetReply is called. Callers must Close it.
+func NewServer() *Server {
+	s := &Server{reply: func(llm.ChatRequest) string { return "" }}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/chat", s.handleChat)
+	mux.HandleFunc("/api/embeddings", s.handleEmbeddings)
+	mux.HandleFunc("/api/embed", s.handleEmbed)
+	mux.HandleFunc("/v1/rerank", s.handleRerank)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// SetReply sets the function that produces chat replies.
+func (s *Server) SetReply(fn func(req llm.ChatRequest) string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reply = fn
+}
+
+// SetRerank makes /v1/rerank, a llama.cpp-style rerank endpoint served
+// alongside the Ollama API for convenience, score each document with fn.
+// Until it is called the endpoint is missing, as on a llama.cpp server
+// started without --reranking.
+func (s *Server) SetRerank(fn func(query, document string) float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rerank = fn
+}
+
+// Chats returns the chat requests received so far.
+func (s *Server) Chats() []llm.ChatRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]llm.ChatRequest(nil), s.chats...)
+}
+
+// Embedded returns the number of texts embedded so far.
+func (s *Server) Embedded() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.embedded
+}
+
+func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
+	var req llm.ChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.chats = append(s.chats, req)
+	reply := s.reply
+	s.mu.Unlock()
+
+	writeJSON(w, llm.ChatResponse{
+		Message: llm.Message{Role: "assistant", Content: reply(req)},
+		Done:    true,
+	})
+}
+
+func (s *Server) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Prompt string `json:"prompt"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.embedded++
+	s.mu.Unlock()
+	writeJSON(w, map[string][]float32{"embedding": Embed(req.Prompt)})
+}
+
+func (s *Server) handleEmbed(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Input []string `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.embedded += len(req.Input)
+	s.mu.Unlock()
+	embeddings := make([][]float32, len(req.Input))
+	for i, text := range req.Input {
+		embeddings[i] = Embed(text)
+	}
+	writeJSON(w, map[string][][]float32{"embeddings": embeddings})
+}
+
+func (s *Server) handleRerank(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	rerank := s.rerank
+	s.mu.Unlock()
+	if rerank == nil {
+		http.NotFound(w, r)
+		return
+	}
+	var req struct {
+		Query     string   `json:"query"`
+		Documents []string `json:"documents"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	type result struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	}
+	// Results are listed best first, as real rerankers do.
+	results := make([]result, len(req.Documents))
+	for i, doc := range req.Documents {
+		results[i] = result{Index: i, RelevanceScore: rerank(req.Query, doc)}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].RelevanceScore > results[j].RelevanceScore })
+	writeJSON(w, map[string]interface{}{"results": results})
+}
+
+// Embed returns the fake embedding of text: lower-cased words hashed into
+// Dimensions buckets, normalized to unit length.
+func Embed(text string) []float32 {
+	v := make([]float32, Dimensions)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		h := fnv.New32a()
+		h.Write([]byte(word))
+		v[h.Sum32()%Dimensions]++
+	}
+
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	if norm > 0 {
+		n := float32(math.Sqrt(norm))
+		for i := range v {
+			v[i] /= n
+		}
+	} else {
+		v[0] = 1
+	}
+	return v
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,362 @@
+// pkg/rag/chunker.go
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Chunking strategies.
+const (
+	// ChunkFixed cuts windows of Size tokens, each starting Size-Overlap
+	// tokens after the previous one.
+	ChunkFixed = "fixed"
+	// ChunkSentence packs whole sentences, list items and paragraphs into
+	// chunks of up to Size tokens, repeating up to Overlap tokens of
+	// trailing sentences at the start of the next chunk.
+	ChunkSentence = "sentence"
+	// ChunkMarkdown splits at Markdown headings first and chunks each
+	// section by sentence, recording the headings it falls under.
+	ChunkMarkdown = "markdown"
+)
+
+// Default chunking, sized to stay well inside the context of common
+// embedding models.
+const (
+	DefaultChunkSize    = 256
+	DefaultChunkOverlap = 32
+)
+
+// ErrInvalidChunkOptions is returned for unknown strategies and sizes that
+// cannot make progress.
+var ErrInvalidChunkOptions = errors.New("invalid chunk options")
+
+// ChunkOptions configure ChunkText. Tokens are approximated by
+// whitespace-separated words. Zero values select ChunkMarkdown,
+// DefaultChunkSize and no overlap.
+type ChunkOptions struct {
+	Strategy string
+	Size     int
+	Overlap  int
+}
+
+// Validate reports options ChunkText would reject.
+func (o ChunkOptions) Validate() error {
+	_, err := o.normalize()
+	return err
+}
+
+func (o ChunkOptions) normalize() (ChunkOptions, error) {
+	if o.Strategy == "" {
+		o.Strategy = ChunkMarkdown
+	}
+	if o.Size == 0 {
+		o.Size = DefaultChunkSize
+	}
+	switch {
+	case o.Strategy != ChunkFixed && o.Strategy != ChunkSentence && o.Strategy != ChunkMarkdown:
+		return o, fmt.Errorf("%w: unknown strategy %q", ErrInvalidChunkOptions, o.Strategy)
+	case o.Size < 0 || o.Overlap < 0:
+		return o, fmt.Errorf("%w: size and overlap must not be negative", ErrInvalidChunkOptions)
+	case o.Overlap >= o.Size:
+		return o, fmt.Errorf("%w: overlap %d must be smaller than size %d", ErrInvalidChunkOptions, o.Overlap, o.Size)
+	}
+	return o, nil
+}
+
+// Chunk is a piece of a document. Text is the document's bytes from Start
+// to End. Consecutive chunks leave no gap between them, so the document
+// can be rebuilt from its chunks; overlapping chunks share bytes. Headings
+// is the path of Markdown headings the chunk falls under, outermost first.
+type Chunk struct {
+	Index    int
+	Text     string
+	Start    int
+	End      int
+	Headings []string
+}
+
+// ChunkText splits text into chunks of at most opts.Size tokens. Only a
+// single token longer than that is kept whole. Text without any words
+// yields no chunks.
+func ChunkText(text string, opts ChunkOptions) ([]Chunk, error) {
+	opts, err := opts.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []Chunk
+	add := func(spans []span, headings []string) {
+		for _, s := range spans {
+			chunks = append(chunks, Chunk{
+				Index:    len(chunks),
+				Text:     text[s.start:s.end],
+				Start:    s.start,
+				End:      s.end,
+				Headings: headings,
+			})
+		}
+	}
+	switch opts.Strategy {
+	case ChunkFixed:
+		add(pack(text, wordSpans(text, 0, len(text)), opts.Size, opts.Overlap), nil)
+	case ChunkSentence:
+		add(pack(text, sentenceSpans(text, 0, len(text)), opts.Size, opts.Overlap), nil)
+	case ChunkMarkdown:
+		for _, sec := range markdownSections(text) {
+			add(pack(text, sentenceSpans(text, sec.start, sec.end), opts.Size, opts.Overlap), sec.headings)
+		}
+	}
+	return chunks, nil
+}
+
+// span is a byte range of the text holding words tokens.
+type span struct {
+	start, end, words int
+}
+
+// pack greedily joins consecutive spans into chunks of up to size words,
+// first breaking spans that are too long into single words. Each chunk
+// after the first starts with as many whole trailing spans of the previous
+// one as fit in overlap words.
+func pack(text string, spans []span, size, overlap int) []span {
+	var segs []span
+	for _, s := range spans {
+		if s.words > size {
+			segs = append(segs, wordSpans(text, s.start, s.end)...)
+		} else {
+			segs = append(segs, s)
+		}
+	}
+
+	var out []span
+	for i := 0; i < len(segs); {
+		j, words := i, 0
+		for j < len(segs) && (j == i || words+segs[j].words <= size) {
+			words += segs[j].words
+			j++
+		}
+		out = append(out, span{segs[i].start, segs[j-1].end, words})
+		if j == len(segs) {
+			break
+		}
+		next, shared := j, 0
+		for next-1 > i && shared+segs[next-1].words <= overlap {
+			shared += segs[next-1].words
+			next--
+		}
+		i = next
+	}
+	return out
+}
+
+// wordSpans splits text[start:end] into one span per word. Each span runs
+// to the next word, and the first starts at start, so they cover the range
+// without gaps. A range without words yields nothing.
+func wordSpans(text string, start, end int) []span {
+	var starts []int
+	inWord := false
+	for i, r := range text[start:end] {
+		space := unicode.IsSpace(r)
+		if !space && !inWord {
+			starts = append(starts, start+i)
+		}
+		inWord = !space
+	}
+	if len(starts) == 0 {
+		return nil
+	}
+	starts[0] = start
+	spans := make([]span, len(starts))
+	for i, s := range starts {
+		e := end
+		if i+1 < len(starts) {
+			e = starts[i+1]
+		}
+		spans[i] = span{s, e, 1}
+	}
+	return spans
+}
+
+// sentenceSpans splits text[start:end] into sentences, paragraphs and list
+// items that together cover the range. Spans without words are joined to
+// their predecessor.
+func sentenceSpans(text string, start, end int) []span {
+	var bounds []int
+	lineStart := true
+	for i := start; i < end; i++ {
+		c := text[i]
+		switch {
+		case c == '\n':
+			// A blank line ends a paragraph; a list item starts a new unit.
+			j := i + 1
+			for j < end && (text[j] == ' ' || text[j] == '\t') {
+				j++
+			}
+			if j < end && (text[j] == '\n' || listItem(text[j:end])) {
+				bounds = append(bounds, j)
+			}
+			lineStart = true
+			continue
+		case (c == '.' || c == '!' || c == '?') && !lineStart:
+			j := i + 1
+			for j < end && strings.IndexByte(`"')]`, text[j]) >= 0 {
+				j++
+			}
+			if j < end && isSpace(text[j]) {
+				for j < end && isSpace(text[j]) {
+					j++
+				}
+				if j < end {
+					bounds = append(bounds, j)
+				}
+			}
+		}
+		if c != ' ' && c != '\t' {
+			lineStart = false
+		}
+	}
+
+	sort.Ints(bounds)
+	var spans []span
+	prev := start
+	for _, b := range append(bounds, end) {
+		if b <= prev {
+			continue
+		}
+		words := countWords(text[prev:b])
+		switch {
+		case words > 0:
+			spans = append(spans, span{prev, b, words})
+		case len(spans) > 0:
+			spans[len(spans)-1].end = b
+		default:
+			// Leading blank text joins the first sentence.
+			continue
+		}
+		prev = b
+	}
+	if len(spans) > 0 {
+		spans[0].start = start
+		spans[len(spans)-1].end = end
+	}
+	return spans
+}
+
+// listItem reports whether line starts with a Markdown list marker.
+func listItem(line string) bool {
+	if len(line) >= 2 && strings.IndexByte("-*+", line[0]) >= 0 && line[1] == ' ' {
+		return true
+	}
+	i := 0
+	for i < len(line) && line[i] >= '0' && line[i] <= '9' {
+		i++
+	}
+	return i > 0 && i+1 < len(line) && (line[i] == '.' || line[i] == ')') && line[i+1] == ' '
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func countWords(s string) int {
+	return len(strings.Fields(s))
+}
+
+// section is the text under one Markdown heading.
+type section struct {
+	start, end int
+	headings   []string
+}
+
+// markdownSections splits text at ATX headings ("## Title") outside code
+// fences. A heading with no text of its own before the next heading is
+// kept with the section that follows.
+func markdownSections(text string) []section {
+	var sections []section
+	var path []string
+	var levels []int
+	cur := section{}
+	inFence := false
+	for off := 0; off < len(text); {
+		lineEnd := strings.IndexByte(text[off:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(text)
+		} else {
+			lineEnd += off + 1
+		}
+		line := strings.TrimRight(text[off:lineEnd], "\r\n")
+		trimmed := strings.TrimLeft(line, " ")
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+		if level, title := heading(trimmed); !inFence && level > 0 && len(line)-len(trimmed) < 4 {
+			if countWords(text[cur.start:off]) > countHeadingWords(text[cur.start:off]) {
+				cur.end = off
+				sections = append(sections, cur)
+				cur = section{start: off}
+			}
+			for len(levels) > 0 && levels[len(levels)-1] >= level {
+				levels, path = levels[:len(levels)-1], path[:len(path)-1]
+			}
+			levels, path = append(levels, level), append(path, title)
+			cur.headings = append([]string(nil), path...)
+		}
+		off = lineEnd
+	}
+	cur.end = len(text)
+	if countWords(text[cur.start:cur.end]) > 0 {
+		sections = append(sections, cur)
+	}
+	return sections
+}
+
+// heading returns the level and title of an ATX heading line, or 0.
+func heading(line string) (int, string) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (level < len(line) && line[level] != ' ' && line[level] != '\t') {
+		return 0, ""
+	}
+	title := strings.TrimSpace(line[level:])
+	title = strings.TrimSpace(strings.TrimRight(title, "#"))
+	return level, title
+}
+
+// countHeadingWords counts the words on heading lines of text.
+func countHeadingWords(text string) int {
+	n := 0
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if level, _ := heading(trimmed); level > 0 {
+			n += countWords(trimmed)
+		}
+	}
+	return n
+}
+
+// JoinChunks rebuilds the text covered by chunks of one document, which
+// must be sorted by Start. Overlapping text appears once; chunks that do
+// not meet are separated by a blank line.
+func JoinChunks(chunks []Chunk) string {
+	var b strings.Builder
+	end := -1
+	for _, c := range chunks {
+		switch {
+		case end < 0:
+			b.WriteString(c.Text)
+		case c.Start > end:
+			b.WriteString("\n\n")
+			b.WriteString(c.Text)
+		case c.End > end:
+			b.WriteString(c.Text[end-c.Start:])
+		}
+		end = max(end, c.End)
+	}
+	return b.String()
+}
@@ -71,8 +71,63 @@ func (es *EmbeddingService) GetEmbedding(ctx context.Context, text string) ([]fl
 	return embedResp.Embedding, nil
 }
 
-// GetEmbeddings gets embeddings for multiple texts in batch
+// OllamaBatchEmbeddingRequest is the body of Ollama's /api/embed, which
+// embeds several inputs in one call.
+type OllamaBatchEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type OllamaBatchEmbeddingResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// Model returns the name of the embedding model.
+func (es *EmbeddingService) Model() string {
+	return es.model
+}
+
+// GetEmbeddings embeds texts in one request to /api/embed, falling back to
+// one request per text for Ollama versions without it.
 func (es *EmbeddingService) GetEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	jsonData, err := json.Marshal(OllamaBatchEmbeddingRequest{Model: es.model, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", es.apiURL+"/api/embed", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return es.getEmbeddingsOneByOne(ctx, texts)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding API returned status %d", resp.StatusCode)
+	}
+
+	var embedResp OllamaBatchEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embedResp); err != nil {
+		return nil, err
+	}
+	if len(embedResp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("embedding API returned %d embeddings for %d texts", len(embedResp.Embeddings), len(texts))
+	}
+	return embedResp.Embeddings, nil
+}
+
+func (es *EmbeddingService) getEmbeddingsOneByOne(ctx context.Context, texts []string) ([][]float32, error) {
 	embeddings := make([][]float32, len(texts))
 	for i, text := range texts {
 		emb, err := es.GetEmbedding(ctx, text)
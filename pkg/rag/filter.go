@@ -0,0 +1,561 @@
+// pkg/rag/filter.go
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	pb "github.com/qdrant/go-client/qdrant"
+)
+
+// ErrInvalidFilter is returned for filter expressions that do not parse.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Filter restricts a search to documents whose metadata matches an
+// expression such as
+//
+//	crop = potato AND season IN (spring, summer) AND NOT category = pests
+//	(region = "north-east" OR region IS EMPTY) AND published >= 2023-01-01
+//
+// Conditions compare a metadata key with =, !=, <, <=, > or >=, test
+// membership with IN (...) and NOT IN (...), or test for a missing value
+// with IS EMPTY and IS NOT EMPTY. They combine with AND, OR (binding less
+// tightly than AND), NOT and parentheses; keywords are case-insensitive.
+//
+// Values are typed as written: true and false are booleans, numbers are
+// numbers, YYYY-MM-DD and RFC 3339 timestamps are dates, and anything else,
+// or anything quoted, is a keyword. Keyword matches are exact. A nil
+// *Filter matches every document.
+type Filter struct {
+	root filterNode
+}
+
+// ParseFilter parses a filter expression. An empty expression yields a nil
+// Filter.
+func ParseFilter(expr string) (*Filter, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	p := &filterParser{tokens: tokens}
+	root, err := p.or()
+	if err == nil && p.pos < len(tokens) {
+		err = fmt.Errorf("unexpected %q", tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
+	return &Filter{root: root}, nil
+}
+
+// And returns a filter matching documents that match both f and other.
+// Either may be nil.
+func (f *Filter) And(other *Filter) *Filter {
+	switch {
+	case f == nil:
+		return other
+	case other == nil:
+		return f
+	}
+	return &Filter{root: &boolNode{op: "AND", children: []filterNode{f.root, other.root}}}
+}
+
+// String returns the filter as a normalized expression.
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.root.String()
+}
+
+// qdrant converts the filter to Qdrant's filter conditions.
+func (f *Filter) qdrant() *pb.Filter {
+	if f == nil {
+		return nil
+	}
+	if b, ok := f.root.(*boolNode); ok {
+		return b.filter()
+	}
+	return &pb.Filter{Must: []*pb.Condition{f.root.condition()}}
+}
+
+type filterNode interface {
+	condition() *pb.Condition
+	String() string
+}
+
+// boolNode is an AND or OR of its children, or a NOT of its only child.
+type boolNode struct {
+	op       string
+	children []filterNode
+}
+
+func (n *boolNode) filter() *pb.Filter {
+	conds := make([]*pb.Condition, len(n.children))
+	for i, c := range n.children {
+		conds[i] = c.condition()
+	}
+	switch n.op {
+	case "AND":
+		return &pb.Filter{Must: conds}
+	case "OR":
+		return &pb.Filter{Should: conds}
+	default:
+		return &pb.Filter{MustNot: conds}
+	}
+}
+
+func (n *boolNode) condition() *pb.Condition {
+	return &pb.Condition{ConditionOneOf: &pb.Condition_Filter{Filter: n.filter()}}
+}
+
+func (n *boolNode) String() string {
+	if n.op == "NOT" {
+		return "NOT " + wrap(n.children[0], "NOT")
+	}
+	parts := make([]string, len(n.children))
+	for i, c := range n.children {
+		parts[i] = wrap(c, n.op)
+	}
+	return strings.Join(parts, " "+n.op+" ")
+}
+
+// wrap parenthesizes boolean children that bind less tightly than parent.
+func wrap(n filterNode, parent string) string {
+	if b, ok := n.(*boolNode); ok && b.op != "NOT" && b.op != parent {
+		return "(" + b.String() + ")"
+	}
+	return n.String()
+}
+
+func not(n filterNode) filterNode {
+	return &boolNode{op: "NOT", children: []filterNode{n}}
+}
+
+// compareNode is a condition on a single metadata key.
+type compareNode struct {
+	key    string
+	op     string // =, <, <=, >, >=, IN
+	values []literal
+}
+
+func (n *compareNode) condition() *pb.Condition {
+	fc := &pb.FieldCondition{Key: n.key}
+	v := n.values[0]
+	switch {
+	case n.op == "IN" && v.kind == literalKeyword:
+		strs := make([]string, len(n.values))
+		for i, v := range n.values {
+			strs[i] = v.text
+		}
+		fc.Match = &pb.Match{MatchValue: &pb.Match_Keywords{Keywords: &pb.RepeatedStrings{Strings: strs}}}
+	case n.op == "IN":
+		ints := make([]int64, len(n.values))
+		for i, v := range n.values {
+			ints[i] = int64(v.number)
+		}
+		fc.Match = &pb.Match{MatchValue: &pb.Match_Integers{Integers: &pb.RepeatedIntegers{Integers: ints}}}
+	case n.op == "=" && v.kind == literalKeyword:
+		fc.Match = &pb.Match{MatchValue: &pb.Match_Keyword{Keyword: v.text}}
+	case n.op == "=" && v.kind == literalBool:
+		fc.Match = &pb.Match{MatchValue: &pb.Match_Boolean{Boolean: v.boolean}}
+	case n.op == "=" && v.integer():
+		fc.Match = &pb.Match{MatchValue: &pb.Match_Integer{Integer: int64(v.number)}}
+	default:
+		// Fractional equality and comparisons are ranges.
+		num := v.number
+		r := &pb.Range{}
+		switch n.op {
+		case "=":
+			r.Gte, r.Lte = &num, &num
+		case "<":
+			r.Lt = &num
+		case "<=":
+			r.Lte = &num
+		case ">":
+			r.Gt = &num
+		case ">=":
+			r.Gte = &num
+		}
+		fc.Range = r
+	}
+	return &pb.Condition{ConditionOneOf: &pb.Condition_Field{Field: fc}}
+}
+
+func (n *compareNode) String() string {
+	if n.op != "IN" {
+		return n.key + " " + n.op + " " + n.values[0].String()
+	}
+	parts := make([]string, len(n.values))
+	for i, v := range n.values {
+		parts[i] = v.String()
+	}
+	return n.key + " IN (" + strings.Join(parts, ", ") + ")"
+}
+
+// emptyNode matches documents without a value for key.
+type emptyNode struct {
+	key string
+}
+
+func (n *emptyNode) condition() *pb.Condition {
+	return &pb.Condition{ConditionOneOf: &pb.Condition_IsEmpty{IsEmpty: &pb.IsEmptyCondition{Key: n.key}}}
+}
+
+func (n *emptyNode) String() string {
+	return n.key + " IS EMPTY"
+}
+
+type literalKind int
+
+const (
+	literalKeyword literalKind = iota
+	literalNumber
+	literalBool
+	literalDate
+)
+
+// literal is a typed value. Dates hold their Unix seconds in number.
+type literal struct {
+	kind    literalKind
+	text    string
+	number  float64
+	boolean bool
+}
+
+func (l literal) integer() bool {
+	return (l.kind == literalNumber || l.kind == literalDate) && l.number == float64(int64(l.number))
+}
+
+func (l literal) String() string {
+	if l.kind == literalKeyword {
+		return strconv.Quote(l.text)
+	}
+	return l.text
+}
+
+var (
+	dateLiteral   = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	numberLiteral = regexp.MustCompile(`^[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?$`)
+)
+
+func parseLiteral(t filterToken) (literal, error) {
+	if t.quoted {
+		return literal{kind: literalKeyword, text: t.text}, nil
+	}
+	switch strings.ToLower(t.text) {
+	case "true":
+		return literal{kind: literalBool, text: "true", boolean: true}, nil
+	case "false":
+		return literal{kind: literalBool, text: "false"}, nil
+	}
+	if numberLiteral.MatchString(t.text) {
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return literal{}, fmt.Errorf("bad number %q", t.text)
+		}
+		return literal{kind: literalNumber, text: t.text, number: n}, nil
+	}
+	if dateLiteral.MatchString(t.text) {
+		d, err := time.Parse("2006-01-02", t.text)
+		if err != nil {
+			return literal{}, fmt.Errorf("bad date %q", t.text)
+		}
+		return literal{kind: literalDate, text: t.text, number: float64(d.Unix())}, nil
+	}
+	if d, err := time.Parse(time.RFC3339, t.text); err == nil {
+		return literal{kind: literalDate, text: t.text, number: float64(d.Unix())}, nil
+	}
+	return literal{kind: literalKeyword, text: t.text}, nil
+}
+
+type filterToken struct {
+	text   string
+	quoted bool
+	// op marks operators and punctuation, which are never values.
+	op bool
+}
+
+// keyword reports whether t is the unquoted keyword kw.
+func (t filterToken) keyword(kw string) bool {
+	return !t.quoted && !t.op && strings.EqualFold(t.text, kw)
+}
+
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	rs := []rune(expr)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')' || r == ',' || r == '=':
+			tokens = append(tokens, filterToken{text: string(r), op: true})
+			i++
+		case r == '<' || r == '>' || r == '!':
+			op := string(r)
+			if i+1 < len(rs) && rs[i+1] == '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("unexpected %q", "!")
+			}
+			tokens = append(tokens, filterToken{text: op, op: true})
+			i += len(op)
+		case r == '"':
+			// Double-quoted strings use Go escapes.
+			j := i + 1
+			for j < len(rs) && rs[j] != '"' {
+				if rs[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(rs) {
+				return nil, errors.New("unterminated string")
+			}
+			s, err := strconv.Unquote(string(rs[i : j+1]))
+			if err != nil {
+				return nil, fmt.Errorf("bad string %s", string(rs[i:j+1]))
+			}
+			tokens = append(tokens, filterToken{text: s, quoted: true})
+			i = j + 1
+		case r == '\'':
+			j := i + 1
+			for j < len(rs) && rs[j] != '\'' {
+				j++
+			}
+			if j >= len(rs) {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, filterToken{text: string(rs[i+1 : j]), quoted: true})
+			i = j + 1
+		default:
+			j := i
+			for j < len(rs) && !unicode.IsSpace(rs[j]) && !strings.ContainsRune(`()",'=<>!`, rs[j]) {
+				j++
+			}
+			tokens = append(tokens, filterToken{text: string(rs[i:j])})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// filterParser is a recursive descent parser over the grammar
+//
+//	or      = and { OR and }
+//	and     = unary { AND unary }
+//	unary   = NOT unary | "(" or ")" | cond
+//	cond    = key op value | key [NOT] IN "(" value { "," value } ")"
+//	        | key IS [NOT] EMPTY
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() (filterToken, bool) {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos], true
+	}
+	return filterToken{}, false
+}
+
+func (p *filterParser) next() (filterToken, error) {
+	t, ok := p.peek()
+	if !ok {
+		return t, errors.New("unexpected end of expression")
+	}
+	p.pos++
+	return t, nil
+}
+
+func (p *filterParser) expect(text string) error {
+	t, err := p.next()
+	if err != nil {
+		return fmt.Errorf("expected %q: %v", text, err)
+	}
+	if t.quoted || !strings.EqualFold(t.text, text) {
+		return fmt.Errorf("expected %q, got %q", text, t.text)
+	}
+	return nil
+}
+
+func (p *filterParser) acceptKeyword(kw string) bool {
+	if t, ok := p.peek(); ok && t.keyword(kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) or() (filterNode, error) {
+	return p.binary("OR", p.and)
+}
+
+func (p *filterParser) and() (filterNode, error) {
+	return p.binary("AND", p.unary)
+}
+
+// binary parses operands joined by op, flattening them into one node.
+func (p *filterParser) binary(op string, operand func() (filterNode, error)) (filterNode, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	children := []filterNode{first}
+	for p.acceptKeyword(op) {
+		n, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if b, ok := n.(*boolNode); ok && b.op == op {
+			children = append(children, b.children...)
+		} else {
+			children = append(children, n)
+		}
+	}
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &boolNode{op: op, children: children}, nil
+}
+
+func (p *filterParser) unary() (filterNode, error) {
+	if p.acceptKeyword("NOT") {
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return not(n), nil
+	}
+	if t, ok := p.peek(); ok && t.op && t.text == "(" {
+		p.pos++
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(")")
+	}
+	return p.cond()
+}
+
+func (p *filterParser) cond() (filterNode, error) {
+	keyTok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if keyTok.op || keyTok.quoted || isReserved(keyTok.text) {
+		return nil, fmt.Errorf("expected a metadata key, got %q", keyTok.text)
+	}
+	key := keyTok.text
+
+	if p.acceptKeyword("IS") {
+		negate := p.acceptKeyword("NOT")
+		if err := p.expect("EMPTY"); err != nil {
+			return nil, err
+		}
+		var n filterNode = &emptyNode{key: key}
+		if negate {
+			n = not(n)
+		}
+		return n, nil
+	}
+	if p.acceptKeyword("NOT") {
+		if err := p.expect("IN"); err != nil {
+			return nil, err
+		}
+		n, err := p.in(key)
+		if err != nil {
+			return nil, err
+		}
+		return not(n), nil
+	}
+	if p.acceptKeyword("IN") {
+		return p.in(key)
+	}
+
+	opTok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if !opTok.op || opTok.text == "(" || opTok.text == ")" || opTok.text == "," {
+		return nil, fmt.Errorf("expected a comparison after %q, got %q", key, opTok.text)
+	}
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	switch opTok.text {
+	case "=":
+		return &compareNode{key: key, op: "=", values: []literal{v}}, nil
+	case "!=":
+		return not(&compareNode{key: key, op: "=", values: []literal{v}}), nil
+	default:
+		if v.kind != literalNumber && v.kind != literalDate {
+			return nil, fmt.Errorf("%s %s needs a number or date, got %s", key, opTok.text, v)
+		}
+		return &compareNode{key: key, op: opTok.text, values: []literal{v}}, nil
+	}
+}
+
+// in parses the value list of an IN condition. Qdrant matches lists of
+// keywords or of integers, so the values must all be one or the other.
+func (p *filterParser) in(key string) (filterNode, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var values []literal
+	for {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		t, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if t.op && t.text == ")" {
+			break
+		}
+		if !t.op || t.text != "," {
+			return nil, fmt.Errorf("expected \",\" or \")\", got %q", t.text)
+		}
+	}
+	keywords := values[0].kind == literalKeyword
+	for _, v := range values {
+		switch {
+		case keywords && v.kind != literalKeyword, !keywords && !v.integer():
+			return nil, fmt.Errorf("%s IN needs all keywords or all integers", key)
+		}
+	}
+	return &compareNode{key: key, op: "IN", values: values}, nil
+}
+
+func (p *filterParser) value() (literal, error) {
+	t, err := p.next()
+	if err != nil {
+		return literal{}, err
+	}
+	if t.op {
+		return literal{}, fmt.Errorf("expected a value, got %q", t.text)
+	}
+	return parseLiteral(t)
+}
+
+func isReserved(word string) bool {
+	switch strings.ToUpper(word) {
+	case "AND", "OR", "NOT", "IN", "IS", "EMPTY":
+		return true
+	}
+	return false
+}
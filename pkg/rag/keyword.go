@@ -0,0 +1,211 @@
+// pkg/rag/keyword.go
+package rag
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// BM25 parameters: term frequency saturation and length normalization.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Passage is a piece of text indexed under ID, such as a chunk's point ID.
+type Passage struct {
+	ID   string
+	Text string
+}
+
+// KeywordHit is a passage matching a keyword query with its BM25 score.
+type KeywordHit struct {
+	ID    string
+	DocID string
+	Score float64
+}
+
+// KeywordIndex is an in-memory BM25 index over the passages of documents.
+// It is safe for concurrent use.
+type KeywordIndex struct {
+	mu       sync.RWMutex
+	docs     map[string][]string // document ID -> passage IDs
+	passages map[string]*indexedPassage
+	postings map[string]map[string]int // term -> passage ID -> frequency
+	totalLen int
+}
+
+type indexedPassage struct {
+	docID  string
+	length int
+	terms  map[string]int
+}
+
+func NewKeywordIndex() *KeywordIndex {
+	return &KeywordIndex{
+		docs:     map[string][]string{},
+		passages: map[string]*indexedPassage{},
+		postings: map[string]map[string]int{},
+	}
+}
+
+// Put indexes a document's passages, replacing those indexed for it before.
+func (ki *KeywordIndex) Put(docID string, passages []Passage) {
+	ki.mu.Lock()
+	defer ki.mu.Unlock()
+	ki.delete(docID)
+	for _, p := range passages {
+		if _, ok := ki.passages[p.ID]; ok {
+			ki.removePassage(p.ID)
+		}
+		terms := Tokenize(p.Text)
+		ip := &indexedPassage{docID: docID, length: len(terms), terms: map[string]int{}}
+		for _, t := range terms {
+			ip.terms[t]++
+		}
+		for t, tf := range ip.terms {
+			if ki.postings[t] == nil {
+				ki.postings[t] = map[string]int{}
+			}
+			ki.postings[t][p.ID] = tf
+		}
+		ki.passages[p.ID] = ip
+		ki.totalLen += len(terms)
+		ki.docs[docID] = append(ki.docs[docID], p.ID)
+	}
+}
+
+// Delete removes a document's passages.
+func (ki *KeywordIndex) Delete(docID string) {
+	ki.mu.Lock()
+	defer ki.mu.Unlock()
+	ki.delete(docID)
+}
+
+func (ki *KeywordIndex) delete(docID string) {
+	for _, id := range ki.docs[docID] {
+		ki.removePassage(id)
+	}
+	delete(ki.docs, docID)
+}
+
+func (ki *KeywordIndex) removePassage(id string) {
+	p := ki.passages[id]
+	if p == nil {
+		return
+	}
+	// Passage IDs are only listed under the document that indexed them
+	// last; drop them from any other.
+	if ids := ki.docs[p.docID]; len(ids) > 0 {
+		kept := ids[:0]
+		for _, other := range ids {
+			if other != id {
+				kept = append(kept, other)
+			}
+		}
+		ki.docs[p.docID] = kept
+	}
+	for t := range p.terms {
+		delete(ki.postings[t], id)
+		if len(ki.postings[t]) == 0 {
+			delete(ki.postings, t)
+		}
+	}
+	ki.totalLen -= p.length
+	delete(ki.passages, id)
+}
+
+// Len returns the number of indexed passages.
+func (ki *KeywordIndex) Len() int {
+	ki.mu.RLock()
+	defer ki.mu.RUnlock()
+	return len(ki.passages)
+}
+
+// Search returns up to limit passages containing any of the query's terms,
+// best BM25 score first.
+func (ki *KeywordIndex) Search(query string, limit int) []KeywordHit {
+	ki.mu.RLock()
+	defer ki.mu.RUnlock()
+	n := float64(len(ki.passages))
+	if n == 0 || limit <= 0 {
+		return nil
+	}
+	avgLen := float64(ki.totalLen) / n
+
+	scores := map[string]float64{}
+	seen := map[string]bool{}
+	for _, t := range Tokenize(query) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		postings := ki.postings[t]
+		df := float64(len(postings))
+		if df == 0 {
+			continue
+		}
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range postings {
+			f := float64(tf)
+			norm := 1 - bm25B + bm25B*float64(ki.passages[id].length)/avgLen
+			scores[id] += idf * f * (bm25K1 + 1) / (f + bm25K1*norm)
+		}
+	}
+
+	hits := make([]KeywordHit, 0, len(scores))
+	for id, s := range scores {
+		hits = append(hits, KeywordHit{ID: id, DocID: ki.passages[id].docID, Score: s})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// stopwords are left out of the index; matching them says nothing about a
+// passage.
+var stopwords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`a an and are as at be by can do does for from how i if in
+		is it its my of on or should so than that the their then there these this to
+		was we what when where which while who why will with you your`) {
+		stopwords[w] = true
+	}
+}
+
+// Tokenize lower-cases text and splits it into words, leaving out common
+// English stopwords. Letters and digits joined by hyphens, dots or slashes
+// stay together, so codes such as "NPK 15-15-15" and "P2O5" match exactly;
+// hyphenated words are also indexed by their parts.
+func Tokenize(text string) []string {
+	var terms []string
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '.' && r != '/'
+	})
+	for _, f := range fields {
+		f = strings.Trim(f, "-./")
+		if f == "" || stopwords[f] {
+			continue
+		}
+		terms = append(terms, f)
+		if strings.ContainsAny(f, "-./") {
+			for _, part := range strings.FieldsFunc(f, func(r rune) bool { return r == '-' || r == '.' || r == '/' }) {
+				if part != f {
+					terms = append(terms, part)
+				}
+			}
+		}
+	}
+	return terms
+}
@@ -0,0 +1,120 @@
+// pkg/rag/payload.go
+package rag
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	pb "github.com/qdrant/go-client/qdrant"
+)
+
+// payloadValue converts a metadata value to the Qdrant type filters match
+// against: strings are keywords, integers and floats numbers, and bools
+// booleans; JSON numbers are integers when they parse as one. Dates (time.Time) are stored as Unix seconds, because this
+// Qdrant version can only range-filter numbers; filter expressions accept
+// dates and convert them the same way. String slices become lists, which a
+// keyword condition matches if any element does. Other values are stored
+// as their string form.
+func payloadValue(v interface{}) *pb.Value {
+	switch v := v.(type) {
+	case string:
+		return &pb.Value{Kind: &pb.Value_StringValue{StringValue: v}}
+	case bool:
+		return &pb.Value{Kind: &pb.Value_BoolValue{BoolValue: v}}
+	case int:
+		return integerValue(int64(v))
+	case int32:
+		return integerValue(int64(v))
+	case int64:
+		return integerValue(v)
+	case uint32:
+		return integerValue(int64(v))
+	case float32:
+		return &pb.Value{Kind: &pb.Value_DoubleValue{DoubleValue: float64(v)}}
+	case float64:
+		return &pb.Value{Kind: &pb.Value_DoubleValue{DoubleValue: v}}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return integerValue(n)
+		}
+		f, _ := v.Float64()
+		return &pb.Value{Kind: &pb.Value_DoubleValue{DoubleValue: f}}
+	case time.Time:
+		return integerValue(v.Unix())
+	case []string:
+		list := &pb.ListValue{}
+		for _, s := range v {
+			list.Values = append(list.Values, payloadValue(s))
+		}
+		return &pb.Value{Kind: &pb.Value_ListValue{ListValue: list}}
+	case []interface{}:
+		list := &pb.ListValue{}
+		for _, e := range v {
+			list.Values = append(list.Values, payloadValue(e))
+		}
+		return &pb.Value{Kind: &pb.Value_ListValue{ListValue: list}}
+	case nil:
+		return &pb.Value{Kind: &pb.Value_NullValue{}}
+	default:
+		return &pb.Value{Kind: &pb.Value_StringValue{StringValue: fmt.Sprintf("%v", v)}}
+	}
+}
+
+func integerValue(n int64) *pb.Value {
+	return &pb.Value{Kind: &pb.Value_IntegerValue{IntegerValue: n}}
+}
+
+// PayloadMetadata converts a point's payload back to metadata values,
+// leaving out the keys VectorStore writes itself. Dates come back as the
+// Unix seconds they are stored as.
+func PayloadMetadata(payload map[string]*pb.Value) map[string]interface{} {
+	metadata := make(map[string]interface{}, len(payload))
+	for key, v := range payload {
+		switch key {
+		case PayloadContent, PayloadDocID, PayloadChunkIndex, PayloadChunkCount,
+			PayloadChunkStart, PayloadChunkEnd, PayloadHeadings,
+			PayloadContentHash, PayloadEmbeddingModel:
+			continue
+		}
+		metadata[key] = metadataValue(v)
+	}
+	return metadata
+}
+
+func metadataValue(v *pb.Value) interface{} {
+	switch k := v.GetKind().(type) {
+	case *pb.Value_StringValue:
+		return k.StringValue
+	case *pb.Value_IntegerValue:
+		return k.IntegerValue
+	case *pb.Value_DoubleValue:
+		return k.DoubleValue
+	case *pb.Value_BoolValue:
+		return k.BoolValue
+	case *pb.Value_ListValue:
+		list := make([]interface{}, len(k.ListValue.GetValues()))
+		for i, e := range k.ListValue.GetValues() {
+			list[i] = metadataValue(e)
+		}
+		return list
+	case *pb.Value_StructValue:
+		fields := make(map[string]interface{}, len(k.StructValue.GetFields()))
+		for key, e := range k.StructValue.GetFields() {
+			fields[key] = metadataValue(e)
+		}
+		return fields
+	}
+	return nil
+}
+
+// payloadNumber reads a numeric payload value, or 0.
+func payloadNumber(payload map[string]*pb.Value, key string) float64 {
+	switch v := payload[key].GetKind().(type) {
+	case *pb.Value_IntegerValue:
+		return float64(v.IntegerValue)
+	case *pb.Value_DoubleValue:
+		return v.DoubleValue
+	}
+	return 0
+}
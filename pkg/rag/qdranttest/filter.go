@@ -0,0 +1,122 @@
+// pkg/rag/qdranttest/filter.go
+package qdranttest
+
+import (
+	pb "github.com/qdrant/go-client/qdrant"
+)
+
+// matches evaluates a Qdrant filter against a point the way Qdrant does for
+// the conditions rag.VectorStore produces: every Must condition and at
+// least one Should condition (if any) must hold, and no MustNot condition
+// may.
+func matches(f *pb.Filter, payload map[string]*pb.Value, id *pb.PointId) bool {
+	if f == nil {
+		return true
+	}
+	for _, c := range f.Must {
+		if !conditionMatches(c, payload, id) {
+			return false
+		}
+	}
+	for _, c := range f.MustNot {
+		if conditionMatches(c, payload, id) {
+			return false
+		}
+	}
+	if len(f.Should) == 0 {
+		return true
+	}
+	for _, c := range f.Should {
+		if conditionMatches(c, payload, id) {
+			return true
+		}
+	}
+	return false
+}
+
+func conditionMatches(c *pb.Condition, payload map[string]*pb.Value, id *pb.PointId) bool {
+	switch c := c.ConditionOneOf.(type) {
+	case *pb.Condition_Filter:
+		return matches(c.Filter, payload, id)
+	case *pb.Condition_HasId:
+		for _, h := range c.HasId.GetHasId() {
+			if pointKey(h) == pointKey(id) {
+				return true
+			}
+		}
+	case *pb.Condition_IsEmpty:
+		return len(values(payload[c.IsEmpty.Key])) == 0
+	case *pb.Condition_Field:
+		// A condition on a list holds if it holds for any element.
+		for _, v := range values(payload[c.Field.Key]) {
+			if fieldMatches(c.Field, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// values flattens a payload value into its non-null elements.
+func values(v *pb.Value) []*pb.Value {
+	switch k := v.GetKind().(type) {
+	case nil, *pb.Value_NullValue:
+		return nil
+	case *pb.Value_ListValue:
+		var out []*pb.Value
+		for _, e := range k.ListValue.GetValues() {
+			out = append(out, values(e)...)
+		}
+		return out
+	default:
+		return []*pb.Value{v}
+	}
+}
+
+func fieldMatches(fc *pb.FieldCondition, v *pb.Value) bool {
+	if r := fc.Range; r != nil {
+		n, ok := number(v)
+		return ok &&
+			(r.Lt == nil || n < *r.Lt) && (r.Lte == nil || n <= *r.Lte) &&
+			(r.Gt == nil || n > *r.Gt) && (r.Gte == nil || n >= *r.Gte)
+	}
+	switch m := fc.Match.GetMatchValue().(type) {
+	case *pb.Match_Keyword:
+		return v.GetStringValue() == m.Keyword && isString(v)
+	case *pb.Match_Keywords:
+		for _, s := range m.Keywords.GetStrings() {
+			if isString(v) && v.GetStringValue() == s {
+				return true
+			}
+		}
+	case *pb.Match_Integer:
+		_, ok := v.GetKind().(*pb.Value_IntegerValue)
+		return ok && v.GetIntegerValue() == m.Integer
+	case *pb.Match_Integers:
+		_, ok := v.GetKind().(*pb.Value_IntegerValue)
+		for _, n := range m.Integers.GetIntegers() {
+			if ok && v.GetIntegerValue() == n {
+				return true
+			}
+		}
+	case *pb.Match_Boolean:
+		_, ok := v.GetKind().(*pb.Value_BoolValue)
+		return ok && v.GetBoolValue() == m.Boolean
+	}
+	return false
+}
+
+func isString(v *pb.Value) bool {
+	_, ok := v.GetKind().(*pb.Value_StringValue)
+	return ok
+}
+
+func number(v *pb.Value) (float64, bool) {
+	switch k := v.GetKind().(type) {
+	case *pb.Value_IntegerValue:
+		return float64(k.IntegerValue), true
+	case *pb.Value_DoubleValue:
+		return k.DoubleValue, true
+	}
+	return 0, false
+}
@@ -0,0 +1,311 @@
+// pkg/rag/qdranttest/server.go
+
+// Package qdranttest provides an in-process stand-in for the Qdrant gRPC
+// API. It keeps points in memory and answers the collection and point
+// calls rag.VectorStore makes, scoring searches by cosine similarity and
+// applying payload filters, so retrieval can be exercised without a running Qdrant.
+package qdranttest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"sync"
+
+	pb "github.com/qdrant/go-client/qdrant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server is a fake Qdrant listening on a loopback port.
+type Server struct {
+	// Addr is the host:port to pass to rag.NewVectorStore.
+	Addr string
+
+	grpc        *grpc.Server
+	mu          sync.Mutex
+	collections map[string]*collection
+}
+
+type collection struct {
+	points map[string]*pb.RetrievedPoint
+	// order keeps insertion order so equal scores sort deterministically.
+	order []string
+}
+
+// NewServer starts a fake Qdrant. Callers must Close it.
+func NewServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("qdranttest: failed to listen: " + err.Error())
+	}
+	s := &Server{
+		Addr:        l.Addr().String(),
+		grpc:        grpc.NewServer(),
+		collections: map[string]*collection{},
+	}
+	pb.RegisterCollectionsServer(s.grpc, &collectionsServer{s: s})
+	pb.RegisterPointsServer(s.grpc, &pointsServer{s: s})
+	go s.grpc.Serve(l)
+	return s
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.grpc.Stop()
+}
+
+// Points returns the payloads of every point in a collection, in insertion
+// order.
+func (s *Server) Points(name string) []map[string]*pb.Value {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.collections[name]
+	if !ok {
+		return nil
+	}
+	out := make([]map[string]*pb.Value, 0, len(c.order))
+	for _, key := range c.order {
+		out = append(out, c.points[key].Payload)
+	}
+	return out
+}
+
+func (s *Server) collection(name string) (*collection, error) {
+	c, ok := s.collections[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "collection %s not found", name)
+	}
+	return c, nil
+}
+
+type collectionsServer struct {
+	pb.UnimplementedCollectionsServer
+	s *Server
+}
+
+func (cs *collectionsServer) List(context.Context, *pb.ListCollectionsRequest) (*pb.ListCollectionsResponse, error) {
+	cs.s.mu.Lock()
+	defer cs.s.mu.Unlock()
+	resp := &pb.ListCollectionsResponse{}
+	for name := range cs.s.collections {
+		resp.Collections = append(resp.Collections, &pb.CollectionDescription{Name: name})
+	}
+	return resp, nil
+}
+
+func (cs *collectionsServer) Create(_ context.Context, req *pb.CreateCollection) (*pb.CollectionOperationResponse, error) {
+	cs.s.mu.Lock()
+	defer cs.s.mu.Unlock()
+	if _, ok := cs.s.collections[req.CollectionName]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "collection %s already exists", req.CollectionName)
+	}
+	cs.s.collections[req.CollectionName] = &collection{points: map[string]*pb.RetrievedPoint{}}
+	return &pb.CollectionOperationResponse{Result: true}, nil
+}
+
+type pointsServer struct {
+	pb.UnimplementedPointsServer
+	s *Server
+}
+
+func (ps *pointsServer) Upsert(_ context.Context, req *pb.UpsertPoints) (*pb.PointsOperationResponse, error) {
+	ps.s.mu.Lock()
+	defer ps.s.mu.Unlock()
+	c, err := ps.s.collection(req.CollectionName)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range req.Points {
+		key := pointKey(p.Id)
+		if _, exists := c.points[key]; !exists {
+			c.order = append(c.order, key)
+		}
+		c.points[key] = &pb.RetrievedPoint{
+			Id:      p.Id,
+			Payload: p.Payload,
+			Vectors: p.Vectors,
+		}
+	}
+	return completed(), nil
+}
+
+func (ps *pointsServer) Search(_ context.Context, req *pb.SearchPoints) (*pb.SearchResponse, error) {
+	ps.s.mu.Lock()
+	defer ps.s.mu.Unlock()
+	c, err := ps.s.collection(req.CollectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	var hits []*pb.ScoredPoint
+	for _, key := range c.order {
+		p := c.points[key]
+		if !matches(req.Filter, p.Payload, p.Id) {
+			continue
+		}
+		score := cosine(req.Vector, p.Vectors.GetVector().GetData())
+		if req.ScoreThreshold != nil && score < *req.ScoreThreshold {
+			continue
+		}
+		hit := &pb.ScoredPoint{Id: p.Id, Score: score}
+		if req.WithPayload.GetEnable() {
+			hit.Payload = p.Payload
+		}
+		if req.WithVectors.GetEnable() {
+			hit.Vectors = p.Vectors
+		}
+		hits = append(hits, hit)
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if offset := int(req.GetOffset()); offset > 0 {
+		hits = hits[min(offset, len(hits)):]
+	}
+	if limit := int(req.Limit); limit < len(hits) {
+		hits = hits[:limit]
+	}
+	return &pb.SearchResponse{Result: hits}, nil
+}
+
+func (ps *pointsServer) Get(_ context.Context, req *pb.GetPoints) (*pb.GetResponse, error) {
+	ps.s.mu.Lock()
+	defer ps.s.mu.Unlock()
+	c, err := ps.s.collection(req.CollectionName)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.GetResponse{}
+	for _, id := range req.Ids {
+		if p, ok := c.points[pointKey(id)]; ok {
+			resp.Result = append(resp.Result, retrieved(p, req.WithPayload, req.WithVectors))
+		}
+	}
+	return resp, nil
+}
+
+// Scroll pages through matching points ordered by ID as Qdrant does:
+// numeric IDs first, then UUIDs.
+func (ps *pointsServer) Scroll(_ context.Context, req *pb.ScrollPoints) (*pb.ScrollResponse, error) {
+	ps.s.mu.Lock()
+	defer ps.s.mu.Unlock()
+	c, err := ps.s.collection(req.CollectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []*pb.RetrievedPoint
+	for _, key := range c.order {
+		p := c.points[key]
+		if matches(req.Filter, p.Payload, p.Id) && (req.Offset == nil || !idLess(p.Id, req.Offset)) {
+			matched = append(matched, p)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return idLess(matched[i].Id, matched[j].Id) })
+
+	limit := 10
+	if req.Limit != nil {
+		limit = int(*req.Limit)
+	}
+	resp := &pb.ScrollResponse{}
+	if len(matched) > limit {
+		resp.NextPageOffset = matched[limit].Id
+		matched = matched[:limit]
+	}
+	for _, p := range matched {
+		resp.Result = append(resp.Result, retrieved(p, req.WithPayload, req.WithVectors))
+	}
+	return resp, nil
+}
+
+func (ps *pointsServer) Delete(_ context.Context, req *pb.DeletePoints) (*pb.PointsOperationResponse, error) {
+	ps.s.mu.Lock()
+	defer ps.s.mu.Unlock()
+	c, err := ps.s.collection(req.CollectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	remove := map[string]bool{}
+	switch sel := req.Points.GetPointsSelectorOneOf().(type) {
+	case *pb.PointsSelector_Points:
+		for _, id := range sel.Points.GetIds() {
+			remove[pointKey(id)] = true
+		}
+	case *pb.PointsSelector_Filter:
+		for key, p := range c.points {
+			if matches(sel.Filter, p.Payload, p.Id) {
+				remove[key] = true
+			}
+		}
+	}
+	order := c.order[:0]
+	for _, key := range c.order {
+		if remove[key] {
+			delete(c.points, key)
+		} else {
+			order = append(order, key)
+		}
+	}
+	c.order = order
+	return completed(), nil
+}
+
+func retrieved(p *pb.RetrievedPoint, payload *pb.WithPayloadSelector, vectors *pb.WithVectorsSelector) *pb.RetrievedPoint {
+	out := &pb.RetrievedPoint{Id: p.Id}
+	if vectors.GetEnable() {
+		out.Vectors = p.Vectors
+	}
+	switch {
+	case payload.GetEnable():
+		out.Payload = p.Payload
+	case payload.GetInclude() != nil:
+		out.Payload = map[string]*pb.Value{}
+		for _, key := range payload.GetInclude().GetFields() {
+			if v, ok := p.Payload[key]; ok {
+				out.Payload[key] = v
+			}
+		}
+	}
+	return out
+}
+
+func idLess(a, b *pb.PointId) bool {
+	au, bu := a.GetUuid(), b.GetUuid()
+	switch {
+	case au == "" && bu == "":
+		return a.GetNum() < b.GetNum()
+	case au == "" || bu == "":
+		return au == ""
+	}
+	return au < bu
+}
+
+func completed() *pb.PointsOperationResponse {
+	return &pb.PointsOperationResponse{Result: &pb.UpdateResult{Status: pb.UpdateStatus_Completed}}
+}
+
+func pointKey(id *pb.PointId) string {
+	if u := id.GetUuid(); u != "" {
+		return u
+	}
+	return fmt.Sprint(id.GetNum())
+}
+
+func cosine(a, b []float32) float32 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(na) * math.Sqrt(nb)))
+}
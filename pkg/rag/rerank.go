@@ -0,0 +1,91 @@
+// pkg/rag/rerank.go
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// RerankService scores passages against a query with a cross-encoder
+// reranker model, such as bge-reranker, served behind a rerank endpoint.
+type RerankService struct {
+	apiURL string
+	model  string
+}
+
+// NewRerankService returns a client for the rerank endpoint at apiURL,
+// the full URL such as "http://localhost:8080/v1/rerank".
+func NewRerankService(apiURL, model string) *RerankService {
+	return &RerankService{
+		apiURL: apiURL,
+		model:  model,
+	}
+}
+
+// RerankRequest is the body of a rerank request, in the shape shared by
+// llama.cpp's server and Jina- and Cohere-style rerank APIs.
+type RerankRequest struct {
+	Model     string   `json:"model"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+}
+
+type RerankResponse struct {
+	Results []RerankResult `json:"results"`
+}
+
+// RerankResult is the relevance of the document at Index in the request.
+type RerankResult struct {
+	Index          int     `json:"index"`
+	RelevanceScore float64 `json:"relevance_score"`
+}
+
+// Rerank returns the relevance of each passage to query, in the order of
+// passages; higher is more relevant.
+func (rs *RerankService) Rerank(ctx context.Context, query string, passages []string) ([]float64, error) {
+	if len(passages) == 0 {
+		return nil, nil
+	}
+	jsonData, err := json.Marshal(RerankRequest{Model: rs.model, Query: query, Documents: passages})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", rs.apiURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rerank API returned status %d", resp.StatusCode)
+	}
+
+	var rerankResp RerankResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rerankResp); err != nil {
+		return nil, err
+	}
+	scores := make([]float64, len(passages))
+	scored := make([]bool, len(passages))
+	for _, r := range rerankResp.Results {
+		if r.Index < 0 || r.Index >= len(passages) {
+			return nil, fmt.Errorf("rerank API returned unknown document index %d", r.Index)
+		}
+		scores[r.Index], scored[r.Index] = r.RelevanceScore, true
+	}
+	for i, ok := range scored {
+		if !ok {
+			return nil, fmt.Errorf("rerank API returned no score for document %d", i)
+		}
+	}
+	return scores, nil
+}
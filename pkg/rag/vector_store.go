@@ -3,14 +3,66 @@ package rag
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 
+	"github.com/google/uuid"
 	pb "github.com/qdrant/go-client/qdrant"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
+// Payload keys written for every document. Metadata supplies the rest.
+const (
+	PayloadContent = "content"
+	PayloadDocID   = "doc_id"
+)
+
+// Payload keys recording what a document's points were built from: a hash
+// of its content, metadata and chunking, and the embedding model. Callers
+// set them through metadata; they tell whether adding a document again
+// would change anything.
+const (
+	PayloadContentHash    = "content_hash"
+	PayloadEmbeddingModel = "embedding_model"
+)
+
+// Payload keys written for documents stored in chunks: the chunk's
+// position among the document's chunks, the byte range of the document it
+// holds, and the Markdown headings it falls under.
+const (
+	PayloadChunkIndex = "chunk_index"
+	PayloadChunkCount = "chunk_count"
+	PayloadChunkStart = "chunk_start"
+	PayloadChunkEnd   = "chunk_end"
+	PayloadHeadings   = "headings"
+)
+
+// scrollPage is the number of points fetched per scroll request when
+// collecting a document's chunks.
+const scrollPage = 256
+
+var (
+	// ErrDocumentNotFound is returned for IDs no document is stored under.
+	ErrDocumentNotFound = errors.New("document not found")
+	// ErrInvalidCursor is returned for list cursors ListDocuments did not
+	// produce.
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// pointNamespace is the UUIDv5 namespace point IDs are derived in.
+var pointNamespace = uuid.MustParse("3c0a8f52-6d1e-5b7a-9f43-2e81c4d6a0b9")
+
+// PointID returns the Qdrant point ID of a document: the UUIDv5 of its ID,
+// so different IDs never share a point and adding an ID again replaces it.
+func PointID(id string) string {
+	return uuid.NewSHA1(pointNamespace, []byte(id)).String()
+}
+
 type VectorStore struct {
+	conn              *grpc.ClientConn
 	pointsClient      pb.PointsClient
 	collectionsClient pb.CollectionsClient
 	collection        string
@@ -23,6 +75,7 @@ func NewVectorStore(url string, collection string) (*VectorStore, error) {
 	}
 
 	vs := &VectorStore{
+		conn:              conn,
 		pointsClient:      pb.NewPointsClient(conn),
 		collectionsClient: pb.NewCollectionsClient(conn),
 		collection:        collection,
@@ -30,6 +83,7 @@ func NewVectorStore(url string, collection string) (*VectorStore, error) {
 
 	// Initialize collection if needed
 	if err := vs.initCollection(context.Background()); err != nil {
+		conn.Close()
 		return nil, err
 	}
 
@@ -73,66 +127,357 @@ func (vs *VectorStore) initCollection(ctx context.Context) error {
 	return nil
 }
 
+// AddDocument stores a document under id, replacing any document already
+// stored under it. Metadata values keep their type (see payloadValue) so
+// searches can filter on them.
 func (vs *VectorStore) AddDocument(ctx context.Context, id string, text string, embedding []float32, metadata map[string]interface{}) error {
+	payload := documentPayload(id, text, metadata)
+	return vs.replaceDocument(ctx, id, []*pb.PointStruct{point(PointID(id), embedding, payload)})
+}
+
+// AddChunks stores a document as its chunks, one point each with the
+// matching embedding, replacing any document already stored under id.
+// Every chunk carries the document's ID and metadata, so filters and
+// deletion apply to the document as a whole, plus its position: see the
+// PayloadChunk keys.
+func (vs *VectorStore) AddChunks(ctx context.Context, id string, chunks []Chunk, embeddings [][]float32, metadata map[string]interface{}) error {
+	if len(chunks) != len(embeddings) {
+		return fmt.Errorf("%d chunks but %d embeddings", len(chunks), len(embeddings))
+	}
+	points := make([]*pb.PointStruct, len(chunks))
+	for i, c := range chunks {
+		payload := documentPayload(id, c.Text, metadata)
+		payload[PayloadChunkIndex] = integerValue(int64(c.Index))
+		payload[PayloadChunkCount] = integerValue(int64(len(chunks)))
+		payload[PayloadChunkStart] = integerValue(int64(c.Start))
+		payload[PayloadChunkEnd] = integerValue(int64(c.End))
+		if len(c.Headings) > 0 {
+			payload[PayloadHeadings] = payloadValue(c.Headings)
+		}
+		points[i] = point(ChunkPointID(id, c.Index), embeddings[i], payload)
+	}
+	return vs.replaceDocument(ctx, id, points)
+}
+
+// ChunkPointID returns the point ID of a document's chunk. The first chunk
+// shares the document's PointID; the others are UUIDv5s within it.
+func ChunkPointID(id string, index int) string {
+	if index == 0 {
+		return PointID(id)
+	}
+	return uuid.NewSHA1(uuid.MustParse(PointID(id)), []byte(strconv.Itoa(index))).String()
+}
+
+func documentPayload(id, text string, metadata map[string]interface{}) map[string]*pb.Value {
 	// Convert metadata to Qdrant payload format
 	payload := make(map[string]*pb.Value)
 	for key, val := range metadata {
-		payload[key] = &pb.Value{
-			Kind: &pb.Value_StringValue{
-				StringValue: fmt.Sprintf("%v", val),
-			},
-		}
+		payload[key] = payloadValue(val)
 	}
-	// Add the text content
-	payload["content"] = &pb.Value{
+	// Add the text content and the caller's ID, which the point ID cannot
+	// be turned back into
+	payload[PayloadContent] = &pb.Value{
 		Kind: &pb.Value_StringValue{
 			StringValue: text,
 		},
 	}
-
-	// Use numeric ID instead of UUID to avoid parsing issues
-	// Hash the string ID to get a numeric value
-	var numericId uint64
-	for i, c := range id {
-		numericId = numericId*31 + uint64(c) + uint64(i)
+	payload[PayloadDocID] = &pb.Value{
+		Kind: &pb.Value_StringValue{
+			StringValue: id,
+		},
 	}
+	return payload
+}
 
-	points := []*pb.PointStruct{
-		{
-			Id: &pb.PointId{
-				PointIdOptions: &pb.PointId_Num{
-					Num: numericId,
-				},
-			},
-			Vectors: &pb.Vectors{
-				VectorsOptions: &pb.Vectors_Vector{
-					Vector: &pb.Vector{
-						Data: embedding,
-					},
+func point(id string, embedding []float32, payload map[string]*pb.Value) *pb.PointStruct {
+	return &pb.PointStruct{
+		Id: &pb.PointId{PointIdOptions: &pb.PointId_Uuid{Uuid: id}},
+		Vectors: &pb.Vectors{
+			VectorsOptions: &pb.Vectors_Vector{
+				Vector: &pb.Vector{
+					Data: embedding,
 				},
 			},
-			Payload: payload,
 		},
+		Payload: payload,
 	}
+}
 
-	_, err := vs.pointsClient.Upsert(ctx, &pb.UpsertPoints{
+// replaceDocument upserts a document's points and then removes any other
+// points stored under its ID, such as chunks the new version no longer
+// has. Points added before point IDs were UUIDs carry no doc_id, so they
+// are not matched and have to be deleted by hand; see docs/API.md.
+func (vs *VectorStore) replaceDocument(ctx context.Context, id string, points []*pb.PointStruct) error {
+	wait := true
+	if _, err := vs.pointsClient.Upsert(ctx, &pb.UpsertPoints{
 		CollectionName: vs.collection,
+		Wait:           &wait,
 		Points:         points,
+	}); err != nil {
+		return err
+	}
+
+	ids := make([]*pb.PointId, len(points))
+	for i, p := range points {
+		ids[i] = p.Id
+	}
+	return vs.deletePoints(ctx, &pb.Filter{
+		Must:    []*pb.Condition{docIDCondition(id)},
+		MustNot: []*pb.Condition{{ConditionOneOf: &pb.Condition_HasId{HasId: &pb.HasIdCondition{HasId: ids}}}},
+	})
+}
+
+// GetDocument returns the points stored under id, in chunk order, or
+// ErrDocumentNotFound. Documents stored whole have a single point.
+func (vs *VectorStore) GetDocument(ctx context.Context, id string) ([]*pb.RetrievedPoint, error) {
+	response, err := vs.pointsClient.Get(ctx, &pb.GetPoints{
+		CollectionName: vs.collection,
+		Ids:            []*pb.PointId{{PointIdOptions: &pb.PointId_Uuid{Uuid: PointID(id)}}},
+		WithPayload:    withPayload(),
 	})
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Result) > 0 && payloadNumber(response.Result[0].Payload, PayloadChunkCount) <= 1 {
+		return response.Result, nil
+	}
 
+	// Collect the chunks by their doc_id.
+	var points []*pb.RetrievedPoint
+	filter := &pb.Filter{Must: []*pb.Condition{docIDCondition(id)}}
+	var offset *pb.PointId
+	for {
+		page, next, err := vs.scroll(ctx, filter, scrollPage, offset, withPayload())
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, page...)
+		if next == nil {
+			break
+		}
+		offset = next
+	}
+	if len(points) == 0 {
+		return nil, ErrDocumentNotFound
+	}
+	sort.SliceStable(points, func(i, j int) bool {
+		return payloadNumber(points[i].Payload, PayloadChunkIndex) < payloadNumber(points[j].Payload, PayloadChunkIndex)
+	})
+	return points, nil
+}
+
+// DeleteDocument removes the document stored under id, or returns
+// ErrDocumentNotFound.
+func (vs *VectorStore) DeleteDocument(ctx context.Context, id string) error {
+	filter := &pb.Filter{Must: []*pb.Condition{docIDCondition(id)}}
+	points, _, err := vs.scroll(ctx, filter, 1, nil, withPayload())
+	if err != nil {
+		return err
+	}
+	if len(points) == 0 {
+		return ErrDocumentNotFound
+	}
+	return vs.deletePoints(ctx, filter)
+}
+
+// ListDocuments returns up to limit documents matching filter, which may be
+// nil, in point ID order starting at cursor ("" for the first page). The
+// returned cursor continues the listing and is "" after the last page.
+// Chunked documents are represented by their first chunk.
+func (vs *VectorStore) ListDocuments(ctx context.Context, filter *Filter, limit uint32, cursor string) ([]*pb.RetrievedPoint, string, error) {
+	var offset *pb.PointId
+	if cursor != "" {
+		var err error
+		if offset, err = parseCursor(cursor); err != nil {
+			return nil, "", err
+		}
+	}
+	points, next, err := vs.scroll(ctx, documentsFilter(filter), limit, offset, withPayload())
+	if err != nil {
+		return nil, "", err
+	}
+	return points, formatCursor(next), nil
+}
+
+// ScanDocuments returns every document matching filter, which may be nil,
+// with only the payload keys given. Like ListDocuments it returns chunked
+// documents' first chunks.
+func (vs *VectorStore) ScanDocuments(ctx context.Context, filter *Filter, keys ...string) ([]*pb.RetrievedPoint, error) {
+	return vs.scan(ctx, documentsFilter(filter), keys)
+}
+
+// ScanPoints returns every point matching filter, which may be nil, every
+// chunk included, with only the payload keys given.
+func (vs *VectorStore) ScanPoints(ctx context.Context, filter *Filter, keys ...string) ([]*pb.RetrievedPoint, error) {
+	return vs.scan(ctx, filter.qdrant(), keys)
+}
+
+func (vs *VectorStore) scan(ctx context.Context, filter *pb.Filter, keys []string) ([]*pb.RetrievedPoint, error) {
+	selector := &pb.WithPayloadSelector{SelectorOptions: &pb.WithPayloadSelector_Include{
+		Include: &pb.PayloadIncludeSelector{Fields: keys},
+	}}
+	var points []*pb.RetrievedPoint
+	var offset *pb.PointId
+	for {
+		page, next, err := vs.scroll(ctx, filter, scrollPage, offset, selector)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, page...)
+		if next == nil {
+			return points, nil
+		}
+		offset = next
+	}
+}
+
+// LookupPoints returns those of the points with the given IDs (see
+// PointIDString) that match filter, which may be nil, with their payloads
+// and vectors, in no particular order. IDs of missing points are ignored.
+func (vs *VectorStore) LookupPoints(ctx context.Context, ids []string, filter *Filter) ([]*pb.RetrievedPoint, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	hasID := &pb.HasIdCondition{}
+	for _, id := range ids {
+		pid, err := parseCursor(id)
+		if err != nil {
+			return nil, err
+		}
+		hasID.HasId = append(hasID.HasId, pid)
+	}
+	lookup := filter.qdrant()
+	if lookup == nil {
+		lookup = &pb.Filter{}
+	}
+	lookup.Must = append(lookup.Must, &pb.Condition{ConditionOneOf: &pb.Condition_HasId{HasId: hasID}})
+	limit := uint32(len(ids))
+	response, err := vs.pointsClient.Scroll(ctx, &pb.ScrollPoints{
+		CollectionName: vs.collection,
+		Filter:         lookup,
+		Limit:          &limit,
+		WithPayload:    withPayload(),
+		WithVectors:    withVectors(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response.Result, nil
+}
+
+// PointIDString formats a point ID as the string LookupPoints and list
+// cursors take.
+func PointIDString(id *pb.PointId) string {
+	return formatCursor(id)
+}
+
+// documentsFilter narrows filter to one point per document: documents
+// stored whole and the first chunks of the others.
+func documentsFilter(filter *Filter) *pb.Filter {
+	documents := filter.qdrant()
+	if documents == nil {
+		documents = &pb.Filter{}
+	}
+	documents.Must = append(documents.Must, &pb.Condition{ConditionOneOf: &pb.Condition_Filter{Filter: &pb.Filter{Should: []*pb.Condition{
+		{ConditionOneOf: &pb.Condition_IsEmpty{IsEmpty: &pb.IsEmptyCondition{Key: PayloadChunkIndex}}},
+		{ConditionOneOf: &pb.Condition_Field{Field: &pb.FieldCondition{
+			Key:   PayloadChunkIndex,
+			Match: &pb.Match{MatchValue: &pb.Match_Integer{Integer: 0}},
+		}}},
+	}}}})
+	return documents
+}
+
+func (vs *VectorStore) scroll(ctx context.Context, filter *pb.Filter, limit uint32, offset *pb.PointId, payload *pb.WithPayloadSelector) ([]*pb.RetrievedPoint, *pb.PointId, error) {
+	response, err := vs.pointsClient.Scroll(ctx, &pb.ScrollPoints{
+		CollectionName: vs.collection,
+		Filter:         filter,
+		Offset:         offset,
+		Limit:          &limit,
+		WithPayload:    payload,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return response.Result, response.NextPageOffset, nil
+}
+
+func (vs *VectorStore) deletePoints(ctx context.Context, filter *pb.Filter) error {
+	wait := true
+	_, err := vs.pointsClient.Delete(ctx, &pb.DeletePoints{
+		CollectionName: vs.collection,
+		Wait:           &wait,
+		Points:         &pb.PointsSelector{PointsSelectorOneOf: &pb.PointsSelector_Filter{Filter: filter}},
+	})
 	return err
 }
 
-func (vs *VectorStore) Search(ctx context.Context, queryVector []float32, limit uint64) ([]*pb.ScoredPoint, error) {
+func docIDCondition(id string) *pb.Condition {
+	return &pb.Condition{ConditionOneOf: &pb.Condition_Field{Field: &pb.FieldCondition{
+		Key:   PayloadDocID,
+		Match: &pb.Match{MatchValue: &pb.Match_Keyword{Keyword: id}},
+	}}}
+}
+
+func withPayload() *pb.WithPayloadSelector {
+	return &pb.WithPayloadSelector{SelectorOptions: &pb.WithPayloadSelector_Enable{Enable: true}}
+}
+
+func withVectors() *pb.WithVectorsSelector {
+	return &pb.WithVectorsSelector{SelectorOptions: &pb.WithVectorsSelector_Enable{Enable: true}}
+}
+
+// Cursors are the point ID to continue from: a UUID, or a number for
+// points left over from numeric IDs.
+func parseCursor(cursor string) (*pb.PointId, error) {
+	if u, err := uuid.Parse(cursor); err == nil {
+		return &pb.PointId{PointIdOptions: &pb.PointId_Uuid{Uuid: u.String()}}, nil
+	}
+	if n, err := strconv.ParseUint(cursor, 10, 64); err == nil {
+		return &pb.PointId{PointIdOptions: &pb.PointId_Num{Num: n}}, nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrInvalidCursor, cursor)
+}
+
+func formatCursor(id *pb.PointId) string {
+	switch v := id.GetPointIdOptions().(type) {
+	case *pb.PointId_Uuid:
+		return v.Uuid
+	case *pb.PointId_Num:
+		return strconv.FormatUint(v.Num, 10)
+	}
+	return ""
+}
+
+// SearchOption adjusts a single search.
+type SearchOption func(*pb.SearchPoints)
+
+// WithVectors returns each hit's vector along with its payload.
+func WithVectors() SearchOption {
+	return func(req *pb.SearchPoints) {
+		req.WithVectors = withVectors()
+	}
+}
+
+// WithScoreThreshold leaves out hits less similar to the query than min.
+func WithScoreThreshold(min float32) SearchOption {
+	return func(req *pb.SearchPoints) {
+		req.ScoreThreshold = &min
+	}
+}
+
+// Search returns the limit documents nearest to queryVector among those
+// matching filter, which may be nil.
+func (vs *VectorStore) Search(ctx context.Context, queryVector []float32, limit uint64, filter *Filter, opts ...SearchOption) ([]*pb.ScoredPoint, error) {
 	searchPoints := &pb.SearchPoints{
 		CollectionName: vs.collection,
 		Vector:         queryVector,
+		Filter:         filter.qdrant(),
 		Limit:          limit,
-		WithPayload: &pb.WithPayloadSelector{
-			SelectorOptions: &pb.WithPayloadSelector_Enable{
-				Enable: true,
-			},
-		},
+		WithPayload:    withPayload(),
+	}
+	for _, opt := range opts {
+		opt(searchPoints)
 	}
 
 	response, err := vs.pointsClient.Search(ctx, searchPoints)
@@ -144,6 +489,5 @@ func (vs *VectorStore) Search(ctx context.Context, queryVector []float32, limit
 }
 
 func (vs *VectorStore) Close() error {
-	// Close the gRPC connection if needed
-	return nil
+	return vs.conn.Close()
 }
@@ -0,0 +1,295 @@
+// test/alerting_test.go
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agricultural-iot-rag/internal/alerting"
+	"agricultural-iot-rag/internal/models"
+	"agricultural-iot-rag/internal/services"
+	"agricultural-iot-rag/internal/storage"
+)
+
+func TestParseRule(t *testing.T) {
+	c, err := alerting.Parse("soil_moisture < 30 for 2h on crop=Potato, field=field_001")
+	require.NoError(t, err)
+	assert.Equal(t, "soil_moisture", c.Measurement)
+	assert.Equal(t, alerting.OpLess, c.Op)
+	assert.Equal(t, 30.0, c.Threshold)
+	assert.Equal(t, 2*time.Hour, c.For)
+	assert.Equal(t, "potato", c.Crop)
+	assert.Equal(t, "field_001", c.Field)
+	assert.True(t, c.Matches("field_001", "potato"))
+	assert.False(t, c.Matches("field_002", "potato"))
+
+	c, err = alerting.Parse("air_temperature >= 35.5 for 1d")
+	require.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, c.For)
+	assert.True(t, c.Matches("any", "any"))
+
+	for _, expr := range []string{
+		"",
+		"soil_moisture < thirty",
+		"soil_moisture ~ 30",
+		"soil_moisture < 30 for soon",
+		"soil_moisture < 30 on soil=clay",
+		"soil_moisture < 30 until dawn",
+	} {
+		_, err := alerting.Parse(expr)
+		assert.ErrorIs(t, err, alerting.ErrInvalidRule, expr)
+	}
+}
+
+func TestRuleState(t *testing.T) {
+	c, err := alerting.Parse("soil_moisture < 30 for 1h")
+	require.NoError(t, err)
+	settings := alerting.Settings{Hysteresis: 5, Debounce: 2 * time.Hour}
+	t0 := time.Date(2024, 6, 1, 6, 0, 0, 0, time.UTC)
+
+	var s alerting.State
+	steps := []struct {
+		offset time.Duration
+		value  float64
+		want   alerting.Transition
+	}{
+		{0, 25, alerting.NoChange},                // pending
+		{30 * time.Minute, 25, alerting.NoChange}, // not held for 1h yet
+		{20 * time.Minute, 10, alerting.NoChange}, // late reading, ignored
+		{60 * time.Minute, 28, alerting.Fire},
+		{70 * time.Minute, 20, alerting.NoChange}, // already firing
+		{80 * time.Minute, 32, alerting.NoChange}, // within hysteresis
+		{90 * time.Minute, 35, alerting.Resolve},
+		{100 * time.Minute, 20, alerting.NoChange}, // pending again
+		{170 * time.Minute, 20, alerting.NoChange}, // held 70m but debounced
+		{210 * time.Minute, 20, alerting.Fire},
+	}
+	for i, step := range steps {
+		got := s.Step(c, settings, step.value, t0.Add(step.offset))
+		assert.Equal(t, step.want, got, "step %d", i)
+	}
+}
+
+func TestAlertRulesOnIngest(t *testing.T) {
+	store := openTestStore(t)
+	router := newTestRouter(t, store)
+	ctx := context.Background()
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	fieldID, deviceID := "field_"+suffix, "sensor_"+suffix
+
+	require.NoError(t, store.CreateField(ctx, &models.Field{ID: fieldID, Name: "Rule plot", CropType: "potato"}))
+	require.NoError(t, store.CreateDevice(ctx, &models.Device{ID: deviceID, FieldID: fieldID}))
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/api/v1/alert-rules", map[string]interface{}{
+		"name": "bad", "expression": "soil_moisture <", "severity": "high",
+	}).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/api/v1/alert-rules", map[string]interface{}{
+		"name": "dry\r\nBcc: attacker@evil.test", "expression": "soil_moisture < 30", "severity": "high",
+	}).Code)
+
+	w := doJSON(router, "POST", "/api/v1/alert-rules", map[string]interface{}{
+		"name":       "dry_potatoes",
+		"expression": "soil_moisture < 30 for 1h on crop=potato, field=" + fieldID,
+		"severity":   "high",
+		"hysteresis": 5,
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var rule models.AlertRule
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rule))
+	assert.True(t, rule.Enabled)
+
+	t0 := time.Now().UTC().Add(-3 * time.Hour).Truncate(time.Second)
+	post := func(offset time.Duration, value float64) {
+		w := doJSON(router, "POST", "/api/v1/sensors/data", map[string]interface{}{
+			"device_id": deviceID,
+			"timestamp": t0.Add(offset),
+			"location":  map[string]interface{}{"field_id": fieldID},
+			"measurements": map[string]interface{}{
+				"soil_moisture": map[string]interface{}{"value": value, "unit": "%"},
+			},
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+	fieldAlerts := func() []models.Alert {
+		alerts, err := store.ListAlerts(ctx, storage.AlertFilter{FieldID: fieldID})
+		require.NoError(t, err)
+		return alerts
+	}
+
+	post(0, 25)
+	post(30*time.Minute, 24)
+	assert.Empty(t, fieldAlerts())
+
+	post(61*time.Minute, 22)
+	alerts := fieldAlerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "dry_potatoes", alerts[0].AlertType)
+	assert.Equal(t, models.SeverityHigh, alerts[0].Severity)
+	require.NotNil(t, alerts[0].RuleID)
+	assert.Equal(t, rule.ID, *alerts[0].RuleID)
+	require.NotNil(t, alerts[0].Value)
+	assert.Equal(t, 22.0, *alerts[0].Value)
+
+	post(90*time.Minute, 32)
+	assert.False(t, fieldAlerts()[0].Resolved, "inside the hysteresis band")
+
+	post(120*time.Minute, 36)
+	alerts = fieldAlerts()
+	require.Len(t, alerts, 1)
+	assert.True(t, alerts[0].Resolved)
+	assert.NotNil(t, alerts[0].ResolvedAt)
+
+	id := fmt.Sprint(rule.ID)
+	assert.Equal(t, http.StatusOK, doJSON(router, "GET", "/api/v1/alert-rules/"+id, nil).Code)
+	assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", "/api/v1/alert-rules/"+id, nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", "/api/v1/alert-rules/"+id, nil).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/api/v1/alert-rules/abc", nil).Code)
+}
+
+func TestEvaluateConcurrentReadings(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	fieldID, unregistered := "field_"+suffix, "unregistered_"+suffix
+	require.NoError(t, store.CreateField(ctx, &models.Field{ID: fieldID, Name: "Busy plot"}))
+
+	alerts := services.NewAlertService(store, nil)
+	require.NoError(t, alerts.CreateRule(ctx, &models.AlertRule{
+		Name: "dry_" + suffix, Expression: "soil_moisture < 30", Severity: models.SeverityHigh, Enabled: true,
+	}))
+	fieldAlerts := func(field string) []models.Alert {
+		list, err := store.ListAlerts(ctx, storage.AlertFilter{FieldID: field})
+		require.NoError(t, err)
+		return list
+	}
+
+	// Alerts need a registered field, so other fields are not evaluated.
+	t0 := time.Now().UTC().Add(-time.Hour)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, alerts.Evaluate(ctx, sampleReading("sensor_"+suffix, unregistered, t0.Add(time.Duration(i)*time.Minute), 10)))
+	}
+	assert.Empty(t, fieldAlerts(unregistered))
+
+	// Concurrent breaches of one rule raise a single alert.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, alerts.Evaluate(ctx, sampleReading("sensor_"+suffix, fieldID, t0.Add(time.Duration(i)*time.Second), 10)))
+		}(i)
+	}
+	wg.Wait()
+	require.Len(t, fieldAlerts(fieldID), 1)
+
+	require.NoError(t, alerts.Evaluate(ctx, sampleReading("sensor_"+suffix, fieldID, t0.Add(time.Minute), 40)))
+	list := fieldAlerts(fieldID)
+	require.Len(t, list, 1)
+	assert.True(t, list[0].Resolved)
+}
+
+func TestDisableRuleDuringIngest(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	fieldID := "field_" + suffix
+	require.NoError(t, store.CreateField(ctx, &models.Field{ID: fieldID, Name: "Flapping plot"}))
+
+	alerts := services.NewAlertService(store, nil)
+	rule := &models.AlertRule{Name: "dry_" + suffix, Expression: "soil_moisture < 30 on field=" + fieldID, Severity: models.SeverityHigh, Enabled: true}
+	require.NoError(t, alerts.CreateRule(ctx, rule))
+
+	// Readings flap across the threshold, firing and resolving alerts,
+	// while the rule is disabled.
+	t0 := time.Now().UTC().Add(-time.Hour)
+	started := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			if i == 10 {
+				close(started)
+			}
+			value := 10.0
+			if i%2 == 1 {
+				value = 40
+			}
+			assert.NoError(t, alerts.Evaluate(ctx, sampleReading("sensor_"+suffix, fieldID, t0.Add(time.Duration(i)*time.Second), value)))
+		}
+	}()
+	<-started
+	rule.Enabled = false
+	require.NoError(t, alerts.UpdateRule(ctx, rule))
+	wg.Wait()
+
+	list, err := store.ListAlerts(ctx, storage.AlertFilter{FieldID: fieldID})
+	require.NoError(t, err)
+	require.NotEmpty(t, list)
+	for _, a := range list {
+		assert.True(t, a.Resolved, "alert %d left open", a.ID)
+	}
+}
+
+func TestAlertLifecycle(t *testing.T) {
+	store := openTestStore(t)
+	router := newTestRouter(t, store)
+	ctx := context.Background()
+	fieldID := fmt.Sprint("field_", time.Now().UnixNano())
+	require.NoError(t, store.CreateField(ctx, &models.Field{ID: fieldID, Name: "Lifecycle plot", CropType: "barley"}))
+
+	alert := &models.Alert{FieldID: fieldID, AlertType: "frost", Severity: models.SeverityCritical, Message: "-2°C"}
+	require.NoError(t, store.CreateAlert(ctx, alert))
+	path := fmt.Sprintf("/api/v1/alerts/%d", alert.ID)
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", path+"/acknowledge", map[string]string{}).Code, "actor is required")
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "POST", "/api/v1/alerts/999999/acknowledge", map[string]string{"actor": "ana"}).Code)
+
+	w := doJSON(router, "POST", path+"/acknowledge", map[string]string{"actor": "ana"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"state":"acknowledged"`)
+	assert.Equal(t, http.StatusConflict, doJSON(router, "POST", path+"/acknowledge", map[string]string{"actor": "ben"}).Code)
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", path+"/snooze", map[string]string{"actor": "ana", "duration": "forever"}).Code)
+	w = doJSON(router, "POST", path+"/snooze", map[string]string{"actor": "ana", "duration": "4h", "note": "covers on"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"state":"snoozed"`)
+
+	w = doJSON(router, "GET", "/api/v1/fields/stats?crop_type=barley", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var stats struct {
+		OpenAlerts       map[string]int `json:"open_alerts"`
+		UnresolvedAlerts map[string]int `json:"unresolved_alerts"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, 1, stats.OpenAlerts[models.SeverityCritical])
+	assert.Equal(t, map[string]int{"open": 0, "acknowledged": 0, "snoozed": 1}, stats.UnresolvedAlerts)
+
+	w = doJSON(router, "GET", "/api/v1/alerts?field_id="+fieldID+"&severity=critical&resolved=false", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"count":1`)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/api/v1/alerts?from=yesterday", nil).Code)
+
+	w = doJSON(router, "POST", path+"/resolve", map[string]string{"actor": "ben", "note": "frost passed"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusConflict, doJSON(router, "POST", path+"/snooze", map[string]string{"actor": "ben", "duration": "1h"}).Code)
+
+	w = doJSON(router, "GET", path, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var got models.Alert
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, models.AlertStateResolved, got.State)
+	require.Len(t, got.Events, 3)
+	assert.Equal(t, []string{"acknowledge", "snooze", "resolve"}, []string{got.Events[0].Action, got.Events[1].Action, got.Events[2].Action})
+	assert.Equal(t, "ben", got.Events[2].Actor)
+	assert.Equal(t, "frost passed", got.Events[2].Note)
+	assert.NotNil(t, got.Events[1].SnoozedUntil)
+}
@@ -0,0 +1,150 @@
+// test/chunker_test.go
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agricultural-iot-rag/internal/services"
+	"agricultural-iot-rag/pkg/rag"
+)
+
+const potatoGuide = `# Potato Guide
+
+Intro to growing potatoes.
+
+## Irrigation
+
+Potatoes need steady moisture. Irrigate when soil moisture drops below 60%. Avoid waterlogging.
+
+### Drip
+
+- Drip lines save water.
+- Check emitters weekly.
+
+## Harvest
+
+Harvest when the vines die back.
+`
+
+func chunkTexts(chunks []rag.Chunk) []string {
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		texts[i] = strings.TrimSpace(c.Text)
+	}
+	return texts
+}
+
+// assertCovers checks that chunks rebuild text exactly.
+func assertCovers(t *testing.T, text string, chunks []rag.Chunk) {
+	t.Helper()
+	for i, c := range chunks {
+		assert.Equal(t, i, c.Index)
+		assert.Equal(t, text[c.Start:c.End], c.Text)
+	}
+	assert.Equal(t, text, rag.JoinChunks(chunks))
+}
+
+func TestChunkText(t *testing.T) {
+	text := "one two three four five six seven eight nine ten"
+	chunks, err := rag.ChunkText(text, rag.ChunkOptions{Strategy: rag.ChunkFixed, Size: 4, Overlap: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one two three four", "four five six seven", "seven eight nine ten"}, chunkTexts(chunks))
+	assertCovers(t, text, chunks)
+
+	text = "Potatoes need water. Corn needs more water than potatoes do! Is rain enough? Check the soil."
+	chunks, err = rag.ChunkText(text, rag.ChunkOptions{Strategy: rag.ChunkSentence, Size: 8, Overlap: 4})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"Potatoes need water.",
+		"Corn needs more water than potatoes do!",
+		"Is rain enough? Check the soil.",
+	}, chunkTexts(chunks))
+	assertCovers(t, text, chunks)
+
+	// A sentence longer than a chunk is cut by words.
+	chunks, err = rag.ChunkText(text, rag.ChunkOptions{Strategy: rag.ChunkSentence, Size: 3})
+	require.NoError(t, err)
+	assert.Equal(t, "Potatoes need water.", strings.TrimSpace(chunks[0].Text))
+	assert.Equal(t, "Corn needs more", strings.TrimSpace(chunks[1].Text))
+	assertCovers(t, text, chunks)
+
+	chunks, err = rag.ChunkText(potatoGuide, rag.ChunkOptions{Strategy: rag.ChunkMarkdown, Size: 12})
+	require.NoError(t, err)
+	assertCovers(t, potatoGuide, chunks)
+	var headings [][]string
+	for _, c := range chunks {
+		headings = append(headings, c.Headings)
+	}
+	assert.Equal(t, [][]string{
+		{"Potato Guide"},
+		{"Potato Guide", "Irrigation"},
+		{"Potato Guide", "Irrigation"},
+		{"Potato Guide", "Irrigation", "Drip"},
+		{"Potato Guide", "Harvest"},
+	}, headings)
+	assert.Equal(t, "# Potato Guide\n\nIntro to growing potatoes.", strings.TrimSpace(chunks[0].Text))
+	assert.Equal(t, "Irrigate when soil moisture drops below 60%. Avoid waterlogging.", strings.TrimSpace(chunks[2].Text))
+
+	chunks, err = rag.ChunkText(" \n ", rag.ChunkOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, chunks)
+
+	for _, opts := range []rag.ChunkOptions{
+		{Strategy: "paragraph"},
+		{Size: 10, Overlap: 10},
+		{Size: -1},
+	} {
+		assert.ErrorIs(t, opts.Validate(), rag.ErrInvalidChunkOptions)
+	}
+}
+
+func TestChunkedKnowledge(t *testing.T) {
+	env := newDecisionEnv(t, services.DecisionOptions{})
+	vectorStore, err := rag.NewVectorStore(env.qdrant.Addr, "knowledge_test")
+	require.NoError(t, err)
+	t.Cleanup(func() { vectorStore.Close() })
+	ks := services.NewKnowledgeService(vectorStore, rag.NewEmbeddingService(env.ollama.URL, "test-embed"), services.KnowledgeOptions{
+		Chunking: rag.ChunkOptions{Strategy: rag.ChunkMarkdown, Size: 12},
+	})
+	ctx := context.Background()
+
+	require.NoError(t, ks.AddKnowledge(ctx, "potato_guide", potatoGuide, map[string]interface{}{"crop": "potato"}))
+	assert.Len(t, env.qdrant.Points("knowledge_test"), 5)
+
+	doc, err := ks.GetKnowledge(ctx, "potato_guide")
+	require.NoError(t, err)
+	assert.Equal(t, potatoGuide, doc.Content)
+	assert.Equal(t, 5, doc.Chunks)
+	assert.Equal(t, map[string]interface{}{"crop": "potato"}, doc.Metadata)
+
+	page, err := ks.ListKnowledge(ctx, services.KnowledgeListQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Documents, 1)
+	assert.Equal(t, potatoGuide, page.Documents[0].Content)
+
+	filter, err := rag.ParseFilter("crop = potato")
+	require.NoError(t, err)
+	hits, err := ks.SearchKnowledge(ctx, services.KnowledgeQuery{Query: "Irrigate when soil moisture drops below 60%. Avoid waterlogging.", Filter: filter, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, hits, 2)
+	assert.Equal(t, []string{"Potato Guide", "Irrigation"}, hits[0].Headings)
+
+	// Merged, the two irrigation chunks form one passage.
+	hits, err = ks.SearchKnowledge(ctx, services.KnowledgeQuery{Query: "Irrigate when soil moisture drops below 60%. Avoid waterlogging.", Limit: 2, MergeChunks: true})
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Equal(t, []int{1, 2}, hits[0].Chunks)
+	assert.Equal(t, "## Irrigation\n\nPotatoes need steady moisture. Irrigate when soil moisture drops below 60%. Avoid waterlogging.", strings.TrimSpace(hits[0].Content))
+	assert.Equal(t, potatoGuide[*hits[0].ChunkStart:*hits[0].ChunkEnd], hits[0].Content)
+
+	// Replacing the guide with a short text drops its chunks.
+	require.NoError(t, ks.AddKnowledge(ctx, "potato_guide", "Irrigate potatoes weekly.", nil))
+	assert.Len(t, env.qdrant.Points("knowledge_test"), 1)
+	require.NoError(t, ks.DeleteKnowledge(ctx, "potato_guide"))
+	assert.Empty(t, env.qdrant.Points("knowledge_test"))
+}
@@ -0,0 +1,110 @@
+// test/cli_test.go
+package test
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agricultural-iot-rag/pkg/llm/ollamatest"
+	"agricultural-iot-rag/pkg/rag/qdranttest"
+)
+
+// buildCLI compiles cmd/cli into a temporary directory.
+func buildCLI(t *testing.T) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "cli")
+	out, err := exec.Command("go", "build", "-o", bin, "agricultural-iot-rag/cmd/cli").CombinedOutput()
+	require.NoError(t, err, string(out))
+	return bin
+}
+
+// runCLI runs the CLI with env added to the environment, returning its
+// stdout and exit code.
+func runCLI(t *testing.T, bin string, env []string, args ...string) ([]byte, int) {
+	t.Helper()
+	cmd := exec.Command(bin, args...)
+	cmd.Env = append(os.Environ(), env...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return stdout.Bytes(), exitErr.ExitCode()
+	}
+	require.NoError(t, err)
+	return stdout.Bytes(), 0
+}
+
+// singleDocument decodes stdout, failing unless it is exactly one JSON
+// document.
+func singleDocument(t *testing.T, stdout []byte) map[string]interface{} {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader(stdout))
+	var doc map[string]interface{}
+	require.NoError(t, dec.Decode(&doc), string(stdout))
+	var extra json.RawMessage
+	require.ErrorIs(t, dec.Decode(&extra), io.EOF, "more than one JSON document:\n%s", stdout)
+	return doc
+}
+
+func TestCLIJSONOutput(t *testing.T) {
+	bin := buildCLI(t)
+	ollama := ollamatest.NewServer()
+	t.Cleanup(ollama.Close)
+	qdrant := qdranttest.NewServer()
+	t.Cleanup(qdrant.Close)
+	env := []string{
+		"QDRANT_URL=" + qdrant.Addr,
+		"QDRANT_COLLECTION=knowledge_test",
+		"EMBEDDING_API_URL=" + ollama.URL,
+		"EMBEDDING_MODEL=test-embed",
+		"RERANKER=",
+	}
+
+	// A search without matches prints its result alone and exits with 3.
+	stdout, code := runCLI(t, bin, env, "--json", "search", "potato irrigation")
+	assert.Equal(t, 3, code)
+	doc := singleDocument(t, stdout)
+	assert.Equal(t, "potato irrigation", doc["query"])
+	assert.Empty(t, doc["results"])
+	assert.NotContains(t, doc, "error")
+
+	// A failure before any result is reported as the only document.
+	stdout, code = runCLI(t, bin, env, "search", "--json")
+	assert.Equal(t, 2, code)
+	doc = singleDocument(t, stdout)
+	assert.Contains(t, doc["error"], "search requires a query")
+}
+
+func TestCLIMigrateReportsPartialProgress(t *testing.T) {
+	bin := buildCLI(t)
+	path := filepath.Join(t.TempDir(), "partial.db")
+	// A readings table without the expected columns makes 0003 fail after
+	// the earlier migrations applied.
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE readings (id INTEGER PRIMARY KEY)`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	env := []string{"STORAGE_DRIVER=sqlite", "SQLITE_PATH=" + path}
+	stdout, code := runCLI(t, bin, env, "migrate", "up", "--json")
+	assert.Equal(t, 1, code)
+	doc := singleDocument(t, stdout)
+	assert.Equal(t, "up", doc["action"])
+	assert.NotEmpty(t, doc["error"])
+	migrations, ok := doc["migrations"].([]interface{})
+	require.True(t, ok, string(stdout))
+	require.Len(t, migrations, 2)
+	assert.Equal(t, float64(2), migrations[1].(map[string]interface{})["version"])
+}
@@ -0,0 +1,388 @@
+// test/decision_test.go
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agricultural-iot-rag/internal/decision"
+	"agricultural-iot-rag/internal/handlers"
+	"agricultural-iot-rag/internal/ingest"
+	"agricultural-iot-rag/internal/models"
+	"agricultural-iot-rag/internal/services"
+	"agricultural-iot-rag/internal/storage"
+	"agricultural-iot-rag/internal/storage/influxtest"
+	"agricultural-iot-rag/pkg/llm"
+	"agricultural-iot-rag/pkg/llm/ollamatest"
+	"agricultural-iot-rag/pkg/rag"
+	"agricultural-iot-rag/pkg/rag/qdranttest"
+)
+
+// decisionEnv is the decision and knowledge API wired to fake Ollama,
+// Qdrant and InfluxDB servers.
+type decisionEnv struct {
+	router     *gin.Engine
+	ollama     *ollamatest.Server
+	qdrant     *qdranttest.Server
+	knowledge  *services.KnowledgeService
+	timeseries storage.TimeSeries
+	importDir  string // directory knowledge imports may read from
+}
+
+func newDecisionEnv(t *testing.T, opts services.DecisionOptions) *decisionEnv {
+	return newDecisionEnvWith(t, opts, services.KnowledgeOptions{})
+}
+
+// newDecisionEnvWith is newDecisionEnv with knowledge retrieval tuned by
+// knowledgeOpts.
+func newDecisionEnvWith(t *testing.T, opts services.DecisionOptions, knowledgeOpts services.KnowledgeOptions) *decisionEnv {
+	gin.SetMode(gin.TestMode)
+	env := &decisionEnv{ollama: ollamatest.NewServer(), qdrant: qdranttest.NewServer(), importDir: t.TempDir()}
+	t.Cleanup(env.ollama.Close)
+	t.Cleanup(env.qdrant.Close)
+	influx := influxtest.NewServer()
+	t.Cleanup(influx.Close)
+
+	vectorStore, err := rag.NewVectorStore(env.qdrant.Addr, "knowledge_test")
+	require.NoError(t, err)
+	t.Cleanup(func() { vectorStore.Close() })
+	env.knowledge = services.NewKnowledgeService(vectorStore, rag.NewEmbeddingService(env.ollama.URL, "test-embed"), knowledgeOpts)
+	env.timeseries = storage.NewInfluxDB(influx.URL, "test-token", "agurotech", "sensors")
+
+	sensorService := services.NewSensorService(env.timeseries, nil, nil, services.UnregisteredQuarantine)
+	decisionService := services.NewDecisionService(env.knowledge, sensorService, llm.NewOllamaClient(env.ollama.URL, "test-llm"), opts)
+	decisionHandler := handlers.NewDecisionHandler(decisionService)
+	env.router = gin.New()
+	env.router.POST("/api/v1/decision", decisionHandler.GetDecision)
+	knowledgeHandler := handlers.NewKnowledgeHandler(env.knowledge, ingest.NewIngester(env.knowledge), env.importDir)
+	env.router.GET("/api/v1/knowledge", knowledgeHandler.ListKnowledge)
+	env.router.POST("/api/v1/knowledge/import", knowledgeHandler.ImportKnowledge)
+	env.router.GET("/api/v1/knowledge/:doc_id", knowledgeHandler.GetKnowledge)
+	env.router.PUT("/api/v1/knowledge/:doc_id", knowledgeHandler.PutKnowledge)
+	env.router.DELETE("/api/v1/knowledge/:doc_id", knowledgeHandler.DeleteKnowledge)
+	return env
+}
+
+func (env *decisionEnv) addKnowledge(t *testing.T, id, text string, metadata map[string]interface{}) {
+	require.NoError(t, env.knowledge.AddKnowledge(context.Background(), id, text, metadata))
+}
+
+func TestDecisionCombinesFieldDevices(t *testing.T) {
+	env := newDecisionEnv(t, services.DecisionOptions{})
+	ctx := context.Background()
+	env.ollama.SetReply(func(llm.ChatRequest) string { return `{"recommendation": "Irrigate today.", "actions": []}` })
+
+	// As in the simulator, the weather station reports right after the
+	// soil sensor, with different measurements.
+	now := time.Now().UTC()
+	require.NoError(t, env.timeseries.WriteReading(ctx, sampleReading("soil_sensor_001", "field_001", now.Add(-2*time.Minute), 35)))
+	require.NoError(t, env.timeseries.WriteReading(ctx, models.SensorReading{
+		DeviceID:  "weather_sensor_001",
+		Timestamp: now.Add(-time.Minute),
+		Location:  models.Location{FieldID: "field_001", CropType: "potato"},
+		Measurements: map[string]models.Measurement{
+			"air_temperature": {Value: 28.5, Unit: "°C", Quality: "good"},
+			"humidity":        {Value: 41.0, Unit: "%", Quality: "good"},
+		},
+	}))
+
+	w := doJSON(env.router, "POST", "/api/v1/decision", map[string]interface{}{"query": "Should I irrigate?", "field_id": "field_001"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp handlers.DecisionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	devices := map[string]string{}
+	for _, r := range resp.ReadingsUsed {
+		assert.Equal(t, services.ReadingSourceLatest, r.Source)
+		require.NotNil(t, r.Timestamp, r.Measurement)
+		devices[r.Measurement] = r.DeviceID
+	}
+	assert.Equal(t, map[string]string{
+		"air_temperature":  "weather_sensor_001",
+		"humidity":         "weather_sensor_001",
+		"soil_moisture":    "soil_sensor_001",
+		"soil_temperature": "soil_sensor_001",
+	}, devices)
+	prompt := env.ollama.Chats()[0].Messages[1].Content
+	assert.Contains(t, prompt, "- soil_moisture: 35 % (device soil_sensor_001, ")
+	assert.Contains(t, prompt, "- air_temperature: 28.5 °C (device weather_sensor_001, ")
+}
+
+func TestDecisionUsesSensorData(t *testing.T) {
+	env := newDecisionEnv(t, services.DecisionOptions{})
+	ctx := context.Background()
+	env.addKnowledge(t, "potato_irrigation", "Irrigate potato fields when soil moisture drops below 60 percent.", map[string]interface{}{"category": "irrigation"})
+	env.ollama.SetReply(func(llm.ChatRequest) string {
+		return `{"recommendation": "Irrigate today [1].", "actions": [{"type": "irrigate", "target_field": "field_001",
+			"quantity": 20, "unit": "mm", "timing": "today", "rationale": "soil_moisture is 35% and falling"}]}`
+	})
+
+	// Moisture falls over the last three hours.
+	now := time.Now().UTC()
+	for i, moisture := range []float64{48, 41, 35} {
+		ts := now.Add(time.Duration(i-2) * time.Hour)
+		require.NoError(t, env.timeseries.WriteReading(ctx, sampleReading("soil_sensor_001", "field_001", ts, moisture)))
+	}
+
+	w := doJSON(env.router, "POST", "/api/v1/decision", map[string]interface{}{
+		"query":       "Should I irrigate?",
+		"field_id":    "field_001",
+		"sensor_data": map[string]interface{}{"air_temperature": map[string]interface{}{"value": 31.5, "unit": "°C"}},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp handlers.DecisionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Actions, 1)
+	assert.Equal(t, decision.ActionIrrigate, resp.Actions[0].Type)
+	require.Len(t, resp.Sources, 1)
+	source := resp.Sources[0]
+	assert.Equal(t, 1, source.Number)
+	assert.Equal(t, "potato_irrigation", source.ID)
+	assert.Equal(t, "Irrigate potato fields when soil moisture drops below 60 percent", source.Title)
+	assert.Equal(t, "irrigation", source.Category)
+	assert.Greater(t, source.Score, float32(0))
+	assert.True(t, source.Cited)
+	require.Len(t, resp.ReadingsUsed, 3)
+
+	air, moisture := resp.ReadingsUsed[0], resp.ReadingsUsed[1]
+	assert.Equal(t, "air_temperature", air.Measurement)
+	assert.Equal(t, services.ReadingSourceRequest, air.Source)
+	assert.Equal(t, "soil_moisture", moisture.Measurement)
+	assert.Equal(t, services.ReadingSourceLatest, moisture.Source)
+	assert.Equal(t, 35.0, moisture.Value)
+	assert.Equal(t, "soil_sensor_001", moisture.DeviceID)
+	require.NotNil(t, moisture.Trend)
+	assert.Equal(t, "falling", moisture.Trend.Direction)
+	assert.Equal(t, -13.0, moisture.Trend.Change)
+
+	chats := env.ollama.Chats()
+	require.Len(t, chats, 1)
+	prompt := chats[0].Messages[1].Content
+	assert.Contains(t, prompt, "=== SENSOR DATA ===\nField: field_001\nCrop: potato\n")
+	assert.Contains(t, prompt, "- soil_moisture: 35 % (device soil_sensor_001, ")
+	assert.Contains(t, prompt, "24h trend: falling from 48 to 35)")
+	assert.Contains(t, prompt, "- air_temperature: 31.5 °C (reported with the question)")
+	assert.Contains(t, prompt, "[1] Irrigate potato fields when soil moisture drops below 60 percent (category: irrigation)\nIrrigate potato fields")
+
+	// Without a field or supplied data the prompt says so explicitly.
+	w = doJSON(env.router, "POST", "/api/v1/decision", map[string]interface{}{"query": "When should potatoes be harvested?"})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"readings_used":[]`)
+	assert.Contains(t, env.ollama.Chats()[1].Messages[1].Content, "No sensor readings are available")
+
+	w = doJSON(env.router, "POST", "/api/v1/decision", map[string]interface{}{
+		"query":       "Should I irrigate?",
+		"sensor_data": map[string]interface{}{"soil_moisture": "dry"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestParseDecisionOutput(t *testing.T) {
+	// Fences, trailing commas, a bare action object, a type synonym and a
+	// quantity with its unit folded in are all repaired.
+	out, err := decision.Parse("Here you go:\n```json\n"+`{"recommendation": "Water lightly.",
+		"actions": {"type": "Irrigation", "quantity": "12.5 mm", "timing": "tonight", "rationale": "dry topsoil",},}`+"\n```", decision.Expect{FieldID: "field_007"})
+	require.NoError(t, err)
+	require.Len(t, out.Actions, 1)
+	a := out.Actions[0]
+	assert.Equal(t, decision.ActionIrrigate, a.Type)
+	assert.Equal(t, "field_007", a.TargetField)
+	require.NotNil(t, a.Quantity)
+	assert.Equal(t, 12.5, *a.Quantity)
+	assert.Equal(t, "mm", a.Unit)
+
+	// Advice against acting carries no actions, unlike keyword matching.
+	out, err = decision.Parse(`{"recommendation": "Do not water today; rain is due.", "actions": []}`, decision.Expect{FieldID: "field_007"})
+	require.NoError(t, err)
+	assert.Empty(t, out.Actions)
+
+	_, err = decision.Parse(`{"actions": [{"type": "dance", "quantity": -3}]}`, decision.Expect{})
+	var invalid *decision.ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.ElementsMatch(t, []string{
+		"recommendation is required",
+		`actions[0].type "dance" is not one of irrigate, fertilize, pest_control, harvest, monitor, other`,
+		"actions[0].target_field is required",
+		"actions[0].quantity must not be negative",
+		"actions[0].unit is required with a quantity",
+		"actions[0].timing is required",
+		"actions[0].rationale is required",
+	}, invalid.Problems)
+
+	_, err = decision.Parse("I think you should irrigate.", decision.Expect{FieldID: "field_007"})
+	assert.ErrorAs(t, err, &invalid)
+
+	// Citations must point at listed documents.
+	cited := `{"recommendation": "Irrigate [1].", "actions": [{"type": "irrigate", "timing": "today", "rationale": "dry soil [1, 3]"}]}`
+	out, err = decision.Parse(cited, decision.Expect{FieldID: "field_007", Sources: 3})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 3}, out.References())
+	_, err = decision.Parse(cited, decision.Expect{FieldID: "field_007", Sources: 2})
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []string{"citation [3] does not match a listed document (1-2)"}, invalid.Problems)
+}
+
+func TestDecisionRetriesInvalidOutput(t *testing.T) {
+	env := newDecisionEnv(t, services.DecisionOptions{})
+	env.ollama.SetReply(func(req llm.ChatRequest) string {
+		// The first reply misses its timing; the correction request that
+		// follows it gets a valid answer.
+		if len(req.Messages) == 2 {
+			return `{"recommendation": "Scout for aphids.", "actions": [{"type": "monitor", "rationale": "warm weather"}]}`
+		}
+		return `{"recommendation": "Scout for aphids.", "actions": [{"type": "monitor", "timing": "this week", "rationale": "warm weather"}]}`
+	})
+
+	w := doJSON(env.router, "POST", "/api/v1/decision", map[string]interface{}{"query": "Any pest risk?", "field_id": "field_009"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp handlers.DecisionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Actions, 1)
+	assert.Equal(t, "field_009", resp.Actions[0].TargetField)
+	assert.Empty(t, resp.ValidationErrors)
+
+	chats := env.ollama.Chats()
+	require.Len(t, chats, 2)
+	assert.JSONEq(t, string(decision.Schema), string(chats[0].Format))
+	assert.Contains(t, chats[1].Messages[3].Content, "actions[0].timing is required")
+
+	// A model that never complies falls back to its raw text.
+	env.ollama.SetReply(func(llm.ChatRequest) string { return "Keep an eye on the leaves." })
+	w = doJSON(env.router, "POST", "/api/v1/decision", map[string]interface{}{"query": "Any pest risk?"})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "Keep an eye on the leaves.", resp.Recommendation)
+	assert.Empty(t, resp.Actions)
+	assert.Equal(t, []string{"reply does not contain a JSON object"}, resp.ValidationErrors)
+	assert.Len(t, env.ollama.Chats(), 5)
+}
+
+func TestDecisionConfidence(t *testing.T) {
+	env := newDecisionEnv(t, services.DecisionOptions{Samples: 3})
+	env.addKnowledge(t, "potato_irrigation", "Should I irrigate potato fields? Irrigate when soil moisture falls below 60 percent.", nil)
+	require.NoError(t, env.timeseries.WriteReading(context.Background(), sampleReading("soil_sensor_001", "field_001", time.Now().UTC(), 35)))
+
+	irrigate := `{"type": "irrigate", "timing": "today", "rationale": "dry"}`
+	monitor := `{"type": "monitor", "timing": "tomorrow", "rationale": "check again"}`
+	env.ollama.SetReply(func(req llm.ChatRequest) string {
+		// The second extra sample also wants monitoring.
+		if seed, _ := req.Options["seed"].(float64); seed == 2 {
+			return `{"recommendation": "Irrigate and recheck.", "actions": [` + irrigate + `, ` + monitor + `]}`
+		}
+		return `{"recommendation": "Irrigate.", "actions": [` + irrigate + `]}`
+	})
+
+	w := doJSON(env.router, "POST", "/api/v1/decision", map[string]interface{}{"query": "Should I irrigate?", "field_id": "field_001"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp handlers.DecisionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, env.ollama.Chats(), 3)
+
+	b := resp.ConfidenceBreakdown
+	assert.Greater(t, b.Retrieval, 0.0)
+	assert.Equal(t, 1.0, b.SensorData, "a fresh reading of good quality")
+	assert.Equal(t, 1.0, b.Validation)
+	require.NotNil(t, b.Agreement)
+	assert.Equal(t, 0.75, *b.Agreement, "one sample agrees fully, one half")
+	assert.InDelta(t, 0.35*b.Retrieval+0.25*b.SensorData+0.2*(*b.Agreement)+0.2*b.Validation, resp.Confidence, 0.01)
+	assert.Equal(t, "Irrigate.", resp.Recommendation, "the first sample is the answer")
+
+	// Nothing to go on: no documents match and no readings are known.
+	env = newDecisionEnv(t, services.DecisionOptions{Samples: 1})
+	env.ollama.SetReply(func(llm.ChatRequest) string { return `{"recommendation": "Unclear.", "actions": []}` })
+	w = doJSON(env.router, "POST", "/api/v1/decision", map[string]interface{}{"query": "Should I irrigate?"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	resp = handlers.DecisionResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Nil(t, resp.ConfidenceBreakdown.Agreement)
+	assert.True(t, resp.InsufficientEvidence)
+	assert.Equal(t, []string{"no relevant documents were found", "no sensor readings were available"}, resp.EvidenceGaps)
+	assert.Less(t, resp.Confidence, 0.5)
+}
+
+func TestDecisionWithoutRelevantKnowledge(t *testing.T) {
+	env := newDecisionEnvWith(t, services.DecisionOptions{Samples: 1}, services.KnowledgeOptions{MinScore: 0.3})
+	env.addKnowledge(t, "tractor_storage", "Drain the tractor's fuel system before winter storage.", nil)
+	require.NoError(t, env.timeseries.WriteReading(context.Background(), sampleReading("soil_sensor_001", "field_001", time.Now().UTC(), 35)))
+	env.ollama.SetReply(func(llm.ChatRequest) string {
+		return `{"recommendation": "No reference material covers this; soil_moisture is 35%, so irrigate.", "actions": []}`
+	})
+	decide := func() handlers.DecisionResponse {
+		t.Helper()
+		w := doJSON(env.router, "POST", "/api/v1/decision", map[string]interface{}{"query": "Should I irrigate?", "field_id": "field_001"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp handlers.DecisionResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	// The only document is unrelated, so the answer rests on sensor data.
+	resp := decide()
+	assert.Empty(t, resp.Sources)
+	assert.NotEmpty(t, resp.Disclaimer)
+	assert.True(t, resp.InsufficientEvidence)
+	assert.Contains(t, resp.EvidenceGaps, "no relevant documents were found")
+	assert.Equal(t, 1.0, resp.ConfidenceBreakdown.SensorData)
+	assert.LessOrEqual(t, resp.Confidence, 0.4)
+	prompt := env.ollama.Chats()[0].Messages[1].Content
+	assert.Contains(t, prompt, "do not cite any sources")
+	assert.NotContains(t, prompt, "tractor")
+
+	env.addKnowledge(t, "irrigation", "Irrigate the potato field when soil moisture drops below 60 percent.", nil)
+	resp = decide()
+	require.Len(t, resp.Sources, 1)
+	assert.Equal(t, "irrigation", resp.Sources[0].ID)
+	assert.Empty(t, resp.Disclaimer)
+}
+
+func TestDecisionCropFilter(t *testing.T) {
+	env := newDecisionEnv(t, services.DecisionOptions{})
+	env.addKnowledge(t, "potato_irrigation", "Irrigate potato fields when soil moisture drops below 60 percent.", map[string]interface{}{"crop": "potato", "season": "summer"})
+	env.addKnowledge(t, "corn_irrigation", "Irrigate corn fields when soil moisture drops below 50 percent.", map[string]interface{}{"crop": "corn", "season": "summer"})
+	env.addKnowledge(t, "morning_irrigation", "Irrigate early in the morning to limit evaporation.", map[string]interface{}{"season": "spring"})
+	env.ollama.SetReply(func(llm.ChatRequest) string { return `{"recommendation": "Irrigate.", "actions": []}` })
+	require.NoError(t, env.timeseries.WriteReading(context.Background(), sampleReading("soil_sensor_001", "field_001", time.Now().UTC(), 35)))
+
+	decide := func(body map[string]interface{}) handlers.DecisionResponse {
+		t.Helper()
+		w := doJSON(env.router, "POST", "/api/v1/decision", body)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp handlers.DecisionResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+	sourceIDs := func(resp handlers.DecisionResponse) []string {
+		var ids []string
+		for _, s := range resp.Sources {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	// The field grows potatoes, so corn guidance is left out.
+	resp := decide(map[string]interface{}{"query": "Should I irrigate?", "field_id": "field_001"})
+	assert.ElementsMatch(t, []string{"potato_irrigation", "morning_irrigation"}, sourceIDs(resp))
+	assert.Equal(t, `crop = "potato" OR crop IS EMPTY`, resp.RetrievalFilter)
+
+	// A request filter narrows that further, leaving too few documents, so
+	// every crop is searched.
+	resp = decide(map[string]interface{}{"query": "Should I irrigate?", "field_id": "field_001", "filter": "season = summer"})
+	assert.ElementsMatch(t, []string{"potato_irrigation", "corn_irrigation"}, sourceIDs(resp))
+	assert.Equal(t, `season = "summer"`, resp.RetrievalFilter)
+
+	// Without a field there is no crop to filter on.
+	resp = decide(map[string]interface{}{"query": "Should I irrigate?"})
+	assert.Len(t, resp.Sources, 3)
+	assert.Empty(t, resp.RetrievalFilter)
+
+	w := doJSON(env.router, "POST", "/api/v1/decision", map[string]interface{}{"query": "Should I irrigate?", "filter": "season ="})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
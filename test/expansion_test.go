@@ -0,0 +1,71 @@
+// test/expansion_test.go
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agricultural-iot-rag/internal/handlers"
+	"agricultural-iot-rag/internal/services"
+	"agricultural-iot-rag/pkg/llm"
+)
+
+func TestDecisionQueryExpansion(t *testing.T) {
+	env := newDecisionEnvWith(t, services.DecisionOptions{
+		Samples:   1,
+		Expansion: services.ExpansionOptions{Queries: 3, HyDE: true},
+	}, services.KnowledgeOptions{MinScore: 0.2})
+	env.addKnowledge(t, "market", "What do you do when going to the market?", nil)
+	env.addKnowledge(t, "late_blight", "Late blight causes necrotic lesions on potato foliage; apply a protectant fungicide.", nil)
+
+	question := "leaves going brown, what do?"
+	var decisionPrompt string
+	env.ollama.SetReply(func(req llm.ChatRequest) string {
+		prompt := req.Messages[len(req.Messages)-1].Content
+		switch {
+		case strings.Contains(prompt, "search queries"):
+			return "1. potato foliage necrotic lesions\n- late blight symptoms\n\n\"" + question + "\"\n"
+		case strings.Contains(prompt, "agronomy guide that answers"):
+			return "Necrotic lesions on potato foliage usually indicate late blight."
+		}
+		decisionPrompt = prompt
+		return `{"recommendation": "Check for late blight [1].", "actions": []}`
+	})
+
+	w := doJSON(env.router, "POST", "/api/v1/decision", map[string]interface{}{"query": question})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp handlers.DecisionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	require.NotNil(t, resp.Debug)
+	assert.Equal(t, []string{"potato foliage necrotic lesions", "late blight symptoms"}, resp.Debug.RewrittenQueries)
+	assert.Equal(t, "Necrotic lesions on potato foliage usually indicate late blight.", resp.Debug.HypotheticalAnswer)
+	assert.Empty(t, resp.Debug.ExpansionError)
+
+	// The question alone only finds the unrelated document; the rewritten
+	// queries find the relevant one, once.
+	hits, err := env.knowledge.SearchKnowledge(context.Background(), services.KnowledgeQuery{Query: question})
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Equal(t, "market", hits[0].ID)
+	var ids []string
+	for _, s := range resp.Sources {
+		ids = append(ids, s.ID)
+	}
+	assert.ElementsMatch(t, []string{"late_blight", "market"}, ids)
+	assert.Equal(t, "late_blight", ids[0])
+	assert.Contains(t, decisionPrompt, "necrotic lesions")
+
+	// Without expansion there is no debug section.
+	env = newDecisionEnv(t, services.DecisionOptions{Samples: 1})
+	env.ollama.SetReply(func(llm.ChatRequest) string { return `{"recommendation": "Unclear.", "actions": []}` })
+	w = doJSON(env.router, "POST", "/api/v1/decision", map[string]interface{}{"query": question})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), `"debug"`)
+}
@@ -0,0 +1,110 @@
+// test/hybrid_test.go
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agricultural-iot-rag/internal/services"
+	"agricultural-iot-rag/pkg/rag"
+)
+
+func TestKeywordIndex(t *testing.T) {
+	assert.Equal(t, []string{"apply", "npk", "15-15-15", "15", "15", "15", "p2o5"}, rag.Tokenize("Apply the NPK 15-15-15, or P2O5."))
+
+	index := rag.NewKeywordIndex()
+	index.Put("blight", []rag.Passage{
+		{ID: "b0", Text: "Late blight is caused by Phytophthora infestans."},
+		{ID: "b1", Text: "Remove infected potato plants."},
+	})
+	index.Put("npk", []rag.Passage{{ID: "n0", Text: "Apply NPK 15-15-15 before planting potato."}})
+	index.Put("water", []rag.Passage{{ID: "w0", Text: "Water potato fields in the morning."}})
+	assert.Equal(t, 4, index.Len())
+
+	hits := index.Search("phytophthora infestans potato", 10)
+	require.Len(t, hits, 4)
+	assert.Equal(t, "b0", hits[0].ID)
+	assert.Equal(t, "blight", hits[0].DocID)
+
+	hits = index.Search("NPK 15-15-15", 10)
+	require.NotEmpty(t, hits)
+	assert.Equal(t, "n0", hits[0].ID)
+	assert.Empty(t, index.Search("how to do it", 10))
+
+	// Replacing and deleting drop the old passages.
+	index.Put("blight", []rag.Passage{{ID: "b0", Text: "Late blight spreads in wet weather."}})
+	assert.Empty(t, index.Search("infestans", 10))
+	index.Delete("npk")
+	assert.Empty(t, index.Search("npk", 10))
+	assert.Equal(t, 2, index.Len())
+}
+
+func TestHybridSearch(t *testing.T) {
+	env := newDecisionEnv(t, services.DecisionOptions{})
+	vectorStore, err := rag.NewVectorStore(env.qdrant.Addr, "knowledge_test")
+	require.NoError(t, err)
+	t.Cleanup(func() { vectorStore.Close() })
+	hybrid := services.NewKnowledgeService(vectorStore, rag.NewEmbeddingService(env.ollama.URL, "test-embed"), services.KnowledgeOptions{
+		Hybrid: services.HybridOptions{LexicalWeight: 1},
+	})
+
+	// The questions share the query's common words, so embeddings rank
+	// them above the one document naming the pathogen.
+	env.addKnowledge(t, "late_blight", "Late blight shows as dark water-soaked lesions on potato leaves that spread quickly "+
+		"in cool wet weather. It is caused by Phytophthora infestans. Remove infected plants, avoid overhead "+
+		"irrigation and rotate crops to keep the disease from coming back next season.", map[string]interface{}{"crop": "potato"})
+	env.addKnowledge(t, "question_1", "How do I know what I should do?", map[string]interface{}{"crop": "corn"})
+	env.addKnowledge(t, "question_2", "What do I do if I do not know how?", map[string]interface{}{"crop": "corn"})
+	env.addKnowledge(t, "question_3", "How can I do what I must do?", map[string]interface{}{"crop": "corn"})
+
+	search := func(ks *services.KnowledgeService, query, filter string) []services.KnowledgeHit {
+		t.Helper()
+		f, err := rag.ParseFilter(filter)
+		require.NoError(t, err)
+		hits, err := ks.SearchKnowledge(context.Background(), services.KnowledgeQuery{Query: query, Filter: f, Limit: 3})
+		require.NoError(t, err)
+		return hits
+	}
+	ids := func(hits []services.KnowledgeHit) []string {
+		var out []string
+		for _, h := range hits {
+			out = append(out, h.ID)
+		}
+		return out
+	}
+
+	query := "How do I treat Phytophthora infestans?"
+	assert.NotContains(t, ids(search(env.knowledge, query, "")), "late_blight")
+
+	hits := search(hybrid, query, "")
+	require.Len(t, hits, 3)
+	top := hits[0]
+	assert.Equal(t, "late_blight", top.ID)
+	require.NotNil(t, top.Lexical)
+	require.NotNil(t, top.Semantic)
+	assert.Equal(t, 1, top.Lexical.Rank)
+	assert.Equal(t, 4, top.Semantic.Rank)
+	assert.InDelta(t, 1.0/61+1.0/64, top.FusedScore, 1e-9)
+	assert.InDelta(t, top.Lexical.Contribution+top.Semantic.Contribution, top.FusedScore, 1e-9)
+	assert.InDelta(t, top.Semantic.Score, float64(top.Score), 1e-6)
+	for _, h := range hits[1:] {
+		assert.Nil(t, h.Lexical, h.ID)
+	}
+
+	// Keyword matches obey the filter.
+	assert.NotContains(t, ids(search(hybrid, query, "crop = corn")), "late_blight")
+
+	// Documents stored after the index was built are matched, deleted
+	// ones are not.
+	require.NoError(t, hybrid.AddKnowledge(context.Background(), "npk", "Apply NPK 15-15-15 before planting, "+
+		"then side-dress with nitrogen once the crop is established and growing well.", nil))
+	hits = search(hybrid, "What do I do with NPK 15-15-15?", "")
+	require.NotEmpty(t, hits)
+	assert.Equal(t, "npk", hits[0].ID)
+	assert.NotNil(t, hits[0].Lexical)
+	require.NoError(t, hybrid.DeleteKnowledge(context.Background(), "late_blight"))
+	assert.NotContains(t, ids(search(hybrid, query, "")), "late_blight")
+}
@@ -0,0 +1,282 @@
+// test/ingest_test.go
+package test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agricultural-iot-rag/internal/ingest"
+	"agricultural-iot-rag/internal/services"
+	"agricultural-iot-rag/pkg/rag"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func fileResults(report *ingest.Report) map[string]ingest.FileResult {
+	results := map[string]ingest.FileResult{}
+	for _, f := range report.Files {
+		results[f.Path] = f
+	}
+	return results
+}
+
+func TestIngestDirectory(t *testing.T) {
+	env := newDecisionEnv(t, services.DecisionOptions{})
+	writeFiles(t, env.importDir, map[string]string{
+		"guides/potato.md": "---\ncrop: potato\nseason: spring\npublished: 2023-04-01\n---\n# Potato irrigation\n\nIrrigate potato fields when soil moisture drops below 60 percent.\n",
+		"guides/tomato.md": "---\nid: tomato_guide\ncrop: tomato\n---\nWater tomatoes consistently to prevent blossom end rot.\n",
+		"notes.txt":        "Irrigate early in the morning to limit evaporation.",
+		"facts.csv":        "id,crop,min_moisture,content\ncorn_silking,corn,55,Corn needs the most water during silking.\n,corn,,\n,corn,40,Corn tolerates dry spells before flowering.\n",
+		"broken.md":        "---\ncrop: potato\nNo closing delimiter.\n",
+		"empty.txt":        "  \n",
+		"photo.jpg":        "not a document",
+		".hidden/skip.md":  "Hidden files are ignored.",
+	})
+
+	w := doJSON(env.router, "POST", "/api/v1/knowledge/import", map[string]string{"directory": "."})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var report ingest.Report
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+
+	files := fileResults(&report)
+	assert.Len(t, files, 7)
+	assert.Equal(t, 4, report.Added)
+	assert.Equal(t, 2, report.Skipped)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, []string{"guides/potato"}, files["guides/potato.md"].Added)
+	assert.Equal(t, []string{"tomato_guide"}, files["guides/tomato.md"].Added)
+	assert.Equal(t, []string{"corn_silking", "facts#3"}, files["facts.csv"].Added)
+	assert.Equal(t, ingest.StatusFailed, files["broken.md"].Status)
+	assert.Equal(t, "no text", files["empty.txt"].Reason)
+	assert.Equal(t, "unsupported file type", files["photo.jpg"].Reason)
+
+	// Every document is embedded once, in shared batches.
+	assert.Equal(t, 5, env.ollama.Embedded())
+	assert.Len(t, env.qdrant.Points("knowledge_test"), 5)
+
+	doc, err := env.knowledge.GetKnowledge(context.Background(), "guides/potato")
+	require.NoError(t, err)
+	assert.Equal(t, "potato", doc.Metadata["crop"])
+	assert.Equal(t, "guides/potato.md", doc.Metadata["source"])
+	assert.Equal(t, "test-embed", doc.EmbeddingModel)
+	assert.NotEmpty(t, doc.ContentHash)
+	assert.NotContains(t, doc.Content, "season:")
+
+	filter, err := rag.ParseFilter("published >= 2023-01-01 OR min_moisture < 50")
+	require.NoError(t, err)
+	hits, err := env.knowledge.SearchKnowledge(context.Background(), services.KnowledgeQuery{Query: "irrigate", Filter: filter})
+	require.NoError(t, err)
+	var ids []string
+	for _, h := range hits {
+		ids = append(ids, h.ID)
+	}
+	assert.ElementsMatch(t, []string{"guides/potato", "facts#3"}, ids)
+
+	w = doJSON(env.router, "POST", "/api/v1/knowledge/import", map[string]string{"directory": "../"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doJSON(env.router, "POST", "/api/v1/knowledge/import", map[string]string{"directory": "missing"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestIngestUpload(t *testing.T) {
+	env := newDecisionEnv(t, services.DecisionOptions{})
+
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	for name, content := range map[string]string{
+		"kb/corn.md":    "# Corn\n\nCorn requires heaviest irrigation during silking.",
+		"kb/dupe.txt":   "---\nid: kb/corn\n---\nA second document with the same ID.",
+		"../escape.txt": "Outside the archive.",
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	upload := func(name string, data []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		part, err := mw.CreateFormFile("file", name)
+		require.NoError(t, err)
+		part.Write(data)
+		require.NoError(t, mw.Close())
+		req := httptest.NewRequest("POST", "/api/v1/knowledge/import", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := upload("kb.tar.gz", archive.Bytes())
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var report ingest.Report
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	files := fileResults(&report)
+	assert.Len(t, files, 2)
+	assert.Equal(t, ingest.StatusAdded, files["kb/corn.md"].Status)
+	assert.Equal(t, ingest.StatusFailed, files["kb/dupe.txt"].Status)
+	assert.Contains(t, files["kb/dupe.txt"].Error, "kb/corn.md")
+
+	w = upload("tomato.md", []byte("Tomatoes need consistent watering."))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	_, err := env.knowledge.GetKnowledge(context.Background(), "tomato")
+	require.NoError(t, err)
+
+	w = upload("photo.jpg", []byte("not a document"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestOpenUploadLimits(t *testing.T) {
+	tarball := func(gzipped bool, entries ...*tar.Header) []byte {
+		var buf bytes.Buffer
+		var w io.Writer = &buf
+		var gz *gzip.Writer
+		if gzipped {
+			gz = gzip.NewWriter(&buf)
+			w = gz
+		}
+		tw := tar.NewWriter(w)
+		for _, hdr := range entries {
+			hdr.Mode, hdr.Typeflag = 0o644, tar.TypeReg
+			require.NoError(t, tw.WriteHeader(hdr))
+			if hdr.Size <= ingest.MaxArchiveSize {
+				_, err := tw.Write(bytes.Repeat([]byte("a"), int(hdr.Size)))
+				require.NoError(t, err)
+			}
+		}
+		// A header claiming more than is written is left truncated.
+		tw.Flush()
+		if gz != nil {
+			require.NoError(t, gz.Close())
+		}
+		return buf.Bytes()
+	}
+	open := func(name string, data []byte) (fs.FS, error) {
+		return ingest.OpenUpload(name, bytes.NewReader(data), int64(len(data)))
+	}
+
+	fsys, err := open("kb.tar", tarball(false,
+		&tar.Header{Name: "a.md", Size: 3},
+		&tar.Header{Name: "docs/b.txt", Size: 5},
+		&tar.Header{Name: "docs/deep/c.csv", Size: 0},
+	))
+	require.NoError(t, err)
+	require.NoError(t, fstest.TestFS(fsys, "a.md", "docs/b.txt", "docs/deep/c.csv"))
+
+	// A gzip bomb is refused before it is decompressed.
+	_, err = open("bomb.tgz", tarball(true, &tar.Header{Name: "big.txt", Size: ingest.MaxArchiveSize + 1}))
+	require.ErrorIs(t, err, ingest.ErrUnsupportedUpload)
+	assert.Contains(t, err.Error(), "decompressed")
+
+	// Zip entries are checked against the sizes they record, which the
+	// zip reader holds them to.
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	for _, name := range []string{"a.md", "b.md"} {
+		_, err := zw.CreateRaw(&zip.FileHeader{Name: name, Method: zip.Deflate, UncompressedSize64: ingest.MaxArchiveSize/2 + 1})
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	_, err = open("bomb.zip", zipped.Bytes())
+	require.ErrorIs(t, err, ingest.ErrUnsupportedUpload)
+
+	// Files too large to ingest are listed without their content.
+	fsys, err = open("kb.tar.gz", tarball(true, &tar.Header{Name: "big.txt", Size: ingest.MaxFileSize + 1}))
+	require.NoError(t, err)
+	info, err := fs.Stat(fsys, "big.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(ingest.MaxFileSize+1), info.Size())
+	_, err = fs.ReadFile(fsys, "big.txt")
+	assert.Error(t, err)
+}
+
+func TestIngestSync(t *testing.T) {
+	env := newDecisionEnv(t, services.DecisionOptions{})
+	writeFiles(t, env.importDir, map[string]string{
+		"potato.md": "---\ncrop: potato\n---\nIrrigate potato fields when soil moisture drops below 60 percent.",
+		"corn.md":   "Corn requires heaviest irrigation during silking.",
+		"facts.csv": "id,content\nfact_1,Drip irrigation is 90% efficient.\nfact_2,Mulch reduces evaporation.\n",
+	})
+	sync := func(dryRun bool) ingest.Report {
+		t.Helper()
+		w := doJSON(env.router, "POST", fmt.Sprintf("/api/v1/knowledge/import?dry_run=%t", dryRun), map[string]string{"directory": "."})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var report ingest.Report
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return report
+	}
+	sync(false)
+	require.Equal(t, 4, env.ollama.Embedded())
+	env.addKnowledge(t, "manual", "Added by hand, not from the directory.", nil)
+
+	// Nothing changed: nothing is embedded again.
+	report := sync(false)
+	assert.Equal(t, 3, report.Unchanged)
+	assert.Empty(t, report.Deleted)
+	assert.Equal(t, 5, env.ollama.Embedded())
+
+	writeFiles(t, env.importDir, map[string]string{
+		"potato.md": "---\ncrop: potato\n---\nIrrigate potato fields when soil moisture drops below 55 percent.",
+		"facts.csv": "id,content\nfact_1,Drip irrigation is 90% efficient.\n",
+		"tomato.md": "Tomatoes need consistent watering.",
+	})
+	require.NoError(t, os.Remove(filepath.Join(env.importDir, "corn.md")))
+
+	// A dry run plans the changes without making them.
+	report = sync(true)
+	assert.True(t, report.DryRun)
+	files := fileResults(&report)
+	assert.Equal(t, []string{"potato"}, files["potato.md"].Updated)
+	assert.Equal(t, []string{"tomato"}, files["tomato.md"].Added)
+	assert.Equal(t, ingest.StatusUnchanged, files["facts.csv"].Status)
+	assert.Equal(t, []string{"corn", "fact_2"}, report.Deleted)
+	assert.Equal(t, 5, env.ollama.Embedded())
+	assert.Len(t, env.qdrant.Points("knowledge_test"), 5)
+
+	report = sync(false)
+	assert.Equal(t, []string{"corn", "fact_2"}, report.Deleted)
+	assert.Equal(t, 7, env.ollama.Embedded())
+	var ids []string
+	for _, p := range env.qdrant.Points("knowledge_test") {
+		ids = append(ids, p[rag.PayloadDocID].GetStringValue())
+	}
+	assert.ElementsMatch(t, []string{"potato", "tomato", "fact_1", "manual"}, ids)
+	doc, err := env.knowledge.GetKnowledge(context.Background(), "potato")
+	require.NoError(t, err)
+	assert.Contains(t, doc.Content, "55 percent")
+
+	// A file that cannot be read keeps its stored documents.
+	writeFiles(t, env.importDir, map[string]string{"potato.md": "---\ncrop: potato\n"})
+	report = sync(false)
+	assert.Equal(t, 1, report.Failed)
+	assert.Empty(t, report.Deleted)
+	_, err = env.knowledge.GetKnowledge(context.Background(), "potato")
+	assert.NoError(t, err)
+}
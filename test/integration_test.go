@@ -3,22 +3,101 @@ package test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 
 	"agricultural-iot-rag/internal/handlers"
+	"agricultural-iot-rag/internal/metrics"
+	"agricultural-iot-rag/internal/models"
+	"agricultural-iot-rag/internal/services"
+	"agricultural-iot-rag/internal/storage"
+	"agricultural-iot-rag/internal/storage/influxtest"
 )
 
-func setupTestRouter() *gin.Engine {
+// openTestStore returns the Postgres database named by TEST_POSTGRES_DSN,
+// or a fresh SQLite database when it is not set. Either is migrated.
+func openTestStore(t *testing.T) storage.Store {
+	if dsn := os.Getenv("TEST_POSTGRES_DSN"); dsn != "" {
+		return migrated(t, storage.DriverPostgres, dsn)
+	}
+	return migrated(t, storage.DriverSQLite, filepath.Join(t.TempDir(), "test.db"))
+}
+
+// forEachStore runs fn against SQLite and, when TEST_POSTGRES_DSN is set,
+// against Postgres.
+func forEachStore(t *testing.T, fn func(t *testing.T, store storage.Store)) {
+	t.Run("sqlite", func(t *testing.T) {
+		fn(t, migrated(t, storage.DriverSQLite, filepath.Join(t.TempDir(), "test.db")))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("TEST_POSTGRES_DSN")
+		if dsn == "" {
+			t.Skip("TEST_POSTGRES_DSN not set")
+		}
+		fn(t, migrated(t, storage.DriverPostgres, dsn))
+	})
+}
+
+func migrated(t *testing.T, driver, dsn string) storage.Store {
+	store, err := storage.Open(driver, dsn)
+	if err != nil {
+		t.Fatalf("failed to open %s store: %v", driver, err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := store.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return store
+}
+
+// seedRegistry registers the field and devices the HTTP tests report from,
+// so their readings are not quarantined.
+func seedRegistry(t *testing.T, db storage.Store) {
+	ctx := context.Background()
+	err := db.CreateField(ctx, &models.Field{ID: "field_001", Name: "Test field", CropType: "potato"})
+	if err != nil && !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("failed to seed field: %v", err)
+	}
+	for _, id := range []string{"device_field_001", "device_test"} {
+		err := db.CreateDevice(ctx, &models.Device{ID: id, FieldID: "field_001"})
+		if err != nil && !errors.Is(err, storage.ErrConflict) {
+			t.Fatalf("failed to seed device: %v", err)
+		}
+	}
+}
+
+func setupTestRouter(t *testing.T) *gin.Engine {
+	return newTestRouter(t, openTestStore(t))
+}
+
+// newTestRouter builds the API against a fake InfluxDB and db, which may be
+// nil to run without the field registry.
+func newTestRouter(t *testing.T, db storage.Store) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
 
-	sensorHandler := handlers.NewSensorHandler()
+	influx := influxtest.NewServer()
+	t.Cleanup(influx.Close)
+
+	if db != nil {
+		seedRegistry(t, db)
+	}
+
+	timeseries := storage.NewInfluxDB(influx.URL, "test-token", "agurotech", "sensors")
+	alertService := services.NewAlertService(db, nil)
+	sensorHandler := handlers.NewSensorHandler(services.NewSensorService(timeseries, db, alertService, services.UnregisteredQuarantine))
+	registryHandler := handlers.NewRegistryHandler(services.NewRegistryService(db))
+	alertHandler := handlers.NewAlertHandler(alertService)
 
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
@@ -27,15 +106,41 @@ func setupTestRouter() *gin.Engine {
 	api := router.Group("/api/v1")
 	{
 		api.GET("/sensors/:field_id", sensorHandler.GetSensorData)
+		api.GET("/sensors/:field_id/history", sensorHandler.GetSensorHistory)
 		api.POST("/sensors/data", sensorHandler.ReceiveSensorData)
 		api.GET("/fields/stats", sensorHandler.GetFieldsStats)
+
+		api.POST("/fields", registryHandler.CreateField)
+		api.GET("/fields", registryHandler.ListFields)
+		api.GET("/fields/:field_id", registryHandler.GetField)
+		api.PATCH("/fields/:field_id", registryHandler.UpdateField)
+		api.DELETE("/fields/:field_id", registryHandler.RetireField)
+
+		api.POST("/devices", registryHandler.CreateDevice)
+		api.GET("/devices", registryHandler.ListDevices)
+		api.GET("/devices/:device_id", registryHandler.GetDevice)
+		api.PATCH("/devices/:device_id", registryHandler.UpdateDevice)
+		api.DELETE("/devices/:device_id", registryHandler.RetireDevice)
+
+		api.POST("/alert-rules", alertHandler.CreateRule)
+		api.GET("/alert-rules", alertHandler.ListRules)
+		api.GET("/alert-rules/:rule_id", alertHandler.GetRule)
+		api.PUT("/alert-rules/:rule_id", alertHandler.UpdateRule)
+		api.DELETE("/alert-rules/:rule_id", alertHandler.DeleteRule)
+
+		api.GET("/alerts", alertHandler.ListAlerts)
+		api.GET("/alerts/:alert_id", alertHandler.GetAlert)
+		api.POST("/alerts/:alert_id/acknowledge", alertHandler.AcknowledgeAlert)
+		api.POST("/alerts/:alert_id/resolve", alertHandler.ResolveAlert)
+		api.POST("/alerts/:alert_id/snooze", alertHandler.SnoozeAlert)
+		api.GET("/notifications/dead-letters", alertHandler.ListDeadLetters)
 	}
 
 	return router
 }
 
 func TestHealthEndpoint(t *testing.T) {
-	router := setupTestRouter()
+	router := setupTestRouter(t)
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/health", nil)
@@ -50,10 +155,27 @@ func TestHealthEndpoint(t *testing.T) {
 }
 
 func TestGetSensorData(t *testing.T) {
-	router := setupTestRouter()
+	router := setupTestRouter(t)
 
+	payload := map[string]interface{}{
+		"id":        "reading_001",
+		"device_id": "device_field_001",
+		"location": map[string]interface{}{
+			"field_id": "field_001",
+		},
+		"measurements": map[string]interface{}{
+			"soil_moisture": map[string]interface{}{"value": 45.5, "unit": "%"},
+		},
+	}
+	jsonData, _ := json.Marshal(payload)
 	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", "/api/v1/sensors/field_001", nil)
+	req, _ := http.NewRequest("POST", "/api/v1/sensors/data", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/sensors/field_001", nil)
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, 200, w.Code)
@@ -66,7 +188,7 @@ func TestGetSensorData(t *testing.T) {
 }
 
 func TestReceiveSensorData(t *testing.T) {
-	router := setupTestRouter()
+	router := setupTestRouter(t)
 
 	payload := map[string]interface{}{
 		"id":        "test_001",
@@ -93,10 +215,20 @@ func TestReceiveSensorData(t *testing.T) {
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
 	assert.Equal(t, "received", response["status"])
+
+	// Device IDs without a numeric serial share one metric label.
+	received := metrics.SensorDataReceived.WithLabelValues("unknown", "field_001")
+	before := testutil.ToFloat64(received)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/sensors/data", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(received))
 }
 
 func TestGetFieldsStats(t *testing.T) {
-	router := setupTestRouter()
+	router := setupTestRouter(t)
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/api/v1/fields/stats", nil)
@@ -109,4 +241,5 @@ func TestGetFieldsStats(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, response["total_fields"])
 	assert.NotNil(t, response["active_sensors"])
+	assert.NotNil(t, response["open_alerts"])
 }
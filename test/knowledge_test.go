@@ -0,0 +1,168 @@
+// test/knowledge_test.go
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agricultural-iot-rag/internal/services"
+	"agricultural-iot-rag/pkg/rag"
+)
+
+func TestParseFilter(t *testing.T) {
+	for expr, want := range map[string]string{
+		"crop = potato": `crop = "potato"`,
+		"crop != corn and season in (spring, 'summer')":     `NOT crop = "corn" AND season IN ("spring", "summer")`,
+		"(region = north OR region IS EMPTY) AND ph >= 6.5": `(region = "north" OR region IS EMPTY) AND ph >= 6.5`,
+		"organic = true AND published < 2024-01-01":         `organic = true AND published < 2024-01-01`,
+		`NOT category NOT IN (pests, "disease")`:            `NOT NOT category IN ("pests", "disease")`,
+		`crop = "123"`:                                      `crop = "123"`,
+	} {
+		f, err := rag.ParseFilter(expr)
+		require.NoError(t, err, expr)
+		assert.Equal(t, want, f.String(), expr)
+	}
+
+	f, err := rag.ParseFilter("   ")
+	require.NoError(t, err)
+	assert.Nil(t, f)
+
+	for _, expr := range []string{
+		"crop",
+		"crop = ",
+		"crop = potato AND",
+		"(crop = potato",
+		"crop < potato",
+		"crop IN (potato, 3)",
+		"AND = potato",
+		`crop = "potato`,
+		"crop ! potato",
+	} {
+		_, err := rag.ParseFilter(expr)
+		assert.ErrorIs(t, err, rag.ErrInvalidFilter, expr)
+	}
+}
+
+func TestSearchKnowledgeFilter(t *testing.T) {
+	env := newDecisionEnv(t, services.DecisionOptions{})
+	env.addKnowledge(t, "potato_spring", "Irrigate potato fields in spring when soil moisture is low.", map[string]interface{}{
+		"crop": "potato", "season": "spring", "organic": true, "published": time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC),
+	})
+	env.addKnowledge(t, "corn_spring", "Irrigate corn fields in spring when soil moisture is low.", map[string]interface{}{
+		"crop": "corn", "season": "spring", "organic": false, "rainfall_mm": 450,
+	})
+	env.addKnowledge(t, "general", "Irrigate fields early in the morning when soil moisture is low.", map[string]interface{}{
+		"crop": []string{"potato", "corn"}, "season": "summer", "rainfall_mm": 700,
+	})
+
+	search := func(expr string) []string {
+		t.Helper()
+		filter, err := rag.ParseFilter(expr)
+		require.NoError(t, err)
+		hits, err := env.knowledge.SearchKnowledge(context.Background(), services.KnowledgeQuery{Query: "irrigate soil moisture", Filter: filter})
+		require.NoError(t, err)
+		var ids []string
+		for _, h := range hits {
+			ids = append(ids, h.ID)
+		}
+		return ids
+	}
+
+	assert.Len(t, search(""), 3)
+	assert.ElementsMatch(t, []string{"potato_spring", "general"}, search("crop = potato"))
+	assert.ElementsMatch(t, []string{"corn_spring"}, search("crop = corn AND NOT season = summer"))
+	assert.ElementsMatch(t, []string{"potato_spring", "corn_spring"}, search("season IN (spring, winter)"))
+	assert.ElementsMatch(t, []string{"potato_spring"}, search("organic = true"))
+	assert.ElementsMatch(t, []string{"general"}, search("rainfall_mm > 500"))
+	assert.ElementsMatch(t, []string{"potato_spring"}, search("published >= 2023-01-01"))
+	assert.ElementsMatch(t, []string{"potato_spring", "general"}, search("rainfall_mm IS EMPTY OR rainfall_mm >= 700"))
+	assert.Empty(t, search("crop = tomato"))
+
+	hits, err := env.knowledge.SearchKnowledge(context.Background(), services.KnowledgeQuery{Query: "irrigate", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+}
+
+func TestKnowledgeDocuments(t *testing.T) {
+	env := newDecisionEnv(t, services.DecisionOptions{})
+
+	assert.Equal(t, rag.PointID("potato_irrigation"), rag.PointID("potato_irrigation"))
+	assert.NotEqual(t, rag.PointID("ab"), rag.PointID("ba"))
+
+	w := doJSON(env.router, "PUT", "/api/v1/knowledge/potato_irrigation", map[string]interface{}{
+		"content":  "Irrigate potato fields when soil moisture drops below 60 percent.",
+		"metadata": map[string]interface{}{"crop": "potato", "min_moisture": 60, "organic": true},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var doc services.KnowledgeDocument
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "potato_irrigation", doc.ID)
+	assert.Equal(t, "Irrigate potato fields when soil moisture drops below 60 percent", doc.Title)
+	assert.Equal(t, map[string]interface{}{"crop": "potato", "min_moisture": 60.0, "organic": true}, doc.Metadata)
+
+	// Replacing keeps a single point; integers stay integers for filters.
+	w = doJSON(env.router, "PUT", "/api/v1/knowledge/potato_irrigation", map[string]interface{}{
+		"content":  "Irrigate potato fields when soil moisture drops below 55 percent.",
+		"metadata": map[string]interface{}{"crop": "potato", "min_moisture": 55},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Len(t, env.qdrant.Points("knowledge_test"), 1)
+	filter, err := rag.ParseFilter("min_moisture = 55")
+	require.NoError(t, err)
+	hits, err := env.knowledge.SearchKnowledge(context.Background(), services.KnowledgeQuery{Query: "irrigate", Filter: filter})
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Contains(t, hits[0].Content, "55 percent")
+
+	w = doJSON(env.router, "GET", "/api/v1/knowledge/potato_irrigation", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "55 percent")
+
+	for i := 0; i < 4; i++ {
+		env.addKnowledge(t, fmt.Sprintf("corn_%d", i), fmt.Sprintf("Corn guidance %d.", i), map[string]interface{}{"crop": "corn"})
+	}
+
+	// Page through the corn documents two at a time.
+	var ids []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 3)
+		w = doJSON(env.router, "GET", "/api/v1/knowledge?limit=2&filter="+url.QueryEscape("crop = corn")+"&cursor="+cursor, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var page struct {
+			Documents  []services.KnowledgeDocument `json:"documents"`
+			NextCursor string                       `json:"next_cursor"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		for _, d := range page.Documents {
+			ids = append(ids, d.ID)
+		}
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+	assert.ElementsMatch(t, []string{"corn_0", "corn_1", "corn_2", "corn_3"}, ids)
+
+	w = doJSON(env.router, "GET", "/api/v1/knowledge?cursor=bogus", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doJSON(env.router, "GET", "/api/v1/knowledge?filter=crop", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doJSON(env.router, "PUT", "/api/v1/knowledge/empty", map[string]interface{}{"content": " "})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(env.router, "DELETE", "/api/v1/knowledge/potato_irrigation", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, env.qdrant.Points("knowledge_test"), 4)
+	w = doJSON(env.router, "GET", "/api/v1/knowledge/potato_irrigation", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doJSON(env.router, "DELETE", "/api/v1/knowledge/potato_irrigation", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
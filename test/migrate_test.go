@@ -0,0 +1,88 @@
+// test/migrate_test.go
+package test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agricultural-iot-rag/internal/storage"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := storage.LoadMigrations(fstest.MapFS{
+		"0002_add_notes.up.sql":   {Data: []byte("ALTER TABLE fields ADD COLUMN notes TEXT;")},
+		"0002_add_notes.down.sql": {Data: []byte("ALTER TABLE fields DROP COLUMN notes;")},
+		"0001_init.up.sql":        {Data: []byte("CREATE TABLE fields (id TEXT);")},
+		"README.md":               {Data: []byte("ignored")},
+	})
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, 1, migrations[0].Version)
+	assert.Equal(t, "init", migrations[0].Name)
+	assert.Empty(t, migrations[0].Down)
+	assert.Equal(t, "add_notes", migrations[1].Name)
+	assert.Len(t, migrations[1].Checksum, 64)
+
+	// Editing a migration changes its checksum.
+	edited, err := storage.LoadMigrations(fstest.MapFS{
+		"0001_init.up.sql": {Data: []byte("CREATE TABLE fields (id TEXT PRIMARY KEY);")},
+	})
+	require.NoError(t, err)
+	assert.NotEqual(t, migrations[0].Checksum, edited[0].Checksum)
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"bad name":     {"init.up.sql": {Data: []byte("SELECT 1;")}},
+		"no up file":   {"0001_init.down.sql": {Data: []byte("SELECT 1;")}},
+		"name clashes": {"0001_a.up.sql": {Data: []byte("SELECT 1;")}, "0001_b.up.sql": {Data: []byte("SELECT 1;")}},
+	} {
+		_, err := storage.LoadMigrations(fsys)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	postgres, err := storage.EmbeddedMigrations(storage.DriverPostgres)
+	require.NoError(t, err)
+	sqlite, err := storage.EmbeddedMigrations(storage.DriverSQLite)
+	require.NoError(t, err)
+	require.NotEmpty(t, postgres)
+	require.Len(t, sqlite, len(postgres), "every migration needs a version for each driver")
+
+	for i, m := range postgres {
+		assert.Equal(t, i+1, m.Version, "migrations must be numbered without gaps")
+		assert.Equal(t, m.Name, sqlite[i].Name)
+		assert.NotEmpty(t, m.Down, "migration %d_%s has no down file", m.Version, m.Name)
+		assert.NotEmpty(t, sqlite[i].Down, "migration %d_%s has no sqlite down file", m.Version, m.Name)
+	}
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store storage.Store) {
+		ctx := context.Background()
+		migrator, err := store.Migrator()
+		require.NoError(t, err)
+
+		applied, err := migrator.Up(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, applied, "the store is already migrated")
+
+		states, err := migrator.Status(ctx)
+		require.NoError(t, err)
+		last := states[len(states)-1]
+		require.NotNil(t, last.AppliedAt)
+
+		reverted, err := migrator.Down(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, reverted, 1)
+		assert.Equal(t, last.Version, reverted[0].Version)
+
+		applied, err = migrator.Up(ctx)
+		require.NoError(t, err)
+		require.Len(t, applied, 1)
+		assert.Equal(t, last.Version, applied[0].Version)
+	})
+}
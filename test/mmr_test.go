@@ -0,0 +1,56 @@
+// test/mmr_test.go
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agricultural-iot-rag/internal/services"
+	"agricultural-iot-rag/pkg/rag"
+)
+
+func TestMMRDiversifiesHits(t *testing.T) {
+	env := newDecisionEnv(t, services.DecisionOptions{})
+	vectorStore, err := rag.NewVectorStore(env.qdrant.Addr, "knowledge_test")
+	require.NoError(t, err)
+	t.Cleanup(func() { vectorStore.Close() })
+	diverse := func(opts services.KnowledgeOptions) *services.KnowledgeService {
+		opts.Diversity = services.DiversityOptions{Lambda: 0.5}
+		return services.NewKnowledgeService(vectorStore, rag.NewEmbeddingService(env.ollama.URL, "test-embed"), opts)
+	}
+
+	for i := 1; i <= 6; i++ {
+		env.addKnowledge(t, fmt.Sprintf("irrigation_%d", i), fmt.Sprintf("Irrigate potato fields when soil moisture "+
+			"drops below 60 percent; potato irrigation guide %d.", i), map[string]interface{}{"category": "irrigation"})
+	}
+	env.addKnowledge(t, "disease", "Scout potato fields for late blight disease after rain.", map[string]interface{}{"category": "disease"})
+	env.addKnowledge(t, "nutrition", "Potato nutrition: apply nitrogen fertilizer at planting.", map[string]interface{}{"category": "nutrition"})
+
+	query := "How do I manage irrigation, disease and nutrition in potato fields?"
+	categories := func(ks *services.KnowledgeService) []string {
+		t.Helper()
+		hits, err := ks.SearchKnowledge(context.Background(), services.KnowledgeQuery{Query: query})
+		require.NoError(t, err)
+		require.Len(t, hits, 5)
+		var out []string
+		for _, h := range hits {
+			out = append(out, h.Category)
+		}
+		return out
+	}
+
+	assert.Equal(t, []string{"irrigation", "irrigation", "irrigation", "irrigation", "irrigation"}, categories(env.knowledge))
+	picked := categories(diverse(services.KnowledgeOptions{}))
+	assert.Equal(t, "irrigation", picked[0])
+	assert.Contains(t, picked, "disease")
+	assert.Contains(t, picked, "nutrition")
+
+	// Keyword matches bring their vectors too.
+	picked = categories(diverse(services.KnowledgeOptions{Hybrid: services.HybridOptions{LexicalWeight: 1}}))
+	assert.Contains(t, picked, "disease")
+	assert.Contains(t, picked, "nutrition")
+}
@@ -0,0 +1,264 @@
+// test/notify_test.go
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agricultural-iot-rag/internal/models"
+	"agricultural-iot-rag/internal/notify"
+	"agricultural-iot-rag/internal/notify/smtptest"
+)
+
+// recordingChannel collects the notifications sent to it.
+type recordingChannel struct {
+	name string
+	mu   sync.Mutex
+	sent []notify.Notification
+}
+
+func (r *recordingChannel) Name() string { return r.name }
+
+func (r *recordingChannel) Send(_ context.Context, n notify.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+func (r *recordingChannel) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.sent)
+}
+
+// fakePublisher stands in for iot.MQTTCollector.
+type fakePublisher struct {
+	mu     sync.Mutex
+	topics []string
+}
+
+func (p *fakePublisher) Publish(topic string, _ interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.topics = append(p.topics, topic)
+	return nil
+}
+
+func (p *fakePublisher) published() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.topics...)
+}
+
+func newTestNotifier(t *testing.T, opts notify.Options) *notify.Notifier {
+	opts.BaseDelay = 10 * time.Millisecond
+	n, err := notify.New(opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { n.Close(context.Background()) })
+	return n
+}
+
+func testAlert(fieldID, severity string) models.Alert {
+	return models.Alert{ID: 7, FieldID: fieldID, AlertType: "dry_potatoes", Severity: severity,
+		Message: "soil_moisture is 22", CreatedAt: time.Now().UTC()}
+}
+
+func TestNotifyRouting(t *testing.T) {
+	routes, err := notify.ParseRoutes("field_001=webhook+email; *@high=mqtt")
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+	assert.Equal(t, notify.Route{FieldID: "*", MinSeverity: "high", Channels: []string{"mqtt"}}, routes[1])
+
+	for _, bad := range []string{"field_001", "*@urgent=mqtt", "=mqtt"} {
+		_, err := notify.ParseRoutes(bad)
+		assert.ErrorIs(t, err, notify.ErrInvalidConfig, bad)
+	}
+
+	webhook, email, mqtt := &recordingChannel{name: "webhook"}, &recordingChannel{name: "email"}, &recordingChannel{name: "mqtt"}
+	_, err = notify.New(notify.Options{Channels: []notify.Channel{mqtt}, Routes: routes})
+	assert.ErrorIs(t, err, notify.ErrInvalidConfig, "routes must name configured channels")
+
+	n := newTestNotifier(t, notify.Options{Channels: []notify.Channel{webhook, email, mqtt}, Routes: routes})
+	n.Notify(testAlert("field_001", models.SeverityLow), notify.EventFired)      // webhook + email
+	n.Notify(testAlert("field_002", models.SeverityCritical), notify.EventFired) // mqtt
+	n.Notify(testAlert("field_002", models.SeverityMedium), notify.EventFired)   // below the default route
+	require.NoError(t, n.Close(context.Background()))
+
+	assert.Equal(t, 1, webhook.count())
+	assert.Equal(t, 1, email.count())
+	assert.Equal(t, 1, mqtt.count())
+}
+
+func TestQuietHours(t *testing.T) {
+	q, err := notify.ParseQuietHours("22:00-06:00", time.UTC)
+	require.NoError(t, err)
+	day := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 8*time.Hour, q.Until(day.Add(22*time.Hour)))
+	assert.Equal(t, time.Hour, q.Until(day.Add(5*time.Hour)))
+	assert.Zero(t, q.Until(day.Add(6*time.Hour)))
+	assert.Zero(t, q.Until(day.Add(12*time.Hour)))
+
+	_, err = notify.ParseQuietHours("22:00", time.UTC)
+	assert.ErrorIs(t, err, notify.ErrInvalidConfig)
+
+	// Outside the window nothing is held; inside it only critical alerts
+	// go out straight away.
+	now := time.Now().UTC()
+	start := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	window := strings.Join([]string{clockString(start - time.Hour), clockString(start + 2*time.Hour)}, "-")
+	q, err = notify.ParseQuietHours(window, time.UTC)
+	require.NoError(t, err)
+
+	ch := &recordingChannel{name: "mqtt"}
+	n := newTestNotifier(t, notify.Options{Channels: []notify.Channel{ch}, QuietHours: q})
+	n.Notify(testAlert("field_001", models.SeverityHigh), notify.EventFired)
+	n.Notify(testAlert("field_001", models.SeverityCritical), notify.EventFired)
+	require.Eventually(t, func() bool { return ch.count() == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, models.SeverityCritical, ch.sent[0].Alert.Severity)
+}
+
+func clockString(d time.Duration) string {
+	d = (d + 24*time.Hour) % (24 * time.Hour)
+	return time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).Add(d).Format("15:04")
+}
+
+func TestWebhookChannel(t *testing.T) {
+	secret := "s3cret"
+	var calls atomic.Int32
+	var delivered atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get(notify.TimestampHeader)
+		if r.Header.Get(notify.SignatureHeader) != notify.Sign([]byte(secret), timestamp, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		delivered.Store(body)
+	}))
+	defer server.Close()
+
+	n := newTestNotifier(t, notify.Options{Channels: []notify.Channel{notify.NewWebhookChannel(server.URL, secret)}})
+	n.Notify(testAlert("field_001", models.SeverityHigh), notify.EventFired)
+	require.Eventually(t, func() bool { return delivered.Load() != nil }, 2*time.Second, 10*time.Millisecond)
+	assert.EqualValues(t, 2, calls.Load(), "first attempt fails and is retried")
+
+	var payload notify.Notification
+	require.NoError(t, json.Unmarshal(delivered.Load().([]byte), &payload))
+	assert.Equal(t, notify.EventFired, payload.Event)
+	assert.Equal(t, int64(7), payload.Alert.ID)
+}
+
+func TestSMTPChannel(t *testing.T) {
+	sink := smtptest.NewServer()
+	defer sink.Close()
+	sink.RejectNext(1)
+
+	email := notify.NewSMTPChannel(sink.Addr, "", "", "alerts@farm.test", []string{"ops@farm.test", " agronomist@farm.test"})
+	n := newTestNotifier(t, notify.Options{Channels: []notify.Channel{email}})
+	n.Notify(testAlert("field_001", models.SeverityHigh), notify.EventResolved)
+	require.Eventually(t, func() bool { return len(sink.Messages()) == 1 }, 2*time.Second, 10*time.Millisecond)
+
+	msg := sink.Messages()[0]
+	assert.Equal(t, "alerts@farm.test", msg.From)
+	assert.Equal(t, []string{"ops@farm.test", "agronomist@farm.test"}, msg.To)
+	assert.Equal(t, "[high] dry_potatoes on field_001 resolved", msg.Header("Subject"))
+	assert.Contains(t, msg.Data, "soil_moisture is 22")
+
+	// Line breaks in a rule name stay inside the encoded subject.
+	alert := testAlert("field_001", models.SeverityHigh)
+	alert.AlertType = "dry\r\nBcc: attacker@evil.test"
+	n.Notify(alert, notify.EventFired)
+	require.Eventually(t, func() bool { return len(sink.Messages()) == 2 }, 2*time.Second, 10*time.Millisecond)
+	msg = sink.Messages()[1]
+	assert.Empty(t, msg.Header("Bcc"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "[high] dry\r\nBcc: attacker@evil.test on field_001 fired", subject)
+}
+
+func TestMQTTChannel(t *testing.T) {
+	publisher := &fakePublisher{}
+	n := newTestNotifier(t, notify.Options{Channels: []notify.Channel{notify.NewMQTTChannel(publisher)}})
+	n.Notify(testAlert("field_042", models.SeverityMedium), notify.EventFired)
+	require.NoError(t, n.Close(context.Background()))
+	assert.Equal(t, []string{"alerts/field_042"}, publisher.published())
+}
+
+// failingChannel fails every send, permanently if told to.
+type failingChannel struct {
+	permanent bool
+	calls     atomic.Int32
+}
+
+func (f *failingChannel) Name() string { return "webhook" }
+
+func (f *failingChannel) Send(context.Context, notify.Notification) error {
+	f.calls.Add(1)
+	if f.permanent {
+		return notify.Permanent(errors.New("rejected"))
+	}
+	return errors.New("connection refused")
+}
+
+func TestNotifyDeadLetters(t *testing.T) {
+	store := openTestStore(t)
+	router := newTestRouter(t, store)
+	ctx := context.Background()
+	fieldID := fmt.Sprint("field_", time.Now().UnixNano())
+	require.NoError(t, store.CreateField(ctx, &models.Field{ID: fieldID, Name: "Dead letter plot"}))
+	alert := &models.Alert{FieldID: fieldID, AlertType: "frost", Severity: models.SeverityCritical, Message: "-3°C"}
+	require.NoError(t, store.CreateAlert(ctx, alert))
+
+	transient := &failingChannel{}
+	n := newTestNotifier(t, notify.Options{Channels: []notify.Channel{transient}, DeadLetters: store, MaxAttempts: 3})
+	n.Notify(*alert, notify.EventFired)
+	require.NoError(t, n.Close(context.Background()))
+
+	// Close aborts the pending retry, so the alert is dead-lettered early.
+	alertLetters := func() []models.DeadLetter {
+		letters, err := store.ListDeadLetters(ctx, 100)
+		require.NoError(t, err)
+		var mine []models.DeadLetter
+		for _, d := range letters {
+			if d.AlertID == alert.ID {
+				mine = append(mine, d)
+			}
+		}
+		return mine
+	}
+	letters := alertLetters()
+	require.Len(t, letters, 1)
+	assert.Equal(t, alert.ID, letters[0].AlertID)
+	assert.Equal(t, "webhook", letters[0].Channel)
+	assert.Contains(t, letters[0].Error, "connection refused")
+
+	permanent := &failingChannel{permanent: true}
+	n = newTestNotifier(t, notify.Options{Channels: []notify.Channel{permanent}, DeadLetters: store, MaxAttempts: 3})
+	n.Notify(*alert, notify.EventResolved)
+	require.Eventually(t, func() bool { return len(alertLetters()) == 2 }, 2*time.Second, 10*time.Millisecond)
+	assert.EqualValues(t, 1, permanent.calls.Load(), "permanent errors are not retried")
+
+	w := doJSON(router, "GET", "/api/v1/notifications/dead-letters", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"event":"resolved"`)
+}
@@ -0,0 +1,96 @@
+// test/registry_test.go
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func doJSON(router *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRegistryUnavailable(t *testing.T) {
+	router := newTestRouter(t, nil)
+
+	assert.Equal(t, http.StatusServiceUnavailable, doJSON(router, "GET", "/api/v1/fields", nil).Code)
+	assert.Equal(t, http.StatusServiceUnavailable, doJSON(router, "GET", "/api/v1/devices/sensor_001", nil).Code)
+	assert.Equal(t, http.StatusServiceUnavailable, doJSON(router, "GET", "/api/v1/fields/stats", nil).Code)
+	assert.Equal(t, http.StatusServiceUnavailable, doJSON(router, "GET", "/api/v1/alerts", nil).Code)
+}
+
+func TestRegistryLifecycle(t *testing.T) {
+	router := setupTestRouter(t)
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	fieldID := "field_" + suffix
+	deviceID := "sensor_" + suffix
+
+	w := doJSON(router, "POST", "/api/v1/fields", map[string]interface{}{
+		"id": fieldID, "name": "North plot", "crop_type": "Potato", "area_hectares": 2.5,
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusConflict, doJSON(router, "POST", "/api/v1/fields", map[string]interface{}{
+		"id": fieldID, "name": "Duplicate",
+	}).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/api/v1/fields", map[string]interface{}{
+		"id": "field_noname_" + suffix,
+	}).Code)
+
+	w = doJSON(router, "PATCH", "/api/v1/fields/"+fieldID, map[string]interface{}{"name": "North plot B"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var field map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &field))
+	assert.Equal(t, "North plot B", field["name"])
+	assert.Equal(t, "potato", field["crop_type"])
+
+	// Readings from an unknown device are quarantined, not stored.
+	reading := map[string]interface{}{
+		"id": "r_" + suffix, "device_id": deviceID,
+		"location":     map[string]interface{}{"field_id": "somewhere_else"},
+		"measurements": map[string]interface{}{"soil_moisture": map[string]interface{}{"value": 30, "unit": "%"}},
+	}
+	w = doJSON(router, "POST", "/api/v1/sensors/data", reading)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	w = doJSON(router, "GET", "/api/v1/devices/"+deviceID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"quarantined"`)
+
+	// Approving the device assigns it to the field; its readings follow.
+	w = doJSON(router, "PATCH", "/api/v1/devices/"+deviceID, map[string]interface{}{
+		"field_id": fieldID, "status": "active",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusOK, doJSON(router, "POST", "/api/v1/sensors/data", reading).Code)
+	assert.Equal(t, http.StatusOK, doJSON(router, "GET", "/api/v1/sensors/"+fieldID, nil).Code)
+
+	w = doJSON(router, "GET", "/api/v1/devices/"+deviceID, nil)
+	assert.Contains(t, w.Body.String(), `"last_seen"`)
+
+	// Retired devices are rejected; retired fields leave the listing.
+	assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", "/api/v1/devices/"+deviceID, nil).Code)
+	assert.Equal(t, http.StatusForbidden, doJSON(router, "POST", "/api/v1/sensors/data", reading).Code)
+
+	assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", "/api/v1/fields/"+fieldID, nil).Code)
+	w = doJSON(router, "GET", "/api/v1/fields?crop_type=potato", nil)
+	assert.NotContains(t, w.Body.String(), fieldID)
+	w = doJSON(router, "GET", "/api/v1/fields?crop_type=potato&include_retired=true", nil)
+	assert.Contains(t, w.Body.String(), fieldID)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "PATCH", "/api/v1/fields/"+fieldID, map[string]interface{}{"name": "x"}).Code)
+}
@@ -0,0 +1,163 @@
+// test/rerank_test.go
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agricultural-iot-rag/internal/config"
+	"agricultural-iot-rag/internal/services"
+	"agricultural-iot-rag/pkg/llm"
+	"agricultural-iot-rag/pkg/rag"
+)
+
+// rerankObservations returns how many rerank latencies were recorded.
+func rerankObservations(t *testing.T) uint64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() != "rag_query_duration_seconds" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "query_type" && l.GetValue() == "rerank" {
+					return m.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestRerank(t *testing.T) {
+	env := newDecisionEnv(t, services.DecisionOptions{})
+	vectorStore, err := rag.NewVectorStore(env.qdrant.Addr, "knowledge_test")
+	require.NoError(t, err)
+	t.Cleanup(func() { vectorStore.Close() })
+	reranking := func(kind string) *services.KnowledgeService {
+		t.Helper()
+		url := env.ollama.URL
+		if kind == services.RerankerModel {
+			url += "/v1/rerank"
+		}
+		reranker, err := services.NewReranker(kind, url, "test-rerank")
+		require.NoError(t, err)
+		return services.NewKnowledgeService(vectorStore, rag.NewEmbeddingService(env.ollama.URL, "test-embed"), services.KnowledgeOptions{
+			Rerank: services.RerankOptions{Reranker: reranker},
+		})
+	}
+	_, err = services.NewReranker("cross-encoder", "", "")
+	assert.Error(t, err)
+	_, err = services.NewReranker(services.RerankerModel, "", "test-rerank")
+	assert.Error(t, err)
+
+	env.addKnowledge(t, "late_blight", "Late blight is caused by Phytophthora infestans. Remove infected plants.", nil)
+	env.addKnowledge(t, "question_1", "How do I know what I should do?", nil)
+	env.addKnowledge(t, "question_2", "What do I do if I do not know how?", nil)
+	env.addKnowledge(t, "question_3", "How can I do what I must do?", nil)
+	for i := 1; i <= 8; i++ {
+		env.addKnowledge(t, fmt.Sprintf("note_%d", i), fmt.Sprintf("Field note %d: corn emerged evenly.", i), nil)
+	}
+
+	query := "How do I treat Phytophthora infestans?"
+	search := func(ks *services.KnowledgeService) []services.KnowledgeHit {
+		t.Helper()
+		hits, err := ks.SearchKnowledge(context.Background(), services.KnowledgeQuery{Query: query, Limit: 3})
+		require.NoError(t, err)
+		return hits
+	}
+	ids := func(hits []services.KnowledgeHit) []string {
+		var out []string
+		for _, h := range hits {
+			out = append(out, h.ID)
+		}
+		return out
+	}
+	plain := search(env.knowledge)
+	require.Len(t, plain, 3)
+	assert.NotContains(t, ids(plain), "late_blight")
+
+	observed := rerankObservations(t)
+	hits := search(reranking(services.RerankerLexical))
+	require.Len(t, hits, 3)
+	assert.Equal(t, "late_blight", hits[0].ID)
+	for i, h := range hits {
+		require.NotNil(t, h.RerankScore, h.ID)
+		if i > 0 {
+			assert.GreaterOrEqual(t, *hits[i-1].RerankScore, *h.RerankScore)
+		}
+	}
+	assert.Equal(t, observed+1, rerankObservations(t))
+
+	// A reranker that fails leaves the retrieval order.
+	model := reranking(services.RerankerModel)
+	assert.Equal(t, ids(plain), ids(search(model)))
+	assert.Nil(t, search(model)[0].RerankScore)
+
+	var reranked []string
+	env.ollama.SetRerank(func(q, doc string) float64 {
+		assert.Equal(t, query, q)
+		reranked = append(reranked, doc)
+		if strings.Contains(doc, "must") {
+			return 0.9
+		}
+		return 0.1
+	})
+	hits = search(model)
+	assert.Equal(t, "question_3", hits[0].ID)
+	assert.InDelta(t, 0.9, *hits[0].RerankScore, 1e-9)
+	assert.Len(t, reranked, 12)
+
+	// The LLM rates a few passages per prompt.
+	passage := regexp.MustCompile(`(?m)^\[\d+\] (.*)$`)
+	env.ollama.SetReply(func(req llm.ChatRequest) string {
+		var scores []float64
+		for _, m := range passage.FindAllStringSubmatch(req.Messages[0].Content, -1) {
+			if strings.Contains(m[1], "Phytophthora") {
+				scores = append(scores, 10)
+			} else {
+				scores = append(scores, 2)
+			}
+		}
+		out, _ := json.Marshal(map[string][]float64{"scores": scores})
+		return string(out)
+	})
+	chats := len(env.ollama.Chats())
+	hits = search(reranking(services.RerankerLLM))
+	assert.Equal(t, "late_blight", hits[0].ID)
+	assert.Equal(t, 10.0, *hits[0].RerankScore)
+	assert.Equal(t, chats+2, len(env.ollama.Chats()))
+}
+
+func TestRerankEndpointConfig(t *testing.T) {
+	t.Setenv("RERANKER", services.RerankerModel)
+	t.Setenv("RERANK_MODEL", "bge-reranker-v2-m3")
+	_, _, err := config.Load().RerankEndpoint()
+	assert.Error(t, err, "the model reranker has no default endpoint")
+
+	t.Setenv("RERANK_URL", "http://localhost:8081/v1/rerank")
+	url, model, err := config.Load().RerankEndpoint()
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8081/v1/rerank", url)
+	assert.Equal(t, "bge-reranker-v2-m3", model)
+
+	t.Setenv("RERANKER", services.RerankerLLM)
+	t.Setenv("RERANK_URL", "")
+	t.Setenv("RERANK_MODEL", "")
+	t.Setenv("OLLAMA_URL", "http://ollama:11434")
+	t.Setenv("LLM_MODEL", "llama3.2")
+	url, model, err = config.Load().RerankEndpoint()
+	require.NoError(t, err)
+	assert.Equal(t, "http://ollama:11434", url)
+	assert.Equal(t, "llama3.2", model)
+}
@@ -0,0 +1,222 @@
+// test/store_test.go
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agricultural-iot-rag/internal/models"
+	"agricultural-iot-rag/internal/storage"
+)
+
+func TestStoreRegistry(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store storage.Store) {
+		ctx := context.Background()
+		suffix := fmt.Sprint(time.Now().UnixNano())
+		fieldID, deviceID := "field_"+suffix, "device_"+suffix
+
+		area := 4.25
+		field := &models.Field{
+			ID: fieldID, Name: "East plot", CropType: "corn", AreaHectares: &area,
+			Location: json.RawMessage(`{"latitude": 40.7}`),
+		}
+		require.NoError(t, store.CreateField(ctx, field))
+		assert.ErrorIs(t, store.CreateField(ctx, field), storage.ErrConflict)
+
+		got, err := store.GetField(ctx, fieldID)
+		require.NoError(t, err)
+		assert.Equal(t, "corn", got.CropType)
+		require.NotNil(t, got.AreaHectares)
+		assert.Equal(t, 4.25, *got.AreaHectares)
+		assert.JSONEq(t, `{"latitude": 40.7}`, string(got.Location))
+
+		name := "East plot 2"
+		got, err = store.UpdateField(ctx, fieldID, models.FieldUpdate{Name: &name})
+		require.NoError(t, err)
+		assert.Equal(t, name, got.Name)
+		assert.Equal(t, "corn", got.CropType)
+
+		require.NoError(t, store.CreateDevice(ctx, &models.Device{ID: deviceID, FieldID: fieldID, DeviceType: "soil_sensor"}))
+		seen := time.Now().UTC().Truncate(time.Millisecond)
+		require.NoError(t, store.TouchDevice(ctx, deviceID, seen))
+		require.NoError(t, store.TouchDevice(ctx, deviceID, seen.Add(-time.Hour)), "older timestamps are ignored")
+		device, err := store.GetDevice(ctx, deviceID)
+		require.NoError(t, err)
+		assert.Equal(t, models.DeviceStatusActive, device.Status)
+		require.NotNil(t, device.LastSeen)
+		assert.True(t, device.LastSeen.Equal(seen), "last_seen %s, want %s", device.LastSeen, seen)
+
+		unassigned := ""
+		device, err = store.UpdateDevice(ctx, deviceID, models.DeviceUpdate{FieldID: &unassigned})
+		require.NoError(t, err)
+		assert.Empty(t, device.FieldID)
+
+		devices, err := store.ListDevices(ctx, storage.DeviceFilter{Status: models.DeviceStatusActive})
+		require.NoError(t, err)
+		assert.Contains(t, deviceIDs(devices), deviceID)
+
+		crops, err := store.FieldCrops(ctx, "corn")
+		require.NoError(t, err)
+		assert.Equal(t, "corn", crops[fieldID])
+
+		require.NoError(t, store.RetireField(ctx, fieldID))
+		assert.ErrorIs(t, store.RetireField(ctx, fieldID), storage.ErrNotFound)
+		crops, err = store.FieldCrops(ctx, "corn")
+		require.NoError(t, err)
+		assert.NotContains(t, crops, fieldID)
+
+		_, err = store.GetDevice(ctx, "missing_"+suffix)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+}
+
+func deviceIDs(devices []models.Device) []string {
+	ids := make([]string, len(devices))
+	for i, d := range devices {
+		ids[i] = d.ID
+	}
+	return ids
+}
+
+func TestStoreAlerts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store storage.Store) {
+		ctx := context.Background()
+		fieldID := fmt.Sprint("field_", time.Now().UnixNano())
+		require.NoError(t, store.CreateField(ctx, &models.Field{ID: fieldID, Name: "Alert plot", CropType: "onion"}))
+
+		low := &models.Alert{FieldID: fieldID, AlertType: "low_moisture", Severity: models.SeverityHigh, Message: "Soil moisture 25%"}
+		require.NoError(t, store.CreateAlert(ctx, low))
+		require.NotZero(t, low.ID)
+		hot := &models.Alert{FieldID: fieldID, AlertType: "heat", Severity: models.SeverityMedium, Message: "34°C"}
+		require.NoError(t, store.CreateAlert(ctx, hot))
+
+		until := time.Now().UTC().Add(time.Hour)
+		snooze := &models.AlertEvent{AlertID: hot.ID, Actor: "agronomist", SnoozedUntil: &until}
+		require.NoError(t, store.SnoozeAlert(ctx, snooze))
+		require.NotZero(t, snooze.ID)
+
+		counts, err := store.UnresolvedAlerts(ctx, "onion", time.Now())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []storage.AlertCount{
+			{Severity: models.SeverityHigh, State: models.AlertStateOpen, Count: 1},
+			{Severity: models.SeverityMedium, State: models.AlertStateSnoozed, Count: 1},
+		}, counts)
+
+		require.NoError(t, store.AcknowledgeAlert(ctx, &models.AlertEvent{AlertID: low.ID, Actor: "agronomist"}))
+		require.NoError(t, store.ResolveAlert(ctx, &models.AlertEvent{AlertID: low.ID, Actor: "agronomist", Note: "irrigated"}))
+		assert.ErrorIs(t, store.ResolveAlert(ctx, &models.AlertEvent{AlertID: low.ID, Actor: "agronomist"}), storage.ErrNotFound)
+
+		events, err := store.AlertEvents(ctx, low.ID)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, models.AlertActionAcknowledge, events[0].Action)
+		assert.Equal(t, models.AlertActionResolve, events[1].Action)
+		assert.Equal(t, "irrigated", events[1].Note)
+
+		open := false
+		alerts, err := store.ListAlerts(ctx, storage.AlertFilter{FieldID: fieldID, Resolved: &open})
+		require.NoError(t, err)
+		require.Len(t, alerts, 1)
+		assert.Equal(t, hot.ID, alerts[0].ID)
+		assert.Equal(t, models.AlertStateSnoozed, alerts[0].State)
+
+		alerts, err = store.ListAlerts(ctx, storage.AlertFilter{FieldID: fieldID, From: time.Now().Add(time.Minute)})
+		require.NoError(t, err)
+		assert.Empty(t, alerts)
+
+		got, err := store.GetAlert(ctx, low.ID)
+		require.NoError(t, err)
+		assert.True(t, got.Resolved)
+		assert.NotNil(t, got.ResolvedAt)
+		assert.Equal(t, "agronomist", got.AcknowledgedBy)
+		assert.Equal(t, models.AlertStateResolved, got.State)
+	})
+}
+
+func TestStoreReadings(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store storage.Store) {
+		ctx := context.Background()
+		fieldID := fmt.Sprint("field_", time.Now().UnixNano())
+		base := time.Now().UTC().Truncate(time.Hour).Add(-4 * time.Hour)
+
+		for _, r := range []struct {
+			device string
+			offset time.Duration
+			value  float64
+		}{
+			{"sensor_001", 10 * time.Minute, 40},
+			{"sensor_001", 40 * time.Minute, 50},
+			{"sensor_001", 70 * time.Minute, 30},
+			{"sensor_001", 200 * time.Minute, 20},
+			{"sensor_002", 215 * time.Minute, 60},
+		} {
+			require.NoError(t, store.WriteReading(ctx, sampleReading(r.device, fieldID, base.Add(r.offset), r.value)))
+		}
+
+		reading, err := store.LatestReading(ctx, fieldID)
+		require.NoError(t, err)
+		assert.Equal(t, "sensor_002", reading.DeviceID)
+		assert.True(t, reading.Timestamp.Equal(base.Add(215*time.Minute)))
+		assert.Equal(t, 60.0, reading.Measurements["soil_moisture"].Value)
+		assert.Equal(t, "%", reading.Measurements["soil_moisture"].Unit)
+		assert.Equal(t, "potato", reading.Location.CropType)
+		assert.Equal(t, 85, reading.DeviceStatus.BatteryLevel)
+
+		_, err = store.LatestReading(ctx, "field_404")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+
+		page, err := store.History(ctx, storage.HistoryQuery{
+			FieldID: fieldID, Measurement: "soil_moisture",
+			From: base, To: base.Add(4 * time.Hour), Window: time.Hour, Agg: storage.AggMean,
+		})
+		require.NoError(t, err)
+		require.Len(t, page.Series, 2)
+		s1 := page.Series[0]
+		require.Len(t, s1.Points, 4)
+		assert.Equal(t, 45.0, *s1.Points[0].Value)
+		assert.Equal(t, 30.0, *s1.Points[1].Value)
+		assert.True(t, s1.Points[2].Gap)
+		assert.Equal(t, 20.0, *s1.Points[3].Value)
+
+		activity, err := store.RecentActivity(ctx, 2*time.Hour)
+		require.NoError(t, err)
+		var devices []string
+		for _, a := range activity {
+			if a.FieldID == fieldID {
+				devices = append(devices, a.DeviceID)
+			}
+		}
+		assert.ElementsMatch(t, []string{"sensor_001", "sensor_002"}, devices)
+
+		means, err := store.FieldMeans(ctx, "soil_moisture", 2*time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, 40.0, means[fieldID])
+
+		weather := models.SensorReading{
+			DeviceID: "weather_001", Timestamp: base.Add(220 * time.Minute),
+			Location:     models.Location{FieldID: fieldID},
+			Measurements: map[string]models.Measurement{"air_temperature": {Value: 24.5, Unit: "°C"}},
+		}
+		require.NoError(t, store.WriteReading(ctx, weather))
+		latest, err := store.LatestMeasurements(ctx, fieldID)
+		require.NoError(t, err)
+		require.Len(t, latest, 3)
+		assert.Equal(t, "air_temperature", latest[0].Name)
+		assert.Equal(t, "weather_001", latest[0].DeviceID)
+		assert.Equal(t, 24.5, latest[0].Value)
+		assert.Equal(t, "soil_moisture", latest[1].Name)
+		assert.Equal(t, "sensor_002", latest[1].DeviceID)
+		assert.Equal(t, 60.0, latest[1].Value)
+		assert.Equal(t, "potato", latest[1].CropType)
+		assert.True(t, latest[1].Timestamp.Equal(base.Add(215*time.Minute)))
+		latest, err = store.LatestMeasurements(ctx, "field_404")
+		require.NoError(t, err)
+		assert.Empty(t, latest)
+	})
+}
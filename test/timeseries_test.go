@@ -0,0 +1,201 @@
+// test/timeseries_test.go
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agricultural-iot-rag/internal/models"
+	"agricultural-iot-rag/internal/storage"
+	"agricultural-iot-rag/internal/storage/influxtest"
+)
+
+func sampleReading(deviceID, fieldID string, ts time.Time, moisture float64) models.SensorReading {
+	return models.SensorReading{
+		ID:        "reading_" + deviceID,
+		DeviceID:  deviceID,
+		Timestamp: ts,
+		Location: models.Location{
+			Latitude:  40.7128,
+			Longitude: -74.006,
+			FieldID:   fieldID,
+			CropType:  "potato",
+		},
+		Measurements: map[string]models.Measurement{
+			"soil_moisture":    {Value: moisture, Unit: "%", Quality: "good"},
+			"soil_temperature": {Value: 22.3, Unit: "°C"},
+		},
+		DeviceStatus: models.DeviceStatus{BatteryLevel: 85, SignalStrength: -65},
+	}
+}
+
+func TestEncodeLineProtocol(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	reading := sampleReading("soil sensor,1", "field_001", ts, 45.5)
+
+	lines := strings.Split(strings.TrimSpace(string(storage.EncodeLineProtocol(reading))), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t,
+		`soil_moisture,crop_type=potato,device_id=soil\ sensor\,1,field_id=field_001,quality=good,unit=% `+
+			`value=45.5,reading_id="reading_soil sensor,1",latitude=40.7128,longitude=-74.006,battery_level=85i,signal_strength=-65i `+
+			`1700000000000000000`,
+		lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "soil_temperature,"))
+}
+
+func TestInfluxLatestReading(t *testing.T) {
+	influx := influxtest.NewServer()
+	defer influx.Close()
+	db := storage.NewInfluxDB(influx.URL, "token", "agurotech", "sensors")
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, db.WriteReading(ctx, sampleReading("sensor_001", "field_001", now.Add(-time.Hour), 40)))
+	require.NoError(t, db.WriteReading(ctx, sampleReading("sensor_002", "field_001", now.Add(-time.Minute), 35)))
+	require.NoError(t, db.WriteReading(ctx, sampleReading("sensor_003", "field_002", now, 70)))
+	assert.Len(t, influx.Points(), 6)
+
+	reading, err := db.LatestReading(ctx, "field_001")
+	require.NoError(t, err)
+	assert.Equal(t, "sensor_002", reading.DeviceID)
+	assert.Equal(t, "reading_sensor_002", reading.ID)
+	assert.True(t, reading.Timestamp.Equal(now.Add(-time.Minute)))
+	assert.Equal(t, 35.0, reading.Measurements["soil_moisture"].Value)
+	assert.Equal(t, "good", reading.Measurements["soil_moisture"].Quality)
+	assert.Equal(t, "potato", reading.Location.CropType)
+	assert.Equal(t, 85, reading.DeviceStatus.BatteryLevel)
+
+	_, err = db.LatestReading(ctx, "field_404")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestGetSensorDataNotFound(t *testing.T) {
+	router := setupTestRouter(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/sensors/field_404", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestInfluxHistory(t *testing.T) {
+	influx := influxtest.NewServer()
+	defer influx.Close()
+	db := storage.NewInfluxDB(influx.URL, "token", "agurotech", "sensors")
+	ctx := context.Background()
+
+	base := time.Date(2025, 10, 6, 0, 0, 0, 0, time.UTC)
+	// sensor_001 reports in hours 0, 1 and 3; hour 2 is a gap.
+	for _, r := range []struct {
+		device string
+		offset time.Duration
+		value  float64
+	}{
+		{"sensor_001", 10 * time.Minute, 40},
+		{"sensor_001", 40 * time.Minute, 50},
+		{"sensor_001", 70 * time.Minute, 30},
+		{"sensor_001", 200 * time.Minute, 20},
+		{"sensor_002", 15 * time.Minute, 60},
+	} {
+		require.NoError(t, db.WriteReading(ctx, sampleReading(r.device, "field_001", base.Add(r.offset), r.value)))
+	}
+
+	page, err := db.History(ctx, storage.HistoryQuery{
+		FieldID:     "field_001",
+		Measurement: "soil_moisture",
+		From:        base,
+		To:          base.Add(4 * time.Hour),
+		Window:      time.Hour,
+		Agg:         storage.AggMean,
+	})
+	require.NoError(t, err)
+	require.Nil(t, page.NextFrom)
+	require.Len(t, page.Series, 2)
+
+	s1 := page.Series[0]
+	assert.Equal(t, "sensor_001", s1.DeviceID)
+	assert.Equal(t, "%", s1.Unit)
+	require.Len(t, s1.Points, 4)
+	assert.Equal(t, 45.0, *s1.Points[0].Value)
+	assert.Equal(t, 30.0, *s1.Points[1].Value)
+	assert.True(t, s1.Points[2].Gap)
+	assert.Nil(t, s1.Points[2].Value)
+	assert.Equal(t, 20.0, *s1.Points[3].Value)
+
+	// Paging: two windows per page.
+	page, err = db.History(ctx, storage.HistoryQuery{
+		FieldID:     "field_001",
+		Measurement: "soil_moisture",
+		From:        base,
+		To:          base.Add(4 * time.Hour),
+		Window:      time.Hour,
+		Agg:         storage.AggMax,
+		Limit:       2,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, page.NextFrom)
+	assert.True(t, page.NextFrom.Equal(base.Add(2*time.Hour)))
+	assert.Len(t, page.Series[0].Points, 2)
+	assert.Equal(t, 50.0, *page.Series[0].Points[0].Value)
+
+	_, err = db.History(ctx, storage.HistoryQuery{
+		FieldID: "field_001", Measurement: "soil_moisture",
+		From: base, To: base.Add(time.Hour), Window: time.Hour, Agg: "median",
+	})
+	assert.ErrorIs(t, err, storage.ErrInvalidQuery)
+}
+
+func TestGetSensorHistoryValidation(t *testing.T) {
+	router := setupTestRouter(t)
+
+	for _, query := range []string{
+		"",
+		"?measurement=soil_moisture&agg=median",
+		"?measurement=soil_moisture&window=soon",
+		"?measurement=soil_moisture&from=yesterday",
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/sensors/field_001/history"+query, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/sensors/field_001/history?measurement=soil_moisture&window=1d&agg=last", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestInfluxActivityAndMeans(t *testing.T) {
+	influx := influxtest.NewServer()
+	defer influx.Close()
+	db := storage.NewInfluxDB(influx.URL, "token", "agurotech", "sensors")
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	require.NoError(t, db.WriteReading(ctx, sampleReading("sensor_001", "field_001", now.Add(-2*time.Hour), 10)))
+	require.NoError(t, db.WriteReading(ctx, sampleReading("sensor_001", "field_001", now.Add(-5*time.Minute), 40)))
+	require.NoError(t, db.WriteReading(ctx, sampleReading("sensor_002", "field_001", now.Add(-3*time.Minute), 50)))
+	require.NoError(t, db.WriteReading(ctx, sampleReading("sensor_003", "field_002", now.Add(-3*time.Hour), 70)))
+
+	activity, err := db.RecentActivity(ctx, 15*time.Minute)
+	require.NoError(t, err)
+	require.Len(t, activity, 2)
+	seen := map[string]string{}
+	for _, a := range activity {
+		seen[a.DeviceID] = a.FieldID
+	}
+	assert.Equal(t, map[string]string{"sensor_001": "field_001", "sensor_002": "field_001"}, seen)
+
+	means, err := db.FieldMeans(ctx, "soil_moisture", 15*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"field_001": 45}, means)
+}